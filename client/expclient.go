@@ -17,18 +17,14 @@ import (
 
 	"github.com/golang/glog"
 	conf "github.com/relab/smartMerge/confProvider"
-	cc "github.com/relab/smartMerge/consclient"
-	"github.com/relab/smartMerge/doreconf"
-	dyna "github.com/relab/smartMerge/dynaclient"
 	"github.com/relab/smartMerge/elog"
 	e "github.com/relab/smartMerge/elog/event"
 	pb "github.com/relab/smartMerge/proto"
-	qf "github.com/relab/smartMerge/qfuncs"
 	smc "github.com/relab/smartMerge/smclient"
-	ssr "github.com/relab/smartMerge/ssrclient"
+	"github.com/relab/smartMerge/store"
 	"github.com/relab/smartMerge/util"
 	"github.com/relab/smartMerge/util/bgen"
-	grpc "google.golang.org/grpc"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -52,6 +48,7 @@ var (
 	nclients  = flag.Int("nclients", 1, "the number of clients")
 	initsize  = flag.Int("initsize", 1, "the number of servers in the initial configuration")
 	useleader = flag.Bool("useleader", false, "let a leader handle reconfigurations.")
+	bluepDir  = flag.String("bluepdir", "", "directory to save the known configurations in, to continue from them after a restart.")
 
 	//Read or Write Bench
 	contW  = flag.Bool("contW", false, "continuously write")
@@ -60,6 +57,17 @@ var (
 	writes = flag.Int("writes", 0, "number of writes to be performed.")
 	size   = flag.Int("size", 16, "number of bytes for value.")
 	regul  = flag.Bool("regular", false, "do only regular reads")
+	digest = flag.Bool("digest", false, "let servers reply to reads with a digest of the value (sm and cons).")
+	lease  = flag.Duration("lease", 0, "hold read leases of this length, and read locally while they last (sm and cons).")
+	opTime = flag.Duration("optimeout", 0, "abort a read, write or reconfiguration after this long (0 for no limit).")
+	batch  = flag.Bool("batch", false, "coalesce concurrent writes into one quorum round.")
+	batchW = flag.Duration("batchwindow", 0, "with -batch, wait this long for more writes before a round.")
+	wrtrs  = flag.Int("writers", 1, "number of concurrent writers per client with -contW.")
+
+	//Retries
+	attempts  = flag.Int("attempts", 2, "number of times a quorum call is tried.")
+	backoff   = flag.Duration("backoff", 0, "wait before retrying a quorum call, doubled for every retry.")
+	fullAfter = flag.Int("fullafter", 1, "number of failed attempts before using the full configuration (0 never).")
 
 	//Reconf Exp
 	rm   = flag.Bool("rm", false, "remove nclients servers concurrently.")
@@ -84,6 +92,10 @@ func main() {
 		debug.SetGCPercent(-1)
 	}
 
+	smc.DigestReads = *digest
+	smc.LeaseReads = *lease
+	smc.BluepDir = *bluepDir
+
 	if *allCores {
 		cpus := runtime.NumCPU()
 		runtime.GOMAXPROCS(cpus)
@@ -138,15 +150,7 @@ func benchmain() {
 		return
 	}
 
-	initBlp := new(pb.Blueprint)
-	initBlp.Nodes = make([]*pb.Node, 0, len(ids))
-	for i, id := range ids {
-		if i >= *initsize {
-			break
-		}
-		initBlp.Nodes = append(initBlp.Nodes, &pb.Node{Id: id})
-	}
-	initBlp.FaultTolerance = uint32(15)
+	initBlp := initBlueprint(ids)
 
 	checkFlags(*alg, *cprov, *opt)
 
@@ -158,7 +162,7 @@ func benchmain() {
 
 	for i := 0; i < *nclients; i++ {
 		glog.Infof("starting configProvider and manager %d at time %v\n", i, time.Now())
-		cp, mgr, err := NewConfP(addrs, *cprov, (*clientid)+i)
+		cp, mgr, err := store.NewConfP(addrs, *cprov, (*clientid)+i)
 		if err != nil {
 			glog.Errorln("Error creating confProvider: ", err)
 			continue
@@ -166,16 +170,23 @@ func benchmain() {
 
 		defer PrintErrors(mgr)
 		glog.Infoln("starting client with id", (*clientid)+i)
-		cl, err := NewClient(initBlp, *alg, *opt, (*clientid)+i, cp)
+		cl, err := store.NewClient(initBlp, *alg, *opt, (*clientid)+i, cp, retryPolicy())
 		if err != nil {
 			glog.Errorln("Error creating client: ", err)
 			continue
 		}
+		if *batch {
+			cl = &batchClient{cl, smc.NewBatcher(cl, *batchW)}
+		}
 
 		wg.Add(1)
 		switch {
 		case *contW:
 			go contWrite(cl, cp, *size, stop, &wg)
+			for w := 1; w < *wrtrs; w++ {
+				wg.Add(1)
+				go contWrite(cl, cp, *size, stop, &wg)
+			}
 		case *contR:
 			go contRead(cl, cp, stop, *regul, *logT, &wg)
 		case *reads > 0:
@@ -207,82 +218,22 @@ func benchmain() {
 	return
 }
 
-func NewConfP(addrs []string, cprov string, id int) (cp conf.Provider, mgr *pb.Manager, err error) {
-	mgr, err = pb.NewManager(addrs, pb.WithGrpcDialOptions(
-		grpc.WithBlock(),
-		grpc.WithTimeout(3000*time.Millisecond),
-		grpc.WithInsecure()),
-		pb.WithAReadSQuorumFunc(qf.AReadSQF),
-		pb.WithAWriteSQuorumFunc(qf.AWriteSQF),
-		pb.WithAWriteNQuorumFunc(qf.AWriteNQF),
-		pb.WithSetCurQuorumFunc(qf.SetCurQF),
-		pb.WithLAPropQuorumFunc(qf.LAPropQF),
-		pb.WithSetStateQuorumFunc(qf.SetStateQF),
-		pb.WithGetPromiseQuorumFunc(qf.GetPromiseQF),
-		pb.WithAcceptQuorumFunc(qf.AcceptQF),
-		pb.WithDWriteNQuorumFunc(qf.DWriteNQF),
-		pb.WithDSetStateQuorumFunc(qf.DSetStateQF),
-		pb.WithDWriteNSetQuorumFunc(qf.DWriteNSetQF),
-		pb.WithDSetCurQuorumFunc(qf.DSetCurQF),
-		pb.WithGetOneNQuorumFunc(qf.GetOneNQF),
-		pb.WithSpSnOneQuorumFunc(qf.SpSnOneQF),
-		pb.WithSCommitQuorumFunc(qf.SCommitQF),
-		pb.WithSSetStateQuorumFunc(qf.SSetStateQF),
-	)
-	if err != nil {
-		glog.Errorln("Creating manager returned error: ", err)
-		return
-	}
-
-	cp = conf.NewProvider(mgr, id)
-	switch cprov {
-	case "norecontact":
-		break
-	case "thrifty":
-		cp = &conf.ThriftyConfP{cp}
-	case "normal", "":
-		cp = &conf.NormalConfP{cp}
-	default:
-		glog.Fatalf("confprovider %v is not supported.\n", cprov)
-	}
-	return
-}
-
-func NewClient(initB *pb.Blueprint, alg string, opt string, id int, cp conf.Provider) (cl RWRer, err error) {
-	switch alg {
-	case "", "sm":
-		switch opt {
-		case "", "no":
-			cl, err = smc.New(initB, uint32(id), cp)
-		case "doreconf":
-			cl, err = doreconf.NewSM(initB, uint32(id), cp)
-		default:
-			glog.Fatalf("optimization %v not supported.\n", opt)
-		}
-	case "dyna":
-		cl, err = dyna.New(initB, uint32(id), cp)
-	case "ssr":
-		cl, err = ssr.New(initB, uint32(id), cp)
-	case "cons":
-		switch opt {
-		case "", "no":
-			cl, err = cc.New(initB, uint32(id), cp)
-		case "doreconf":
-			cl, err = doreconf.NewCons(initB, uint32(id), cp)
-		default:
-			glog.Fatalln("optimization recontact not yet supported.")
-		}
-	default:
-		glog.Fatalln("this algorithm is not supported.")
+// retryPolicy returns the retry policy set by the flags.
+func retryPolicy() *smc.RetryPolicy {
+	return &smc.RetryPolicy{
+		Attempts:  *attempts,
+		Backoff:   *backoff,
+		Jitter:    0.2,
+		FullAfter: *fullAfter,
 	}
-	return
 }
 
-func contWrite(cl RWRer, cp conf.Provider, size int, stop chan struct{}, wg *sync.WaitGroup) {
+func contWrite(cl store.Client, cp conf.Provider, size int, stop chan struct{}, wg *sync.WaitGroup) {
 	glog.Infoln("starting continous write")
 	var (
 		value   = make([]byte, size)
 		cnt     int
+		err     error
 		reqsent time.Time
 	)
 
@@ -291,7 +242,12 @@ func contWrite(cl RWRer, cp conf.Provider, size int, stop chan struct{}, wg *syn
 loop:
 	for {
 		reqsent = time.Now()
-		cnt = cl.Write(cp, value)
+		ctx, cancel := opContext()
+		cnt, err = cl.Write(ctx, cp, value)
+		cancel()
+		if err != nil {
+			glog.Errorln("Write returned error:", err)
+		}
 		elog.Log(e.NewTimedEventWithMetric(e.ClientWriteLatency, reqsent, uint64(cnt)))
 		if cnt > 100 {
 			break
@@ -307,7 +263,7 @@ loop:
 	wg.Done()
 }
 
-func contRead(cl RWRer, cp conf.Provider, stop chan struct{}, reg bool, logT bool, wg *sync.WaitGroup) {
+func contRead(cl store.Client, cp conf.Provider, stop chan struct{}, reg bool, logT bool, wg *sync.WaitGroup) {
 	glog.Infoln("starting continous read")
 	var (
 		c        int
@@ -329,10 +285,16 @@ loop:
 	for {
 		reqsent = time.Now()
 		go func() {
+			var err error
+			ctx, cancel := opContext()
 			if reg {
-				_, c = cl.RRead(cp)
+				_, c, err = cl.RRead(ctx, cp)
 			} else {
-				_, c = cl.Read(cp)
+				_, c, err = cl.Read(ctx, cp)
+			}
+			cancel()
+			if err != nil {
+				glog.Errorln("Read returned error:", err)
 			}
 			cchan <- c
 		}()
@@ -359,17 +321,23 @@ loop:
 	wg.Done()
 }
 
-func doWrites(cl RWRer, cp conf.Provider, size int, writes int, wg *sync.WaitGroup) {
+func doWrites(cl store.Client, cp conf.Provider, size int, writes int, wg *sync.WaitGroup) {
 	var (
 		value   = make([]byte, size)
 		cnt     int
+		err     error
 		reqsent time.Time
 	)
 
 	bgen.GetBytes(value)
 	for i := 0; i < writes; i++ {
 		reqsent = time.Now()
-		cnt = cl.Write(cp, value)
+		ctx, cancel := opContext()
+		cnt, err = cl.Write(ctx, cp, value)
+		cancel()
+		if err != nil {
+			glog.Errorln("Write returned error:", err)
+		}
 		elog.Log(e.NewTimedEventWithMetric(e.ClientWriteLatency, reqsent, uint64(cnt)))
 	}
 	glog.Infoln("finished writes")
@@ -378,7 +346,7 @@ func doWrites(cl RWRer, cp conf.Provider, size int, writes int, wg *sync.WaitGro
 	}
 }
 
-func doReads(cl RWRer, cp conf.Provider, reads int, reg bool, wg *sync.WaitGroup) {
+func doReads(cl store.Client, cp conf.Provider, reads int, reg bool, wg *sync.WaitGroup) {
 	var (
 		cnt     int
 		reqsent time.Time
@@ -386,10 +354,16 @@ func doReads(cl RWRer, cp conf.Provider, reads int, reg bool, wg *sync.WaitGroup
 
 	for i := 0; i < reads; i++ {
 		reqsent = time.Now()
+		var err error
+		ctx, cancel := opContext()
 		if reg {
-			_, cnt = cl.RRead(cp)
+			_, cnt, err = cl.RRead(ctx, cp)
 		} else {
-			_, cnt = cl.Read(cp)
+			_, cnt, err = cl.Read(ctx, cp)
+		}
+		cancel()
+		if err != nil {
+			glog.Errorln("Read returned error:", err)
 		}
 		elog.Log(e.NewTimedEventWithMetric(e.ClientReadLatency, reqsent, uint64(cnt)))
 	}
@@ -417,12 +391,26 @@ func handleSignal(signal os.Signal) bool {
 	}
 }
 
-type RWRer interface {
-	RRead(conf.Provider) ([]byte, int)
-	Read(conf.Provider) ([]byte, int)
-	Write(cp conf.Provider, val []byte) int
-	Reconf(cp conf.Provider, prop *pb.Blueprint) (int, error)
-	GetCur(conf.Provider) *pb.Blueprint
+// batchClient sends the writes of a client through a Batcher.
+type batchClient struct {
+	store.Client
+	b *smc.Batcher
+}
+
+func (bc *batchClient) Write(ctx context.Context, cp conf.Provider, val []byte) (int, error) {
+	return bc.b.Write(ctx, cp, val)
+}
+
+func (bc *batchClient) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (int, error) {
+	return bc.b.WriteKey(ctx, cp, key, val)
+}
+
+// opContext returns the context for one client operation.
+func opContext() (context.Context, context.CancelFunc) {
+	if *opTime > 0 {
+		return context.WithTimeout(context.Background(), *opTime)
+	}
+	return context.WithCancel(context.Background())
 }
 
 func LogErrors(mgr *pb.Manager) {
@@ -465,3 +453,12 @@ func checkFlags(alg, cprov, opt string) {
 		}
 	}
 }
+
+// initBlueprint returns the initial configuration, with the first initsize
+// servers in ids, or all of them if there are fewer.
+func initBlueprint(ids []uint32) *pb.Blueprint {
+	if *initsize < len(ids) {
+		ids = ids[:*initsize]
+	}
+	return pb.InitBlueprint(ids)
+}
@@ -5,18 +5,20 @@ import (
 
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/store"
+	"golang.org/x/net/context"
 )
 
 type FwdClient struct {
-	RWRer
+	store.Client
 	leader *pb.Configuration
 }
 
-func (fc *FwdClient) Reconf(cp conf.Provider, prop *pb.Blueprint) (int, error) {
+func (fc *FwdClient) Reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (int, error) {
 	if glog.V(4) {
 		glog.Infoln("Sending reconfiguration proposal")
 	}
-	_, err := fc.leader.Fwd(&pb.Proposal{prop})
+	_, err := fc.leader.Fwd(ctx, &pb.Proposal{prop})
 	if err != nil {
 		glog.Errorln("Forward returned error", err)
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/relab/smartMerge/elog"
 	e "github.com/relab/smartMerge/elog/event"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/store"
 	"github.com/relab/smartMerge/util"
 )
 
@@ -26,15 +27,7 @@ func expmain() {
 		return
 	}
 
-	initBlp := new(pb.Blueprint)
-	initBlp.Nodes = make([]*pb.Node, 0, len(ids))
-	for i, id := range ids {
-		if i >= *initsize {
-			break
-		}
-		initBlp.Nodes = append(initBlp.Nodes, &pb.Node{Id: id})
-	}
-	initBlp.FaultTolerance = uint32(15)
+	initBlp := initBlueprint(ids)
 
 	if *doelog {
 		elog.Enable()
@@ -46,12 +39,12 @@ func expmain() {
 
 	for i := 0; i < *nclients; i++ {
 		glog.Infoln("starting client number: ", i)
-		cp, mgr, err := NewConfP(addrs, *cprov, (*clientid)+i)
+		cp, mgr, err := store.NewConfP(addrs, *cprov, (*clientid)+i)
 		if err != nil {
 			glog.Errorln("Error creating confProvider: ", err)
 			continue
 		}
-		cl, err := NewClient(initBlp, *alg, *opt, (*clientid)+i, cp)
+		cl, err := store.NewClient(initBlp, *alg, *opt, (*clientid)+i, cp, retryPolicy())
 		if err != nil {
 			glog.Errorln("Error creating client: ", err)
 			continue
@@ -116,7 +109,7 @@ func expmain() {
 
 }
 
-func contremove(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
+func contremove(c store.Client, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
 	if len(ids) <= i {
 		glog.Errorf("Configuration file does not hold %d processes.\n", i+1)
 		return
@@ -129,7 +122,9 @@ func contremove(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int
 			glog.Infoln("Could not remove %v\n.", ids[i])
 		} else {
 			reqsent := time.Now()
-			cnt, err := c.Reconf(cp, target)
+			ctx, cancel := opContext()
+			cnt, err := c.Reconf(ctx, cp, target)
+			cancel()
 			if err == nil || cnt == 0 {
 				elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 			} else {
@@ -146,7 +141,7 @@ func contremove(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int
 	}
 }
 
-func contadd(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
+func contadd(c store.Client, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
 	if len(ids) <= i {
 		glog.Errorf("Configuration file does not hold %d processes.\n", i+1)
 		return
@@ -159,7 +154,9 @@ func contadd(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, w
 			glog.V(4).Infoln("Could not add %v\n.", ids[i])
 		} else {
 			reqsent := time.Now()
-			cnt, err := c.Reconf(cp, target)
+			ctx, cancel := opContext()
+			cnt, err := c.Reconf(ctx, cp, target)
+			cancel()
 			if err == nil || cnt == 0 {
 				elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 			} else {
@@ -176,7 +173,7 @@ func contadd(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, w
 	}
 }
 
-func contreplace(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
+func contreplace(c store.Client, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
 	if len(ids) <= i {
 		glog.Errorf("Configuration file does not hold %d processes.\n", i+1)
 		return
@@ -192,7 +189,9 @@ func contreplace(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i in
 		}
 
 		reqsent := time.Now()
-		cnt, err := c.Reconf(cp, target)
+		ctx, cancel := opContext()
+		cnt, err := c.Reconf(ctx, cp, target)
+		cancel()
 		if err == nil || cnt == 0 {
 			elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 		} else {
@@ -208,7 +207,7 @@ func contreplace(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i in
 	}
 }
 
-func replace(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
+func replace(c store.Client, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	cur := c.GetCur(cp)
 	if len(ids) <= *initsize+i {
@@ -223,7 +222,9 @@ func replace(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, w
 
 	<-sc
 	reqsent := time.Now()
-	cnt, err := c.Reconf(cp, target)
+	ctx, cancel := opContext()
+	cnt, err := c.Reconf(ctx, cp, target)
+	cancel()
 	elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 
 	if err != nil {
@@ -232,7 +233,7 @@ func replace(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, w
 	return
 }
 
-func remove(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
+func remove(c store.Client, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	cur := c.GetCur(cp)
 	if len(ids) <= i {
@@ -246,7 +247,9 @@ func remove(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg
 
 	<-sc
 	reqsent := time.Now()
-	cnt, err := c.Reconf(cp, target)
+	ctx, cancel := opContext()
+	cnt, err := c.Reconf(ctx, cp, target)
+	cancel()
 	elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 
 	if err != nil {
@@ -255,7 +258,7 @@ func remove(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg
 	return
 }
 
-func adds(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
+func adds(c store.Client, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	cur := c.GetCur(cp)
 	if len(ids) <= i {
@@ -272,7 +275,9 @@ func adds(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *
 	<-sc
 
 	reqsent := time.Now()
-	cnt, err := c.Reconf(cp, target)
+	ctx, cancel := opContext()
+	cnt, err := c.Reconf(ctx, cp, target)
+	cancel()
 	elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 
 	if err != nil {
@@ -281,7 +286,7 @@ func adds(c RWRer, cp conf.Provider, ids []uint32, sc chan struct{}, i int, wg *
 	return
 }
 
-func createForwarder(cl RWRer, mgr *pb.Manager, lid uint32) (RWRer, error) {
+func createForwarder(cl store.Client, mgr *pb.Manager, lid uint32) (store.Client, error) {
 	ids := mgr.ToIds([]uint32{lid})
 	cnf, err := mgr.NewConfiguration(ids, 1, conf.ConfTimeout)
 	if err != nil {
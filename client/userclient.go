@@ -10,6 +10,7 @@ import (
 	"github.com/relab/smartMerge/elog"
 	e "github.com/relab/smartMerge/elog/event"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/store"
 	"github.com/relab/smartMerge/util"
 )
 
@@ -23,22 +24,14 @@ func usermain() {
 		return
 	}
 
-	initBlp := new(pb.Blueprint)
-	initBlp.Nodes = make([]*pb.Node, 0, len(ids))
-	for i, id := range ids {
-		if i >= *initsize {
-			break
-		}
-		initBlp.Nodes = append(initBlp.Nodes, &pb.Node{Id: id})
-	}
-	initBlp.FaultTolerance = uint32(15)
+	initBlp := initBlueprint(ids)
 
-	cp, mgr, err := NewConfP(addrs, *cprov, (*clientid))
+	cp, mgr, err := store.NewConfP(addrs, *cprov, (*clientid))
 	if err != nil {
 		fmt.Println("Error creating confProvider: ", err)
 		return
 	}
-	client, err := NewClient(initBlp, *alg, *opt, *clientid, cp)
+	client, err := store.NewClient(initBlp, *alg, *opt, *clientid, cp, retryPolicy())
 	defer PrintErrors(mgr)
 	if err != nil {
 		fmt.Println("Error creating client: ", err)
@@ -69,7 +62,12 @@ func usermain() {
 		switch op {
 		case 1:
 			reqsent := time.Now()
-			bytes, cnt := client.Read(cp)
+			ctx, cancel := opContext()
+			bytes, cnt, err := client.Read(ctx, cp)
+			cancel()
+			if err != nil {
+				fmt.Println("Read returned error:", err)
+			}
 			elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 			state := string(bytes)
 			fmt.Println("Current value is: ", state)
@@ -80,12 +78,22 @@ func usermain() {
 			fmt.Print("Insert string to write: ")
 			fmt.Scanln(&str)
 			reqsent := time.Now()
-			cnt := client.Write(cp, []byte(str))
+			ctx, cancel := opContext()
+			cnt, err := client.Write(ctx, cp, []byte(str))
+			cancel()
+			if err != nil {
+				fmt.Println("Write returned error:", err)
+			}
 			elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 			fmt.Printf("Did %d accesses.\n", cnt)
 		case 3:
 			reqsent := time.Now()
-			bytes, cnt := client.RRead(cp)
+			ctx, cancel := opContext()
+			bytes, cnt, err := client.RRead(ctx, cp)
+			cancel()
+			if err != nil {
+				fmt.Println("Read returned error:", err)
+			}
 			elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
 			state := string(bytes)
 			fmt.Println("Current value is: ", state)
@@ -107,12 +115,16 @@ func usermain() {
 
 }
 
-func handleReconf(c RWRer, cp conf.Provider, ids []uint32) {
+func handleReconf(c store.Client, cp conf.Provider, ids []uint32) {
 	cur := c.GetCur(cp)
 	fmt.Println("Current Blueprint is: ", cur)
-	fmt.Println("Type 1 or 2 for add or remove?")
+	fmt.Println("Type 1 to 6 for add, remove, set weight, set quorum sizes, set zone or set zone faults?")
 	fmt.Println("  1: Add")
 	fmt.Println("  2: Remove")
+	fmt.Println("  3: Set weight")
+	fmt.Println("  4: Set quorum sizes")
+	fmt.Println("  5: Set zone")
+	fmt.Println("  6: Set zone faults")
 
 	var adrem int
 	_, err := fmt.Scanf("%d", &adrem)
@@ -138,15 +150,7 @@ func handleReconf(c RWRer, cp conf.Provider, ids []uint32) {
 		}
 
 		fmt.Println("Starting reconfiguration with target ", target)
-		reqsent := time.Now()
-		cnt, err := c.Reconf(cp, target)
-		elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
-		if err != nil {
-			fmt.Println("Reconf returned error: ", err)
-		}
-		fmt.Printf("did %d accesses.\n", cnt)
-		fmt.Println("new blueprint is ", c.GetCur(cp))
-		return
+		reconf(c, cp, target)
 	case 2:
 		fmt.Println("Ids in the current configuration:")
 		for _, id := range cur.Ids() {
@@ -165,22 +169,98 @@ func handleReconf(c RWRer, cp conf.Provider, ids []uint32) {
 			fmt.Println("Node is not part of current configuration.")
 			return
 		}
+		reconf(c, cp, target)
+	case 3:
+		fmt.Println("Ids in the current configuration:")
+		for _, id := range cur.Ids() {
+			fmt.Printf("%d (weight %d)\n", id, cur.Weight(id))
+		}
+		fmt.Println("Type the id and its new weight.")
+		var id, w uint32
+		_, err = fmt.Scanf("%d %d", &id, &w)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
-		reqsent := time.Now()
-		cnt, err := c.Reconf(cp, target)
-		elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
+		target := cur.Copy()
+		if !target.SetWeight(id, w) {
+			fmt.Println("Node is not part of current configuration, or already has that weight.")
+			return
+		}
+		reconf(c, cp, target)
+	case 4:
+		fmt.Printf("Quorums are %d for reads and %d for writes, out of %d.\n", cur.ReadQuorum(), cur.Quorum(), cur.TotalWeight())
+		fmt.Println("Type the read and write quorum sizes, 0 to derive one from the other.")
+		var r, w uint32
+		_, err = fmt.Scanf("%d %d", &r, &w)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
+		target := cur.Copy()
+		if err := target.SetQuorums(r, w); err != nil {
+			fmt.Println(err)
+			return
+		}
+		reconf(c, cp, target)
+	case 5:
+		fmt.Println("Ids in the current configuration:")
+		for _, id := range cur.Ids() {
+			fmt.Printf("%d (zone %q)\n", id, cur.Zone(id))
+		}
+		fmt.Println("Type the id and its new zone.")
+		var id uint32
+		var zone string
+		_, err = fmt.Scanf("%d %s", &id, &zone)
 		if err != nil {
-			fmt.Println("Reconf returned error: ", err)
+			fmt.Println(err)
+			return
 		}
 
-		fmt.Printf("did %d accesses.\n", cnt)
-		fmt.Println("new blueprint is ", c.GetCur(cp))
-		return
+		target := cur.Copy()
+		if !target.SetZone(id, zone) {
+			fmt.Println("Node is not part of current configuration, or already in that zone.")
+			return
+		}
+		reconf(c, cp, target)
+	case 6:
+		fmt.Printf("The configuration tolerates the loss of %d zones.\n", cur.ZoneFaults)
+		fmt.Println("Type the number of zones whose loss to tolerate.")
+		var k uint32
+		_, err = fmt.Scanf("%d", &k)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		target := cur.Copy()
+		target.SetZoneFaults(k)
+		if err := target.CheckZones(); err != nil {
+			fmt.Println(err)
+			return
+		}
+		reconf(c, cp, target)
 	default:
 		return
 	}
+}
+
+// reconf reconfigures to target and prints the result.
+func reconf(c store.Client, cp conf.Provider, target *pb.Blueprint) {
+	reqsent := time.Now()
+	ctx, cancel := opContext()
+	cnt, err := c.Reconf(ctx, cp, target)
+	cancel()
+	elog.Log(e.NewTimedEventWithMetric(e.ClientReconfLatency, reqsent, uint64(cnt)))
+
+	if err != nil {
+		fmt.Println("Reconf returned error: ", err)
+	}
 
+	fmt.Printf("did %d accesses.\n", cnt)
+	fmt.Println("new blueprint is ", c.GetCur(cp))
 }
 
 func PrintErrors(mgr *pb.Manager) {
@@ -29,61 +29,154 @@ func NewProvider(mgr *pb.Manager, id int) *ThriftyNorecConfP {
 	return &ThriftyNorecConfP{mgr, id}
 }
 
-func (cp *ThriftyNorecConfP) chooseQ(ids []int, q int) (quorum []int) {
-	if q > len(ids) {
-		glog.Fatalf("Trying to choose %d nodes, out of %d\n", q, len(ids))
+// chooseQ chooses nodes from ids, starting at an offset given by cp.id, until
+// their weight in ws is at least q. If span > 0, it first picks one node from
+// each zone in zs, that the nodes in have are not in, until have and the
+// chosen nodes span that many zones. It returns false, if ids do not have
+// the weight or the zones.
+func (cp *ThriftyNorecConfP) chooseQ(ids []int, ws map[int]int, q int, zs map[int]string, have []int, span int) (quorum []int, ok bool) {
+	if total := weightOf(ids, ws); q > total {
+		glog.V(3).Infof("Trying to choose weight %d, out of %d\n", q, total)
+		return nil, false
 	}
 
-	quorum = make([]int, q)
 	start := cp.id % len(ids)
-	if start+q <= len(ids) {
-		copy(quorum, ids[start:])
-		return quorum
+	chosen := make(map[int]bool, len(ids))
+	seen := make(map[string]bool)
+	for _, id := range have {
+		seen[zs[id]] = true
 	}
-	copy(quorum, ids[start:])
-	copy(quorum[len(ids)-start:], ids)
-	return quorum
+	w := 0
+	for i := 0; i < len(ids) && span > 0 && len(seen) < span; i++ {
+		id := ids[(start+i)%len(ids)]
+		if seen[zs[id]] {
+			continue
+		}
+		seen[zs[id]] = true
+		chosen[id] = true
+		quorum = append(quorum, id)
+		w += ws[id]
+	}
+	if len(seen) < span {
+		glog.V(3).Infof("Trying to choose %d zones, out of %d\n", span, len(seen))
+		return nil, false
+	}
+	for i := 0; w < q; i++ {
+		id := ids[(start+i)%len(ids)]
+		if chosen[id] {
+			continue
+		}
+		quorum = append(quorum, id)
+		w += ws[id]
+	}
+	return quorum, true
 }
 
-func (cp *ThriftyNorecConfP) ReadC(blp *pb.Blueprint, rids []int) *pb.Configuration {
+// weights returns the ids of the nodes in blp, and their weights by id.
+func (cp *ThriftyNorecConfP) weights(blp *pb.Blueprint) ([]int, map[int]int) {
 	cids := cp.mgr.ToIds(blp.Ids())
-	rq := len(cids) - blp.Quorum() + 1 //read quorum
+	ws := make(map[int]int, len(cids))
+	for i, w := range blp.Weights() {
+		ws[cids[i]] = w
+	}
+	return cids, ws
+}
+
+// zones returns the zones of the nodes in blp by id, or nil if blp has no zone
+// rule.
+func (cp *ThriftyNorecConfP) zones(blp *pb.Blueprint) map[int]string {
+	if blp.ZoneSpan() == 0 {
+		return nil
+	}
+	cids := cp.mgr.ToIds(blp.Ids())
+	zs := make(map[int]string, len(cids))
+	for i, z := range blp.Zones() {
+		zs[cids[i]] = z
+	}
+	return zs
+}
+
+// spans returns true, if the nodes ids are in at least span zones in zs.
+func spans(ids []int, zs map[int]string, span int) bool {
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		seen[zs[id]] = true
+	}
+	return len(seen) >= span
+}
+
+// weightOf returns the weight of the nodes ids.
+func weightOf(ids []int, ws map[int]int) int {
+	w := 0
+	for _, id := range ids {
+		w += ws[id]
+	}
+	return w
+}
+
+// newConf returns a configuration of ids, weighted by ws, with write and read
+// quorums q and rq. If rq is 0, it is derived from q.
+func (cp *ThriftyNorecConfP) newConf(ids []int, ws map[int]int, q, rq int, timeout time.Duration) (*pb.Configuration, error) {
+	weights := make([]int, len(ids))
+	for i, id := range ids {
+		weights[i] = ws[id]
+	}
+	return cp.mgr.NewWeightedConfiguration(ids, weights, q, rq, timeout)
+}
+
+func (cp *ThriftyNorecConfP) ReadC(blp *pb.Blueprint, rids []int) *pb.Configuration {
+	cids, ws := cp.weights(blp)
+	rq := blp.ReadQuorum()
 	newcids := pb.Difference(cids, rids)
 
-	if len(cids)-len(newcids) >= rq {
+	// The replies I already have weigh y.
+	y := weightOf(cids, ws) - weightOf(newcids, ws)
+	if y >= rq {
 		//We already have enough replies.
 		return nil
 	}
 
-	// I already have y := len(cids) - len(newcids) many replies.
-	// I still need rq - y many.
-	newcids = cp.chooseQ(newcids, rq-len(cids)+len(newcids))
+	// I still need rq - y.
+	newcids, ok := cp.chooseQ(newcids, ws, rq-y, nil, nil, 0)
+	if !ok {
+		return cp.FullC(blp)
+	}
 
 	// With quorum size 1, a read quorum contains all processes.
-	cnf, err := cp.mgr.NewConfiguration(newcids, 1, TryTimeout)
+	cnf, err := cp.newConf(newcids, ws, 1, 0, TryTimeout)
 	if err != nil {
-		glog.Fatalln("could not get read config")
+		glog.Errorln("could not get read config, using the full config:", err)
+		return cp.FullC(blp)
 	}
 
 	return cnf
 }
 
+// WriteC is also used for calls that read, so it chooses a read quorum, if
+// that is larger than a write quorum. Together with the replies it already
+// has, the chosen nodes span the zones blp requires.
 func (cp *ThriftyNorecConfP) WriteC(blp *pb.Blueprint, rids []int) *pb.Configuration {
-	cids := cp.mgr.ToIds(blp.Ids())
-	q := blp.Quorum()
+	cids, ws := cp.weights(blp)
+	zs, span := cp.zones(blp), blp.ZoneSpan()
+	q := blp.MaxQuorum()
 	newcids := pb.Difference(cids, rids)
+	have := pb.Difference(cids, newcids)
 
-	if len(cids)-len(newcids) >= q {
+	y := weightOf(have, ws)
+	if y >= q && spans(have, zs, span) {
 		//We already have enough replies.
 		return nil
 	}
 
-	// I already have y := len(cids) - len(newcids) many replies.
-	// I still need q - y many.
-	newcids = cp.chooseQ(newcids, q-len(cids)+len(newcids))
-	cnf, err := cp.mgr.NewConfiguration(newcids, len(newcids), TryTimeout)
+	// I still need q - y.
+	newcids, ok := cp.chooseQ(newcids, ws, q-y, zs, have, span)
+	if !ok {
+		return cp.FullC(blp)
+	}
+	cnf, err := cp.newConf(newcids, ws, weightOf(newcids, ws), 0, TryTimeout)
 	if err != nil {
-		glog.Fatalln("could not get read config")
+		glog.Errorln("could not get write config, using the full config:", err)
+		return cp.FullC(blp)
 	}
 
 	return cnf
@@ -91,9 +184,9 @@ func (cp *ThriftyNorecConfP) WriteC(blp *pb.Blueprint, rids []int) *pb.Configura
 
 func (cp *ThriftyNorecConfP) FullC(blp *pb.Blueprint) *pb.Configuration {
 	cids := cp.mgr.ToIds(blp.Ids())
-	q := blp.Quorum()
+	q, rq := blp.Quorum(), blp.ReadQuorum()
 
-	cnf, err := cp.mgr.NewConfiguration(cids, q, ConfTimeout)
+	cnf, err := cp.mgr.NewZonedConfiguration(cids, blp.Weights(), blp.Zones(), blp.ZoneSpan(), q, rq, ConfTimeout)
 	if err != nil {
 		glog.Fatalln("could not get config")
 	}
@@ -120,7 +213,7 @@ func (cp *ThriftyNorecConfP) SingleC(blp *pb.Blueprint) *pb.Configuration {
 }
 
 func (cp *ThriftyNorecConfP) WriteCNoS(blp *pb.Blueprint, rids []int) *pb.Configuration {
-	cids := cp.mgr.ToIds(blp.Ids())
+	cids, ws := cp.weights(blp)
 	m := cids[0]
 	for _, id := range cids {
 		if m < id {
@@ -128,22 +221,27 @@ func (cp *ThriftyNorecConfP) WriteCNoS(blp *pb.Blueprint, rids []int) *pb.Config
 		}
 	}
 
-	q := blp.Quorum()
+	zs, span := cp.zones(blp), blp.ZoneSpan()
+	q := blp.MaxQuorum()
 	newcids := pb.Difference(cids, rids)
+	have := pb.Difference(cids, newcids)
 
-	if len(cids)-len(newcids) >= q {
+	y := weightOf(have, ws)
+	if y >= q && spans(have, zs, span) {
 		//We already have enough replies.
 		return nil
 	}
 
-	// I already have y := len(cids) - len(newcids) many replies.
-	// I still need q - y many.
-	y := len(cids) - len(newcids)
+	// I still need q - y.
 	newcids = pb.Difference(newcids, []int{m})
-	newcids = cp.chooseQ(newcids, q-y)
-	cnf, err := cp.mgr.NewConfiguration(newcids, len(newcids), TryTimeout)
+	newcids, ok := cp.chooseQ(newcids, ws, q-y, zs, have, span)
+	if !ok {
+		return cp.FullC(blp)
+	}
+	cnf, err := cp.newConf(newcids, ws, weightOf(newcids, ws), 0, TryTimeout)
 	if err != nil {
-		glog.Fatalln("could not get read config")
+		glog.Errorln("could not get write config, using the full config:", err)
+		return cp.FullC(blp)
 	}
 
 	return cnf
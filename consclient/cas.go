@@ -0,0 +1,253 @@
+package consclient
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	conf "github.com/relab/smartMerge/confProvider"
+	pb "github.com/relab/smartMerge/proto"
+	smc "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
+)
+
+// Compare-and-swap runs a Paxos instance for the timestamp T read from the
+// register, to decide the state with timestamp T+1, see regserver/casserver.go.
+// The decided state is then written like any other. A swap that lost the
+// instance reads again, and retries if the condition still holds.
+//
+// Swaps are linearizable with each other and with reads. Blind writes to the
+// same register are not ordered with swaps, do not mix the two on one key.
+
+// ErrSwapUnknown is returned, if a swap was held up so long, that the servers
+// dropped its instance. The swap may or may not have taken effect.
+var ErrSwapUnknown = errors.New("outcome of compare-and-swap unknown")
+
+// CasMaxBackoff is the longest wait after a conflict with another swap.
+var CasMaxBackoff = 100 * time.Millisecond
+
+// casOps numbers the swaps of each client id.
+var casOps = struct {
+	sync.Mutex
+	m map[uint32]uint32
+}{m: make(map[uint32]uint32)}
+
+// casOwner returns an owner that is unique per swap: The client id in the
+// higher 32 bits, and the number of the swap in the lower.
+func (cc *ConsClient) casOwner() uint64 {
+	casOps.Lock()
+	casOps.m[cc.Id]++
+	n := casOps.m[cc.Id]
+	casOps.Unlock()
+	return uint64(cc.Id)<<32 | uint64(n)
+}
+
+// casRound returns the first round of this client above higher. The lower 32
+// bits of a round are the client id, the higher bits are a counter. Swaps of
+// the same client may share a round, but at most one of them gets its
+// promises, since a server only promises rounds above the ones it has seen.
+func (cc *ConsClient) casRound(higher uint64) uint64 {
+	return (higher>>32+1)<<32 | uint64(cc.Id)
+}
+
+// CompareAndSwap writes val to the register with the given key, if it holds
+// old. It reports whether the swap took effect. A nil old matches a register
+// that was never written.
+func (cc *ConsClient) CompareAndSwap(ctx context.Context, cp conf.Provider, key string, old, val []byte) (swapped bool, cnt int, err error) {
+	return cc.CompareAndSwapFunc(ctx, cp, key, func(st *pb.State) bool {
+		if st == nil {
+			return old == nil
+		}
+		return bytes.Equal(st.Value, old)
+	}, val)
+}
+
+// CompareAndSwapFunc writes val to the register with the given key, if cond
+// holds for its state. The state is nil, if the register was never written.
+// E.g. to swap on the timestamp, compare st.Timestamp in cond.
+func (cc *ConsClient) CompareAndSwapFunc(ctx context.Context, cp conf.Provider, key string, cond func(st *pb.State) bool, val []byte) (swapped bool, cnt int, err error) {
+	op := &ConsClient{cc.View()}
+	defer cc.Merge(op.SmClient)
+	return op.cas(ctx, cp, key, cond, val)
+}
+
+func (cc *ConsClient) cas(ctx context.Context, cp conf.Provider, key string, cond func(*pb.State) bool, val []byte) (swapped bool, cnt int, err error) {
+	owner := cc.casOwner()
+	for {
+		// Atomic read, that also completes pending reconfigurations.
+		st, c, err := cc.doreconf(ctx, cp, nil, 2, key, nil)
+		cnt += c
+		if err != nil {
+			return false, cnt, err
+		}
+		if !cond(st) {
+			return false, cnt, nil
+		}
+
+		var t int32
+		if st != nil {
+			t = st.Timestamp
+		}
+		prop := &pb.State{Value: val, Timestamp: t + 1, Writer: cc.Id}
+		dec, ours, c, err := cc.decide(ctx, cp, key, t, owner, prop)
+		cnt += c
+		if err != nil {
+			return false, cnt, err
+		}
+
+		c, err = cc.WriteState(ctx, cp, key, dec)
+		cnt += c
+		if err != nil {
+			return false, cnt, err
+		}
+		if ours {
+			return true, cnt, nil
+		}
+		glog.V(4).Infof("C%d: Lost swap on %q at timestamp %d, retrying.\n", cc.Id, key, t)
+	}
+}
+
+// decide runs the instance for timestamp t of key, proposing prop. It returns
+// the decided state, and whether it was proposed by this swap. If the
+// configuration changes, decide moves on to the new one, the slots moved
+// along.
+func (cc *ConsClient) decide(ctx context.Context, cp conf.Provider, key string, t int32, owner uint64, prop *pb.State) (dec *pb.State, ours bool, cnt int, err error) {
+	rnd := cc.casRound(0)
+	ms := 1 * time.Millisecond
+
+	for {
+		c := cc.Blueps[0].ID()
+		cnf := cp.FullC(cc.Blueps[0])
+
+		var promise *pb.CasPromise
+		for j := 0; ; j++ {
+			promise, err = cnf.CasPrepare(ctx, &pb.CasPrepare{CurC: c.Ptr(), Key: key, T: t, Rnd: rnd})
+			cnt++
+			if cc.Policy.Retry(ctx, "CasPrepare", j, err) {
+				continue
+			}
+			if err != nil {
+				glog.Errorf("C%d: error %v from CasPrepare after %d attempts.\n", cc.Id, err, j+1)
+				return nil, false, cnt, smc.NewQuorumError("CasPrepare", err)
+			}
+			break
+		}
+		if promise.Stale {
+			return nil, false, cnt, ErrSwapUnknown
+		}
+		if moved, c, err := cc.casMove(ctx, cp, key, promise.Cur, promise.Next); err != nil {
+			return nil, false, cnt + c, err
+		} else if moved {
+			cnt += c
+			continue
+		}
+
+		higher := promise.Rnd
+		if promise.Ok {
+			// Re-propose the value accepted in the highest round, if any.
+			val, vowner := prop, owner
+			if s := promise.Slot; s != nil {
+				val, vowner = s.Val, s.Owner
+			}
+
+			var learn *pb.CasLearn
+			for j := 0; ; j++ {
+				learn, err = cnf.CasAccept(ctx, &pb.CasPropose{CurC: c.Ptr(), Key: key, T: t, Rnd: rnd, Val: val, Owner: vowner})
+				cnt++
+				if cc.Policy.Retry(ctx, "CasAccept", j, err) {
+					continue
+				}
+				if err != nil {
+					glog.Errorf("C%d: error %v from CasAccept after %d attempts.\n", cc.Id, err, j+1)
+					return nil, false, cnt, smc.NewQuorumError("CasAccept", err)
+				}
+				break
+			}
+			if learn.Stale {
+				return nil, false, cnt, ErrSwapUnknown
+			}
+			if moved, c, err := cc.casMove(ctx, cp, key, learn.Cur, learn.Next); err != nil {
+				return nil, false, cnt + c, err
+			} else if moved {
+				cnt += c
+				continue
+			}
+			if learn.Ok {
+				return val, vowner == owner, cnt, nil
+			}
+			higher = learn.Rnd
+		}
+
+		// Conflict, or the servers are not ready. Sleep, then try again in
+		// a higher round.
+		if higher < rnd {
+			higher = rnd
+		}
+		rnd = cc.casRound(higher)
+		if glog.V(3) {
+			glog.Infof("C%d: CAS conflict, sleeping up to %v.\n", cc.Id, ms)
+		}
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(ms)))):
+		case <-ctx.Done():
+			return nil, false, cnt, ctx.Err()
+		}
+		if ms *= 2; ms > CasMaxBackoff {
+			ms = CasMaxBackoff
+		}
+	}
+}
+
+// casMove adds cur and next to the client. If there were any, it moves on to
+// the newest configuration, completing reconfigurations on the way.
+func (cc *ConsClient) casMove(ctx context.Context, cp conf.Provider, key string, cur *pb.Blueprint, next []*pb.Blueprint) (moved bool, cnt int, err error) {
+	if cur == nil && len(next) == 0 {
+		return false, 0, nil
+	}
+	cc.SetNewCur(cc.HandleOneCur(0, cur))
+	cc.HandleNext(0, next)
+	_, cnt, err = cc.doreconf(ctx, cp, nil, 1, key, nil)
+	return true, cnt, err
+}
+
+// casFreeze stops CAS in configuration i, and adds its slots to slots.
+func (cc *ConsClient) casFreeze(ctx context.Context, cp conf.Provider, i int, slots pb.KeySlots) (cnt int, err error) {
+	cnf := cp.FullC(cc.Blueps[i])
+	var ks pb.KeySlots
+	for j := 0; ; j++ {
+		ks, err = cnf.CasFreeze(ctx, cc.Blueps[i].ID())
+		cnt++
+		if cc.Policy.Retry(ctx, "CasFreeze", j, err) {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("C%d: error %v from CasFreeze after %d attempts.\n", cc.Id, err, j+1)
+			return cnt, smc.NewQuorumError("CasFreeze", err)
+		}
+		break
+	}
+	for _, s := range ks.List() {
+		slots.Add(s)
+	}
+	return cnt, nil
+}
+
+// casInstall installs slots in configuration i, and allows CAS there.
+func (cc *ConsClient) casInstall(ctx context.Context, cp conf.Provider, i int, slots pb.KeySlots) (cnt int, err error) {
+	cnf := cp.FullC(cc.Blueps[i])
+	for j := 0; ; j++ {
+		err = cnf.CasInstall(ctx, cc.Blueps[i].ID(), slots)
+		cnt++
+		if cc.Policy.Retry(ctx, "CasInstall", j, err) {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("C%d: error %v from CasInstall after %d attempts.\n", cc.Id, err, j+1)
+			return cnt, smc.NewQuorumError("CasInstall", err)
+		}
+		return cnt, nil
+	}
+}
@@ -0,0 +1,120 @@
+package consclient_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/relab/smartMerge/consclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	cl := testcluster.Start(t, "cons", 5)
+	defer cl.Stop()
+	ctx := context.Background()
+	cc := &consclient.ConsClient{SmClient: cl.C}
+
+	if ok, _, err := cc.CompareAndSwap(ctx, cl.CP, "n", []byte("1"), []byte("2")); err != nil || ok {
+		t.Fatalf("Swap on an empty register returned %v, %v, expected false.", ok, err)
+	}
+	if ok, _, err := cc.CompareAndSwap(ctx, cl.CP, "n", nil, []byte("0")); err != nil || !ok {
+		t.Fatalf("Swap on an empty register returned %v, %v, expected true.", ok, err)
+	}
+
+	// Concurrent increments must not get lost, also not while a server is
+	// removed.
+	prop := cl.C.GetCur(cl.CP)
+	prop.Rem(cl.ID(4))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := cc.Reconf(ctx, cl.CP, prop); err != nil {
+			t.Error(err)
+		}
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; {
+				v, _, err := cc.ReadKey(ctx, cl.CP, "n")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				x, _ := strconv.Atoi(string(v))
+				ok, _, err := cc.CompareAndSwap(ctx, cl.CP, "n", v, []byte(strconv.Itoa(x+1)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok {
+					j++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _, err := cc.ReadKey(ctx, cl.CP, "n"); err != nil || string(v) != "40" {
+		t.Errorf("Read after 40 increments returned %q, %v.", v, err)
+	}
+	if cur := cl.C.GetCur(cl.CP); !cur.Equals(prop) {
+		t.Errorf("Client ended in a configuration of size %d, expected %d.", cur.Order(), prop.Order())
+	}
+}
+
+func TestCompareAndSwapRace(t *testing.T) {
+	cl := testcluster.Start(t, "cons", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	// Ids that differ only above the lower 16 bits.
+	ccs := []*consclient.ConsClient{{SmClient: cl.C}}
+	for _, id := range []uint32{1<<16 | 1, 1<<31 | 1} {
+		cc, err := consclient.New(cl.Init, id, cl.CP, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ccs = append(ccs, cc)
+	}
+
+	for i := 0; i < 20; i++ {
+		key := "k" + strconv.Itoa(i)
+		won := make([]bool, len(ccs))
+		var wg sync.WaitGroup
+		for j, cc := range ccs {
+			wg.Add(1)
+			go func(j int, cc *consclient.ConsClient) {
+				defer wg.Done()
+				ok, _, err := cc.CompareAndSwap(ctx, cl.CP, key, nil, []byte(strconv.Itoa(j)))
+				if err != nil {
+					t.Error(err)
+				}
+				won[j] = ok
+			}(j, cc)
+		}
+		wg.Wait()
+
+		winner := -1
+		for j, ok := range won {
+			if !ok {
+				continue
+			}
+			if winner != -1 {
+				t.Fatalf("Clients %d and %d both swapped %q.", winner, j, key)
+			}
+			winner = j
+		}
+		if winner == -1 {
+			t.Fatalf("No client swapped %q.", key)
+		}
+		if v, _, err := ccs[0].ReadKey(ctx, cl.CP, key); err != nil || string(v) != strconv.Itoa(winner) {
+			t.Errorf("Read of %q returned %q, %v, expected the value of client %d.", key, v, err, winner)
+		}
+	}
+}
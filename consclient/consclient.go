@@ -6,27 +6,42 @@ import (
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
 	smc "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
 type ConsClient struct {
 	*smc.SmClient
 }
 
-func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*ConsClient, error) {
-	c, err := smc.New(initBlp, id, cp)
+func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider, rp *smc.RetryPolicy) (*ConsClient, error) {
+	c, err := smc.New(initBlp, id, cp, rp)
 	if err != nil {
 		return nil, err
 	}
 	return &ConsClient{c}, nil
 }
 
-func (cc *ConsClient) Reconf(cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
+func (cc *ConsClient) Reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
+	op := &ConsClient{cc.View()}
+	defer cc.Merge(op.SmClient)
+	return op.reconf(ctx, cp, prop)
+}
+
+func (cc *ConsClient) reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
 	//Proposed blueprint is already in place, or outdated.
 	if prop.Compare(cc.Blueps[0]) == 1 {
 		glog.V(3).Infof("C%d: Proposal is already in place.", cc.Id)
 		return 0, nil
 	}
+	if err := prop.CheckZones(); err != nil {
+		glog.Errorf("C%d: Rejecting proposal: %v", cc.Id, err)
+		return 0, smc.ErrZones
+	}
 
-	_, cnt, err = cc.Doreconf(cp, prop, 0, nil)
+	incomparable := cc.Blueps[0].Compare(prop) != 1
+	_, cnt, err = cc.doreconf(ctx, cp, prop, 0, "", nil)
+	if err == nil && incomparable && !prop.Equals(cc.Blueps[0]) {
+		err = smc.ErrSuperseded
+	}
 	return
 }
@@ -1,22 +1,31 @@
 package consclient
 
 import (
-	"errors"
 	"time"
 
 	"github.com/golang/glog"
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
 	smc "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
-func (cc *ConsClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular int, val []byte) (rst *pb.State, cnt int, err error) {
+func (cc *ConsClient) Doreconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, regular int, key string, val []byte) (rst *pb.State, cnt int, err error) {
+	op := &ConsClient{cc.View()}
+	defer cc.Merge(op.SmClient)
+	return op.doreconf(ctx, cp, prop, regular, key, val)
+}
+
+func (cc *ConsClient) doreconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, regular int, key string, val []byte) (rst *pb.State, cnt int, err error) {
 	if glog.V(6) {
 		glog.Infof("C%d: Starting reconfiguration\n", cc.Id)
 	}
 
+	old := cc.Blueps[0]
 	doconsensus := true
 	cur := 0
+	kst := make(pb.KeyStates)  // States of the other registers.
+	slots := make(pb.KeySlots) // CAS slots, moved along with the states.
 
 forconfiguration:
 	for i := 0; i < len(cc.Blueps); i++ {
@@ -32,7 +41,7 @@ forconfiguration:
 			if doconsensus {
 				//Need to agree on new proposal
 				var cs int
-				next, cs, cur, err = cc.getconsensus(cp, i, prop)
+				next, cs, cur, err = cc.getconsensus(ctx, cp, i, prop)
 				if err != nil {
 					return nil, 0, err
 				}
@@ -47,7 +56,7 @@ forconfiguration:
 				// If atomic: Need to read before writing.
 				var st *pb.State
 				var c int
-				st, cur, c, err = cc.Doread(cp, cur, i, nil)
+				st, cur, c, err = cc.Doread(ctx, cp, cur, i, nil, key)
 				if err != nil {
 					return nil, 0, err
 				}
@@ -73,36 +82,47 @@ forconfiguration:
 			writeN := new(pb.AWriteNReply)
 
 			for j := 0; cnf != nil; j++ {
-				writeN, err = cnf.AWriteN(&pb.WriteN{
-					CurC: uint32(cc.Blueps[i].Len()),
+				writeN, err = cnf.AWriteN(ctx, &pb.WriteN{
+					CurC: cc.Blueps[i].ID(),
 					Next: next,
+					Key:  key,
 				})
 				cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && cc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedWriteN: %v\n", cc.Id, err)
 					// Try again with full configuration.
 					cnf = cp.FullC(cc.Blueps[i])
 				}
 
-				if err != nil && j == smc.Retry {
-					glog.Errorf("C%d: error %v from WriteN after %d retries: ", cc.Id, err, smc.Retry)
-					return nil, 0, err
+				if cc.Policy.Retry(ctx, "WriteN", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from WriteN after %d attempts: ", cc.Id, err, j+1)
+					return nil, 0, smc.NewQuorumError("WriteN", err)
 				}
+				break
 			}
 
 			if glog.V(3) {
 				glog.Infof("C%d: CWriteN returned.\n", cc.Id)
 			}
 
+			var c int
+			c, err = cc.casFreeze(ctx, cp, i, slots)
+			if err != nil {
+				return nil, 0, err
+			}
+			cnt += c
+
 			cur = cc.HandleNewCur(cur, writeN.Reply.GetCur())
 
-			if rst.Compare(writeN.Reply.GetState()) == 1 {
-				rst = writeN.Reply.GetState()
+			if rst, err = cnf.FetchNewer(ctx, key, rst, writeN.Reply.GetState()); err != nil {
+				return nil, 0, err
+			}
+			if err = cnf.FetchNewerAll(ctx, kst, writeN.Reply.GetKStates()); err != nil {
+				return nil, 0, err
 			}
 
 		} else if i > cur || regular > 1 {
@@ -110,35 +130,53 @@ forconfiguration:
 
 			rst = cc.WriteValue(&val, rst)
 
+			if i > cur {
+				var c int
+				c, err = cc.casInstall(ctx, cp, i, slots)
+				if err != nil {
+					return nil, 0, err
+				}
+				cnt += c
+			}
+
 			cnf := cp.WriteC(cc.Blueps[i], nil)
 
 			var setS *pb.SetStateReply
 
 			for j := 0; ; j++ {
-				setS, err = cnf.SetState(&pb.NewState{
-					CurC:  uint32(cc.Blueps[i].Len()),
-					State: rst,
-				})
+				var st *pb.State
+				var kss []*pb.KeyState
+				if st, err = cnf.Stage(ctx, key, rst); err == nil {
+					kss, err = cnf.StageAll(ctx, kst.Others(key))
+				}
+				if err == nil {
+					setS, err = cnf.SetState(ctx, &pb.NewState{
+						CurC:    cc.Blueps[i].ID(),
+						State:   st,
+						Key:     key,
+						KStates: kss,
+					})
+				}
 				cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && cc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedSetState: %v\n", cc.Id, err)
 					// Try again with full configuration.
 					cnf = cp.FullC(cc.Blueps[i])
 				}
 
-				if err != nil && j == smc.Retry {
-					glog.Errorf("C%d: error %v from SetState after %d retries: ", cc.Id, err, smc.Retry)
-					return nil, 0, err
+				if cc.Policy.Retry(ctx, "SetState", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from SetState after %d attempts: ", cc.Id, err, j+1)
+					return nil, 0, smc.NewQuorumError("SetState", err)
 				}
+				break
 			}
 
 			if i > 0 && glog.V(3) {
-				glog.Infof("C%d: Set state in configuration of size %d.\n", cc.Id, cc.Blueps[i].Len())
+				glog.Infof("C%d: Set state in configuration of size %d.\n", cc.Id, cc.Blueps[i].Order())
 			} else if glog.V(6) {
 				glog.Infof("Set state returned.")
 			}
@@ -155,14 +193,15 @@ forconfiguration:
 
 	cc.SetNewCur(cur)
 	if cnt > 2 {
-		cc.SetCur(cp, cc.Blueps[0])
+		cc.SetCur(ctx, cp, cc.Blueps[0])
+		cc.SetCurRemoved(cp, old)
 		cnt++
 	}
 
 	return rst, cnt, nil
 }
 
-func (cc *ConsClient) getconsensus(cp conf.Provider, i int, prop *pb.Blueprint) (next *pb.Blueprint, cnt, cur int, err error) {
+func (cc *ConsClient) getconsensus(ctx context.Context, cp conf.Provider, i int, prop *pb.Blueprint) (next *pb.Blueprint, cnt, cur int, err error) {
 	ms := 1 * time.Millisecond
 	rnd := cc.Id
 	// The 24 higher bits of rnd (uint32) are a counter, the lower 8 bits the client id. Should separate the two in the future, to simplify things
@@ -179,24 +218,24 @@ prepare:
 			var promise *pb.GetPromiseReply
 
 			for j := 0; ; j++ {
-				promise, err = cnf.GetPromise(&pb.Prepare{
-					CurC: uint32(cc.Blueps[i].Len()),
+				promise, err = cnf.GetPromise(ctx, &pb.Prepare{
+					CurC: cc.Blueps[i].ID(),
 					Rnd:  rnd})
-				if err != nil && j == 0 {
+				if err != nil && cc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from Optimized Prepare: %v\n", cc.Id, err)
 					//Try again with full configuration.
 					cnf = cp.FullC(cc.Blueps[i])
 				}
 				cnt++
 
-				if err != nil && j == smc.Retry {
-					glog.Errorf("C%d: error %v from Prepare after %d retries.\n", cc.Id, err, smc.Retry)
-					return nil, 0, 0, err
+				if cc.Policy.Retry(ctx, "Prepare", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from Prepare after %d attempts.\n", cc.Id, err, j+1)
+					return nil, 0, 0, smc.NewQuorumError("Prepare", err)
 				}
+				break
 			}
 
 			cur = cc.HandleOneCur(i, promise.Reply.GetCur())
@@ -227,7 +266,11 @@ prepare:
 					next = prop.Merge(cc.Blueps[i]) // This could have side effects on prop. Is this a problem?
 					if len(prop.Ids()) == 0 {
 						glog.Errorf("Aborting Reconfiguration to avoid unacceptable configuration.")
-						return nil, cnt, cur, errors.New("Abort before proposing unacceptable configuration.")
+						return nil, cnt, cur, smc.ErrMinSize
+					}
+					if err := next.CheckZones(); err != nil {
+						glog.Errorf("Aborting Reconfiguration, proposal breaks zone rule: %v", err)
+						return nil, cnt, cur, smc.ErrZones
 					}
 				}
 			case rrnd > rnd:
@@ -242,7 +285,11 @@ prepare:
 				} else {
 					rnd = rrnd - rrid + 256 + cc.Id
 				}
-				time.Sleep(ms)
+				select {
+				case <-time.After(ms):
+				case <-ctx.Done():
+					return nil, 0, cur, ctx.Err()
+				}
 				ms = 2 * ms
 				continue prepare
 
@@ -256,25 +303,25 @@ prepare:
 		var learn *pb.AcceptReply
 
 		for j := 0; ; j++ {
-			learn, err = cnf.Accept(&pb.Propose{
-				CurC: uint32(cc.Blueps[i].Len()),
+			learn, err = cnf.Accept(ctx, &pb.Propose{
+				CurC: cc.Blueps[i].ID(),
 				Val:  &pb.CV{rnd, next},
 			})
 			cnt++
-			if err != nil && j == 0 {
+			if err != nil && cc.Policy.Widen(j) {
 				glog.Errorf("C%d: error from OptimizedAccept: %v\n", cc.Id, err)
 				// Try again with full configuration.
 				cnf = cp.FullC(cc.Blueps[i])
 			}
 
-			if err != nil && j == smc.Retry {
-				glog.Errorf("C%d: error %v from Accept after %d retries: ", cc.Id, err, smc.Retry)
-				return nil, 0, cur, err
+			if cc.Policy.Retry(ctx, "Accept", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("C%d: error %v from Accept after %d attempts: ", cc.Id, err, j+1)
+				return nil, 0, cur, smc.NewQuorumError("Accept", err)
 			}
+			break
 		}
 
 		cur = cc.HandleOneCur(cur, learn.Reply.GetCur())
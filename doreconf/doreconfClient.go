@@ -6,11 +6,12 @@ import (
 	cc "github.com/relab/smartMerge/consclient"
 	pb "github.com/relab/smartMerge/proto"
 	smc "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
 type Reconfer interface {
-	Doreconf(conf.Provider, *pb.Blueprint, int, []byte) (*pb.State, int, error)
-	Reconf(conf.Provider, *pb.Blueprint) (int, error)
+	Doreconf(context.Context, conf.Provider, *pb.Blueprint, int, string, []byte) (*pb.State, int, error)
+	Reconf(context.Context, conf.Provider, *pb.Blueprint) (int, error)
 	GetCur(conf.Provider) *pb.Blueprint
 }
 
@@ -18,9 +19,9 @@ type DoreconfClient struct {
 	Reconfer
 }
 
-func NewSM(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*DoreconfClient, error) {
+func NewSM(initBlp *pb.Blueprint, id uint32, cp conf.Provider, rp *smc.RetryPolicy) (*DoreconfClient, error) {
 
-	rec, err := smc.New(initBlp, id, cp)
+	rec, err := smc.New(initBlp, id, cp, rp)
 
 	if err != nil {
 		return nil, err
@@ -29,9 +30,9 @@ func NewSM(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*DoreconfClient,
 	return &DoreconfClient{rec}, nil
 }
 
-func NewCons(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*DoreconfClient, error) {
+func NewCons(initBlp *pb.Blueprint, id uint32, cp conf.Provider, rp *smc.RetryPolicy) (*DoreconfClient, error) {
 
-	rec, err := cc.New(initBlp, id, cp)
+	rec, err := cc.New(initBlp, id, cp, rp)
 
 	if err != nil {
 		return nil, err
@@ -41,17 +42,29 @@ func NewCons(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*DoreconfClien
 }
 
 //Atomic read
-func (drc *DoreconfClient) Read(cp conf.Provider) (val []byte, cnt int) {
+func (drc *DoreconfClient) Read(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return drc.ReadKey(ctx, cp, "")
+}
+
+//Regular read
+func (drc *DoreconfClient) RRead(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return drc.RReadKey(ctx, cp, "")
+}
+
+func (drc *DoreconfClient) Write(ctx context.Context, cp conf.Provider, val []byte) (cnt int, err error) {
+	return drc.WriteKey(ctx, cp, "", val)
+}
+
+//Atomic read of the register with the given key.
+func (drc *DoreconfClient) ReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Read")
 	}
 	var st *pb.State
-	var err error
 
-	st, cnt, err = drc.Doreconf(cp, nil, 2, nil)
+	st, cnt, err = drc.Doreconf(ctx, cp, nil, 2, key, nil)
 	if err != nil {
-		glog.Errorln("Error during Read", err)
-		return nil, 0
+		return nil, cnt, err
 	}
 
 	if glog.V(3) {
@@ -60,25 +73,21 @@ func (drc *DoreconfClient) Read(cp conf.Provider) (val []byte, cnt int) {
 		}
 	}
 	if st == nil {
-		glog.Errorln("read returned nil state")
-		return nil, cnt
+		return nil, cnt, nil
 	}
-	return st.Value, cnt
+	return st.Value, cnt, nil
 }
 
-//Regular read
-func (drc *DoreconfClient) RRead(cp conf.Provider) (val []byte, cnt int) {
+//Regular read of the register with the given key.
+func (drc *DoreconfClient) RReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting regular Read")
 	}
 	var st *pb.State
-	var err error
-
-	st, cnt, err = drc.Doreconf(cp, nil, 1, nil)
 
+	st, cnt, err = drc.Doreconf(ctx, cp, nil, 1, key, nil)
 	if err != nil {
-		glog.Errorln("Error during RRead")
-		return nil, 0
+		return nil, cnt, err
 	}
 	if glog.V(3) {
 		if cnt > 1 {
@@ -86,28 +95,24 @@ func (drc *DoreconfClient) RRead(cp conf.Provider) (val []byte, cnt int) {
 		}
 	}
 	if st == nil {
-		glog.Errorln("read returned nil state")
-		return nil, cnt
+		return nil, cnt, nil
 	}
-	return st.Value, cnt
+	return st.Value, cnt, nil
 }
 
-func (drc *DoreconfClient) Write(cp conf.Provider, val []byte) (cnt int) {
+func (drc *DoreconfClient) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Write")
 	}
-	var err error
-
-	_, cnt, err = drc.Doreconf(cp, nil, 2, val)
 
+	_, cnt, err = drc.Doreconf(ctx, cp, nil, 2, key, val)
 	if err != nil {
-		glog.Errorln("Error during Write")
-		return 0
+		return cnt, err
 	}
 	if glog.V(3) {
 		if cnt > 2 {
 			glog.Infof("Write used %d accesses\n", cnt)
 		}
 	}
-	return cnt
+	return cnt, nil
 }
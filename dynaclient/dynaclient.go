@@ -1,43 +1,83 @@
 package dynaclient
 
 import (
-	"errors"
+	"sync"
 
 	"github.com/golang/glog"
 
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
+	sm "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
+// DynaClient is safe for concurrent use, see smclient.SmClient.
 type DynaClient struct {
 	Blueps []*pb.Blueprint
 	Confs  []*pb.Configuration
 	ID     uint32
+	Policy *sm.RetryPolicy
+
+	mu       sync.Mutex // Protects Blueps and Confs.
+	onNewCur sm.CurCallbacks
 }
 
-func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*DynaClient, error) {
-	conf := cp.FullC(initBlp)
+// New creates a client for the configuration initBlp, or for the newer
+// blueprints saved in smclient.BluepDir.
+func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider, rp *sm.RetryPolicy) (*DynaClient, error) {
+	if rp == nil {
+		rp = sm.DefaultRetry
+	}
 
 	glog.Infof("New Client with Id: %d\n", id)
 
-	_, err := conf.DSetCur(&pb.NewCur{initBlp, uint32(initBlp.Len())})
-	if err != nil {
-		glog.Errorln("initial SetCur returned error: ", err)
-		return nil, errors.New("Initial SetCur failed.")
+	blps, stale := sm.StartBlueps(initBlp, id)
+	confs := make([]*pb.Configuration, len(blps))
+	for i, blp := range blps {
+		confs[i] = cp.FullC(blp)
+	}
+	if !stale {
+		_, err := confs[0].DSetCur(context.Background(), &pb.NewCur{initBlp, initBlp.ID()})
+		if err != nil {
+			glog.Errorln("initial SetCur returned error: ", err)
+			return nil, sm.NewQuorumError("DSetCur", err)
+		}
+		sm.SaveBlueps(id, blps)
 	}
 	return &DynaClient{
-		Blueps: []*pb.Blueprint{initBlp},
-		Confs:  []*pb.Configuration{conf},
+		Blueps: blps,
+		Confs:  confs,
 		ID:     id,
+		Policy: rp,
 	}, nil
 }
 
 //Atomic read
-func (dc *DynaClient) Read(cp conf.Provider) (val []byte, cnt int) {
+func (dc *DynaClient) Read(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return dc.ReadKey(ctx, cp, "")
+}
+
+//Regular read
+func (dc *DynaClient) RRead(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return dc.RReadKey(ctx, cp, "")
+}
+
+func (dc *DynaClient) Write(ctx context.Context, cp conf.Provider, val []byte) (cnt int, err error) {
+	return dc.WriteKey(ctx, cp, "", val)
+}
+
+//Atomic read of the register with the given key.
+func (dc *DynaClient) ReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
+	op := dc.view()
+	defer dc.merge(op)
+	return op.readKey(ctx, cp, key)
+}
+
+func (dc *DynaClient) readKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Read")
 	}
-	val, cnt, err := dc.Traverse(cp, nil, nil, false)
+	val, cnt, err = dc.traverse(ctx, cp, nil, key, nil, false)
 	if err != nil {
 		glog.Infoln("Traverse returned error: ", err)
 	}
@@ -46,16 +86,22 @@ func (dc *DynaClient) Read(cp conf.Provider) (val []byte, cnt int) {
 			glog.Infof("read used %d accesses\n", cnt)
 		}
 	}
-	return val, cnt
+	return val, cnt, err
 }
 
-//Regular read
-func (dc *DynaClient) RRead(cp conf.Provider) (val []byte, cnt int) {
+//Regular read of the register with the given key.
+func (dc *DynaClient) RReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
+	op := dc.view()
+	defer dc.merge(op)
+	return op.rreadKey(ctx, cp, key)
+}
+
+func (dc *DynaClient) rreadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting regular Read")
 	}
 
-	val, cnt, err := dc.Traverse(cp, nil, nil, true)
+	val, cnt, err = dc.traverse(ctx, cp, nil, key, nil, true)
 	if err != nil {
 		glog.Infoln("Traverse returned error: ", err)
 	}
@@ -64,14 +110,20 @@ func (dc *DynaClient) RRead(cp conf.Provider) (val []byte, cnt int) {
 			glog.Infof("regular read used %d accesses\n", cnt)
 		}
 	}
-	return val, cnt
+	return val, cnt, err
+}
+
+func (dc *DynaClient) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
+	op := dc.view()
+	defer dc.merge(op)
+	return op.writeKey(ctx, cp, key, val)
 }
 
-func (dc *DynaClient) Write(cp conf.Provider, val []byte) int {
+func (dc *DynaClient) writeKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting write")
 	}
-	_, cnt, err := dc.Traverse(cp, nil, val, false)
+	_, cnt, err = dc.traverse(ctx, cp, nil, key, val, false)
 	if err != nil {
 		glog.Infoln("Traverse returned error: ", err)
 	}
@@ -80,15 +132,25 @@ func (dc *DynaClient) Write(cp conf.Provider, val []byte) int {
 			glog.Infof("write used %d accesses\n", cnt)
 		}
 	}
-	return cnt
+	return cnt, err
+}
+
+func (dc *DynaClient) Reconf(ctx context.Context, cp conf.Provider, bp *pb.Blueprint) (int, error) {
+	op := dc.view()
+	defer dc.merge(op)
+	return op.reconf(ctx, cp, bp)
 }
 
-func (dc *DynaClient) Reconf(cp conf.Provider, bp *pb.Blueprint) (int, error) {
+func (dc *DynaClient) reconf(ctx context.Context, cp conf.Provider, bp *pb.Blueprint) (int, error) {
 	if glog.V(3) {
 		glog.Infoln("starting reconf")
 	}
+	if err := bp.CheckZones(); err != nil {
+		glog.Errorf("C%d: Rejecting proposal: %v", dc.ID, err)
+		return 0, sm.ErrZones
+	}
 
-	_, cnt, err := dc.Traverse(cp, bp, nil, false)
+	_, cnt, err := dc.traverse(ctx, cp, bp, "", nil, false)
 	if glog.V(3) {
 		glog.Infof("reconf used %d accesses\n", cnt)
 	}
@@ -96,5 +158,59 @@ func (dc *DynaClient) Reconf(cp conf.Provider, bp *pb.Blueprint) (int, error) {
 }
 
 func (dc *DynaClient) GetCur(cp conf.Provider) *pb.Blueprint {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
 	return dc.Blueps[len(dc.Blueps)-1].Copy()
 }
+
+// view returns a copy of the client for a single operation.
+func (dc *DynaClient) view() *DynaClient {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return &DynaClient{
+		Blueps: append([]*pb.Blueprint(nil), dc.Blueps...),
+		Confs:  append([]*pb.Configuration(nil), dc.Confs...),
+		ID:     dc.ID,
+		Policy: dc.Policy,
+	}
+}
+
+// merge takes over the views of op, if it found a newer current view, or more
+// views after the same current one.
+func (dc *DynaClient) merge(op *DynaClient) {
+	dc.mu.Lock()
+	cur, ocur := dc.Blueps[0], op.Blueps[0]
+	if cur.Compare(ocur) != 1 {
+		dc.mu.Unlock()
+		return
+	}
+	if ocur.Compare(cur) == 1 && len(op.Blueps) <= len(dc.Blueps) {
+		dc.mu.Unlock()
+		return
+	}
+	dc.Blueps, dc.Confs = op.Blueps, op.Confs
+	sm.SaveBlueps(dc.ID, dc.Blueps)
+	dc.mu.Unlock()
+
+	if ocur.Compare(cur) != 1 {
+		dc.onNewCur.Notify(ocur)
+	}
+}
+
+// OnNewCur registers fn to be called with every new current configuration,
+// see smclient.SmClient.OnNewCur.
+func (dc *DynaClient) OnNewCur(fn func(cur *pb.Blueprint)) {
+	dc.onNewCur.Add(fn)
+}
+
+// Watch subscribes to new current configurations at the servers, and moves
+// the client to them in the background, until ctx is done.
+func (dc *DynaClient) Watch(ctx context.Context, cp conf.Provider) {
+	go sm.WatchCur(ctx, cp, func() *pb.Blueprint {
+		dc.mu.Lock()
+		defer dc.mu.Unlock()
+		return dc.Blueps[0]
+	}, func(cur *pb.Blueprint) {
+		dc.merge(&DynaClient{Blueps: []*pb.Blueprint{cur}, Confs: []*pb.Configuration{cp.FullC(cur)}})
+	})
+}
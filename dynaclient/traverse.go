@@ -6,10 +6,22 @@ import (
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
 	sm "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
-func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte, regular bool) (rval []byte, cnt int, err error) {
+// Traverse reads or writes the register with the given key. The states of all
+// other registers are moved along when moving to a new configuration.
+func (dc *DynaClient) Traverse(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, key string, val []byte, regular bool) (rval []byte, cnt int, err error) {
+	op := dc.view()
+	defer dc.merge(op)
+	return op.traverse(ctx, cp, prop, key, val, regular)
+}
+
+func (dc *DynaClient) traverse(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, key string, val []byte, regular bool) (rval []byte, cnt int, err error) {
+	old := dc.Blueps[0]
 	rst := new(pb.State)
+	kst := make(pb.KeyStates) // States of the other registers.
+	var allkeys bool
 	for i := 0; i < len(dc.Blueps); i++ {
 		cnt++
 		var curprop *pb.Blueprint // The current proposal
@@ -21,30 +33,30 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			getOne := new(pb.GetOneNReply)
 
 			for j := 0; ; j++ {
-				getOne, err = cnf.GetOneN(&pb.GetOne{
+				getOne, err = cnf.GetOneN(ctx, &pb.GetOne{
 					Conf: &pb.Conf{
-						Cur:  uint32(dc.Blueps[0].Len()),
-						This: uint32(dc.Blueps[i].Len()),
+						Cur:  dc.Blueps[0].ID(),
+						This: dc.Blueps[i].ID(),
 					},
 					Next: prop,
 				})
 
 				//cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && dc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedGetOne: %v\n", dc.ID, err)
 					// Try again with full configuration.
 					cnf = dc.Confs[i]
 				}
 
-				if err != nil && j == sm.Retry {
-					glog.Errorf("C%d: error %v from WriteN after %d retries: ", dc.ID, err, sm.Retry)
-					return nil, 0, err
+				if dc.Policy.Retry(ctx, "WriteN", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from WriteN after %d attempts: ", dc.ID, err, j+1)
+					return nil, 0, sm.NewQuorumError("WriteN", err)
 				}
+				break
 			}
 
 			if glog.V(4) {
@@ -54,7 +66,7 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			isnew := dc.handleNewCur(i, getOne.Reply.GetCur(), cp)
 			if isnew {
 				prop = prop.Merge(getOne.Reply.GetCur())
-				glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Len())
+				glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Order())
 				i = -1
 				continue
 			}
@@ -62,7 +74,7 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			curprop = getOne.Reply.GetNext()
 			if glog.V(4) {
 				if prop.Equals(curprop) {
-					glog.Infof("C%d: My proposal l%d was the one in c%d\n", dc.ID, prop.Len(), dc.Blueps[i].Len())
+					glog.Infof("C%d: My proposal l%d was the one in c%d\n", dc.ID, prop.Order(), dc.Blueps[i].Order())
 				}
 			}
 
@@ -72,36 +84,40 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 		var cnf *pb.Configuration
 		cnf = cp.WriteC(dc.Blueps[i], nil)
 		writeN := new(pb.DWriteNReply)
+		// Only fetch the other registers, if we might move to a new configuration.
+		allkeys = allkeys || prop != nil || i+1 < len(dc.Blueps)
 
 		for j := 0; ; j++ {
-			writeN, err = dc.Confs[i].DWriteN(
+			writeN, err = dc.Confs[i].DWriteN(ctx,
 				&pb.DRead{
 					Conf: &pb.Conf{
-						Cur:  uint32(dc.Blueps[0].Len()),
-						This: uint32(dc.Blueps[i].Len()),
+						Cur:     dc.Blueps[0].ID(),
+						This:    dc.Blueps[i].ID(),
+						Key:     key,
+						AllKeys: allkeys,
 					},
 					Prop: curprop,
 				})
 			//cnt++
 
-			if err != nil && j == 0 {
+			if err != nil && dc.Policy.Widen(j) {
 				glog.Errorf("C%d: error from OptimizedWriteN: %v\n", dc.ID, err)
 				// Try again with full configuration.
 				cnf = dc.Confs[i]
 			}
 
-			if err != nil && j == sm.Retry {
-				glog.Errorf("C%d: error %v from WriteN after %d retries: ", dc.ID, err, sm.Retry)
-				return nil, 0, err
+			if dc.Policy.Retry(ctx, "WriteN", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("C%d: error %v from WriteN after %d attempts: ", dc.ID, err, j+1)
+				return nil, 0, sm.NewQuorumError("WriteN", err)
 			}
+			break
 		}
 
 		if curprop != nil && glog.V(3) {
-			glog.Infof("C%d: Read in View with length %d and id %d.\n ", dc.ID, dc.Blueps[i].Len(), dc.Confs[i].GlobalID())
+			glog.Infof("C%d: Read in View with length %d and id %d.\n ", dc.ID, dc.Blueps[i].Order(), dc.Confs[i].GlobalID())
 		} else if glog.V(6) {
 			glog.Infof("C%d: Read returned.\n", dc.ID)
 		}
@@ -110,7 +126,7 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 		if isnew {
 			if prop != nil {
 				prop = prop.Merge(writeN.Reply.GetCur())
-				glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Len())
+				glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Order())
 			}
 			i = -1
 			continue
@@ -118,14 +134,24 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 
 		next := writeN.Reply.GetNext()
 		prop = dc.handleNext(i, next, prop, cp)
-		if rst.Compare(writeN.Reply.GetState()) == 1 {
-			rst = writeN.Reply.GetState()
+		if rst, err = cnf.FetchNewer(ctx, key, rst, writeN.Reply.GetState()); err != nil {
+			return nil, 0, err
+		}
+		if err = cnf.FetchNewerAll(ctx, kst, writeN.Reply.GetKStates()); err != nil {
+			return nil, 0, err
+		}
+
+		if !allkeys && len(next) > 0 {
+			// Found a new configuration, read again to also get the other registers.
+			allkeys = true
+			i--
+			continue
 		}
 
 		if i == len(dc.Blueps)-1 && (!regular || i > 0) {
 
 			if glog.V(6) {
-				glog.Infof("C%d: Starting write in view with length %d and id %d\n ", dc.ID, dc.Blueps[i].Len(), dc.Confs[i].GlobalID())
+				glog.Infof("C%d: Starting write in view with length %d and id %d\n ", dc.ID, dc.Blueps[i].Order(), dc.Confs[i].GlobalID())
 			}
 			//WriteInView
 			wst := dc.WriteValue(val, rst)
@@ -136,33 +162,42 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			var setS *pb.DSetStateReply
 
 			for j := 0; ; j++ {
-				setS, err = cnf.DSetState(&pb.DNewState{
-					Conf: &pb.Conf{
-						Cur:  uint32(dc.Blueps[i].Len()),
-						This: uint32(dc.Blueps[i].Len()),
-					},
-					State: wst,
-				})
+				var st *pb.State
+				var kss []*pb.KeyState
+				if st, err = cnf.Stage(ctx, key, wst); err == nil {
+					kss, err = cnf.StageAll(ctx, kst.Others(key))
+				}
+				if err == nil {
+					setS, err = cnf.DSetState(ctx, &pb.DNewState{
+						Conf: &pb.Conf{
+							Cur:  dc.Blueps[i].ID(),
+							This: dc.Blueps[i].ID(),
+							Key:  key,
+						},
+						State:   st,
+						KStates: kss,
+					})
+				}
 				//cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && dc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedSetState: %v\n", dc.ID, err)
 					// Try again with full configuration.
 					cnf = dc.Confs[i]
 				}
 
-				if err != nil && j == sm.Retry {
-					glog.Errorf("C%d: error %v from SetState after %d retries: ", dc.ID, err, sm.Retry)
-					return nil, 0, err
+				if dc.Policy.Retry(ctx, "SetState", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from SetState after %d attempts: ", dc.ID, err, j+1)
+					return nil, 0, sm.NewQuorumError("SetState", err)
 				}
+				break
 			}
 
 			if i > 0 && glog.V(3) {
-				glog.Infof("C%d: Write in view with length %d and id %d\n ", dc.ID, dc.Blueps[i].Len(), dc.Confs[i].GlobalID())
+				glog.Infof("C%d: Write in view with length %d and id %d\n ", dc.ID, dc.Blueps[i].Order(), dc.Confs[i].GlobalID())
 			} else if glog.V(6) {
 				glog.Infoln("Write returned.")
 			}
@@ -171,7 +206,7 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			if isnew {
 				if prop != nil {
 					prop = prop.Merge(setS.Reply.GetCur())
-					glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Len())
+					glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Order())
 				}
 				i = -1
 				continue
@@ -187,7 +222,7 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 
 		if len(next) > 0 { //Oups this is not just an else to the if above, but can also be used be true, after the WriteInView was executed.
 			if len(next) > 1 {
-				glog.Errorf("Did not expect ever to receive %d next values with length: %d and %d.\n", len(next), next[0].Len(), next[1].Len())
+				glog.Errorf("Did not expect ever to receive %d next values with length: %d and %d.\n", len(next), next[0].Order(), next[1].Order())
 				if next[0].Equals(next[1]) {
 					glog.Errorln("They are duplicates.")
 				}
@@ -204,33 +239,33 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			var writeNs *pb.DWriteNSetReply
 
 			for j := 0; ; j++ {
-				writeNs, err = cnf.DWriteNSet(&pb.DWriteNs{
+				writeNs, err = cnf.DWriteNSet(ctx, &pb.DWriteNs{
 					Conf: &pb.Conf{
-						Cur:  uint32(dc.Blueps[0].Len()),
-						This: uint32(dc.Blueps[i].Len()),
+						Cur:  dc.Blueps[0].ID(),
+						This: dc.Blueps[i].ID(),
 					},
 					Next: next[0],
 				})
 				//cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && dc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedWriteNSet: %v\n", dc.ID, err)
 					// Try again with full configuration.
 					cnf = dc.Confs[i]
 				}
 
-				if err != nil && j == sm.Retry {
-					glog.Errorf("C%d: error %v from WriteNSet after %d retries.\n ", dc.ID, err, sm.Retry)
-					return nil, 0, err
+				if dc.Policy.Retry(ctx, "WriteNSet", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from WriteNSet after %d attempts.\n ", dc.ID, err, j+1)
+					return nil, 0, sm.NewQuorumError("WriteNSet", err)
 				}
+				break
 			}
 
 			if glog.V(3) {
-				glog.Infof("C%d: WriteNSet returned in conf with length %d.\n", dc.ID, dc.Blueps[0].Len())
+				glog.Infof("C%d: WriteNSet returned in conf with length %d.\n", dc.ID, dc.Blueps[0].Order())
 				if writeNs.Reply.GetCur() != nil {
 					glog.Infof("C%d: WriteNSet did return new current.\n", dc.ID)
 				}
@@ -240,7 +275,7 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 			if isnew {
 				if prop != nil {
 					prop = prop.Merge(writeNs.Reply.GetCur())
-					glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Len())
+					glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Order())
 				}
 				i = -1
 				continue
@@ -255,7 +290,8 @@ func (dc *DynaClient) Traverse(cp conf.Provider, prop *pb.Blueprint, val []byte,
 		glog.Infof("About to return")
 	}
 	if cnt > 1 {
-		dc.SetCur(cp, dc.Blueps[0])
+		dc.SetCur(ctx, cp, dc.Blueps[0])
+		dc.SetCurRemoved(cp, old)
 	}
 
 	if val == nil {
@@ -274,7 +310,7 @@ func (dc *DynaClient) handleNewCur(i int, newCur *pb.Blueprint, cp conf.Provider
 
 	cnf := cp.FullC(newCur)
 
-	glog.V(4).Infof("C%d: Found new current view with length %d and id: %d\n", dc.ID, newCur.Len(), cnf.GlobalID())
+	glog.V(4).Infof("C%d: Found new current view with length %d and id: %d\n", dc.ID, newCur.Order(), cnf.GlobalID())
 	dc.Blueps = make([]*pb.Blueprint, 1, 5)
 	dc.Confs = make([]*pb.Configuration, 1, 5)
 	dc.Blueps[0] = newCur
@@ -289,7 +325,7 @@ func (dc *DynaClient) handleNext(i int, next []*pb.Blueprint, prop *pb.Blueprint
 		if nxt != nil {
 			dc.findorinsert(i, nxt, cp)
 			prop = prop.Merge(nxt)
-			glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Len())
+			glog.V(4).Infof("C%d: Proposal has now length %d.\n", dc.ID, prop.Order())
 		}
 	}
 	return prop
@@ -318,7 +354,7 @@ func (dc *DynaClient) findorinsert(i int, blp *pb.Blueprint, cp conf.Provider) {
 }
 
 func (dc *DynaClient) insert(i int, blp *pb.Blueprint, cp conf.Provider) {
-	glog.V(4).Infof("C%d: Found next blueprint with length %d.\n", dc.ID, blp.Len())
+	glog.V(4).Infof("C%d: Found next blueprint with length %d.\n", dc.ID, blp.Order())
 
 	cnf := cp.FullC(blp)
 
@@ -343,27 +379,35 @@ func (dc *DynaClient) WriteValue(val []byte, st *pb.State) *pb.State {
 	return &pb.State{Value: val, Timestamp: st.Timestamp + 1, Writer: dc.ID}
 }
 
-func (dc *DynaClient) SetCur(cp conf.Provider, cur *pb.Blueprint) {
+func (dc *DynaClient) SetCur(ctx context.Context, cp conf.Provider, cur *pb.Blueprint) {
 	cnf := cp.WriteC(cur, nil)
 
 	for j := 0; ; j++ {
-		_, err := cnf.DSetCur(&pb.NewCur{
-			CurC: uint32(cur.Len()),
+		_, err := cnf.DSetCur(ctx, &pb.NewCur{
+			CurC: cur.ID(),
 			Cur:  cur})
 
-		if err != nil && j == 0 {
+		if err != nil && dc.Policy.Widen(j) {
 			glog.Errorf("C%d: error from Thrifty New Cur: %v\n", dc.ID, err)
 			// Try again with full configuration.
 			cnf = cp.FullC(cur)
 		}
 
-		if err != nil && j == sm.Retry {
-			glog.Errorf("C%d: error %v from NewCur after %d retries: ", dc.ID, err, sm.Retry)
-			break
+		if dc.Policy.Retry(ctx, "SetCur", j, err) {
+			continue
 		}
-
-		if err == nil {
-			break
+		if err != nil {
+			glog.Errorf("C%d: error %v from NewCur after %d attempts: ", dc.ID, err, j+1)
 		}
+		break
 	}
 }
+
+// SetCurRemoved sends the current blueprint to the servers removed since old.
+func (dc *DynaClient) SetCurRemoved(cp conf.Provider, old *pb.Blueprint) {
+	cur := dc.Blueps[0]
+	sm.NotifyRemoved(cp, old, cur, func(ctx context.Context, cnf *pb.Configuration) error {
+		_, err := cnf.DSetCur(ctx, &pb.NewCur{CurC: cur.ID(), Cur: cur})
+		return err
+	})
+}
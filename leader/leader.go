@@ -5,6 +5,7 @@ import (
 	conf "github.com/relab/smartMerge/confProvider"
 	cs "github.com/relab/smartMerge/consclient"
 	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
 )
 
 type Leader struct {
@@ -16,7 +17,7 @@ type Leader struct {
 }
 
 func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*Leader, error) {
-	cc, err := cs.New(initBlp, id, cp)
+	cc, err := cs.New(initBlp, id, cp, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +68,7 @@ run_for:
 		}
 
 		//Should we add a check, whether the proposal is actually holding anything new?
-		_, err := l.Reconf(l.cp, prop)
+		_, err := l.Reconf(context.Background(), l.cp, prop)
 		if err != nil {
 			glog.Errorln("Reconf returned error:", err)
 		}
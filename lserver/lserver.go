@@ -16,6 +16,7 @@ import (
 	pb "github.com/relab/smartMerge/proto"
 	qf "github.com/relab/smartMerge/qfuncs"
 	"github.com/relab/smartMerge/regserver"
+	"github.com/relab/smartMerge/storage"
 	"github.com/relab/smartMerge/util"
 	grpc "google.golang.org/grpc"
 )
@@ -28,6 +29,10 @@ var (
 
 	noabort = flag.Bool("no-abort", false, "do not send aborting new-cur information.")
 
+	datadir   = flag.String("datadir", "", "directory to keep the server state in. If empty, state is kept in memory only.")
+	fsync     = flag.String("fsync", "always", "when to sync the state to disk (always | periodic | never )")
+	doRecover = flag.Bool("recover", false, "if the datadir is empty, recover the state from the other servers before serving requests.")
+
 	cprov = flag.String("cprov", "normal", "which configuration provider: (normal | thrifty | norecontact ) ")
 	//Config
 	confFile = flag.String("conf", "config", "the config file, a list of host:port addresses.")
@@ -59,16 +64,48 @@ func main() {
 
 	var err error
 	var rs *regserver.ConsServer
+	policy, err := storage.ParseSyncPolicy(*fsync)
+	if err != nil {
+		glog.Fatalln(err)
+	}
+	st, err := storage.Open(*datadir, policy)
+	if err != nil {
+		glog.Fatalln("Opening storage returned error", err)
+	}
+
+	var peers *regserver.Peers
+	if *doRecover {
+		if peers, err = regserver.NewPeers(addrs, ids, *port, *initsize); err != nil {
+			glog.Fatalln(err)
+		}
+	}
+
 	glog.Infoln("Starting Server with port: ", *port)
 	switch *alg {
 	case "", "sm":
-		_, err = regserver.StartAdv(*port, *noabort)
+		if peers != nil {
+			_, err = regserver.StartAdvRecover(*port, peers, st, *noabort)
+		} else {
+			_, err = regserver.StartAdv(*port, st, *noabort)
+		}
 	case "dyna":
-		_, err = regserver.StartDyna(*port)
+		if peers != nil {
+			_, err = regserver.StartDynaRecover(*port, peers, st)
+		} else {
+			_, err = regserver.StartDyna(*port, st)
+		}
 	case "ssr":
-		_, err = regserver.StartSSR(*port)
+		if peers != nil {
+			_, err = regserver.StartSSRRecover(*port, peers, st)
+		} else {
+			_, err = regserver.StartSSR(*port, st)
+		}
 	case "cons":
-		rs, err = regserver.StartCons(*port, *noabort)
+		if peers != nil {
+			rs, err = regserver.StartConsRecover(*port, peers, st, *noabort)
+		} else {
+			rs, err = regserver.StartCons(*port, st, *noabort)
+		}
 	}
 
 	if err != nil {
@@ -77,15 +114,7 @@ func main() {
 
 		time.Sleep(1 * time.Second) //Better than a long timeout here is a long timeout for trying to connect.
 
-		initBlp := new(pb.Blueprint)
-		initBlp.Nodes = make([]*pb.Node, 0, len(ids))
-		for i, id := range ids {
-			if i >= *initsize {
-				break
-			}
-			initBlp.Nodes = append(initBlp.Nodes, &pb.Node{Id: id})
-		}
-		initBlp.FaultTolerance = uint32(15)
+		initBlp := initBlueprint(ids)
 
 		glog.Infof("starting configProvider and manager at time %v\n", time.Now())
 		cp, mgr, err := NewConfP(addrs, *cprov, (*clientid))
@@ -194,3 +223,12 @@ func LogErrors(mgr *pb.Manager) {
 
 	return
 }
+
+// initBlueprint returns the initial configuration, with the first initsize
+// servers in ids, or all of them if there are fewer.
+func initBlueprint(ids []uint32) *pb.Blueprint {
+	if *initsize < len(ids) {
+		ids = ids[:*initsize]
+	}
+	return pb.InitBlueprint(ids)
+}
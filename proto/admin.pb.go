@@ -0,0 +1,261 @@
+// Code generated by protoc-gen-gogo.
+// source: admin.proto
+// DO NOT EDIT!
+
+package proto
+
+import proto1 "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto1.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type InspectRequest struct {
+}
+
+func (m *InspectRequest) Reset()         { *m = InspectRequest{} }
+func (m *InspectRequest) String() string { return proto1.CompactTextString(m) }
+func (*InspectRequest) ProtoMessage()    {}
+
+type Snapshot struct {
+	Algorithm  string        `protobuf:"bytes,1,opt,name=Algorithm,proto3" json:"Algorithm,omitempty"`
+	Uptime     int64         `protobuf:"varint,2,opt,name=Uptime,proto3" json:"Uptime,omitempty"`
+	Recovering bool          `protobuf:"varint,3,opt,name=Recovering,proto3" json:"Recovering,omitempty"`
+	Cur        *Blueprint    `protobuf:"bytes,4,opt,name=Cur" json:"Cur,omitempty"`
+	CurC       *ConfID       `protobuf:"bytes,5,opt,name=CurC" json:"CurC,omitempty"`
+	Next       []*Blueprint  `protobuf:"bytes,6,rep,name=Next" json:"Next,omitempty"`
+	LAState    *Blueprint    `protobuf:"bytes,7,opt,name=LAState" json:"LAState,omitempty"`
+	Timestamp  int32         `protobuf:"varint,8,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Writer     uint32        `protobuf:"varint,9,opt,name=Writer,proto3" json:"Writer,omitempty"`
+	Keys       uint32        `protobuf:"varint,10,opt,name=Keys,proto3" json:"Keys,omitempty"`
+	Paxos      []*PaxosRound `protobuf:"bytes,11,rep,name=Paxos" json:"Paxos,omitempty"`
+	DNext      []*ConfNext   `protobuf:"bytes,12,rep,name=DNext" json:"DNext,omitempty"`
+	Rounds     []*SSRRound   `protobuf:"bytes,13,rep,name=Rounds" json:"Rounds,omitempty"`
+	Removed    bool          `protobuf:"varint,14,opt,name=Removed,proto3" json:"Removed,omitempty"`
+	SafeToStop bool          `protobuf:"varint,15,opt,name=SafeToStop,proto3" json:"SafeToStop,omitempty"`
+}
+
+func (m *Snapshot) Reset()         { *m = Snapshot{} }
+func (m *Snapshot) String() string { return proto1.CompactTextString(m) }
+func (*Snapshot) ProtoMessage()    {}
+
+func (m *Snapshot) GetCur() *Blueprint {
+	if m != nil {
+		return m.Cur
+	}
+	return nil
+}
+
+func (m *Snapshot) GetCurC() *ConfID {
+	if m != nil {
+		return m.CurC
+	}
+	return nil
+}
+
+func (m *Snapshot) GetNext() []*Blueprint {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+func (m *Snapshot) GetLAState() *Blueprint {
+	if m != nil {
+		return m.LAState
+	}
+	return nil
+}
+
+func (m *Snapshot) GetPaxos() []*PaxosRound {
+	if m != nil {
+		return m.Paxos
+	}
+	return nil
+}
+
+func (m *Snapshot) GetDNext() []*ConfNext {
+	if m != nil {
+		return m.DNext
+	}
+	return nil
+}
+
+func (m *Snapshot) GetRounds() []*SSRRound {
+	if m != nil {
+		return m.Rounds
+	}
+	return nil
+}
+
+type PaxosRound struct {
+	Conf *ConfID    `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
+	Rnd  uint32     `protobuf:"varint,2,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+	Val  *CV        `protobuf:"bytes,3,opt,name=Val" json:"Val,omitempty"`
+	Next *Blueprint `protobuf:"bytes,4,opt,name=Next" json:"Next,omitempty"`
+}
+
+func (m *PaxosRound) Reset()         { *m = PaxosRound{} }
+func (m *PaxosRound) String() string { return proto1.CompactTextString(m) }
+func (*PaxosRound) ProtoMessage()    {}
+
+func (m *PaxosRound) GetConf() *ConfID {
+	if m != nil {
+		return m.Conf
+	}
+	return nil
+}
+
+func (m *PaxosRound) GetVal() *CV {
+	if m != nil {
+		return m.Val
+	}
+	return nil
+}
+
+func (m *PaxosRound) GetNext() *Blueprint {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+type ConfNext struct {
+	Conf *ConfID      `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
+	Next []*Blueprint `protobuf:"bytes,2,rep,name=Next" json:"Next,omitempty"`
+}
+
+func (m *ConfNext) Reset()         { *m = ConfNext{} }
+func (m *ConfNext) String() string { return proto1.CompactTextString(m) }
+func (*ConfNext) ProtoMessage()    {}
+
+func (m *ConfNext) GetConf() *ConfID {
+	if m != nil {
+		return m.Conf
+	}
+	return nil
+}
+
+func (m *ConfNext) GetNext() []*Blueprint {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+type SSRRound struct {
+	Conf      *ConfID      `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
+	Rnd       uint32       `protobuf:"varint,2,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+	Proposed  []*Blueprint `protobuf:"bytes,3,rep,name=Proposed" json:"Proposed,omitempty"`
+	Committed *Blueprint   `protobuf:"bytes,4,opt,name=Committed" json:"Committed,omitempty"`
+	Collected *Blueprint   `protobuf:"bytes,5,opt,name=Collected" json:"Collected,omitempty"`
+}
+
+func (m *SSRRound) Reset()         { *m = SSRRound{} }
+func (m *SSRRound) String() string { return proto1.CompactTextString(m) }
+func (*SSRRound) ProtoMessage()    {}
+
+func (m *SSRRound) GetConf() *ConfID {
+	if m != nil {
+		return m.Conf
+	}
+	return nil
+}
+
+func (m *SSRRound) GetProposed() []*Blueprint {
+	if m != nil {
+		return m.Proposed
+	}
+	return nil
+}
+
+func (m *SSRRound) GetCommitted() *Blueprint {
+	if m != nil {
+		return m.Committed
+	}
+	return nil
+}
+
+func (m *SSRRound) GetCollected() *Blueprint {
+	if m != nil {
+		return m.Collected
+	}
+	return nil
+}
+
+func init() {
+	proto1.RegisterType((*InspectRequest)(nil), "proto.InspectRequest")
+	proto1.RegisterType((*Snapshot)(nil), "proto.Snapshot")
+	proto1.RegisterType((*PaxosRound)(nil), "proto.PaxosRound")
+	proto1.RegisterType((*ConfNext)(nil), "proto.ConfNext")
+	proto1.RegisterType((*SSRRound)(nil), "proto.SSRRound")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Admin service
+
+type AdminClient interface {
+	Inspect(ctx context.Context, in *InspectRequest, opts ...grpc.CallOption) (*Snapshot, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) Inspect(ctx context.Context, in *InspectRequest, opts ...grpc.CallOption) (*Snapshot, error) {
+	out := new(Snapshot)
+	err := grpc.Invoke(ctx, "/proto.Admin/Inspect", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Admin service
+
+type AdminServer interface {
+	Inspect(context.Context, *InspectRequest) (*Snapshot, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_Inspect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(InspectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).Inspect(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Inspect",
+			Handler:    _Admin_Inspect_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -0,0 +1,38 @@
+package proto
+
+import (
+	"testing"
+
+	proto1 "github.com/gogo/protobuf/proto"
+)
+
+func TestSnapshotMarshal(t *testing.T) {
+	bp := &Blueprint{Nodes: []*Node{{Id: 1, Version: 1}, {Id: 2, Version: 1}}}
+	sn := &Snapshot{
+		Algorithm: "cons",
+		Uptime:    42,
+		Cur:       bp,
+		CurC:      bp.ID().Ptr(),
+		Timestamp: 3,
+		Writer:    2,
+		Paxos:     []*PaxosRound{{Conf: bp.ID().Ptr(), Rnd: 5, Val: &CV{Rnd: 5, Val: bp}}},
+		Rounds:    []*SSRRound{{Conf: bp.ID().Ptr(), Rnd: 1, Proposed: []*Blueprint{bp, bp}}},
+	}
+	data, err := proto1.Marshal(sn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Snapshot)
+	if err = proto1.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Algorithm != "cons" || got.Uptime != 42 || got.CurC.Value() != bp.ID() || got.Writer != 2 || !got.Cur.Equals(bp) {
+		t.Fatalf("Unmarshal returned %v, expected %v.", got, sn)
+	}
+	if len(got.Paxos) != 1 || got.Paxos[0].Conf.Value() != bp.ID() || got.Paxos[0].Rnd != 5 || !got.Paxos[0].Val.Val.Equals(bp) {
+		t.Errorf("Unmarshal returned Paxos %v, expected %v.", got.Paxos, sn.Paxos)
+	}
+	if len(got.Rounds) != 1 || len(got.Rounds[0].Proposed) != 2 || got.Rounds[0].Committed != nil {
+		t.Errorf("Unmarshal returned Rounds %v, expected %v.", got.Rounds, sn.Rounds)
+	}
+}
@@ -1,5 +1,12 @@
 package proto
 
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
 func Union(A, B []int) (C []int) {
 	return union(A, B)
 }
@@ -82,44 +89,66 @@ func (bp *Blueprint) Merge(blpr *Blueprint) (mbp *Blueprint) {
 	mbp = new(Blueprint)
 	mbp.Nodes = make([]*Node, len(bp.Nodes))
 	for i, n := range bp.Nodes {
-		mbp.Nodes[i] = &Node{Id: n.Id, Version: n.Version}
+		mbp.Nodes[i] = n.copy()
 	}
 
 	for _, n := range blpr.Nodes {
 		found := false
-	for_blpr:
 		for _, node := range mbp.Nodes {
 			if n.Id == node.Id {
 				found = true
-				if n.Version >= node.Version {
-					node.Version = n.Version
-				} else {
-					break for_blpr
-				}
+				node.join(n)
+				break
 			}
 		}
 		if !found {
-			mbp.Nodes = append(mbp.Nodes, &Node{Id: n.Id, Version: n.Version})
+			mbp.Nodes = append(mbp.Nodes, n.copy())
 		}
 	}
 
+	// Within an epoch, the fault tolerance, quorum sizes and zone faults only
+	// grow. A new epoch may set them to anything.
 	switch {
 	case bp.Epoch > blpr.Epoch:
-		mbp.Epoch = bp.Epoch
-		mbp.FaultTolerance = bp.FaultTolerance
-	case blpr.Epoch > blpr.Epoch:
-		mbp.Epoch = blpr.Epoch
-		mbp.FaultTolerance = blpr.FaultTolerance
-	case bp.FaultTolerance > blpr.FaultTolerance:
-		mbp.Epoch = bp.Epoch
-		mbp.FaultTolerance = bp.FaultTolerance
+		mbp.setParams(bp)
+	case blpr.Epoch > bp.Epoch:
+		mbp.setParams(blpr)
 	default:
-		mbp.Epoch = blpr.Epoch
-		mbp.FaultTolerance = blpr.FaultTolerance
+		mbp.Epoch = bp.Epoch
+		mbp.FaultTolerance = maxUint32(bp.FaultTolerance, blpr.FaultTolerance)
+		mbp.ReadQuorumSize = maxUint32(bp.ReadQuorumSize, blpr.ReadQuorumSize)
+		mbp.WriteQuorumSize = maxUint32(bp.WriteQuorumSize, blpr.WriteQuorumSize)
+		mbp.ZoneFaults = maxUint32(bp.ZoneFaults, blpr.ZoneFaults)
 	}
 	return mbp
 }
 
+// setParams sets the epoch, fault tolerance, quorum sizes and zone faults of
+// bp to those of from.
+func (bp *Blueprint) setParams(from *Blueprint) {
+	bp.Epoch = from.Epoch
+	bp.FaultTolerance = from.FaultTolerance
+	bp.ReadQuorumSize = from.ReadQuorumSize
+	bp.WriteQuorumSize = from.WriteQuorumSize
+	bp.ZoneFaults = from.ZoneFaults
+}
+
+// paramsLeq returns true, if the fault tolerance, quorum sizes and zone
+// faults of a are not larger than those of b.
+func (a *Blueprint) paramsLeq(b *Blueprint) bool {
+	return a.FaultTolerance <= b.FaultTolerance &&
+		a.ReadQuorumSize <= b.ReadQuorumSize &&
+		a.WriteQuorumSize <= b.WriteQuorumSize &&
+		a.ZoneFaults <= b.ZoneFaults
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 // a.Compare b = 1 <=> a <= b
 // a.Compare b = -1 <=> b < a
 // a.Compare b = 0 <=> !(b <= a) && !(a <= b)
@@ -138,73 +167,86 @@ func (a *Blueprint) Compare(b *Blueprint) int {
 		aleqb = false
 	case b.Epoch > a.Epoch:
 		bleqa = false
-	case a.FaultTolerance > b.FaultTolerance:
-		aleqb = false
-	case b.FaultTolerance > a.FaultTolerance:
-		bleqa = false
+	default:
+		aleqb = a.paramsLeq(b)
+		bleqa = b.paramsLeq(a)
 	}
 
-	if len(a.Nodes) < len(b.Nodes) {
-		bleqa = false
-	}
-	if len(b.Nodes) < len(a.Nodes) {
-		aleqb = false
-	}
+	aleqb = aleqb && a.nodesLeq(b)
+	bleqa = bleqa && b.nodesLeq(a)
 
+	if !aleqb && !bleqa {
+		return 0
+	}
 	if aleqb {
-	for_a:
-		for _, na := range a.Nodes {
-			found := false
-		for_b:
-			for _, nb := range b.Nodes {
-				if na.Id == nb.Id {
-					found = true
-					if na.Version > nb.Version {
-						aleqb = false
-						break for_a
-					}
-					if na.Version < nb.Version {
-						bleqa = false
-					}
-					break for_b
-				}
-			}
-			if !found {
-				aleqb = false
-				break for_a
-			}
-		}
+		return 1
 	}
+	return -1
+}
 
-	if bleqa {
-	for_B:
+// nodesLeq returns true, if every node of a is in b, in the same or a later
+// state.
+func (a *Blueprint) nodesLeq(b *Blueprint) bool {
+	if len(a.Nodes) > len(b.Nodes) {
+		return false
+	}
+for_a:
+	for _, na := range a.Nodes {
 		for _, nb := range b.Nodes {
-			found := false
-		for_A:
-			for _, na := range a.Nodes {
-				if nb.Id == na.Id {
-					found = true
-					if nb.Version > na.Version {
-						bleqa = false
-						break for_B
-					}
-					break for_A
+			if na.Id == nb.Id {
+				if !na.leq(nb) {
+					return false
 				}
-			}
-			if !found {
-				bleqa = false
-				break for_B
+				continue for_a
 			}
 		}
+		return false
 	}
+	return true
+}
 
-	if !aleqb && !bleqa {
-		return 0
-	}
-	if aleqb {
-		return 1
+// leq returns true, if m is the same or a later state of the node than n.
+// A later version is a later state. At the same version, the conflict state
+// is later than all others, which are incomparable if they differ, e.g. after
+// concurrent SetWeight or SetZone calls.
+func (n *Node) leq(m *Node) bool {
+	if n.Version != m.Version {
+		return n.Version < m.Version
+	}
+	return m.Conflict || n.same(m)
+}
+
+func (n *Node) same(m *Node) bool {
+	return n.Weight == m.Weight && n.Zone == m.Zone && n.Conflict == m.Conflict
+}
+
+// join sets n to the least state of the node, that is the same as or later
+// than both n and m. For incomparable states, this is the conflict state of
+// their version: Concurrent weight and zone changes are both rejected, the
+// node has weight 1 and no zone until the next SetWeight or SetZone. Unlike
+// picking one of the changes, this does not depend on the order of merges.
+func (n *Node) join(m *Node) {
+	switch {
+	case m.leq(n):
+	case n.leq(m):
+		*n = *m.copy()
+	default:
+		n.Weight, n.Zone, n.Conflict = 0, "", true
 	}
-	return -1
+}
+
+// rank counts the states up to n in the order of leq: Two per version, for
+// the states of that version, and their conflict state.
+func (n *Node) rank() uint64 {
+	r := 2 * (uint64(n.Version) + 1)
+	if n.Conflict {
+		r++
+	}
+	return r
+}
+
+func (n *Node) copy() *Node {
+	return &Node{Id: n.Id, Version: n.Version, Weight: n.Weight, Zone: n.Zone, Conflict: n.Conflict}
 }
 
 func (a *Blueprint) Equals(b *Blueprint) bool {
@@ -223,6 +265,12 @@ func (a *Blueprint) Equals(b *Blueprint) bool {
 	if a.FaultTolerance != b.FaultTolerance {
 		return false
 	}
+	if a.ReadQuorumSize != b.ReadQuorumSize || a.WriteQuorumSize != b.WriteQuorumSize {
+		return false
+	}
+	if a.ZoneFaults != b.ZoneFaults {
+		return false
+	}
 
 	if len(a.Nodes) != len(b.Nodes) {
 		return false
@@ -232,7 +280,7 @@ for_a:
 	for _, na := range a.Nodes {
 		for _, nb := range b.Nodes {
 			if na.Id == nb.Id {
-				if na.Version != nb.Version {
+				if na.Version != nb.Version || !na.same(nb) {
 					return false
 				}
 				continue for_a
@@ -244,33 +292,150 @@ for_a:
 	return true
 }
 
-// See Ids.
-func (bp *Blueprint) Len() int {
+// Order encodes the position of bp within its epoch, in the order of learned
+// blueprints. Together with the Epoch, it is the first part of the
+// configuration's ID, see ID and ConfID.Newer. If bp is smaller than blpr
+// (bp.Compare(blpr) == 1 and not equal) and in the same epoch, then
+// bp.Order() < blpr.Order(). So blueprints learned in a lattice agreement,
+// which are all comparable, have distinct (Epoch, Order) pairs.
+//
+// Order is FaultTolerance + ReadQuorumSize + WriteQuorumSize + ZoneFaults +
+// Σ rank over the nodes. Within an epoch, a larger blueprint has at least the
+// same FaultTolerance, quorum sizes, zone faults and node states, and
+// something more. The rank of a node is at least 2, so adding a node with
+// version 0 counts. See Ids. The epoch is compared first, and not added in,
+// so no sum can outweigh it.
+//
+// A weight or zone change bumps the version by 2, see SetWeight and SetZone.
+// Two blueprints that gave the same node different weights or zones from the
+// same version have the same Order, but they are incomparable, and their
+// Merge has the node in the conflict state, which ranks one higher, see
+// Node.join.
+func (bp *Blueprint) Order() uint64 {
 	if bp == nil {
 		return 0
 	}
 
-	if bp.FaultTolerance > uint32(15) {
-		panic("Specified Fault tolerance larger than 15. Len nor correct for such values.")
+	sum := uint64(bp.FaultTolerance)
+	sum += uint64(bp.ReadQuorumSize) + uint64(bp.WriteQuorumSize)
+	sum += uint64(bp.ZoneFaults)
+	for _, n := range bp.Nodes {
+		sum += n.rank()
 	}
+	return sum
+}
 
-	sum := uint32(0)
-	for _, n := range bp.Nodes {
-		sum = sum + n.Version + 1
-		// +1 necessary to acchieve, that adding one id with version 0 results in increased length.
+// ID identifies the configuration bp by its Epoch, Order and Digest.
+// Different blueprints may have the same Epoch and Order, e.g. {1:v0, 2:v1}
+// and {1:v1, 2:v0}, but not the same ID: its Digest is taken from the first 8
+// bytes of a SHA-256 over the nodes, sorted by id, the FaultTolerance and the
+// Epoch. Node weights, zones and conflicts,
+// quorum sizes and zone faults are only included if set, so blueprints
+// without them keep their IDs. The nil blueprint has the zero ID.
+func (bp *Blueprint) ID() ConfID {
+	if bp == nil {
+		return ConfID{}
+	}
+
+	nodes := make([]*Node, len(bp.Nodes))
+	copy(nodes, bp.Nodes)
+	sort.Sort(byID(nodes))
+
+	buf := make([]byte, 0, 8*len(nodes)+8)
+	for _, n := range nodes {
+		buf = appendUint32(buf, n.Id)
+		buf = appendUint32(buf, n.Version)
+		if n.Weight != 0 {
+			buf = appendUint32(buf, n.Weight)
+		}
+		if n.Zone != "" {
+			buf = appendUint32(buf, uint32(len(n.Zone)))
+			buf = append(buf, n.Zone...)
+		}
+		if n.Conflict {
+			buf = append(buf, 1)
+		}
+	}
+	buf = appendUint32(buf, bp.FaultTolerance)
+	buf = appendUint32(buf, bp.Epoch)
+	if bp.ReadQuorumSize != 0 || bp.WriteQuorumSize != 0 {
+		buf = appendUint32(buf, bp.ReadQuorumSize)
+		buf = appendUint32(buf, bp.WriteQuorumSize)
+	}
+	if bp.ZoneFaults != 0 {
+		buf = appendUint32(buf, bp.ZoneFaults)
+	}
+	sum := sha256.Sum256(buf)
+
+	return ConfID{Epoch: bp.Epoch, Order: bp.Order(), Digest: binary.BigEndian.Uint64(sum[:8])}
+}
+
+// position returns the ID of bp without the Digest.
+func (bp *Blueprint) position() ConfID {
+	if bp == nil {
+		return ConfID{}
 	}
+	return ConfID{Epoch: bp.Epoch, Order: bp.Order()}
+}
 
-	sum += bp.Epoch * 16
-	sum += bp.FaultTolerance
+// Newer returns true, if c follows d in the order of learned blueprints: It
+// is in a later epoch, or in the same epoch with a larger Order. Different
+// configurations in the same epoch with the same Order are incomparable.
+func (c ConfID) Newer(d ConfID) bool {
+	if c.Epoch != d.Epoch {
+		return c.Epoch > d.Epoch
+	}
+	return c.Order > d.Order
+}
 
-	return int(sum)
+// Less orders ids by Epoch, Order and Digest. It is a total order, that
+// agrees with Newer.
+func (c ConfID) Less(d ConfID) bool {
+	switch {
+	case c.Epoch != d.Epoch:
+		return c.Epoch < d.Epoch
+	case c.Order != d.Order:
+		return c.Order < d.Order
+	}
+	return c.Digest < d.Digest
 }
 
+// Value returns the id c points to, or the zero id if c is nil. The messages
+// marshaled by reflection, e.g. in cas.proto, hold ids by pointer.
+func (c *ConfID) Value() ConfID {
+	if c == nil {
+		return ConfID{}
+	}
+	return *c
+}
+
+// Ptr returns a pointer to a copy of c, to put it in such a message.
+func (c ConfID) Ptr() *ConfID {
+	return &c
+}
+
+type byID []*Node
+
+func (ns byID) Len() int           { return len(ns) }
+func (ns byID) Less(i, j int) bool { return ns[i].Id < ns[j].Id }
+func (ns byID) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
+
+func appendUint32(b []byte, x uint32) []byte {
+	return append(b, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
+// LearnedCompare orders blueprints by their ID: by Epoch and Order, and by
+// Digest if those are equal, see ConfID.Less. It returns 0 only for the same
+// configuration.
 func (bp *Blueprint) LearnedCompare(blpr *Blueprint) int {
-	if bp.Len() < blpr.Len() {
+	a, b := bp.position(), blpr.position()
+	if a == b {
+		a, b = bp.ID(), blpr.ID()
+	}
+	if a.Less(b) {
 		return 1
 	}
-	if bp.Len() > blpr.Len() {
+	if b.Less(a) {
 		return -1
 	}
 
@@ -278,7 +443,7 @@ func (bp *Blueprint) LearnedCompare(blpr *Blueprint) int {
 }
 
 func (bp *Blueprint) LearnedEquals(blpr *Blueprint) bool {
-	return bp.Len() == blpr.Len()
+	return bp.LearnedCompare(blpr) == 0
 }
 
 // Oups: Nodes with even version are part of the configuration, those with odd
@@ -327,21 +492,290 @@ func (bp *Blueprint) Rem(id uint32) bool {
 	return false
 }
 
+// IsRemoved returns true, if the node with id was removed in bp.
+func (bp *Blueprint) IsRemoved(id uint32) bool {
+	if bp == nil {
+		return false
+	}
+	for _, n := range bp.Nodes {
+		if n.Id == id {
+			return n.Version%2 == 1
+		}
+	}
+	return false
+}
+
+// Removed returns the ids of the nodes in old, that were removed in bp.
+func (bp *Blueprint) Removed(old *Blueprint) []uint32 {
+	var ids []uint32
+	for _, id := range old.Ids() {
+		if bp.IsRemoved(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// SetWeight gives the node with id w votes. It bumps the version by 2, so the
+// node stays in or out of the configuration, and Merge and Compare see the
+// change like an Add or Rem. It ends a conflict, see Node.join. Returns true,
+// if the weight was changed, false, if the node is not present or already has
+// weight w. Weight 0 is taken as 1.
+func (bp *Blueprint) SetWeight(id, w uint32) bool {
+	if w == 0 {
+		w = 1
+	}
+	for _, n := range bp.Nodes {
+		if n.Id == id {
+			if n.Version%2 == 1 || !n.Conflict && n.votes() == int(w) {
+				return false
+			}
+			n.Version += 2
+			n.Weight = w
+			n.Conflict = false
+			return true
+		}
+	}
+	return false
+}
+
+// votes returns the weight of n. Nodes without a weight have one vote.
+func (n *Node) votes() int {
+	if n.Weight == 0 {
+		return 1
+	}
+	return int(n.Weight)
+}
+
+// Weight returns the weight of the node with id, or 0 if it is not in bp.
+func (bp *Blueprint) Weight(id uint32) int {
+	if bp == nil {
+		return 0
+	}
+	for _, n := range bp.Nodes {
+		if n.Id == id && n.Version%2 == 0 {
+			return n.votes()
+		}
+	}
+	return 0
+}
+
+// Weights returns the weights of the nodes in bp, in the order of Ids.
+func (bp *Blueprint) Weights() []int {
+	if bp == nil {
+		return nil
+	}
+	ws := make([]int, 0, len(bp.Nodes))
+	for _, n := range bp.Nodes {
+		if n.Version%2 == 0 {
+			ws = append(ws, n.votes())
+		}
+	}
+	return ws
+}
+
+// TotalWeight returns the sum of the weights of the nodes in bp.
+func (bp *Blueprint) TotalWeight() int {
+	w := 0
+	for _, v := range bp.Weights() {
+		w += v
+	}
+	return w
+}
+
+// Quorum returns the weight of a write quorum in bp. Without weights, votes
+// are nodes. If WriteQuorumSize is set, it is the size of a write quorum, but
+// at most all votes. Otherwise it is a majority of the votes, or all but
+// FaultTolerance votes, whichever is larger, and if ReadQuorumSize is set,
+// large enough to intersect every read quorum.
 func (bp *Blueprint) Quorum() int {
-	n := len(bp.Ids())
-	if q := n/2 + 1; q >= n-int(bp.FaultTolerance) {
-		return q
+	n := bp.TotalWeight()
+	if bp.WriteQuorumSize != 0 {
+		return minInt(int(bp.WriteQuorumSize), n)
+	}
+	q := n/2 + 1
+	if q < n-int(bp.FaultTolerance) {
+		q = n - int(bp.FaultTolerance)
+	}
+	if bp.ReadQuorumSize != 0 && q < n-int(bp.ReadQuorumSize)+1 {
+		q = n - int(bp.ReadQuorumSize) + 1
+	}
+	return q
+}
+
+// ReadQuorum returns the weight of a read quorum in bp. It is ReadQuorumSize,
+// if set, but never less than needed to intersect every write quorum, so
+// |R|+|W| > n also holds after nodes were added.
+func (bp *Blueprint) ReadQuorum() int {
+	n := bp.TotalWeight()
+	rq := n - bp.Quorum() + 1
+	if r := minInt(int(bp.ReadQuorumSize), n); r > rq {
+		return r
+	}
+	return rq
+}
+
+// MaxQuorum returns the larger of Quorum and ReadQuorum, the weight needed by
+// calls that both read and write.
+func (bp *Blueprint) MaxQuorum() int {
+	q, rq := bp.Quorum(), bp.ReadQuorum()
+	if q < rq {
+		return rq
+	}
+	return q
+}
+
+// SetQuorums sets the read and write quorum sizes of bp, for a
+// reconfiguration to bp. 0 leaves a size to be derived, see Quorum and
+// ReadQuorum. It fails, if the sizes do not intersect, r+w <= TotalWeight(),
+// or are larger than TotalWeight(). If a size shrinks, SetQuorums starts a new
+// epoch, since within an epoch sizes only grow, see Merge.
+func (bp *Blueprint) SetQuorums(r, w uint32) error {
+	n := bp.TotalWeight()
+	if int(r) > n || int(w) > n {
+		return fmt.Errorf("quorum sizes %d and %d exceed the total weight %d", r, w, n)
+	}
+	if r != 0 && w != 0 && int(r+w) <= n {
+		return fmt.Errorf("quorum sizes %d and %d do not intersect, need more than %d", r, w, n)
+	}
+	if r < bp.ReadQuorumSize || w < bp.WriteQuorumSize {
+		bp.Epoch++
+	}
+	bp.ReadQuorumSize = r
+	bp.WriteQuorumSize = w
+	return nil
+}
+
+// SetZone places the node with id in zone. Like SetWeight, it bumps the
+// version by 2. Returns true, if the zone was changed, false, if the node is
+// not present or already in zone.
+func (bp *Blueprint) SetZone(id uint32, zone string) bool {
+	for _, n := range bp.Nodes {
+		if n.Id == id {
+			if n.Version%2 == 1 || !n.Conflict && n.Zone == zone {
+				return false
+			}
+			n.Version += 2
+			n.Zone = zone
+			n.Conflict = false
+			return true
+		}
+	}
+	return false
+}
+
+// Zone returns the zone of the node with id, or "" if it is not in bp.
+func (bp *Blueprint) Zone(id uint32) string {
+	if bp == nil {
+		return ""
+	}
+	for _, n := range bp.Nodes {
+		if n.Id == id && n.Version%2 == 0 {
+			return n.Zone
+		}
+	}
+	return ""
+}
+
+// Zones returns the zones of the nodes in bp, in the order of Ids. Nodes
+// without a zone are all in the zone "".
+func (bp *Blueprint) Zones() []string {
+	if bp == nil {
+		return nil
+	}
+	zs := make([]string, 0, len(bp.Nodes))
+	for _, n := range bp.Nodes {
+		if n.Version%2 == 0 {
+			zs = append(zs, n.Zone)
+		}
 	}
-	return n - int(bp.FaultTolerance)
+	return zs
+}
+
+// ZoneSpan returns the number of zones the replies to a write must come
+// from, so the write outlives the loss of ZoneFaults zones. It is 0, if bp
+// has no zone rule.
+func (bp *Blueprint) ZoneSpan() int {
+	if bp == nil || bp.ZoneFaults == 0 {
+		return 0
+	}
+	return int(bp.ZoneFaults) + 1
+}
+
+// SetZoneFaults sets the number of zones bp must tolerate the loss of. If
+// it shrinks, SetZoneFaults starts a new epoch, see SetQuorums. Use
+// CheckZones to see whether bp follows the rule.
+func (bp *Blueprint) SetZoneFaults(k uint32) {
+	if k < bp.ZoneFaults {
+		bp.Epoch++
+	}
+	bp.ZoneFaults = k
+}
+
+// CheckZones returns an error, if bp breaks its zone rule: Losing any
+// ZoneFaults zones must leave both the weight of a MaxQuorum, and enough
+// zones for a write to span ZoneSpan of them. That needs 2·ZoneFaults+1
+// zones.
+func (bp *Blueprint) CheckZones() error {
+	if bp == nil || bp.ZoneFaults == 0 {
+		return nil
+	}
+	k := int(bp.ZoneFaults)
+	zw := make(map[string]int)
+	for _, n := range bp.Nodes {
+		if n.Version%2 == 0 {
+			zw[n.Zone] += n.votes()
+		}
+	}
+	if len(zw) < 2*k+1 {
+		return fmt.Errorf("nodes in %d zones, need %d to tolerate the loss of %d", len(zw), 2*k+1, k)
+	}
+
+	// The worst case is losing the heaviest zones.
+	ws := make([]int, 0, len(zw))
+	for _, w := range zw {
+		ws = append(ws, w)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ws)))
+	left := bp.TotalWeight()
+	for _, w := range ws[:k] {
+		left -= w
+	}
+	if q := bp.MaxQuorum(); left < q {
+		return fmt.Errorf("losing %d zones leaves weight %d, need %d", k, left, q)
+	}
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// InitBlueprint returns the initial configuration of the servers with ids.
+// It tolerates the failure of a minority, so its quorums are majorities.
+// Servers and clients must use it to agree on the id of the configuration.
+func InitBlueprint(ids []uint32) *Blueprint {
+	bp := &Blueprint{FaultTolerance: uint32((len(ids) - 1) / 2)}
+	bp.Nodes = make([]*Node, 0, len(ids))
+	for _, id := range ids {
+		bp.Nodes = append(bp.Nodes, &Node{Id: id})
+	}
+	return bp
 }
 
 func (bp *Blueprint) Copy() *Blueprint {
 	b := new(Blueprint)
 	b.Epoch = bp.Epoch
 	b.FaultTolerance = bp.FaultTolerance
+	b.ReadQuorumSize = bp.ReadQuorumSize
+	b.WriteQuorumSize = bp.WriteQuorumSize
+	b.ZoneFaults = bp.ZoneFaults
 	b.Nodes = make([]*Node, len(bp.Nodes))
 	for i, n := range bp.Nodes {
-		b.Nodes[i] = &Node{n.Id, n.Version}
+		b.Nodes[i] = n.copy()
 	}
 	return b
 }
@@ -110,43 +110,43 @@ var four = uint32(4)
 var five = uint32(5)
 var six = uint32(6)
 
-var n00 = &Node{zero, zero}
-var n10 = &Node{one, zero}
-var n20 = &Node{two, zero}
-var n30 = &Node{tre, zero}
-var n40 = &Node{four, zero}
-var n50 = &Node{five, zero}
-var n60 = &Node{six, zero}
-
-var n11 = &Node{one, one}
-var n12 = &Node{one, two}
-var n22 = &Node{two, two}
-var n32 = &Node{tre, two}
-var n33 = &Node{tre, tre}
-
-var b1 = &Blueprint{[]*Node{n11}, one, one}
-var b2 = &Blueprint{[]*Node{n22}, two, one}
-var b12 = &Blueprint{[]*Node{n11, n22}, two, one}
-var b22 = &Blueprint{[]*Node{n11, n22}, two, two}
-var b23 = &Blueprint{[]*Node{n11, n22}, tre, two}
-
-var b12x = &Blueprint{[]*Node{n12, n22}, two, one}
-var b123 = &Blueprint{[]*Node{n12, n22, n32}, two, one}
-var bx = &Blueprint{[]*Node{n11, n33}, tre, two}
-var by = &Blueprint{[]*Node{n12, n32}, two, one}
+var n00 = &Node{Id: zero, Version: zero}
+var n10 = &Node{Id: one, Version: zero}
+var n20 = &Node{Id: two, Version: zero}
+var n30 = &Node{Id: tre, Version: zero}
+var n40 = &Node{Id: four, Version: zero}
+var n50 = &Node{Id: five, Version: zero}
+var n60 = &Node{Id: six, Version: zero}
+
+var n11 = &Node{Id: one, Version: one}
+var n12 = &Node{Id: one, Version: two}
+var n22 = &Node{Id: two, Version: two}
+var n32 = &Node{Id: tre, Version: two}
+var n33 = &Node{Id: tre, Version: tre}
+
+var b1 = &Blueprint{Nodes: []*Node{n11}, FaultTolerance: one, Epoch: one}
+var b2 = &Blueprint{Nodes: []*Node{n22}, FaultTolerance: two, Epoch: one}
+var b12 = &Blueprint{Nodes: []*Node{n11, n22}, FaultTolerance: two, Epoch: one}
+var b22 = &Blueprint{Nodes: []*Node{n11, n22}, FaultTolerance: two, Epoch: two}
+var b23 = &Blueprint{Nodes: []*Node{n11, n22}, FaultTolerance: tre, Epoch: two}
+
+var b12x = &Blueprint{Nodes: []*Node{n12, n22}, FaultTolerance: two, Epoch: one}
+var b123 = &Blueprint{Nodes: []*Node{n12, n22, n32}, FaultTolerance: two, Epoch: one}
+var bx = &Blueprint{Nodes: []*Node{n11, n33}, FaultTolerance: tre, Epoch: two}
+var by = &Blueprint{Nodes: []*Node{n12, n32}, FaultTolerance: two, Epoch: one}
 var b0 *Blueprint
 
-var q0 = &Blueprint{[]*Node{n00, n10, n20, n30, n40, n50, n60}, zero, zero}
-var q1 = &Blueprint{[]*Node{n00, n10, n20, n30, n40, n50, n60}, one, zero}
-var q2 = &Blueprint{[]*Node{n00, n10, n20, n30, n40, n50, n60}, two, zero}
-var q3 = &Blueprint{[]*Node{n00, n10, n20, n30, n40, n50, n60}, tre, zero}
-var q5 = &Blueprint{[]*Node{n00, n10, n20, n30, n40, n50, n60}, five, zero}
+var q0 = &Blueprint{Nodes: []*Node{n00, n10, n20, n30, n40, n50, n60}, FaultTolerance: zero, Epoch: zero}
+var q1 = &Blueprint{Nodes: []*Node{n00, n10, n20, n30, n40, n50, n60}, FaultTolerance: one, Epoch: zero}
+var q2 = &Blueprint{Nodes: []*Node{n00, n10, n20, n30, n40, n50, n60}, FaultTolerance: two, Epoch: zero}
+var q3 = &Blueprint{Nodes: []*Node{n00, n10, n20, n30, n40, n50, n60}, FaultTolerance: tre, Epoch: zero}
+var q5 = &Blueprint{Nodes: []*Node{n00, n10, n20, n30, n40, n50, n60}, FaultTolerance: five, Epoch: zero}
 
-var qx0 = &Blueprint{[]*Node{n00, n11, n20, n30, n40, n50, n60}, zero, zero}
-var qx1 = &Blueprint{[]*Node{n00, n11, n20, n30, n40, n50, n60}, one, zero}
-var qx2 = &Blueprint{[]*Node{n00, n11, n20, n30, n40, n50, n60}, two, zero}
-var qx3 = &Blueprint{[]*Node{n00, n11, n20, n30, n40, n50, n60}, tre, zero}
-var qx5 = &Blueprint{[]*Node{n00, n11, n20, n30, n40, n50, n60}, five, zero}
+var qx0 = &Blueprint{Nodes: []*Node{n00, n11, n20, n30, n40, n50, n60}, FaultTolerance: zero, Epoch: zero}
+var qx1 = &Blueprint{Nodes: []*Node{n00, n11, n20, n30, n40, n50, n60}, FaultTolerance: one, Epoch: zero}
+var qx2 = &Blueprint{Nodes: []*Node{n00, n11, n20, n30, n40, n50, n60}, FaultTolerance: two, Epoch: zero}
+var qx3 = &Blueprint{Nodes: []*Node{n00, n11, n20, n30, n40, n50, n60}, FaultTolerance: tre, Epoch: zero}
+var qx5 = &Blueprint{Nodes: []*Node{n00, n11, n20, n30, n40, n50, n60}, FaultTolerance: five, Epoch: zero}
 
 func TestCopy(t *testing.T) {
 	cop := b123.Copy()
@@ -192,6 +192,250 @@ func TestQuorum(t *testing.T) {
 	}
 }
 
+func TestInitBlueprint(t *testing.T) {
+	for n := 1; n <= 40; n++ {
+		ids := make([]uint32, n)
+		for i := range ids {
+			ids[i] = uint32(i + 1)
+		}
+		bp := InitBlueprint(ids)
+		if len(bp.Ids()) != n || bp.Quorum() != n/2+1 || bp.ReadQuorum() != n-n/2 {
+			t.Errorf("Initial blueprint of %d servers has %d nodes and quorums %d and %d.", n, len(bp.Ids()), bp.Quorum(), bp.ReadQuorum())
+		}
+		if bp.ID() != InitBlueprint(ids).ID() {
+			t.Errorf("Initial blueprints of %d servers have different ids.", n)
+		}
+	}
+}
+
+func TestWeights(t *testing.T) {
+	// Node 1 has 3 of 5 votes, and is a quorum on its own.
+	w := &Blueprint{Nodes: []*Node{{Id: 1, Weight: 3}, {Id: 2}, {Id: 3}, {Id: 4, Version: 1, Weight: 7}}, FaultTolerance: 2}
+	if w.TotalWeight() != 5 || w.Weight(1) != 3 || w.Weight(2) != 1 || w.Weight(4) != 0 {
+		t.Errorf("Unexpected weights %v of %d.", w.Weights(), w.TotalWeight())
+	}
+	if w.Quorum() != 3 || w.ReadQuorum() != 3 {
+		t.Errorf("Got quorums %d and %d, expected 3 and 3.", w.Quorum(), w.ReadQuorum())
+	}
+
+	x := w.Copy()
+	if !x.SetWeight(2, 2) || x.SetWeight(2, 2) || x.SetWeight(4, 2) || x.SetWeight(5, 2) {
+		t.Error("SetWeight returned the wrong result.")
+	}
+	if x.Weight(2) != 2 || len(x.Ids()) != 3 || x.Quorum() != 4 {
+		t.Errorf("Unexpected blueprint %v after SetWeight.", x)
+	}
+
+	// A weight change is larger, like a version change.
+	if w.Compare(x) != 1 || x.Compare(w) != -1 || w.LearnedCompare(x) != 1 {
+		t.Error("Compare does not see the weight change.")
+	}
+	if !w.Merge(x).Equals(x) || !x.Merge(w).Equals(x) {
+		t.Error("Merge lost the weight change.")
+	}
+
+	// It composes with concurrent changes of other nodes.
+	y := w.Copy()
+	y.Rem(3)
+	m := x.Merge(y)
+	if x.Compare(y) != 0 || x.Compare(m) != 1 || y.Compare(m) != 1 {
+		t.Error("Unexpected Compare with a concurrent Rem.")
+	}
+	if m.Weight(2) != 2 || m.Weight(3) != 0 || m.TotalWeight() != 5 {
+		t.Errorf("Unexpected Merge %v with a concurrent Rem.", m)
+	}
+
+	// Concurrent weight changes of the same node are incomparable. Merge
+	// rejects both, until the next SetWeight.
+	z := w.Copy()
+	z.SetWeight(2, 5)
+	if x.Compare(z) != 0 || z.Compare(x) != 0 || x.ID() == z.ID() {
+		t.Error("Concurrent weight changes are comparable.")
+	}
+	m = x.Merge(z)
+	if !m.Equals(z.Merge(x)) || m.Weight(2) != 1 || !m.Nodes[1].Conflict {
+		t.Errorf("Unexpected Merge %v of concurrent weight changes.", m)
+	}
+	if n := m.Copy(); !n.SetWeight(2, 1) || n.Nodes[1].Conflict || m.Compare(n) != 1 {
+		t.Errorf("SetWeight did not end the conflict in %v.", n)
+	}
+	// LearnedCompare and Order agree with Compare.
+	for _, b := range []*Blueprint{x, z} {
+		if b.Compare(m) != 1 || b.LearnedCompare(m) != 1 || b.Order() >= m.Order() {
+			t.Errorf("Merge %v is not larger than %v.", m, b)
+		}
+	}
+}
+
+// TestMergeLattice checks, that Merge is a join for Compare, also for
+// concurrent weight and zone changes of the same node: It is commutative,
+// associative and idempotent, its result is larger than both blueprints, and
+// Order and LearnedCompare agree with Compare.
+func TestMergeLattice(t *testing.T) {
+	w := &Blueprint{Nodes: []*Node{{Id: 1}, {Id: 2}, {Id: 3}}, FaultTolerance: 1}
+	set := func(weight uint32, zone string) *Blueprint {
+		b := w.Copy()
+		if weight != 0 {
+			b.SetWeight(2, weight)
+		}
+		if zone != "" {
+			b.SetZone(2, zone)
+		}
+		return b
+	}
+	a, b, c := set(2, ""), set(3, ""), set(4, "")
+	z := set(0, "x")
+	later := a.Merge(b)
+	later.SetWeight(2, 5)
+	rem := w.Copy()
+	rem.Rem(2)
+	other := w.Copy()
+	other.SetWeight(3, 2)
+	bps := []*Blueprint{w, a, b, c, z, set(3, "y"), later, rem, other, a.Merge(other)}
+
+	if ab, bc := a.Merge(b).Merge(c), a.Merge(b.Merge(c)); !ab.Equals(bc) {
+		t.Errorf("(a⊔b)⊔c = %v, but a⊔(b⊔c) = %v.", ab, bc)
+	}
+
+	for _, x := range bps {
+		if !x.Merge(x).Equals(x) {
+			t.Errorf("Merge of %v with itself is %v.", x, x.Merge(x))
+		}
+		for _, y := range bps {
+			xy := x.Merge(y)
+			if !xy.Equals(y.Merge(x)) {
+				t.Errorf("%v ⊔ %v is %v, but %v the other way.", x, y, xy, y.Merge(x))
+			}
+			if x.Compare(xy) != 1 || y.Compare(xy) != 1 {
+				t.Errorf("%v ⊔ %v = %v is not larger than both.", x, y, xy)
+			}
+			if x.Compare(y) == 1 && !xy.Equals(y) {
+				t.Errorf("%v <= %v, but their Merge is %v.", x, y, xy)
+			}
+			if x.Compare(y) == 1 && !x.Equals(y) && (x.Order() >= y.Order() || x.LearnedCompare(y) != 1) {
+				t.Errorf("%v < %v, but Order or LearnedCompare disagree.", x, y)
+			}
+			for _, v := range bps {
+				if l, r := xy.Merge(v), x.Merge(y.Merge(v)); !l.Equals(r) {
+					t.Errorf("Merge of %v, %v and %v is not associative: %v and %v.", x, y, v, l, r)
+				}
+			}
+		}
+	}
+}
+
+func TestQuorumSizes(t *testing.T) {
+	b := &Blueprint{Nodes: []*Node{{Id: 1}, {Id: 2}, {Id: 3}, {Id: 4}, {Id: 5}}, FaultTolerance: 2}
+	if b.SetQuorums(2, 3) == nil || b.SetQuorums(6, 0) == nil {
+		t.Error("SetQuorums accepted invalid sizes.")
+	}
+	quorums := func(name string, bp *Blueprint, r, w int) {
+		if bp.ReadQuorum() != r || bp.Quorum() != w {
+			t.Errorf("%s: Got quorums %d and %d, expected %d and %d.", name, bp.ReadQuorum(), bp.Quorum(), r, w)
+		}
+	}
+	quorums("default", b, 3, 3)
+
+	r := b.Copy()
+	if err := r.SetQuorums(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	quorums("read one", r, 1, 5)
+	w := b.Copy()
+	if err := w.SetQuorums(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	quorums("write two", w, 4, 2)
+	rw := b.Copy()
+	if err := rw.SetQuorums(2, 4); err != nil {
+		t.Fatal(err)
+	}
+	quorums("both", rw, 2, 4)
+
+	// Larger sizes are a larger blueprint in the same epoch.
+	if r.Epoch != 0 || b.Compare(r) != 1 || b.LearnedCompare(r) != 1 || !b.Merge(r).Equals(r) {
+		t.Error("Compare does not see larger quorum sizes.")
+	}
+
+	// Concurrent changes merge to sizes that still intersect.
+	m := r.Merge(w)
+	if r.Compare(w) != 0 || r.Compare(m) != 1 || w.Compare(m) != 1 {
+		t.Error("Unexpected Compare with concurrent quorum sizes.")
+	}
+	quorums("merged", m, 4, 2)
+
+	// Smaller sizes need a new epoch.
+	s := r.Copy()
+	if err := s.SetQuorums(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if s.Epoch != 1 || r.Compare(s) != 1 || !r.Merge(s).Equals(s) {
+		t.Error("Smaller quorum sizes did not start a new epoch.")
+	}
+	quorums("reset", s, 3, 3)
+
+	// Added nodes do not break the intersection.
+	rw.Add(6)
+	rw.Add(7)
+	quorums("grown", rw, 4, 4)
+}
+
+func TestZones(t *testing.T) {
+	b := &Blueprint{Nodes: []*Node{{Id: 1}, {Id: 2}, {Id: 3}, {Id: 4}, {Id: 5}}, FaultTolerance: 2}
+	b.SetZoneFaults(1)
+	if b.CheckZones() == nil {
+		t.Error("Nodes in one zone do not tolerate the loss of a zone.")
+	}
+	for i, z := range []string{"a", "a", "b", "b", "c"} {
+		if !b.SetZone(uint32(i+1), z) {
+			t.Fatalf("SetZone did not change the zone of %d.", i+1)
+		}
+	}
+	if err := b.CheckZones(); err != nil {
+		t.Error(err)
+	}
+	if b.ZoneSpan() != 2 || b.Zone(5) != "c" || b.Nodes[0].Version != 2 {
+		t.Errorf("Unexpected zones in %v.", b)
+	}
+
+	// Moving the only node of c leaves two zones.
+	two := b.Copy()
+	two.SetZone(5, "a")
+	if two.CheckZones() == nil {
+		t.Error("Two zones tolerate the loss of one.")
+	}
+	if b.Compare(two) != 1 || b.ID() == two.ID() || !b.Merge(two).Equals(two) {
+		t.Error("Compare does not see a zone change.")
+	}
+
+	// Concurrent zone changes of the same node are incomparable. Merge
+	// rejects both, and LearnedCompare agrees.
+	other := b.Copy()
+	other.SetZone(5, "b")
+	m := two.Merge(other)
+	if two.Compare(other) != 0 || two.ID() == other.ID() || !m.Equals(other.Merge(two)) || m.Zone(5) != "" {
+		t.Errorf("Unexpected Merge %v of concurrent zone changes.", m)
+	}
+	for _, x := range []*Blueprint{two, other} {
+		if x.Compare(m) != 1 || x.LearnedCompare(m) != 1 || x.Order() >= m.Order() {
+			t.Errorf("Merge %v is not larger than %v.", m, x)
+		}
+	}
+
+	// Losing a, which holds most of the weight, leaves less than a quorum.
+	heavy := b.Copy()
+	heavy.SetWeight(1, 3)
+	if heavy.CheckZones() == nil {
+		t.Error("Losing the heaviest zone leaves a quorum.")
+	}
+
+	c := &Configuration{machines: []int{0, 1, 2, 3, 4}}
+	setSpec(c, &quorumSpec{zones: map[int]string{0: "a", 1: "a", 2: "b", 3: "b", 4: "c"}, zspan: 2})
+	if c.Spans([]int{0, 1}) || !c.Spans([]int{1, 2}) {
+		t.Error("Spans does not count zones.")
+	}
+}
+
 func TestIds(t *testing.T) {
 	if len(b2.Ids()) != 1 {
 		t.Error("Unexpected Ids")
@@ -252,30 +496,76 @@ func TestLearnedCompare(t *testing.T) {
 	}
 }
 
-// func TestLen(t *testing.T) {
-// 	if b2.Len() != 2+2+16 {
-// 		t.Error("Unexpected Length")
-// 	}
-// 	if b12.Len() != 1+2+2+16 {
-// 		t.Error("Unexpected Length")
-// 	}
-// 	if b12x.Len() != 2+2+2+16 {
-// 		t.Error("Unexpected Length")
-// 	}
-// 	if b123.Len() != 2+2+2+2+16 {
-// 		t.Error("Unexpected Length")
-// 	}
-// 	if bx.Len() != 1+3+3+16*2 {
-// 		t.Error("Unexpected Length")
-// 	}
-// 	if b0.Len() != 0 {
-// 		t.Error("Unexpected Length")
-// 	}
-// 	if by.Len() != 2+2+2+16 {
-// 		t.Error("Unexpected Length")
-// 	}
-//
-// }
+func TestOrder(t *testing.T) {
+	if b0.Order() != 0 {
+		t.Error("Unexpected Order")
+	}
+	if b12.Order() != 2+2*(1+1)+2*(2+1) || b12.ID().Epoch != 1 {
+		t.Error("Unexpected Order")
+	}
+
+	// Fault tolerances above 15 used to overflow into the epoch.
+	big := &Blueprint{Nodes: []*Node{{Id: 1}, {Id: 2}}, FaultTolerance: 40}
+	next := &Blueprint{Nodes: []*Node{{Id: 1}, {Id: 2}}, Epoch: 1}
+	if big.Compare(next) != 1 || big.LearnedCompare(next) != 1 {
+		t.Error("Order does not follow Compare for a larger epoch.")
+	}
+	more := big.Copy()
+	more.FaultTolerance = 41
+	if big.LearnedCompare(more) != 1 || !big.Merge(more).LearnedEquals(more) {
+		t.Error("Order does not follow Compare for a larger fault tolerance.")
+	}
+
+	// No sum within an epoch outweighs a larger epoch.
+	max := ^uint32(0)
+	huge := &Blueprint{FaultTolerance: max, ReadQuorumSize: max, WriteQuorumSize: max, ZoneFaults: max}
+	for i := uint32(1); i <= 4; i++ {
+		huge.Nodes = append(huge.Nodes, &Node{Id: i, Version: max - 1, Conflict: true})
+	}
+	if huge.Order() <= next.Order() || huge.LearnedCompare(next) != 1 || !next.ID().Newer(huge.ID()) {
+		t.Error("A large blueprint in an earlier epoch is ordered after a later epoch.")
+	}
+}
+
+func TestID(t *testing.T) {
+	// Incomparable blueprints with the same order.
+	x := &Blueprint{Nodes: []*Node{{Id: 1, Version: 0}, {Id: 2, Version: 1}}}
+	y := &Blueprint{Nodes: []*Node{{Id: 1, Version: 1}, {Id: 2, Version: 0}}}
+	if x.Order() != y.Order() {
+		t.Fatalf("Expected the same order, got %d and %d.", x.Order(), y.Order())
+	}
+	if x.ID() == y.ID() {
+		t.Errorf("Different blueprints got the same id %v.", x.ID())
+	}
+	if x.LearnedEquals(y) || x.LearnedCompare(y) == 0 || x.LearnedCompare(y) != -y.LearnedCompare(x) {
+		t.Error("LearnedCompare does not tell apart different blueprints with the same order.")
+	}
+
+	// The id does not depend on the order of the nodes.
+	z := &Blueprint{Nodes: []*Node{{Id: 2, Version: 1}, {Id: 1, Version: 0}}}
+	if x.ID() != z.ID() || !x.LearnedEquals(z) {
+		t.Error("Same blueprint with reordered nodes got a different id.")
+	}
+	if b12.ID() != b12.Copy().ID() || b12.ID().Order != b12.Order() {
+		t.Error("Unexpected ID")
+	}
+	if b0.ID() != (ConfID{}) {
+		t.Error("Nil blueprint has non-zero id.")
+	}
+
+	c := &Conf{This: x.ID(), Cur: y.ID(), Key: "k"}
+	data, err := c.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Conf)
+	if err = got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.This != x.ID() || got.Cur != y.ID() || got.Key != "k" {
+		t.Errorf("Unmarshal returned %v, expected %v.", got, c)
+	}
+}
 
 func TestMerge(t *testing.T) {
 	if !b1.Merge(b2).Equals(b12) {
@@ -407,3 +697,20 @@ func TestAddRem(t *testing.T) {
 		t.Error("Wrong result from adding & removing")
 	}
 }
+
+func TestRemoved(t *testing.T) {
+	old := &Blueprint{Nodes: []*Node{{Id: one}, {Id: two}, {Id: tre, Version: 1}}}
+	cur := old.Copy()
+	cur.Rem(two)
+	cur.Add(4)
+
+	if !cur.IsRemoved(two) || !cur.IsRemoved(tre) || cur.IsRemoved(one) || cur.IsRemoved(4) {
+		t.Error("IsRemoved returned the wrong result.")
+	}
+	if rem := cur.Removed(old); len(rem) != 1 || rem[0] != two {
+		t.Errorf("Removed returned %v, expected [%d].", rem, two)
+	}
+	if rem := old.Removed(old); len(rem) != 0 {
+		t.Errorf("Removed returned %v for an unchanged blueprint.", rem)
+	}
+}
@@ -0,0 +1,342 @@
+// Code generated by protoc-gen-gogo.
+// source: cas.proto
+// DO NOT EDIT!
+
+package proto
+
+import proto1 "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto1.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type CasSlot struct {
+	Key   string `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
+	T     int32  `protobuf:"varint,2,opt,name=T,proto3" json:"T,omitempty"`
+	Rnd   uint64 `protobuf:"varint,3,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+	VRnd  uint64 `protobuf:"varint,4,opt,name=VRnd,proto3" json:"VRnd,omitempty"`
+	Val   *State `protobuf:"bytes,5,opt,name=Val" json:"Val,omitempty"`
+	Owner uint64 `protobuf:"varint,6,opt,name=Owner,proto3" json:"Owner,omitempty"`
+}
+
+func (m *CasSlot) Reset()         { *m = CasSlot{} }
+func (m *CasSlot) String() string { return proto1.CompactTextString(m) }
+func (*CasSlot) ProtoMessage()    {}
+
+func (m *CasSlot) GetVal() *State {
+	if m != nil {
+		return m.Val
+	}
+	return nil
+}
+
+type CasPrepare struct {
+	CurC *ConfID `protobuf:"bytes,1,opt,name=CurC" json:"CurC,omitempty"`
+	Key  string  `protobuf:"bytes,2,opt,name=Key,proto3" json:"Key,omitempty"`
+	T    int32   `protobuf:"varint,3,opt,name=T,proto3" json:"T,omitempty"`
+	Rnd  uint64  `protobuf:"varint,4,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+}
+
+func (m *CasPrepare) Reset()         { *m = CasPrepare{} }
+func (m *CasPrepare) String() string { return proto1.CompactTextString(m) }
+func (*CasPrepare) ProtoMessage()    {}
+
+func (m *CasPrepare) GetCurC() *ConfID {
+	if m != nil {
+		return m.CurC
+	}
+	return nil
+}
+
+type CasPromise struct {
+	Cur   *Blueprint   `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
+	Next  []*Blueprint `protobuf:"bytes,2,rep,name=Next" json:"Next,omitempty"`
+	Ok    bool         `protobuf:"varint,3,opt,name=Ok,proto3" json:"Ok,omitempty"`
+	Stale bool         `protobuf:"varint,4,opt,name=Stale,proto3" json:"Stale,omitempty"`
+	Rnd   uint64       `protobuf:"varint,5,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+	Slot  *CasSlot     `protobuf:"bytes,6,opt,name=Slot" json:"Slot,omitempty"`
+}
+
+func (m *CasPromise) Reset()         { *m = CasPromise{} }
+func (m *CasPromise) String() string { return proto1.CompactTextString(m) }
+func (*CasPromise) ProtoMessage()    {}
+
+func (m *CasPromise) GetCur() *Blueprint {
+	if m != nil {
+		return m.Cur
+	}
+	return nil
+}
+
+func (m *CasPromise) GetNext() []*Blueprint {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+func (m *CasPromise) GetSlot() *CasSlot {
+	if m != nil {
+		return m.Slot
+	}
+	return nil
+}
+
+type CasPropose struct {
+	CurC  *ConfID `protobuf:"bytes,1,opt,name=CurC" json:"CurC,omitempty"`
+	Key   string  `protobuf:"bytes,2,opt,name=Key,proto3" json:"Key,omitempty"`
+	T     int32   `protobuf:"varint,3,opt,name=T,proto3" json:"T,omitempty"`
+	Rnd   uint64  `protobuf:"varint,4,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+	Val   *State  `protobuf:"bytes,5,opt,name=Val" json:"Val,omitempty"`
+	Owner uint64  `protobuf:"varint,6,opt,name=Owner,proto3" json:"Owner,omitempty"`
+}
+
+func (m *CasPropose) Reset()         { *m = CasPropose{} }
+func (m *CasPropose) String() string { return proto1.CompactTextString(m) }
+func (*CasPropose) ProtoMessage()    {}
+
+func (m *CasPropose) GetCurC() *ConfID {
+	if m != nil {
+		return m.CurC
+	}
+	return nil
+}
+
+func (m *CasPropose) GetVal() *State {
+	if m != nil {
+		return m.Val
+	}
+	return nil
+}
+
+type CasLearn struct {
+	Cur   *Blueprint   `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
+	Next  []*Blueprint `protobuf:"bytes,2,rep,name=Next" json:"Next,omitempty"`
+	Ok    bool         `protobuf:"varint,3,opt,name=Ok,proto3" json:"Ok,omitempty"`
+	Stale bool         `protobuf:"varint,4,opt,name=Stale,proto3" json:"Stale,omitempty"`
+	Rnd   uint64       `protobuf:"varint,5,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+}
+
+func (m *CasLearn) Reset()         { *m = CasLearn{} }
+func (m *CasLearn) String() string { return proto1.CompactTextString(m) }
+func (*CasLearn) ProtoMessage()    {}
+
+func (m *CasLearn) GetCur() *Blueprint {
+	if m != nil {
+		return m.Cur
+	}
+	return nil
+}
+
+func (m *CasLearn) GetNext() []*Blueprint {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+type CasFreeze struct {
+	CurC *ConfID `protobuf:"bytes,1,opt,name=CurC" json:"CurC,omitempty"`
+}
+
+func (m *CasFreeze) Reset()         { *m = CasFreeze{} }
+func (m *CasFreeze) String() string { return proto1.CompactTextString(m) }
+func (*CasFreeze) ProtoMessage()    {}
+
+func (m *CasFreeze) GetCurC() *ConfID {
+	if m != nil {
+		return m.CurC
+	}
+	return nil
+}
+
+type CasSlots struct {
+	CurC  *ConfID    `protobuf:"bytes,1,opt,name=CurC" json:"CurC,omitempty"`
+	Slots []*CasSlot `protobuf:"bytes,2,rep,name=Slots" json:"Slots,omitempty"`
+}
+
+func (m *CasSlots) Reset()         { *m = CasSlots{} }
+func (m *CasSlots) String() string { return proto1.CompactTextString(m) }
+func (*CasSlots) ProtoMessage()    {}
+
+func (m *CasSlots) GetCurC() *ConfID {
+	if m != nil {
+		return m.CurC
+	}
+	return nil
+}
+
+func (m *CasSlots) GetSlots() []*CasSlot {
+	if m != nil {
+		return m.Slots
+	}
+	return nil
+}
+
+type CasInstalled struct {
+}
+
+func (m *CasInstalled) Reset()         { *m = CasInstalled{} }
+func (m *CasInstalled) String() string { return proto1.CompactTextString(m) }
+func (*CasInstalled) ProtoMessage()    {}
+
+func init() {
+	proto1.RegisterType((*CasSlot)(nil), "proto.CasSlot")
+	proto1.RegisterType((*CasPrepare)(nil), "proto.CasPrepare")
+	proto1.RegisterType((*CasPromise)(nil), "proto.CasPromise")
+	proto1.RegisterType((*CasPropose)(nil), "proto.CasPropose")
+	proto1.RegisterType((*CasLearn)(nil), "proto.CasLearn")
+	proto1.RegisterType((*CasFreeze)(nil), "proto.CasFreeze")
+	proto1.RegisterType((*CasSlots)(nil), "proto.CasSlots")
+	proto1.RegisterType((*CasInstalled)(nil), "proto.CasInstalled")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Cas service
+
+type CasClient interface {
+	CasPrepare(ctx context.Context, in *CasPrepare, opts ...grpc.CallOption) (*CasPromise, error)
+	CasAccept(ctx context.Context, in *CasPropose, opts ...grpc.CallOption) (*CasLearn, error)
+	CasFreeze(ctx context.Context, in *CasFreeze, opts ...grpc.CallOption) (*CasSlots, error)
+	CasInstall(ctx context.Context, in *CasSlots, opts ...grpc.CallOption) (*CasInstalled, error)
+}
+
+type casClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCasClient(cc *grpc.ClientConn) CasClient {
+	return &casClient{cc}
+}
+
+func (c *casClient) CasPrepare(ctx context.Context, in *CasPrepare, opts ...grpc.CallOption) (*CasPromise, error) {
+	out := new(CasPromise)
+	err := grpc.Invoke(ctx, "/proto.Cas/CasPrepare", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *casClient) CasAccept(ctx context.Context, in *CasPropose, opts ...grpc.CallOption) (*CasLearn, error) {
+	out := new(CasLearn)
+	err := grpc.Invoke(ctx, "/proto.Cas/CasAccept", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *casClient) CasFreeze(ctx context.Context, in *CasFreeze, opts ...grpc.CallOption) (*CasSlots, error) {
+	out := new(CasSlots)
+	err := grpc.Invoke(ctx, "/proto.Cas/CasFreeze", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *casClient) CasInstall(ctx context.Context, in *CasSlots, opts ...grpc.CallOption) (*CasInstalled, error) {
+	out := new(CasInstalled)
+	err := grpc.Invoke(ctx, "/proto.Cas/CasInstall", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Cas service
+
+type CasServer interface {
+	CasPrepare(context.Context, *CasPrepare) (*CasPromise, error)
+	CasAccept(context.Context, *CasPropose) (*CasLearn, error)
+	CasFreeze(context.Context, *CasFreeze) (*CasSlots, error)
+	CasInstall(context.Context, *CasSlots) (*CasInstalled, error)
+}
+
+func RegisterCasServer(s *grpc.Server, srv CasServer) {
+	s.RegisterService(&_Cas_serviceDesc, srv)
+}
+
+func _Cas_CasPrepare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(CasPrepare)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CasServer).CasPrepare(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cas_CasAccept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(CasPropose)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CasServer).CasAccept(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cas_CasFreeze_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(CasFreeze)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CasServer).CasFreeze(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cas_CasInstall_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(CasSlots)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CasServer).CasInstall(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _Cas_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Cas",
+	HandlerType: (*CasServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CasPrepare",
+			Handler:    _Cas_CasPrepare_Handler,
+		},
+		{
+			MethodName: "CasAccept",
+			Handler:    _Cas_CasAccept_Handler,
+		},
+		{
+			MethodName: "CasFreeze",
+			Handler:    _Cas_CasFreeze_Handler,
+		},
+		{
+			MethodName: "CasInstall",
+			Handler:    _Cas_CasInstall_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -0,0 +1,158 @@
+package proto
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Merge returns the slot that tells more about the instance, of the slots s
+// and o for the same instance: the higher promise, and the value accepted in
+// the higher round. s and o are not changed.
+func (s *CasSlot) Merge(o *CasSlot) *CasSlot {
+	switch {
+	case s == nil:
+		return o
+	case o == nil:
+		return s
+	}
+	m := *s
+	if o.Rnd > m.Rnd {
+		m.Rnd = o.Rnd
+	}
+	if o.VRnd > m.VRnd {
+		m.VRnd, m.Val, m.Owner = o.VRnd, o.Val, o.Owner
+	}
+	return &m
+}
+
+// KeySlots holds CAS slots, by key and instance.
+type KeySlots map[string]map[int32]*CasSlot
+
+// Get returns the slot for instance t of key, or nil.
+func (ks KeySlots) Get(key string, t int32) *CasSlot {
+	return ks[key][t]
+}
+
+// Put stores s, replacing the slot held for its instance.
+func (ks KeySlots) Put(s *CasSlot) {
+	if ks[s.Key] == nil {
+		ks[s.Key] = make(map[int32]*CasSlot)
+	}
+	ks[s.Key][s.T] = s
+}
+
+// Add merges s into the slot held for its instance.
+func (ks KeySlots) Add(s *CasSlot) {
+	if s != nil {
+		ks.Put(ks.Get(s.Key, s.T).Merge(s))
+	}
+}
+
+// List returns the slots in ks.
+func (ks KeySlots) List() []*CasSlot {
+	var sl []*CasSlot
+	for _, slots := range ks {
+		for _, s := range slots {
+			sl = append(sl, s)
+		}
+	}
+	return sl
+}
+
+func (m *CasPromise) ok() bool     { return m.Ok }
+func (m *CasPromise) stop() bool   { return m.Stale || m.Cur != nil || len(m.Next) > 0 }
+func (m *CasLearn) ok() bool       { return m.Ok }
+func (m *CasLearn) stop() bool     { return m.Stale || m.Cur != nil || len(m.Next) > 0 }
+func (m *CasSlots) ok() bool       { return true }
+func (m *CasSlots) stop() bool     { return false }
+func (m *CasInstalled) ok() bool   { return true }
+func (m *CasInstalled) stop() bool { return false }
+
+// CasPrepare sends p to the servers in c. The reply is Ok, if a quorum
+// promised p.Rnd, and then holds the slot accepted in the highest round. If a
+// server reported that the register or the configuration moved on, its reply
+// is returned. Rnd is the highest round promised by any server.
+func (c *Configuration) CasPrepare(ctx context.Context, p *CasPrepare) (*CasPromise, error) {
+	replies, mids, err := c.callAll(ctx, func(ctx context.Context, cc *grpc.ClientConn) (quorumReply, error) {
+		return NewCasClient(cc).CasPrepare(ctx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rep := new(CasPromise)
+	var oks []int
+	for i, r := range replies {
+		pr := r.(*CasPromise)
+		if pr.stop() {
+			return pr, nil
+		}
+		if pr.Rnd > rep.Rnd {
+			rep.Rnd = pr.Rnd
+		}
+		if !pr.Ok {
+			continue
+		}
+		oks = append(oks, mids[i])
+		if s := pr.Slot; s.GetVal() != nil && (rep.Slot == nil || s.VRnd > rep.Slot.VRnd) {
+			rep.Slot = s
+		}
+	}
+	rep.Ok = c.isQuorum(oks)
+	return rep, nil
+}
+
+// CasAccept sends p to the servers in c. The reply is Ok, if a quorum
+// accepted p.Val. As for CasPrepare, a reply that tells to stop is returned,
+// and Rnd is the highest round promised by any server.
+func (c *Configuration) CasAccept(ctx context.Context, p *CasPropose) (*CasLearn, error) {
+	replies, mids, err := c.callAll(ctx, func(ctx context.Context, cc *grpc.ClientConn) (quorumReply, error) {
+		return NewCasClient(cc).CasAccept(ctx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rep := new(CasLearn)
+	var oks []int
+	for i, r := range replies {
+		lr := r.(*CasLearn)
+		if lr.stop() {
+			return lr, nil
+		}
+		if lr.Rnd > rep.Rnd {
+			rep.Rnd = lr.Rnd
+		}
+		if lr.Ok {
+			oks = append(oks, mids[i])
+		}
+	}
+	rep.Ok = c.isQuorum(oks)
+	return rep, nil
+}
+
+// CasFreeze stops CAS in configuration curc at a quorum of c, and returns
+// their slots. Every instance decided in curc is in the returned slots.
+func (c *Configuration) CasFreeze(ctx context.Context, curc ConfID) (KeySlots, error) {
+	replies, _, err := c.callAll(ctx, func(ctx context.Context, cc *grpc.ClientConn) (quorumReply, error) {
+		return NewCasClient(cc).CasFreeze(ctx, &CasFreeze{CurC: curc.Ptr()})
+	})
+	if err != nil {
+		return nil, err
+	}
+	ks := make(KeySlots)
+	for _, r := range replies {
+		for _, s := range r.(*CasSlots).GetSlots() {
+			ks.Add(s)
+		}
+	}
+	return ks, nil
+}
+
+// CasInstall installs the slots in ks at a quorum of c, and allows CAS in
+// configuration curc.
+func (c *Configuration) CasInstall(ctx context.Context, curc ConfID, ks KeySlots) error {
+	in := &CasSlots{CurC: curc.Ptr(), Slots: ks.List()}
+	_, _, err := c.callAll(ctx, func(ctx context.Context, cc *grpc.ClientConn) (quorumReply, error) {
+		return NewCasClient(cc).CasInstall(ctx, in)
+	})
+	return err
+}
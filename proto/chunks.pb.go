@@ -0,0 +1,216 @@
+// Code generated by protoc-gen-gogo.
+// source: chunks.proto
+// DO NOT EDIT!
+
+package proto
+
+import proto1 "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto1.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type FetchRequest struct {
+	Key       string `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
+	Timestamp int32  `protobuf:"varint,2,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Writer    uint32 `protobuf:"varint,3,opt,name=Writer,proto3" json:"Writer,omitempty"`
+}
+
+func (m *FetchRequest) Reset()         { *m = FetchRequest{} }
+func (m *FetchRequest) String() string { return proto1.CompactTextString(m) }
+func (*FetchRequest) ProtoMessage()    {}
+
+type Chunk struct {
+	Key       string `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
+	Timestamp int32  `protobuf:"varint,2,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Writer    uint32 `protobuf:"varint,3,opt,name=Writer,proto3" json:"Writer,omitempty"`
+	ValueLen  uint32 `protobuf:"varint,4,opt,name=ValueLen,proto3" json:"ValueLen,omitempty"`
+	Data      []byte `protobuf:"bytes,5,opt,name=Data,proto3" json:"Data,omitempty"`
+	Crc       uint32 `protobuf:"varint,6,opt,name=Crc,proto3" json:"Crc,omitempty"`
+}
+
+func (m *Chunk) Reset()         { *m = Chunk{} }
+func (m *Chunk) String() string { return proto1.CompactTextString(m) }
+func (*Chunk) ProtoMessage()    {}
+
+type StageReply struct {
+}
+
+func (m *StageReply) Reset()         { *m = StageReply{} }
+func (m *StageReply) String() string { return proto1.CompactTextString(m) }
+func (*StageReply) ProtoMessage()    {}
+
+func init() {
+	proto1.RegisterType((*FetchRequest)(nil), "proto.FetchRequest")
+	proto1.RegisterType((*Chunk)(nil), "proto.Chunk")
+	proto1.RegisterType((*StageReply)(nil), "proto.StageReply")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Chunks service
+
+type ChunksClient interface {
+	Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (Chunks_FetchClient, error)
+	Stage(ctx context.Context, opts ...grpc.CallOption) (Chunks_StageClient, error)
+}
+
+type chunksClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewChunksClient(cc *grpc.ClientConn) ChunksClient {
+	return &chunksClient{cc}
+}
+
+func (c *chunksClient) Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (Chunks_FetchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Chunks_serviceDesc.Streams[0], c.cc, "/proto.Chunks/Fetch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chunksFetchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Chunks_FetchClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type chunksFetchClient struct {
+	grpc.ClientStream
+}
+
+func (x *chunksFetchClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chunksClient) Stage(ctx context.Context, opts ...grpc.CallOption) (Chunks_StageClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Chunks_serviceDesc.Streams[1], c.cc, "/proto.Chunks/Stage", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chunksStageClient{stream}
+	return x, nil
+}
+
+type Chunks_StageClient interface {
+	Send(*Chunk) error
+	CloseAndRecv() (*StageReply, error)
+	grpc.ClientStream
+}
+
+type chunksStageClient struct {
+	grpc.ClientStream
+}
+
+func (x *chunksStageClient) Send(m *Chunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *chunksStageClient) CloseAndRecv() (*StageReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StageReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Chunks service
+
+type ChunksServer interface {
+	Fetch(*FetchRequest, Chunks_FetchServer) error
+	Stage(Chunks_StageServer) error
+}
+
+func RegisterChunksServer(s *grpc.Server, srv ChunksServer) {
+	s.RegisterService(&_Chunks_serviceDesc, srv)
+}
+
+func _Chunks_Fetch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChunksServer).Fetch(m, &chunksFetchServer{stream})
+}
+
+type Chunks_FetchServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type chunksFetchServer struct {
+	grpc.ServerStream
+}
+
+func (x *chunksFetchServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Chunks_Stage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChunksServer).Stage(&chunksStageServer{stream})
+}
+
+type Chunks_StageServer interface {
+	SendAndClose(*StageReply) error
+	Recv() (*Chunk, error)
+	grpc.ServerStream
+}
+
+type chunksStageServer struct {
+	grpc.ServerStream
+}
+
+func (x *chunksStageServer) SendAndClose(m *StageReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chunksStageServer) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _Chunks_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Chunks",
+	HandlerType: (*ChunksServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Fetch",
+			Handler:       _Chunks_Fetch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Stage",
+			Handler:       _Chunks_Stage_Handler,
+			ClientStreams: true,
+		},
+	},
+}
@@ -0,0 +1,283 @@
+package proto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Register values larger than ChunkThreshold are left out of the messages of
+// the register services. Such a state has only ValueLen set, and its value is
+// moved with the Chunks service instead, in chunks of ChunkSize bytes.
+var (
+	ChunkThreshold = 1 << 20
+	ChunkSize      = 256 << 10
+	ChunkTimeout   = 10 * time.Second
+)
+
+// ErrChecksum is returned if a chunk does not match its checksum.
+var ErrChecksum = errors.New("chunk checksum mismatch")
+
+// Omitted returns true, if the value of s was left out.
+func (s *State) Omitted() bool {
+	return s != nil && s.ValueLen > 0 && len(s.Value) == 0
+}
+
+// Ref returns s without its value, if the value is larger than
+// ChunkThreshold, and s otherwise.
+func (s *State) Ref() *State {
+	if s == nil || len(s.Value) <= ChunkThreshold {
+		return s
+	}
+	return &State{Timestamp: s.Timestamp, Writer: s.Writer, ValueLen: uint32(len(s.Value))}
+}
+
+// Digested returns s without its value, but with the SHA-256 digest of the
+// value. An empty value is kept, since there is nothing to fetch.
+func (s *State) Digested() *State {
+	if s == nil || len(s.Value) == 0 {
+		return s
+	}
+	d := sha256.Sum256(s.Value)
+	return &State{Timestamp: s.Timestamp, Writer: s.Writer, ValueLen: uint32(len(s.Value)), Digest: d[:]}
+}
+
+// Refs returns kss, with Ref applied to all states. kss is not changed.
+func Refs(kss []*KeyState) []*KeyState {
+	out, _ := replace(kss, func(kst *KeyState) (*State, error) {
+		return kst.GetState().Ref(), nil
+	})
+	return out
+}
+
+// replace returns kss, with each state replaced by f. If f returns the state
+// unchanged for all keys, kss itself is returned, otherwise a copy.
+func replace(kss []*KeyState, f func(*KeyState) (*State, error)) ([]*KeyState, error) {
+	var out []*KeyState
+	for i, kst := range kss {
+		st, err := f(kst)
+		if err != nil {
+			return nil, err
+		}
+		if st == kst.GetState() {
+			continue
+		}
+		if out == nil {
+			out = append([]*KeyState(nil), kss...)
+		}
+		out[i] = &KeyState{Key: kst.Key, State: st}
+	}
+	if out == nil {
+		return kss, nil
+	}
+	return out, nil
+}
+
+// SendChunks sends the value of st in chunks. The first chunk also carries
+// key and the timestamp, writer and length of st.
+func SendChunks(send func(*Chunk) error, key string, st *State) error {
+	val := st.Value
+	for off := 0; off == 0 || off < len(val); off += ChunkSize {
+		end := off + ChunkSize
+		if end > len(val) {
+			end = len(val)
+		}
+		c := &Chunk{Data: val[off:end], Crc: crc32.ChecksumIEEE(val[off:end])}
+		if off == 0 {
+			c.Key, c.Timestamp, c.Writer, c.ValueLen = key, st.Timestamp, st.Writer, uint32(len(val))
+		}
+		if err := send(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecvChunks receives a value sent with SendChunks, and checks the
+// checksums. It returns the key and the state with its value.
+func RecvChunks(recv func() (*Chunk, error)) (string, *State, error) {
+	c, err := recv()
+	if err != nil {
+		return "", nil, err
+	}
+	key := c.Key
+	st := &State{Timestamp: c.Timestamp, Writer: c.Writer, Value: make([]byte, 0, c.ValueLen)}
+	for {
+		if crc32.ChecksumIEEE(c.Data) != c.Crc {
+			return "", nil, ErrChecksum
+		}
+		st.Value = append(st.Value, c.Data...)
+		if len(st.Value) >= cap(st.Value) {
+			break
+		}
+		if c, err = recv(); err != nil {
+			return "", nil, err
+		}
+	}
+	if len(st.Value) != cap(st.Value) {
+		return "", nil, fmt.Errorf("received %d bytes, expected %d", len(st.Value), cap(st.Value))
+	}
+	return key, st, nil
+}
+
+// conns returns the connections to the servers in c.
+func (c *Configuration) conns() []*grpc.ClientConn {
+	ms := c.members()
+	conns := make([]*grpc.ClientConn, len(ms))
+	for i, m := range ms {
+		conns[i] = m.conn
+	}
+	return conns
+}
+
+// members returns the machines in c.
+func (c *Configuration) members() []*Machine {
+	ms := make([]*Machine, 0, len(c.machines))
+	for _, id := range c.machines {
+		if m, found := c.mgr.Machine(id); found {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// Fetch returns st with its value, if the value was left out. It asks the
+// servers in c one after the other, until one of them still holds st. The
+// first server is picked at random, to spread the load.
+func (c *Configuration) Fetch(ctx context.Context, key string, st *State) (*State, error) {
+	if !st.Omitted() {
+		return st, nil
+	}
+	err := errors.New("no server to fetch from")
+	conns := c.conns()
+	off := 0
+	if len(conns) > 0 {
+		off = rand.Intn(len(conns))
+	}
+	for i := range conns {
+		var full *State
+		if full, err = fetch(ctx, conns[(off+i)%len(conns)], key, st); err == nil {
+			return full, nil
+		}
+	}
+	return nil, err
+}
+
+func fetch(ctx context.Context, cc *grpc.ClientConn, key string, st *State) (*State, error) {
+	ctx, cancel := context.WithTimeout(ctx, ChunkTimeout)
+	defer cancel()
+	stream, err := NewChunksClient(cc).Fetch(ctx, &FetchRequest{Key: key, Timestamp: st.Timestamp, Writer: st.Writer})
+	if err != nil {
+		return nil, err
+	}
+	_, full, err := RecvChunks(stream.Recv)
+	if err != nil {
+		return nil, err
+	}
+	if full.Compare(st) != 0 {
+		return nil, errors.New("fetched a different state")
+	}
+	if len(st.Digest) > 0 {
+		if d := sha256.Sum256(full.Value); !bytes.Equal(d[:], st.Digest) {
+			return nil, errors.New("fetched value does not match digest")
+		}
+	}
+	return full, nil
+}
+
+// FetchAll is Fetch for all states in kss. kss is not changed.
+func (c *Configuration) FetchAll(ctx context.Context, kss []*KeyState) ([]*KeyState, error) {
+	return replace(kss, func(kst *KeyState) (*State, error) {
+		return c.Fetch(ctx, kst.Key, kst.GetState())
+	})
+}
+
+// Stage sends the value of st to all servers in c, if it is larger than
+// ChunkThreshold, and returns st without its value. The servers keep the
+// value, until a request with the returned state arrives. Stage fails if
+// less than a quorum of c got the value, or if they span too few zones.
+func (c *Configuration) Stage(ctx context.Context, key string, st *State) (*State, error) {
+	ref := st.Ref()
+	if ref == st {
+		return st, nil
+	}
+	type result struct {
+		mid int
+		err error
+	}
+	ms := c.members()
+	results := make(chan result, len(ms))
+	for _, m := range ms {
+		go func(m *Machine) {
+			results <- result{m.id, stage(ctx, m.conn, key, st)}
+		}(m)
+	}
+
+	var err error
+	var staged []int
+	for range ms {
+		res := <-results
+		if res.err != nil {
+			err = res.err
+			continue
+		}
+		staged = append(staged, res.mid)
+	}
+	if w := c.Weight(staged); w < c.MaxQuorum() {
+		return nil, fmt.Errorf("staged value at servers of weight %d, need %d: %v", w, c.MaxQuorum(), err)
+	}
+	if !c.Spans(staged) {
+		return nil, fmt.Errorf("staged value at servers in too few zones: %v", err)
+	}
+	return ref, nil
+}
+
+func stage(ctx context.Context, cc *grpc.ClientConn, key string, st *State) error {
+	ctx, cancel := context.WithTimeout(ctx, ChunkTimeout)
+	defer cancel()
+	stream, err := NewChunksClient(cc).Stage(ctx)
+	if err != nil {
+		return err
+	}
+	if err = SendChunks(stream.Send, key, st); err != nil {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// StageAll is Stage for all states in kss. kss is not changed.
+func (c *Configuration) StageAll(ctx context.Context, kss []*KeyState) ([]*KeyState, error) {
+	return replace(kss, func(kst *KeyState) (*State, error) {
+		return c.Stage(ctx, kst.Key, kst.GetState())
+	})
+}
+
+// FetchNewer returns the more recent of have and st. If that is st, and its
+// value was left out, the value is fetched from c.
+func (c *Configuration) FetchNewer(ctx context.Context, key string, have, st *State) (*State, error) {
+	if have.Compare(st) != 1 {
+		return have, nil
+	}
+	return c.Fetch(ctx, key, st)
+}
+
+// FetchNewerAll adds the states in kss to ks, if they are more recent than
+// the ones held. Their values are fetched from c, if they were left out.
+func (c *Configuration) FetchNewerAll(ctx context.Context, ks KeyStates, kss []*KeyState) error {
+	for _, kst := range kss {
+		st, err := c.FetchNewer(ctx, kst.Key, ks[kst.Key], kst.GetState())
+		if err != nil {
+			return err
+		}
+		ks.Add(kst.Key, st)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package proto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChunks(t *testing.T) {
+	defer func(size int) { ChunkSize = size }(ChunkSize)
+	ChunkSize = 4
+	st := &State{Value: []byte("0123456789"), Timestamp: 2, Writer: 3}
+
+	var sent []*Chunk
+	if err := SendChunks(func(c *Chunk) error { sent = append(sent, c); return nil }, "k", st); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 3 {
+		t.Fatalf("Sent %d chunks, expected 3.", len(sent))
+	}
+
+	recv := func(cs []*Chunk) func() (*Chunk, error) {
+		return func() (*Chunk, error) {
+			c := cs[0]
+			cs = cs[1:]
+			return c, nil
+		}
+	}
+	key, got, err := RecvChunks(recv(sent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "k" || got.Compare(st) != 0 || !bytes.Equal(got.Value, st.Value) {
+		t.Errorf("Received key %q and state %v, expected %q and %v.", key, got, "k", st)
+	}
+
+	sent[1].Data = []byte("xxxx")
+	if _, _, err = RecvChunks(recv(sent)); err != ErrChecksum {
+		t.Errorf("Received a corrupted chunk with error %v, expected %v.", err, ErrChecksum)
+	}
+}
+
+func TestRef(t *testing.T) {
+	defer func(th int) { ChunkThreshold = th }(ChunkThreshold)
+	ChunkThreshold = 4
+	small := &State{Value: []byte("0123"), Timestamp: 1}
+	large := &State{Value: []byte("01234"), Timestamp: 2}
+
+	if small.Ref() != small {
+		t.Error("Ref left out a small value.")
+	}
+	ref := large.Ref()
+	if !ref.Omitted() || ref.ValueLen != 5 || ref.Compare(large) != 0 {
+		t.Errorf("Ref of a large state returned %v.", ref)
+	}
+	if large.Omitted() || len(large.Value) != 5 {
+		t.Error("Ref changed the state.")
+	}
+
+	kss := []*KeyState{{Key: "a", State: small}, {Key: "b", State: large}}
+	refs := Refs(kss)
+	if refs[0].State != small || !refs[1].State.Omitted() || kss[1].State != large {
+		t.Errorf("Refs returned %v.", refs)
+	}
+}
+
+func TestDigested(t *testing.T) {
+	st := &State{Value: []byte("0123"), Timestamp: 1, Writer: 2}
+	d := st.Digested()
+	if !d.Omitted() || len(d.Digest) != 32 || d.Compare(st) != 0 {
+		t.Errorf("Digested returned %v.", d)
+	}
+	empty := &State{Timestamp: 1}
+	if empty.Digested() != empty {
+		t.Error("Digested left out an empty value.")
+	}
+}
@@ -10,10 +10,12 @@
 
 	It has these top-level messages:
 		State
+		KeyState
 		Conf
 		ConfReply
 		Node
 		Blueprint
+		ConfID
 		NewCur
 		NewCurReply
 		Read
@@ -51,6 +53,7 @@ package proto
 import proto1 "github.com/gogo/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import _ "github.com/gogo/protobuf/gogoproto"
 
 import (
 	"encoding/binary"
@@ -81,15 +84,36 @@ type State struct {
 	Value     []byte `protobuf:"bytes,1,opt,name=Value,proto3" json:"Value,omitempty"`
 	Timestamp int32  `protobuf:"varint,2,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
 	Writer    uint32 `protobuf:"varint,3,opt,name=Writer,proto3" json:"Writer,omitempty"`
+	ValueLen  uint32 `protobuf:"varint,4,opt,name=ValueLen,proto3" json:"ValueLen,omitempty"`
+	Digest    []byte `protobuf:"bytes,5,opt,name=Digest,proto3" json:"Digest,omitempty"`
 }
 
 func (m *State) Reset()         { *m = State{} }
 func (m *State) String() string { return proto1.CompactTextString(m) }
 func (*State) ProtoMessage()    {}
 
+type KeyState struct {
+	Key   string `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
+	State *State `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+}
+
+func (m *KeyState) Reset()         { *m = KeyState{} }
+func (m *KeyState) String() string { return proto1.CompactTextString(m) }
+func (*KeyState) ProtoMessage()    {}
+
+func (m *KeyState) GetState() *State {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
 type Conf struct {
-	This uint32 `protobuf:"varint,1,opt,name=This,proto3" json:"This,omitempty"`
-	Cur  uint32 `protobuf:"varint,2,opt,name=Cur,proto3" json:"Cur,omitempty"`
+	This    ConfID `protobuf:"bytes,1,opt,name=This" json:"This"`
+	Cur     ConfID `protobuf:"bytes,2,opt,name=Cur" json:"Cur"`
+	Key     string `protobuf:"bytes,3,opt,name=Key,proto3" json:"Key,omitempty"`
+	AllKeys bool   `protobuf:"varint,4,opt,name=AllKeys,proto3" json:"AllKeys,omitempty"`
+	Digest  bool   `protobuf:"varint,5,opt,name=Digest,proto3" json:"Digest,omitempty"`
 }
 
 func (m *Conf) Reset()         { *m = Conf{} }
@@ -121,8 +145,11 @@ func (m *ConfReply) GetNext() []*Blueprint {
 }
 
 type Node struct {
-	Id      uint32 `protobuf:"varint,1,opt,name=Id,proto3" json:"Id,omitempty"`
-	Version uint32 `protobuf:"varint,2,opt,name=Version,proto3" json:"Version,omitempty"`
+	Id       uint32 `protobuf:"varint,1,opt,name=Id,proto3" json:"Id,omitempty"`
+	Version  uint32 `protobuf:"varint,2,opt,name=Version,proto3" json:"Version,omitempty"`
+	Weight   uint32 `protobuf:"varint,3,opt,name=Weight,proto3" json:"Weight,omitempty"`
+	Zone     string `protobuf:"bytes,4,opt,name=Zone,proto3" json:"Zone,omitempty"`
+	Conflict bool   `protobuf:"varint,5,opt,name=Conflict,proto3" json:"Conflict,omitempty"`
 }
 
 func (m *Node) Reset()         { *m = Node{} }
@@ -130,9 +157,12 @@ func (m *Node) String() string { return proto1.CompactTextString(m) }
 func (*Node) ProtoMessage()    {}
 
 type Blueprint struct {
-	Nodes          []*Node `protobuf:"bytes,1,rep,name=Nodes" json:"Nodes,omitempty"`
-	FaultTolerance uint32  `protobuf:"varint,3,opt,name=FaultTolerance,proto3" json:"FaultTolerance,omitempty"`
-	Epoch          uint32  `protobuf:"varint,4,opt,name=Epoch,proto3" json:"Epoch,omitempty"`
+	Nodes           []*Node `protobuf:"bytes,1,rep,name=Nodes" json:"Nodes,omitempty"`
+	FaultTolerance  uint32  `protobuf:"varint,3,opt,name=FaultTolerance,proto3" json:"FaultTolerance,omitempty"`
+	Epoch           uint32  `protobuf:"varint,4,opt,name=Epoch,proto3" json:"Epoch,omitempty"`
+	ReadQuorumSize  uint32  `protobuf:"varint,5,opt,name=ReadQuorumSize,proto3" json:"ReadQuorumSize,omitempty"`
+	WriteQuorumSize uint32  `protobuf:"varint,6,opt,name=WriteQuorumSize,proto3" json:"WriteQuorumSize,omitempty"`
+	ZoneFaults      uint32  `protobuf:"varint,7,opt,name=ZoneFaults,proto3" json:"ZoneFaults,omitempty"`
 }
 
 func (m *Blueprint) Reset()         { *m = Blueprint{} }
@@ -146,9 +176,19 @@ func (m *Blueprint) GetNodes() []*Node {
 	return nil
 }
 
+type ConfID struct {
+	Order  uint64 `protobuf:"varint,1,opt,name=Order,proto3" json:"Order,omitempty"`
+	Digest uint64 `protobuf:"fixed64,2,opt,name=Digest,proto3" json:"Digest,omitempty"`
+	Epoch  uint32 `protobuf:"varint,3,opt,name=Epoch,proto3" json:"Epoch,omitempty"`
+}
+
+func (m *ConfID) Reset()         { *m = ConfID{} }
+func (m *ConfID) String() string { return proto1.CompactTextString(m) }
+func (*ConfID) ProtoMessage()    {}
+
 type NewCur struct {
 	Cur  *Blueprint `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
-	CurC uint32     `protobuf:"varint,2,opt,name=CurC,proto3" json:"CurC,omitempty"`
+	CurC ConfID     `protobuf:"bytes,2,opt,name=CurC" json:"CurC"`
 }
 
 func (m *NewCur) Reset()         { *m = NewCur{} }
@@ -186,8 +226,9 @@ func (m *Read) GetConf() *Conf {
 }
 
 type ReadReply struct {
-	State *State     `protobuf:"bytes,1,opt,name=State" json:"State,omitempty"`
-	Cur   *ConfReply `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
+	State   *State      `protobuf:"bytes,1,opt,name=State" json:"State,omitempty"`
+	Cur     *ConfReply  `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
+	KStates []*KeyState `protobuf:"bytes,3,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *ReadReply) Reset()         { *m = ReadReply{} }
@@ -208,9 +249,17 @@ func (m *ReadReply) GetCur() *ConfReply {
 	return nil
 }
 
+func (m *ReadReply) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type WriteS struct {
 	State *State `protobuf:"bytes,1,opt,name=State" json:"State,omitempty"`
 	Conf  *Conf  `protobuf:"bytes,2,opt,name=Conf" json:"Conf,omitempty"`
+	Key   string `protobuf:"bytes,3,opt,name=Key,proto3" json:"Key,omitempty"`
 }
 
 func (m *WriteS) Reset()         { *m = WriteS{} }
@@ -232,8 +281,9 @@ func (m *WriteS) GetConf() *Conf {
 }
 
 type WriteN struct {
-	CurC uint32     `protobuf:"varint,1,opt,name=CurC,proto3" json:"CurC,omitempty"`
+	CurC ConfID     `protobuf:"bytes,1,opt,name=CurC" json:"CurC"`
 	Next *Blueprint `protobuf:"bytes,2,opt,name=Next" json:"Next,omitempty"`
+	Key  string     `protobuf:"bytes,3,opt,name=Key,proto3" json:"Key,omitempty"`
 }
 
 func (m *WriteN) Reset()         { *m = WriteN{} }
@@ -248,9 +298,10 @@ func (m *WriteN) GetNext() *Blueprint {
 }
 
 type WriteNReply struct {
-	Cur     *ConfReply `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
-	State   *State     `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
-	LAState *Blueprint `protobuf:"bytes,3,opt,name=LAState" json:"LAState,omitempty"`
+	Cur     *ConfReply  `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
+	State   *State      `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	LAState *Blueprint  `protobuf:"bytes,3,opt,name=LAState" json:"LAState,omitempty"`
+	KStates []*KeyState `protobuf:"bytes,4,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *WriteNReply) Reset()         { *m = WriteNReply{} }
@@ -278,6 +329,13 @@ func (m *WriteNReply) GetLAState() *Blueprint {
 	return nil
 }
 
+func (m *WriteNReply) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type LAProposal struct {
 	Conf *Conf      `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
 	Prop *Blueprint `protobuf:"bytes,2,opt,name=Prop" json:"Prop,omitempty"`
@@ -325,9 +383,11 @@ func (m *LAReply) GetLAState() *Blueprint {
 }
 
 type NewState struct {
-	CurC    uint32     `protobuf:"varint,1,opt,name=CurC,proto3" json:"CurC,omitempty"`
-	State   *State     `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
-	LAState *Blueprint `protobuf:"bytes,3,opt,name=LAState" json:"LAState,omitempty"`
+	CurC    ConfID      `protobuf:"bytes,1,opt,name=CurC" json:"CurC"`
+	State   *State      `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	LAState *Blueprint  `protobuf:"bytes,3,opt,name=LAState" json:"LAState,omitempty"`
+	Key     string      `protobuf:"bytes,4,opt,name=Key,proto3" json:"Key,omitempty"`
+	KStates []*KeyState `protobuf:"bytes,5,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *NewState) Reset()         { *m = NewState{} }
@@ -348,6 +408,13 @@ func (m *NewState) GetLAState() *Blueprint {
 	return nil
 }
 
+func (m *NewState) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type NewStateReply struct {
 	Cur  *Blueprint   `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
 	Next []*Blueprint `protobuf:"bytes,2,rep,name=Next" json:"Next,omitempty"`
@@ -388,7 +455,7 @@ func (m *CV) GetVal() *Blueprint {
 }
 
 type Prepare struct {
-	CurC uint32 `protobuf:"varint,1,opt,name=CurC,proto3" json:"CurC,omitempty"`
+	CurC ConfID `protobuf:"bytes,1,opt,name=CurC" json:"CurC"`
 	Rnd  uint32 `protobuf:"varint,2,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
 }
 
@@ -429,7 +496,7 @@ func (m *Promise) GetDec() *Blueprint {
 }
 
 type Propose struct {
-	CurC uint32 `protobuf:"varint,1,opt,name=CurC,proto3" json:"CurC,omitempty"`
+	CurC ConfID `protobuf:"bytes,1,opt,name=CurC" json:"CurC"`
 	Val  *CV    `protobuf:"bytes,2,opt,name=Val" json:"Val,omitempty"`
 }
 
@@ -560,9 +627,10 @@ func (m *DRead) GetProp() *Blueprint {
 }
 
 type DReadReply struct {
-	State *State       `protobuf:"bytes,1,opt,name=State" json:"State,omitempty"`
-	Cur   *Blueprint   `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
-	Next  []*Blueprint `protobuf:"bytes,3,rep,name=Next" json:"Next,omitempty"`
+	State   *State       `protobuf:"bytes,1,opt,name=State" json:"State,omitempty"`
+	Cur     *Blueprint   `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
+	Next    []*Blueprint `protobuf:"bytes,3,rep,name=Next" json:"Next,omitempty"`
+	KStates []*KeyState  `protobuf:"bytes,4,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *DReadReply) Reset()         { *m = DReadReply{} }
@@ -590,9 +658,17 @@ func (m *DReadReply) GetNext() []*Blueprint {
 	return nil
 }
 
+func (m *DReadReply) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type DNewState struct {
-	Conf  *Conf  `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
-	State *State `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	Conf    *Conf       `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
+	State   *State      `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	KStates []*KeyState `protobuf:"bytes,3,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *DNewState) Reset()         { *m = DNewState{} }
@@ -613,6 +689,13 @@ func (m *DNewState) GetState() *State {
 	return nil
 }
 
+func (m *DNewState) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type DWriteNs struct {
 	Conf *Conf      `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
 	Next *Blueprint `protobuf:"bytes,2,opt,name=Next" json:"Next,omitempty"`
@@ -652,11 +735,13 @@ func (m *DWriteNsReply) GetCur() *Blueprint {
 }
 
 type SWriteN struct {
-	CurL uint32     `protobuf:"varint,1,opt,name=CurL,proto3" json:"CurL,omitempty"`
-	Cur  *Blueprint `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
-	This uint32     `protobuf:"varint,3,opt,name=This,proto3" json:"This,omitempty"`
-	Rnd  uint32     `protobuf:"varint,4,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
-	Prop *Blueprint `protobuf:"bytes,5,opt,name=Prop" json:"Prop,omitempty"`
+	CurL    ConfID     `protobuf:"bytes,1,opt,name=CurL" json:"CurL"`
+	Cur     *Blueprint `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
+	This    ConfID     `protobuf:"bytes,3,opt,name=This" json:"This"`
+	Rnd     uint32     `protobuf:"varint,4,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
+	Prop    *Blueprint `protobuf:"bytes,5,opt,name=Prop" json:"Prop,omitempty"`
+	Key     string     `protobuf:"bytes,6,opt,name=Key,proto3" json:"Key,omitempty"`
+	AllKeys bool       `protobuf:"varint,7,opt,name=AllKeys,proto3" json:"AllKeys,omitempty"`
 }
 
 func (m *SWriteN) Reset()         { *m = SWriteN{} }
@@ -678,9 +763,10 @@ func (m *SWriteN) GetProp() *Blueprint {
 }
 
 type SWriteNReply struct {
-	Cur   *Blueprint   `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
-	Next  []*Blueprint `protobuf:"bytes,2,rep,name=Next" json:"Next,omitempty"`
-	State *State       `protobuf:"bytes,3,opt,name=State" json:"State,omitempty"`
+	Cur     *Blueprint   `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
+	Next    []*Blueprint `protobuf:"bytes,2,rep,name=Next" json:"Next,omitempty"`
+	State   *State       `protobuf:"bytes,3,opt,name=State" json:"State,omitempty"`
+	KStates []*KeyState  `protobuf:"bytes,4,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *SWriteNReply) Reset()         { *m = SWriteNReply{} }
@@ -708,9 +794,16 @@ func (m *SWriteNReply) GetState() *State {
 	return nil
 }
 
+func (m *SWriteNReply) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type Commit struct {
-	CurL    uint32     `protobuf:"varint,1,opt,name=CurL,proto3" json:"CurL,omitempty"`
-	This    uint32     `protobuf:"varint,2,opt,name=This,proto3" json:"This,omitempty"`
+	CurL    ConfID     `protobuf:"bytes,1,opt,name=CurL" json:"CurL"`
+	This    ConfID     `protobuf:"bytes,2,opt,name=This" json:"This"`
 	Rnd     uint32     `protobuf:"varint,3,opt,name=Rnd,proto3" json:"Rnd,omitempty"`
 	Commit  bool       `protobuf:"varint,4,opt,name=Commit,proto3" json:"Commit,omitempty"`
 	Collect *Blueprint `protobuf:"bytes,5,opt,name=Collect" json:"Collect,omitempty"`
@@ -759,8 +852,10 @@ func (m *CommitReply) GetCollected() *Blueprint {
 }
 
 type SState struct {
-	CurL  uint32 `protobuf:"varint,1,opt,name=CurL,proto3" json:"CurL,omitempty"`
-	State *State `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	CurL    ConfID      `protobuf:"bytes,1,opt,name=CurL" json:"CurL"`
+	State   *State      `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	Key     string      `protobuf:"bytes,3,opt,name=Key,proto3" json:"Key,omitempty"`
+	KStates []*KeyState `protobuf:"bytes,4,rep,name=KStates" json:"KStates,omitempty"`
 }
 
 func (m *SState) Reset()         { *m = SState{} }
@@ -774,6 +869,13 @@ func (m *SState) GetState() *State {
 	return nil
 }
 
+func (m *SState) GetKStates() []*KeyState {
+	if m != nil {
+		return m.KStates
+	}
+	return nil
+}
+
 type SStateReply struct {
 	HasNext bool       `protobuf:"varint,1,opt,name=HasNext,proto3" json:"HasNext,omitempty"`
 	Cur     *Blueprint `protobuf:"bytes,2,opt,name=Cur" json:"Cur,omitempty"`
@@ -792,10 +894,12 @@ func (m *SStateReply) GetCur() *Blueprint {
 
 func init() {
 	proto1.RegisterType((*State)(nil), "proto.State")
+	proto1.RegisterType((*KeyState)(nil), "proto.KeyState")
 	proto1.RegisterType((*Conf)(nil), "proto.Conf")
 	proto1.RegisterType((*ConfReply)(nil), "proto.ConfReply")
 	proto1.RegisterType((*Node)(nil), "proto.Node")
 	proto1.RegisterType((*Blueprint)(nil), "proto.Blueprint")
+	proto1.RegisterType((*ConfID)(nil), "proto.ConfID")
 	proto1.RegisterType((*NewCur)(nil), "proto.NewCur")
 	proto1.RegisterType((*NewCurReply)(nil), "proto.NewCurReply")
 	proto1.RegisterType((*Read)(nil), "proto.Read")
@@ -871,8 +975,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.aReadSqf != nil {
 		m.aReadSqf = m.opts.aReadSqf
 	} else {
-		m.aReadSqf = func(c *Configuration, replies []*ReadReply) (*ReadReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.aReadSqf = func(c *Configuration, replies []*ReadReply, mids []int) (*ReadReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -881,8 +985,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.aWriteSqf != nil {
 		m.aWriteSqf = m.opts.aWriteSqf
 	} else {
-		m.aWriteSqf = func(c *Configuration, replies []*ConfReply) (*ConfReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.aWriteSqf = func(c *Configuration, replies []*ConfReply, mids []int) (*ConfReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -891,8 +995,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.aWriteNqf != nil {
 		m.aWriteNqf = m.opts.aWriteNqf
 	} else {
-		m.aWriteNqf = func(c *Configuration, replies []*WriteNReply) (*WriteNReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.aWriteNqf = func(c *Configuration, replies []*WriteNReply, mids []int) (*WriteNReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -901,8 +1005,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.setCurqf != nil {
 		m.setCurqf = m.opts.setCurqf
 	} else {
-		m.setCurqf = func(c *Configuration, replies []*NewCurReply) (*NewCurReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.setCurqf = func(c *Configuration, replies []*NewCurReply, mids []int) (*NewCurReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -911,8 +1015,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.lAPropqf != nil {
 		m.lAPropqf = m.opts.lAPropqf
 	} else {
-		m.lAPropqf = func(c *Configuration, replies []*LAReply) (*LAReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.lAPropqf = func(c *Configuration, replies []*LAReply, mids []int) (*LAReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -921,8 +1025,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.setStateqf != nil {
 		m.setStateqf = m.opts.setStateqf
 	} else {
-		m.setStateqf = func(c *Configuration, replies []*NewStateReply) (*NewStateReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.setStateqf = func(c *Configuration, replies []*NewStateReply, mids []int) (*NewStateReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -931,8 +1035,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.getPromiseqf != nil {
 		m.getPromiseqf = m.opts.getPromiseqf
 	} else {
-		m.getPromiseqf = func(c *Configuration, replies []*Promise) (*Promise, bool) {
-			if len(replies) < c.Quorum() {
+		m.getPromiseqf = func(c *Configuration, replies []*Promise, mids []int) (*Promise, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -941,8 +1045,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.acceptqf != nil {
 		m.acceptqf = m.opts.acceptqf
 	} else {
-		m.acceptqf = func(c *Configuration, replies []*Learn) (*Learn, bool) {
-			if len(replies) < c.Quorum() {
+		m.acceptqf = func(c *Configuration, replies []*Learn, mids []int) (*Learn, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -951,8 +1055,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.fwdqf != nil {
 		m.fwdqf = m.opts.fwdqf
 	} else {
-		m.fwdqf = func(c *Configuration, replies []*Ack) (*Ack, bool) {
-			if len(replies) < c.Quorum() {
+		m.fwdqf = func(c *Configuration, replies []*Ack, mids []int) (*Ack, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -961,8 +1065,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.getOneNqf != nil {
 		m.getOneNqf = m.opts.getOneNqf
 	} else {
-		m.getOneNqf = func(c *Configuration, replies []*GetOneReply) (*GetOneReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.getOneNqf = func(c *Configuration, replies []*GetOneReply, mids []int) (*GetOneReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -971,8 +1075,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.dWriteNqf != nil {
 		m.dWriteNqf = m.opts.dWriteNqf
 	} else {
-		m.dWriteNqf = func(c *Configuration, replies []*DReadReply) (*DReadReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.dWriteNqf = func(c *Configuration, replies []*DReadReply, mids []int) (*DReadReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -981,8 +1085,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.dSetStateqf != nil {
 		m.dSetStateqf = m.opts.dSetStateqf
 	} else {
-		m.dSetStateqf = func(c *Configuration, replies []*NewStateReply) (*NewStateReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.dSetStateqf = func(c *Configuration, replies []*NewStateReply, mids []int) (*NewStateReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -991,8 +1095,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.dWriteNSetqf != nil {
 		m.dWriteNSetqf = m.opts.dWriteNSetqf
 	} else {
-		m.dWriteNSetqf = func(c *Configuration, replies []*DWriteNsReply) (*DWriteNsReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.dWriteNSetqf = func(c *Configuration, replies []*DWriteNsReply, mids []int) (*DWriteNsReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -1001,8 +1105,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.dSetCurqf != nil {
 		m.dSetCurqf = m.opts.dSetCurqf
 	} else {
-		m.dSetCurqf = func(c *Configuration, replies []*NewCurReply) (*NewCurReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.dSetCurqf = func(c *Configuration, replies []*NewCurReply, mids []int) (*NewCurReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -1011,8 +1115,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.spSnOneqf != nil {
 		m.spSnOneqf = m.opts.spSnOneqf
 	} else {
-		m.spSnOneqf = func(c *Configuration, replies []*SWriteNReply) (*SWriteNReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.spSnOneqf = func(c *Configuration, replies []*SWriteNReply, mids []int) (*SWriteNReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -1021,8 +1125,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.sCommitqf != nil {
 		m.sCommitqf = m.opts.sCommitqf
 	} else {
-		m.sCommitqf = func(c *Configuration, replies []*CommitReply) (*CommitReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.sCommitqf = func(c *Configuration, replies []*CommitReply, mids []int) (*CommitReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -1031,8 +1135,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.sSetStateqf != nil {
 		m.sSetStateqf = m.opts.sSetStateqf
 	} else {
-		m.sSetStateqf = func(c *Configuration, replies []*SStateReply) (*SStateReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.sSetStateqf = func(c *Configuration, replies []*SStateReply, mids []int) (*SStateReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -1041,8 +1145,8 @@ func (m *Manager) setDefaultQuorumFuncs() {
 	if m.opts.sSetCurqf != nil {
 		m.sSetCurqf = m.opts.sSetCurqf
 	} else {
-		m.sSetCurqf = func(c *Configuration, replies []*NewCurReply) (*NewCurReply, bool) {
-			if len(replies) < c.Quorum() {
+		m.sSetCurqf = func(c *Configuration, replies []*NewCurReply, mids []int) (*NewCurReply, bool) {
+			if c.Weight(mids) < c.Quorum() {
 				return nil, false
 			}
 			return replies[0], true
@@ -1242,109 +1346,127 @@ func WithSSetCurQuorumFunc(f SSetCurQuorumFn) ManagerOption {
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type AReadSQuorumFn func(c *Configuration, replies []*ReadReply) (*ReadReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type AReadSQuorumFn func(c *Configuration, replies []*ReadReply, mids []int) (*ReadReply, bool)
 
 // AWriteSQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type AWriteSQuorumFn func(c *Configuration, replies []*ConfReply) (*ConfReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type AWriteSQuorumFn func(c *Configuration, replies []*ConfReply, mids []int) (*ConfReply, bool)
 
 // AWriteNQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type AWriteNQuorumFn func(c *Configuration, replies []*WriteNReply) (*WriteNReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type AWriteNQuorumFn func(c *Configuration, replies []*WriteNReply, mids []int) (*WriteNReply, bool)
 
 // SetCurQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type SetCurQuorumFn func(c *Configuration, replies []*NewCurReply) (*NewCurReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type SetCurQuorumFn func(c *Configuration, replies []*NewCurReply, mids []int) (*NewCurReply, bool)
 
 // LAPropQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type LAPropQuorumFn func(c *Configuration, replies []*LAReply) (*LAReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type LAPropQuorumFn func(c *Configuration, replies []*LAReply, mids []int) (*LAReply, bool)
 
 // SetStateQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type SetStateQuorumFn func(c *Configuration, replies []*NewStateReply) (*NewStateReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type SetStateQuorumFn func(c *Configuration, replies []*NewStateReply, mids []int) (*NewStateReply, bool)
 
 // GetPromiseQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type GetPromiseQuorumFn func(c *Configuration, replies []*Promise) (*Promise, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type GetPromiseQuorumFn func(c *Configuration, replies []*Promise, mids []int) (*Promise, bool)
 
 // AcceptQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type AcceptQuorumFn func(c *Configuration, replies []*Learn) (*Learn, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type AcceptQuorumFn func(c *Configuration, replies []*Learn, mids []int) (*Learn, bool)
 
 // FwdQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type FwdQuorumFn func(c *Configuration, replies []*Ack) (*Ack, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type FwdQuorumFn func(c *Configuration, replies []*Ack, mids []int) (*Ack, bool)
 
 // GetOneNQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type GetOneNQuorumFn func(c *Configuration, replies []*GetOneReply) (*GetOneReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type GetOneNQuorumFn func(c *Configuration, replies []*GetOneReply, mids []int) (*GetOneReply, bool)
 
 // DWriteNQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type DWriteNQuorumFn func(c *Configuration, replies []*DReadReply) (*DReadReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type DWriteNQuorumFn func(c *Configuration, replies []*DReadReply, mids []int) (*DReadReply, bool)
 
 // DSetStateQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type DSetStateQuorumFn func(c *Configuration, replies []*NewStateReply) (*NewStateReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type DSetStateQuorumFn func(c *Configuration, replies []*NewStateReply, mids []int) (*NewStateReply, bool)
 
 // DWriteNSetQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type DWriteNSetQuorumFn func(c *Configuration, replies []*DWriteNsReply) (*DWriteNsReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type DWriteNSetQuorumFn func(c *Configuration, replies []*DWriteNsReply, mids []int) (*DWriteNsReply, bool)
 
 // DSetCurQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type DSetCurQuorumFn func(c *Configuration, replies []*NewCurReply) (*NewCurReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type DSetCurQuorumFn func(c *Configuration, replies []*NewCurReply, mids []int) (*NewCurReply, bool)
 
 // SpSnOneQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type SpSnOneQuorumFn func(c *Configuration, replies []*SWriteNReply) (*SWriteNReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type SpSnOneQuorumFn func(c *Configuration, replies []*SWriteNReply, mids []int) (*SWriteNReply, bool)
 
 // SCommitQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type SCommitQuorumFn func(c *Configuration, replies []*CommitReply) (*CommitReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type SCommitQuorumFn func(c *Configuration, replies []*CommitReply, mids []int) (*CommitReply, bool)
 
 // SSetStateQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type SSetStateQuorumFn func(c *Configuration, replies []*SStateReply) (*SStateReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type SSetStateQuorumFn func(c *Configuration, replies []*SStateReply, mids []int) (*SStateReply, bool)
 
 // SSetCurQuorumFn is used to pick a reply from the replies if there is a quorum.
 // If there was not enough replies to satisfy the quorum requirement,
 // then the function returns (nil, false). Otherwise, the function picks a
 // reply among the replies and returns (reply, true).
-type SSetCurQuorumFn func(c *Configuration, replies []*NewCurReply) (*NewCurReply, bool)
+// The replies were sent by the machines with the local ids in mids, in order.
+type SSetCurQuorumFn func(c *Configuration, replies []*NewCurReply, mids []int) (*NewCurReply, bool)
 
 /* Gorums Client API */
 
@@ -1364,8 +1486,8 @@ func (r AReadSReply) String() string {
 
 // AReadSReply invokes a AReadS RPC on configuration c
 // and returns the result as a AReadSReply.
-func (c *Configuration) AReadS(args *Conf) (*AReadSReply, error) {
-	return c.mgr.aReadS(c.id, args)
+func (c *Configuration) AReadS(ctx context.Context, args *Conf) (*AReadSReply, error) {
+	return c.mgr.aReadS(ctx, c.id, args)
 }
 
 // AReadSFuture is a reference to an asynchronous AReadS RPC invocation.
@@ -1378,12 +1500,12 @@ type AReadSFuture struct {
 // AReadSFuture asynchronously invokes a AReadS RPC on configuration c and
 // returns a AReadSFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) AReadSFuture(args *Conf) *AReadSFuture {
+func (c *Configuration) AReadSFuture(ctx context.Context, args *Conf) *AReadSFuture {
 	f := new(AReadSFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.aReadS(c.id, args)
+		f.reply, f.err = c.mgr.aReadS(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1409,8 +1531,8 @@ func (r AWriteSReply) String() string {
 
 // AWriteSReply invokes a AWriteS RPC on configuration c
 // and returns the result as a AWriteSReply.
-func (c *Configuration) AWriteS(args *WriteS) (*AWriteSReply, error) {
-	return c.mgr.aWriteS(c.id, args)
+func (c *Configuration) AWriteS(ctx context.Context, args *WriteS) (*AWriteSReply, error) {
+	return c.mgr.aWriteS(ctx, c.id, args)
 }
 
 // AWriteSFuture is a reference to an asynchronous AWriteS RPC invocation.
@@ -1423,12 +1545,12 @@ type AWriteSFuture struct {
 // AWriteSFuture asynchronously invokes a AWriteS RPC on configuration c and
 // returns a AWriteSFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) AWriteSFuture(args *WriteS) *AWriteSFuture {
+func (c *Configuration) AWriteSFuture(ctx context.Context, args *WriteS) *AWriteSFuture {
 	f := new(AWriteSFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.aWriteS(c.id, args)
+		f.reply, f.err = c.mgr.aWriteS(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1454,8 +1576,8 @@ func (r AWriteNReply) String() string {
 
 // AWriteNReply invokes a AWriteN RPC on configuration c
 // and returns the result as a AWriteNReply.
-func (c *Configuration) AWriteN(args *WriteN) (*AWriteNReply, error) {
-	return c.mgr.aWriteN(c.id, args)
+func (c *Configuration) AWriteN(ctx context.Context, args *WriteN) (*AWriteNReply, error) {
+	return c.mgr.aWriteN(ctx, c.id, args)
 }
 
 // AWriteNFuture is a reference to an asynchronous AWriteN RPC invocation.
@@ -1468,12 +1590,12 @@ type AWriteNFuture struct {
 // AWriteNFuture asynchronously invokes a AWriteN RPC on configuration c and
 // returns a AWriteNFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) AWriteNFuture(args *WriteN) *AWriteNFuture {
+func (c *Configuration) AWriteNFuture(ctx context.Context, args *WriteN) *AWriteNFuture {
 	f := new(AWriteNFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.aWriteN(c.id, args)
+		f.reply, f.err = c.mgr.aWriteN(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1499,8 +1621,8 @@ func (r SetCurReply) String() string {
 
 // SetCurReply invokes a SetCur RPC on configuration c
 // and returns the result as a SetCurReply.
-func (c *Configuration) SetCur(args *NewCur) (*SetCurReply, error) {
-	return c.mgr.setCur(c.id, args)
+func (c *Configuration) SetCur(ctx context.Context, args *NewCur) (*SetCurReply, error) {
+	return c.mgr.setCur(ctx, c.id, args)
 }
 
 // SetCurFuture is a reference to an asynchronous SetCur RPC invocation.
@@ -1513,12 +1635,12 @@ type SetCurFuture struct {
 // SetCurFuture asynchronously invokes a SetCur RPC on configuration c and
 // returns a SetCurFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) SetCurFuture(args *NewCur) *SetCurFuture {
+func (c *Configuration) SetCurFuture(ctx context.Context, args *NewCur) *SetCurFuture {
 	f := new(SetCurFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.setCur(c.id, args)
+		f.reply, f.err = c.mgr.setCur(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1544,8 +1666,8 @@ func (r LAPropReply) String() string {
 
 // LAPropReply invokes a LAProp RPC on configuration c
 // and returns the result as a LAPropReply.
-func (c *Configuration) LAProp(args *LAProposal) (*LAPropReply, error) {
-	return c.mgr.lAProp(c.id, args)
+func (c *Configuration) LAProp(ctx context.Context, args *LAProposal) (*LAPropReply, error) {
+	return c.mgr.lAProp(ctx, c.id, args)
 }
 
 // LAPropFuture is a reference to an asynchronous LAProp RPC invocation.
@@ -1558,12 +1680,12 @@ type LAPropFuture struct {
 // LAPropFuture asynchronously invokes a LAProp RPC on configuration c and
 // returns a LAPropFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) LAPropFuture(args *LAProposal) *LAPropFuture {
+func (c *Configuration) LAPropFuture(ctx context.Context, args *LAProposal) *LAPropFuture {
 	f := new(LAPropFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.lAProp(c.id, args)
+		f.reply, f.err = c.mgr.lAProp(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1589,8 +1711,8 @@ func (r SetStateReply) String() string {
 
 // SetStateReply invokes a SetState RPC on configuration c
 // and returns the result as a SetStateReply.
-func (c *Configuration) SetState(args *NewState) (*SetStateReply, error) {
-	return c.mgr.setState(c.id, args)
+func (c *Configuration) SetState(ctx context.Context, args *NewState) (*SetStateReply, error) {
+	return c.mgr.setState(ctx, c.id, args)
 }
 
 // SetStateFuture is a reference to an asynchronous SetState RPC invocation.
@@ -1603,12 +1725,12 @@ type SetStateFuture struct {
 // SetStateFuture asynchronously invokes a SetState RPC on configuration c and
 // returns a SetStateFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) SetStateFuture(args *NewState) *SetStateFuture {
+func (c *Configuration) SetStateFuture(ctx context.Context, args *NewState) *SetStateFuture {
 	f := new(SetStateFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.setState(c.id, args)
+		f.reply, f.err = c.mgr.setState(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1634,8 +1756,8 @@ func (r GetPromiseReply) String() string {
 
 // GetPromiseReply invokes a GetPromise RPC on configuration c
 // and returns the result as a GetPromiseReply.
-func (c *Configuration) GetPromise(args *Prepare) (*GetPromiseReply, error) {
-	return c.mgr.getPromise(c.id, args)
+func (c *Configuration) GetPromise(ctx context.Context, args *Prepare) (*GetPromiseReply, error) {
+	return c.mgr.getPromise(ctx, c.id, args)
 }
 
 // GetPromiseFuture is a reference to an asynchronous GetPromise RPC invocation.
@@ -1648,12 +1770,12 @@ type GetPromiseFuture struct {
 // GetPromiseFuture asynchronously invokes a GetPromise RPC on configuration c and
 // returns a GetPromiseFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) GetPromiseFuture(args *Prepare) *GetPromiseFuture {
+func (c *Configuration) GetPromiseFuture(ctx context.Context, args *Prepare) *GetPromiseFuture {
 	f := new(GetPromiseFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.getPromise(c.id, args)
+		f.reply, f.err = c.mgr.getPromise(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1679,8 +1801,8 @@ func (r AcceptReply) String() string {
 
 // AcceptReply invokes a Accept RPC on configuration c
 // and returns the result as a AcceptReply.
-func (c *Configuration) Accept(args *Propose) (*AcceptReply, error) {
-	return c.mgr.accept(c.id, args)
+func (c *Configuration) Accept(ctx context.Context, args *Propose) (*AcceptReply, error) {
+	return c.mgr.accept(ctx, c.id, args)
 }
 
 // AcceptFuture is a reference to an asynchronous Accept RPC invocation.
@@ -1693,12 +1815,12 @@ type AcceptFuture struct {
 // AcceptFuture asynchronously invokes a Accept RPC on configuration c and
 // returns a AcceptFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) AcceptFuture(args *Propose) *AcceptFuture {
+func (c *Configuration) AcceptFuture(ctx context.Context, args *Propose) *AcceptFuture {
 	f := new(AcceptFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.accept(c.id, args)
+		f.reply, f.err = c.mgr.accept(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1724,8 +1846,8 @@ func (r FwdReply) String() string {
 
 // FwdReply invokes a Fwd RPC on configuration c
 // and returns the result as a FwdReply.
-func (c *Configuration) Fwd(args *Proposal) (*FwdReply, error) {
-	return c.mgr.fwd(c.id, args)
+func (c *Configuration) Fwd(ctx context.Context, args *Proposal) (*FwdReply, error) {
+	return c.mgr.fwd(ctx, c.id, args)
 }
 
 // FwdFuture is a reference to an asynchronous Fwd RPC invocation.
@@ -1738,12 +1860,12 @@ type FwdFuture struct {
 // FwdFuture asynchronously invokes a Fwd RPC on configuration c and
 // returns a FwdFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) FwdFuture(args *Proposal) *FwdFuture {
+func (c *Configuration) FwdFuture(ctx context.Context, args *Proposal) *FwdFuture {
 	f := new(FwdFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.fwd(c.id, args)
+		f.reply, f.err = c.mgr.fwd(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1769,8 +1891,8 @@ func (r GetOneNReply) String() string {
 
 // GetOneNReply invokes a GetOneN RPC on configuration c
 // and returns the result as a GetOneNReply.
-func (c *Configuration) GetOneN(args *GetOne) (*GetOneNReply, error) {
-	return c.mgr.getOneN(c.id, args)
+func (c *Configuration) GetOneN(ctx context.Context, args *GetOne) (*GetOneNReply, error) {
+	return c.mgr.getOneN(ctx, c.id, args)
 }
 
 // GetOneNFuture is a reference to an asynchronous GetOneN RPC invocation.
@@ -1783,12 +1905,12 @@ type GetOneNFuture struct {
 // GetOneNFuture asynchronously invokes a GetOneN RPC on configuration c and
 // returns a GetOneNFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) GetOneNFuture(args *GetOne) *GetOneNFuture {
+func (c *Configuration) GetOneNFuture(ctx context.Context, args *GetOne) *GetOneNFuture {
 	f := new(GetOneNFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.getOneN(c.id, args)
+		f.reply, f.err = c.mgr.getOneN(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1814,8 +1936,8 @@ func (r DWriteNReply) String() string {
 
 // DWriteNReply invokes a DWriteN RPC on configuration c
 // and returns the result as a DWriteNReply.
-func (c *Configuration) DWriteN(args *DRead) (*DWriteNReply, error) {
-	return c.mgr.dWriteN(c.id, args)
+func (c *Configuration) DWriteN(ctx context.Context, args *DRead) (*DWriteNReply, error) {
+	return c.mgr.dWriteN(ctx, c.id, args)
 }
 
 // DWriteNFuture is a reference to an asynchronous DWriteN RPC invocation.
@@ -1828,12 +1950,12 @@ type DWriteNFuture struct {
 // DWriteNFuture asynchronously invokes a DWriteN RPC on configuration c and
 // returns a DWriteNFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) DWriteNFuture(args *DRead) *DWriteNFuture {
+func (c *Configuration) DWriteNFuture(ctx context.Context, args *DRead) *DWriteNFuture {
 	f := new(DWriteNFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.dWriteN(c.id, args)
+		f.reply, f.err = c.mgr.dWriteN(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1859,8 +1981,8 @@ func (r DSetStateReply) String() string {
 
 // DSetStateReply invokes a DSetState RPC on configuration c
 // and returns the result as a DSetStateReply.
-func (c *Configuration) DSetState(args *DNewState) (*DSetStateReply, error) {
-	return c.mgr.dSetState(c.id, args)
+func (c *Configuration) DSetState(ctx context.Context, args *DNewState) (*DSetStateReply, error) {
+	return c.mgr.dSetState(ctx, c.id, args)
 }
 
 // DSetStateFuture is a reference to an asynchronous DSetState RPC invocation.
@@ -1873,12 +1995,12 @@ type DSetStateFuture struct {
 // DSetStateFuture asynchronously invokes a DSetState RPC on configuration c and
 // returns a DSetStateFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) DSetStateFuture(args *DNewState) *DSetStateFuture {
+func (c *Configuration) DSetStateFuture(ctx context.Context, args *DNewState) *DSetStateFuture {
 	f := new(DSetStateFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.dSetState(c.id, args)
+		f.reply, f.err = c.mgr.dSetState(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1904,8 +2026,8 @@ func (r DWriteNSetReply) String() string {
 
 // DWriteNSetReply invokes a DWriteNSet RPC on configuration c
 // and returns the result as a DWriteNSetReply.
-func (c *Configuration) DWriteNSet(args *DWriteNs) (*DWriteNSetReply, error) {
-	return c.mgr.dWriteNSet(c.id, args)
+func (c *Configuration) DWriteNSet(ctx context.Context, args *DWriteNs) (*DWriteNSetReply, error) {
+	return c.mgr.dWriteNSet(ctx, c.id, args)
 }
 
 // DWriteNSetFuture is a reference to an asynchronous DWriteNSet RPC invocation.
@@ -1918,12 +2040,12 @@ type DWriteNSetFuture struct {
 // DWriteNSetFuture asynchronously invokes a DWriteNSet RPC on configuration c and
 // returns a DWriteNSetFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) DWriteNSetFuture(args *DWriteNs) *DWriteNSetFuture {
+func (c *Configuration) DWriteNSetFuture(ctx context.Context, args *DWriteNs) *DWriteNSetFuture {
 	f := new(DWriteNSetFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.dWriteNSet(c.id, args)
+		f.reply, f.err = c.mgr.dWriteNSet(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1949,8 +2071,8 @@ func (r DSetCurReply) String() string {
 
 // DSetCurReply invokes a DSetCur RPC on configuration c
 // and returns the result as a DSetCurReply.
-func (c *Configuration) DSetCur(args *NewCur) (*DSetCurReply, error) {
-	return c.mgr.dSetCur(c.id, args)
+func (c *Configuration) DSetCur(ctx context.Context, args *NewCur) (*DSetCurReply, error) {
+	return c.mgr.dSetCur(ctx, c.id, args)
 }
 
 // DSetCurFuture is a reference to an asynchronous DSetCur RPC invocation.
@@ -1963,12 +2085,12 @@ type DSetCurFuture struct {
 // DSetCurFuture asynchronously invokes a DSetCur RPC on configuration c and
 // returns a DSetCurFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) DSetCurFuture(args *NewCur) *DSetCurFuture {
+func (c *Configuration) DSetCurFuture(ctx context.Context, args *NewCur) *DSetCurFuture {
 	f := new(DSetCurFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.dSetCur(c.id, args)
+		f.reply, f.err = c.mgr.dSetCur(ctx, c.id, args)
 	}()
 	return f
 }
@@ -1994,8 +2116,8 @@ func (r SpSnOneReply) String() string {
 
 // SpSnOneReply invokes a SpSnOne RPC on configuration c
 // and returns the result as a SpSnOneReply.
-func (c *Configuration) SpSnOne(args *SWriteN) (*SpSnOneReply, error) {
-	return c.mgr.spSnOne(c.id, args)
+func (c *Configuration) SpSnOne(ctx context.Context, args *SWriteN) (*SpSnOneReply, error) {
+	return c.mgr.spSnOne(ctx, c.id, args)
 }
 
 // SpSnOneFuture is a reference to an asynchronous SpSnOne RPC invocation.
@@ -2008,12 +2130,12 @@ type SpSnOneFuture struct {
 // SpSnOneFuture asynchronously invokes a SpSnOne RPC on configuration c and
 // returns a SpSnOneFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) SpSnOneFuture(args *SWriteN) *SpSnOneFuture {
+func (c *Configuration) SpSnOneFuture(ctx context.Context, args *SWriteN) *SpSnOneFuture {
 	f := new(SpSnOneFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.spSnOne(c.id, args)
+		f.reply, f.err = c.mgr.spSnOne(ctx, c.id, args)
 	}()
 	return f
 }
@@ -2039,8 +2161,8 @@ func (r SCommitReply) String() string {
 
 // SCommitReply invokes a SCommit RPC on configuration c
 // and returns the result as a SCommitReply.
-func (c *Configuration) SCommit(args *Commit) (*SCommitReply, error) {
-	return c.mgr.sCommit(c.id, args)
+func (c *Configuration) SCommit(ctx context.Context, args *Commit) (*SCommitReply, error) {
+	return c.mgr.sCommit(ctx, c.id, args)
 }
 
 // SCommitFuture is a reference to an asynchronous SCommit RPC invocation.
@@ -2053,12 +2175,12 @@ type SCommitFuture struct {
 // SCommitFuture asynchronously invokes a SCommit RPC on configuration c and
 // returns a SCommitFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) SCommitFuture(args *Commit) *SCommitFuture {
+func (c *Configuration) SCommitFuture(ctx context.Context, args *Commit) *SCommitFuture {
 	f := new(SCommitFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.sCommit(c.id, args)
+		f.reply, f.err = c.mgr.sCommit(ctx, c.id, args)
 	}()
 	return f
 }
@@ -2084,8 +2206,8 @@ func (r SSetStateReply) String() string {
 
 // SSetStateReply invokes a SSetState RPC on configuration c
 // and returns the result as a SSetStateReply.
-func (c *Configuration) SSetState(args *SState) (*SSetStateReply, error) {
-	return c.mgr.sSetState(c.id, args)
+func (c *Configuration) SSetState(ctx context.Context, args *SState) (*SSetStateReply, error) {
+	return c.mgr.sSetState(ctx, c.id, args)
 }
 
 // SSetStateFuture is a reference to an asynchronous SSetState RPC invocation.
@@ -2098,12 +2220,12 @@ type SSetStateFuture struct {
 // SSetStateFuture asynchronously invokes a SSetState RPC on configuration c and
 // returns a SSetStateFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) SSetStateFuture(args *SState) *SSetStateFuture {
+func (c *Configuration) SSetStateFuture(ctx context.Context, args *SState) *SSetStateFuture {
 	f := new(SSetStateFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.sSetState(c.id, args)
+		f.reply, f.err = c.mgr.sSetState(ctx, c.id, args)
 	}()
 	return f
 }
@@ -2129,8 +2251,8 @@ func (r SSetCurReply) String() string {
 
 // SSetCurReply invokes a SSetCur RPC on configuration c
 // and returns the result as a SSetCurReply.
-func (c *Configuration) SSetCur(args *NewCur) (*SSetCurReply, error) {
-	return c.mgr.sSetCur(c.id, args)
+func (c *Configuration) SSetCur(ctx context.Context, args *NewCur) (*SSetCurReply, error) {
+	return c.mgr.sSetCur(ctx, c.id, args)
 }
 
 // SSetCurFuture is a reference to an asynchronous SSetCur RPC invocation.
@@ -2143,12 +2265,12 @@ type SSetCurFuture struct {
 // SSetCurFuture asynchronously invokes a SSetCur RPC on configuration c and
 // returns a SSetCurFuture which can be used to inspect the RPC reply and error
 // when available.
-func (c *Configuration) SSetCurFuture(args *NewCur) *SSetCurFuture {
+func (c *Configuration) SSetCurFuture(ctx context.Context, args *NewCur) *SSetCurFuture {
 	f := new(SSetCurFuture)
 	f.c = make(chan struct{}, 1)
 	go func() {
 		defer close(f.c)
-		f.reply, f.err = c.mgr.sSetCur(c.id, args)
+		f.reply, f.err = c.mgr.sSetCur(ctx, c.id, args)
 	}()
 	return f
 }
@@ -2168,7 +2290,7 @@ type aReadSReply struct {
 	err   error
 }
 
-func (m *Manager) aReadS(cid int, args *Conf) (*AReadSReply, error) {
+func (m *Manager) aReadS(ctx context.Context, cid int, args *Conf) (*AReadSReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2195,7 +2317,7 @@ func (m *Manager) aReadS(cid int, args *Conf) (*AReadSReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/AReadS",
 					args,
 					reply,
@@ -2234,9 +2356,11 @@ func (m *Manager) aReadS(cid int, args *Conf) (*AReadSReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.aReadSqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.aReadSqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2254,7 +2378,7 @@ type aWriteSReply struct {
 	err   error
 }
 
-func (m *Manager) aWriteS(cid int, args *WriteS) (*AWriteSReply, error) {
+func (m *Manager) aWriteS(ctx context.Context, cid int, args *WriteS) (*AWriteSReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2281,7 +2405,7 @@ func (m *Manager) aWriteS(cid int, args *WriteS) (*AWriteSReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/AWriteS",
 					args,
 					reply,
@@ -2320,9 +2444,11 @@ func (m *Manager) aWriteS(cid int, args *WriteS) (*AWriteSReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.aWriteSqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.aWriteSqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2340,7 +2466,7 @@ type aWriteNReply struct {
 	err   error
 }
 
-func (m *Manager) aWriteN(cid int, args *WriteN) (*AWriteNReply, error) {
+func (m *Manager) aWriteN(ctx context.Context, cid int, args *WriteN) (*AWriteNReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2367,7 +2493,7 @@ func (m *Manager) aWriteN(cid int, args *WriteN) (*AWriteNReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/AWriteN",
 					args,
 					reply,
@@ -2406,9 +2532,11 @@ func (m *Manager) aWriteN(cid int, args *WriteN) (*AWriteNReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.aWriteNqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.aWriteNqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2426,7 +2554,7 @@ type setCurReply struct {
 	err   error
 }
 
-func (m *Manager) setCur(cid int, args *NewCur) (*SetCurReply, error) {
+func (m *Manager) setCur(ctx context.Context, cid int, args *NewCur) (*SetCurReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2453,7 +2581,7 @@ func (m *Manager) setCur(cid int, args *NewCur) (*SetCurReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/SetCur",
 					args,
 					reply,
@@ -2492,9 +2620,11 @@ func (m *Manager) setCur(cid int, args *NewCur) (*SetCurReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.setCurqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.setCurqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2512,7 +2642,7 @@ type lAPropReply struct {
 	err   error
 }
 
-func (m *Manager) lAProp(cid int, args *LAProposal) (*LAPropReply, error) {
+func (m *Manager) lAProp(ctx context.Context, cid int, args *LAProposal) (*LAPropReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2539,7 +2669,7 @@ func (m *Manager) lAProp(cid int, args *LAProposal) (*LAPropReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/LAProp",
 					args,
 					reply,
@@ -2578,9 +2708,11 @@ func (m *Manager) lAProp(cid int, args *LAProposal) (*LAPropReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.lAPropqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.lAPropqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2598,7 +2730,7 @@ type setStateReply struct {
 	err   error
 }
 
-func (m *Manager) setState(cid int, args *NewState) (*SetStateReply, error) {
+func (m *Manager) setState(ctx context.Context, cid int, args *NewState) (*SetStateReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2625,7 +2757,7 @@ func (m *Manager) setState(cid int, args *NewState) (*SetStateReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/SetState",
 					args,
 					reply,
@@ -2664,9 +2796,11 @@ func (m *Manager) setState(cid int, args *NewState) (*SetStateReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.setStateqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.setStateqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2684,7 +2818,7 @@ type getPromiseReply struct {
 	err   error
 }
 
-func (m *Manager) getPromise(cid int, args *Prepare) (*GetPromiseReply, error) {
+func (m *Manager) getPromise(ctx context.Context, cid int, args *Prepare) (*GetPromiseReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2711,7 +2845,7 @@ func (m *Manager) getPromise(cid int, args *Prepare) (*GetPromiseReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/GetPromise",
 					args,
 					reply,
@@ -2750,9 +2884,11 @@ func (m *Manager) getPromise(cid int, args *Prepare) (*GetPromiseReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.getPromiseqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.getPromiseqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2770,7 +2906,7 @@ type acceptReply struct {
 	err   error
 }
 
-func (m *Manager) accept(cid int, args *Propose) (*AcceptReply, error) {
+func (m *Manager) accept(ctx context.Context, cid int, args *Propose) (*AcceptReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2797,7 +2933,7 @@ func (m *Manager) accept(cid int, args *Propose) (*AcceptReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/Accept",
 					args,
 					reply,
@@ -2836,9 +2972,11 @@ func (m *Manager) accept(cid int, args *Propose) (*AcceptReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.acceptqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.acceptqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2856,7 +2994,7 @@ type fwdReply struct {
 	err   error
 }
 
-func (m *Manager) fwd(cid int, args *Proposal) (*FwdReply, error) {
+func (m *Manager) fwd(ctx context.Context, cid int, args *Proposal) (*FwdReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2883,7 +3021,7 @@ func (m *Manager) fwd(cid int, args *Proposal) (*FwdReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.AdvRegister/Fwd",
 					args,
 					reply,
@@ -2922,9 +3060,11 @@ func (m *Manager) fwd(cid int, args *Proposal) (*FwdReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.fwdqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.fwdqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -2942,7 +3082,7 @@ type getOneNReply struct {
 	err   error
 }
 
-func (m *Manager) getOneN(cid int, args *GetOne) (*GetOneNReply, error) {
+func (m *Manager) getOneN(ctx context.Context, cid int, args *GetOne) (*GetOneNReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -2969,7 +3109,7 @@ func (m *Manager) getOneN(cid int, args *GetOne) (*GetOneNReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.DynaDisk/GetOneN",
 					args,
 					reply,
@@ -3008,9 +3148,11 @@ func (m *Manager) getOneN(cid int, args *GetOne) (*GetOneNReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.getOneNqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.getOneNqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3028,7 +3170,7 @@ type dWriteNReply struct {
 	err   error
 }
 
-func (m *Manager) dWriteN(cid int, args *DRead) (*DWriteNReply, error) {
+func (m *Manager) dWriteN(ctx context.Context, cid int, args *DRead) (*DWriteNReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3055,7 +3197,7 @@ func (m *Manager) dWriteN(cid int, args *DRead) (*DWriteNReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.DynaDisk/DWriteN",
 					args,
 					reply,
@@ -3094,9 +3236,11 @@ func (m *Manager) dWriteN(cid int, args *DRead) (*DWriteNReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.dWriteNqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.dWriteNqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3114,7 +3258,7 @@ type dSetStateReply struct {
 	err   error
 }
 
-func (m *Manager) dSetState(cid int, args *DNewState) (*DSetStateReply, error) {
+func (m *Manager) dSetState(ctx context.Context, cid int, args *DNewState) (*DSetStateReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3141,7 +3285,7 @@ func (m *Manager) dSetState(cid int, args *DNewState) (*DSetStateReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.DynaDisk/DSetState",
 					args,
 					reply,
@@ -3183,9 +3327,11 @@ func (m *Manager) dSetState(cid int, args *DNewState) (*DSetStateReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.dSetStateqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.dSetStateqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3203,7 +3349,7 @@ type dWriteNSetReply struct {
 	err   error
 }
 
-func (m *Manager) dWriteNSet(cid int, args *DWriteNs) (*DWriteNSetReply, error) {
+func (m *Manager) dWriteNSet(ctx context.Context, cid int, args *DWriteNs) (*DWriteNSetReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3230,7 +3376,7 @@ func (m *Manager) dWriteNSet(cid int, args *DWriteNs) (*DWriteNSetReply, error)
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.DynaDisk/DWriteNSet",
 					args,
 					reply,
@@ -3269,9 +3415,11 @@ func (m *Manager) dWriteNSet(cid int, args *DWriteNs) (*DWriteNSetReply, error)
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.dWriteNSetqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.dWriteNSetqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3289,7 +3437,7 @@ type dSetCurReply struct {
 	err   error
 }
 
-func (m *Manager) dSetCur(cid int, args *NewCur) (*DSetCurReply, error) {
+func (m *Manager) dSetCur(ctx context.Context, cid int, args *NewCur) (*DSetCurReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3316,7 +3464,7 @@ func (m *Manager) dSetCur(cid int, args *NewCur) (*DSetCurReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.DynaDisk/DSetCur",
 					args,
 					reply,
@@ -3355,9 +3503,11 @@ func (m *Manager) dSetCur(cid int, args *NewCur) (*DSetCurReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.dSetCurqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.dSetCurqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3375,7 +3525,7 @@ type spSnOneReply struct {
 	err   error
 }
 
-func (m *Manager) spSnOne(cid int, args *SWriteN) (*SpSnOneReply, error) {
+func (m *Manager) spSnOne(ctx context.Context, cid int, args *SWriteN) (*SpSnOneReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3402,7 +3552,7 @@ func (m *Manager) spSnOne(cid int, args *SWriteN) (*SpSnOneReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.SpSnRegister/SpSnOne",
 					args,
 					reply,
@@ -3441,9 +3591,11 @@ func (m *Manager) spSnOne(cid int, args *SWriteN) (*SpSnOneReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.spSnOneqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.spSnOneqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3461,7 +3613,7 @@ type sCommitReply struct {
 	err   error
 }
 
-func (m *Manager) sCommit(cid int, args *Commit) (*SCommitReply, error) {
+func (m *Manager) sCommit(ctx context.Context, cid int, args *Commit) (*SCommitReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3488,7 +3640,7 @@ func (m *Manager) sCommit(cid int, args *Commit) (*SCommitReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.SpSnRegister/SCommit",
 					args,
 					reply,
@@ -3527,9 +3679,11 @@ func (m *Manager) sCommit(cid int, args *Commit) (*SCommitReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.sCommitqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.sCommitqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3547,7 +3701,7 @@ type sSetStateReply struct {
 	err   error
 }
 
-func (m *Manager) sSetState(cid int, args *SState) (*SSetStateReply, error) {
+func (m *Manager) sSetState(ctx context.Context, cid int, args *SState) (*SSetStateReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3574,7 +3728,7 @@ func (m *Manager) sSetState(cid int, args *SState) (*SSetStateReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.SpSnRegister/SSetState",
 					args,
 					reply,
@@ -3613,9 +3767,11 @@ func (m *Manager) sSetState(cid int, args *SState) (*SSetStateReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.sSetStateqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.sSetStateqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3633,7 +3789,7 @@ type sSetCurReply struct {
 	err   error
 }
 
-func (m *Manager) sSetCur(cid int, args *NewCur) (*SSetCurReply, error) {
+func (m *Manager) sSetCur(ctx context.Context, cid int, args *NewCur) (*SSetCurReply, error) {
 	c, found := m.Configuration(cid)
 	if !found {
 		panic("execptional: config not found")
@@ -3660,7 +3816,7 @@ func (m *Manager) sSetCur(cid int, args *NewCur) (*SSetCurReply, error) {
 			go func() {
 				select {
 				case ce <- grpc.Invoke(
-					c.defCtx,
+					ctx,
 					"/proto.SpSnRegister/SSetCur",
 					args,
 					reply,
@@ -3699,9 +3855,11 @@ func (m *Manager) sSetCur(cid int, args *NewCur) (*SSetCurReply, error) {
 
 			replyValues = append(replyValues, r.reply)
 			reply.MachineIDs = append(reply.MachineIDs, r.mid)
-			if reply.Reply, quorum = m.sSetCurqf(c, replyValues); quorum {
+			if reply.Reply, quorum = m.sSetCurqf(c, replyValues, reply.MachineIDs); quorum {
 				return reply, nil
 			}
+		case <-ctx.Done():
+			return reply, ctx.Err()
 		case <-time.After(c.timeout):
 			return reply, TimeoutRPCError{c.timeout, errCount, len(replyValues)}
 		}
@@ -3726,7 +3884,6 @@ type Configuration struct {
 	mgr      *Manager
 	quorum   int
 	timeout  time.Duration
-	defCtx   context.Context
 }
 
 // ID reports the local identifier for the configuration.
@@ -3949,6 +4106,7 @@ func (m *Manager) Close() error {
 		return errors.New("manager already closed")
 	}
 	m.closed = true
+	m.closeSpecs()
 	m.closeStreamClients()
 	err := m.closeMachineConns()
 	if err != nil {
@@ -4205,7 +4363,6 @@ func (m *Manager) NewConfiguration(ids []int, quorumSize int, timeout time.Durat
 		mgr:      m,
 		quorum:   quorumSize,
 		timeout:  timeout,
-		defCtx:   context.Background(),
 	}
 	m.configs = append(m.configs, c)
 
@@ -4856,6 +5013,53 @@ func (m *State) MarshalTo(data []byte) (int, error) {
 		i++
 		i = encodeVarintDcSmartMerge(data, i, uint64(m.Writer))
 	}
+	if m.ValueLen != 0 {
+		data[i] = 0x20
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.ValueLen))
+	}
+	if m.Digest != nil {
+		if len(m.Digest) > 0 {
+			data[i] = 0x2a
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Digest)))
+			i += copy(data[i:], m.Digest)
+		}
+	}
+	return i, nil
+}
+
+func (m *KeyState) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *KeyState) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Key) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
+	}
+	if m.State != nil {
+		data[i] = 0x12
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.State.Size()))
+		n2, err := m.State.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
 	return i, nil
 }
 
@@ -4874,15 +5078,47 @@ func (m *Conf) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.This != 0 {
-		data[i] = 0x8
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.This.Size()))
+	n50, err := m.This.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n50
+	data[i] = 0x12
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.Cur.Size()))
+	n51, err := m.Cur.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n51
+	if len(m.Key) > 0 {
+		data[i] = 0x1a
 		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.This))
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
 	}
-	if m.Cur != 0 {
-		data[i] = 0x10
+	if m.AllKeys {
+		data[i] = 0x20
+		i++
+		if m.AllKeys {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
+	if m.Digest {
+		data[i] = 0x28
+		i++
+		if m.Digest {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
 		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.Cur))
 	}
 	return i, nil
 }
@@ -4962,6 +5198,27 @@ func (m *Node) MarshalTo(data []byte) (int, error) {
 		i++
 		i = encodeVarintDcSmartMerge(data, i, uint64(m.Version))
 	}
+	if m.Weight != 0 {
+		data[i] = 0x18
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.Weight))
+	}
+	if len(m.Zone) > 0 {
+		data[i] = 0x22
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Zone)))
+		i += copy(data[i:], m.Zone)
+	}
+	if m.Conflict {
+		data[i] = 0x28
+		i++
+		if m.Conflict {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -5002,6 +5259,54 @@ func (m *Blueprint) MarshalTo(data []byte) (int, error) {
 		i++
 		i = encodeVarintDcSmartMerge(data, i, uint64(m.Epoch))
 	}
+	if m.ReadQuorumSize != 0 {
+		data[i] = 0x28
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.ReadQuorumSize))
+	}
+	if m.WriteQuorumSize != 0 {
+		data[i] = 0x30
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.WriteQuorumSize))
+	}
+	if m.ZoneFaults != 0 {
+		data[i] = 0x38
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.ZoneFaults))
+	}
+	return i, nil
+}
+
+func (m *ConfID) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *ConfID) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Order != 0 {
+		data[i] = 0x8
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.Order))
+	}
+	if m.Digest != 0 {
+		data[i] = 0x11
+		i++
+		i = encodeFixed64DcSmartMerge(data, i, uint64(m.Digest))
+	}
+	if m.Epoch != 0 {
+		data[i] = 0x18
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(m.Epoch))
+	}
 	return i, nil
 }
 
@@ -5030,11 +5335,14 @@ func (m *NewCur) MarshalTo(data []byte) (int, error) {
 		}
 		i += n2
 	}
-	if m.CurC != 0 {
-		data[i] = 0x10
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC))
+	data[i] = 0x12
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC.Size()))
+	n52, err := m.CurC.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n52
 	return i, nil
 }
 
@@ -5129,6 +5437,18 @@ func (m *ReadReply) MarshalTo(data []byte) (int, error) {
 		}
 		i += n5
 	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x1a
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -5167,6 +5487,12 @@ func (m *WriteS) MarshalTo(data []byte) (int, error) {
 		}
 		i += n7
 	}
+	if len(m.Key) > 0 {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
+	}
 	return i, nil
 }
 
@@ -5185,11 +5511,14 @@ func (m *WriteN) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC.Size()))
+	n53, err := m.CurC.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n53
 	if m.Next != nil {
 		data[i] = 0x12
 		i++
@@ -5200,6 +5529,12 @@ func (m *WriteN) MarshalTo(data []byte) (int, error) {
 		}
 		i += n8
 	}
+	if len(m.Key) > 0 {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
+	}
 	return i, nil
 }
 
@@ -5248,6 +5583,18 @@ func (m *WriteNReply) MarshalTo(data []byte) (int, error) {
 		}
 		i += n11
 	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x22
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -5342,11 +5689,14 @@ func (m *NewState) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC.Size()))
+	n54, err := m.CurC.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n54
 	if m.State != nil {
 		data[i] = 0x12
 		i++
@@ -5367,6 +5717,24 @@ func (m *NewState) MarshalTo(data []byte) (int, error) {
 		}
 		i += n17
 	}
+	if len(m.Key) > 0 {
+		data[i] = 0x22
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
+	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x2a
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -5458,11 +5826,14 @@ func (m *Prepare) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC.Size()))
+	n55, err := m.CurC.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n55
 	if m.Rnd != 0 {
 		data[i] = 0x10
 		i++
@@ -5539,11 +5910,14 @@ func (m *Propose) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurC.Size()))
+	n56, err := m.CurC.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n56
 	if m.Val != nil {
 		data[i] = 0x12
 		i++
@@ -5812,6 +6186,18 @@ func (m *DReadReply) MarshalTo(data []byte) (int, error) {
 			i += n
 		}
 	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x22
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -5850,6 +6236,18 @@ func (m *DNewState) MarshalTo(data []byte) (int, error) {
 		}
 		i += n36
 	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x1a
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -5934,11 +6332,14 @@ func (m *SWriteN) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurL != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurL))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurL.Size()))
+	n57, err := m.CurL.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n57
 	if m.Cur != nil {
 		data[i] = 0x12
 		i++
@@ -5949,11 +6350,14 @@ func (m *SWriteN) MarshalTo(data []byte) (int, error) {
 		}
 		i += n40
 	}
-	if m.This != 0 {
-		data[i] = 0x18
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.This))
+	data[i] = 0x1a
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.This.Size()))
+	n58, err := m.This.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n58
 	if m.Rnd != 0 {
 		data[i] = 0x20
 		i++
@@ -5969,6 +6373,22 @@ func (m *SWriteN) MarshalTo(data []byte) (int, error) {
 		}
 		i += n41
 	}
+	if len(m.Key) > 0 {
+		data[i] = 0x32
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
+	}
+	if m.AllKeys {
+		data[i] = 0x38
+		i++
+		if m.AllKeys {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -6019,6 +6439,18 @@ func (m *SWriteNReply) MarshalTo(data []byte) (int, error) {
 		}
 		i += n43
 	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x22
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -6037,16 +6469,22 @@ func (m *Commit) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurL != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurL))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurL.Size()))
+	n59, err := m.CurL.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
-	if m.This != 0 {
-		data[i] = 0x10
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.This))
+	i += n59
+	data[i] = 0x12
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.This.Size()))
+	n60, err := m.This.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n60
 	if m.Rnd != 0 {
 		data[i] = 0x18
 		i++
@@ -6138,11 +6576,14 @@ func (m *SState) MarshalTo(data []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	if m.CurL != 0 {
-		data[i] = 0x8
-		i++
-		i = encodeVarintDcSmartMerge(data, i, uint64(m.CurL))
+	data[i] = 0xa
+	i++
+	i = encodeVarintDcSmartMerge(data, i, uint64(m.CurL.Size()))
+	n61, err := m.CurL.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
 	}
+	i += n61
 	if m.State != nil {
 		data[i] = 0x12
 		i++
@@ -6153,6 +6594,24 @@ func (m *SState) MarshalTo(data []byte) (int, error) {
 		}
 		i += n48
 	}
+	if len(m.Key) > 0 {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintDcSmartMerge(data, i, uint64(len(m.Key)))
+		i += copy(data[i:], m.Key)
+	}
+	if len(m.KStates) > 0 {
+		for _, msg := range m.KStates {
+			data[i] = 0x22
+			i++
+			i = encodeVarintDcSmartMerge(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -6236,17 +6695,48 @@ func (m *State) Size() (n int) {
 	if m.Writer != 0 {
 		n += 1 + sovDcSmartMerge(uint64(m.Writer))
 	}
+	if m.ValueLen != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.ValueLen))
+	}
+	if m.Digest != nil {
+		l = len(m.Digest)
+		if l > 0 {
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *KeyState) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
+	if m.State != nil {
+		l = m.State.Size()
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
 	return n
 }
 
 func (m *Conf) Size() (n int) {
 	var l int
 	_ = l
-	if m.This != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.This))
+	l = m.This.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
+	l = m.Cur.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
+	if m.AllKeys {
+		n += 2
 	}
-	if m.Cur != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.Cur))
+	if m.Digest {
+		n += 2
 	}
 	return n
 }
@@ -6279,6 +6769,16 @@ func (m *Node) Size() (n int) {
 	if m.Version != 0 {
 		n += 1 + sovDcSmartMerge(uint64(m.Version))
 	}
+	if m.Weight != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.Weight))
+	}
+	l = len(m.Zone)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
+	if m.Conflict {
+		n += 2
+	}
 	return n
 }
 
@@ -6297,6 +6797,30 @@ func (m *Blueprint) Size() (n int) {
 	if m.Epoch != 0 {
 		n += 1 + sovDcSmartMerge(uint64(m.Epoch))
 	}
+	if m.ReadQuorumSize != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.ReadQuorumSize))
+	}
+	if m.WriteQuorumSize != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.WriteQuorumSize))
+	}
+	if m.ZoneFaults != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.ZoneFaults))
+	}
+	return n
+}
+
+func (m *ConfID) Size() (n int) {
+	var l int
+	_ = l
+	if m.Order != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.Order))
+	}
+	if m.Digest != 0 {
+		n += 9
+	}
+	if m.Epoch != 0 {
+		n += 1 + sovDcSmartMerge(uint64(m.Epoch))
+	}
 	return n
 }
 
@@ -6307,9 +6831,8 @@ func (m *NewCur) Size() (n int) {
 		l = m.Cur.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
-	if m.CurC != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurC))
-	}
+	l = m.CurC.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	return n
 }
 
@@ -6343,6 +6866,12 @@ func (m *ReadReply) Size() (n int) {
 		l = m.Cur.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -6357,19 +6886,26 @@ func (m *WriteS) Size() (n int) {
 		l = m.Conf.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
 	return n
 }
 
 func (m *WriteN) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurC))
-	}
+	l = m.CurC.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.Next != nil {
 		l = m.Next.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
 	return n
 }
 
@@ -6388,6 +6924,12 @@ func (m *WriteNReply) Size() (n int) {
 		l = m.LAState.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -6422,9 +6964,8 @@ func (m *LAReply) Size() (n int) {
 func (m *NewState) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurC))
-	}
+	l = m.CurC.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.State != nil {
 		l = m.State.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
@@ -6433,6 +6974,16 @@ func (m *NewState) Size() (n int) {
 		l = m.LAState.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -6468,9 +7019,8 @@ func (m *CV) Size() (n int) {
 func (m *Prepare) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurC))
-	}
+	l = m.CurC.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.Rnd != 0 {
 		n += 1 + sovDcSmartMerge(uint64(m.Rnd))
 	}
@@ -6501,9 +7051,8 @@ func (m *Promise) Size() (n int) {
 func (m *Propose) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurC != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurC))
-	}
+	l = m.CurC.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.Val != nil {
 		l = m.Val.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
@@ -6603,6 +7152,12 @@ func (m *DReadReply) Size() (n int) {
 			n += 1 + l + sovDcSmartMerge(uint64(l))
 		}
 	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -6617,6 +7172,12 @@ func (m *DNewState) Size() (n int) {
 		l = m.State.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -6647,16 +7208,14 @@ func (m *DWriteNsReply) Size() (n int) {
 func (m *SWriteN) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurL != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurL))
-	}
+	l = m.CurL.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.Cur != nil {
 		l = m.Cur.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
-	if m.This != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.This))
-	}
+	l = m.This.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.Rnd != 0 {
 		n += 1 + sovDcSmartMerge(uint64(m.Rnd))
 	}
@@ -6664,6 +7223,13 @@ func (m *SWriteN) Size() (n int) {
 		l = m.Prop.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
+	if m.AllKeys {
+		n += 2
+	}
 	return n
 }
 
@@ -6684,18 +7250,22 @@ func (m *SWriteNReply) Size() (n int) {
 		l = m.State.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
 func (m *Commit) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurL != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurL))
-	}
-	if m.This != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.This))
-	}
+	l = m.CurL.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
+	l = m.This.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.Rnd != 0 {
 		n += 1 + sovDcSmartMerge(uint64(m.Rnd))
 	}
@@ -6730,13 +7300,22 @@ func (m *CommitReply) Size() (n int) {
 func (m *SState) Size() (n int) {
 	var l int
 	_ = l
-	if m.CurL != 0 {
-		n += 1 + sovDcSmartMerge(uint64(m.CurL))
-	}
+	l = m.CurL.Size()
+	n += 1 + l + sovDcSmartMerge(uint64(l))
 	if m.State != nil {
 		l = m.State.Size()
 		n += 1 + l + sovDcSmartMerge(uint64(l))
 	}
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovDcSmartMerge(uint64(l))
+	}
+	if len(m.KStates) > 0 {
+		for _, e := range m.KStates {
+			l = e.Size()
+			n += 1 + l + sovDcSmartMerge(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -6861,6 +7440,53 @@ func (m *State) Unmarshal(data []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ValueLen", wireType)
+			}
+			m.ValueLen = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.ValueLen |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Digest", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Digest = append([]byte{}, data[iNdEx:postIndex]...)
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -6882,7 +7508,7 @@ func (m *State) Unmarshal(data []byte) error {
 	}
 	return nil
 }
-func (m *Conf) Unmarshal(data []byte) error {
+func (m *KeyState) Unmarshal(data []byte) error {
 	l := len(data)
 	iNdEx := 0
 	for iNdEx < l {
@@ -6905,17 +7531,17 @@ func (m *Conf) Unmarshal(data []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Conf: wiretype end group for non-group")
+			return fmt.Errorf("proto: KeyState: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: Conf: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: KeyState: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field This", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
 			}
-			m.This = 0
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -6925,16 +7551,26 @@ func (m *Conf) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.This |= (uint32(b) & 0x7F) << shift
+				stringLen |= (uint64(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Cur", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
 			}
-			m.Cur = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -6944,11 +7580,25 @@ func (m *Conf) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.Cur |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.State == nil {
+				m.State = &State{}
+			}
+			if err := m.State.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -6970,7 +7620,7 @@ func (m *Conf) Unmarshal(data []byte) error {
 	}
 	return nil
 }
-func (m *ConfReply) Unmarshal(data []byte) error {
+func (m *Conf) Unmarshal(data []byte) error {
 	l := len(data)
 	iNdEx := 0
 	for iNdEx < l {
@@ -6993,15 +7643,15 @@ func (m *ConfReply) Unmarshal(data []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: ConfReply: wiretype end group for non-group")
+			return fmt.Errorf("proto: Conf: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: ConfReply: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: Conf: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Cur", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field This", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -7025,18 +7675,15 @@ func (m *ConfReply) Unmarshal(data []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.Cur == nil {
-				m.Cur = &Blueprint{}
-			}
-			if err := m.Cur.Unmarshal(data[iNdEx:postIndex]); err != nil {
+			if err := m.This.Unmarshal(data[iNdEx:postIndex]); err != nil {
 				return err
 			}
 			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Abort", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Cur", wireType)
 			}
-			var v int
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7046,17 +7693,27 @@ func (m *ConfReply) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				v |= (int(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			m.Abort = bool(v != 0)
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Cur.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 3:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Next", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7066,23 +7723,61 @@ func (m *ConfReply) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				msglen |= (int(b) & 0x7F) << shift
+				stringLen |= (uint64(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthDcSmartMerge
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Next = append(m.Next, &Blueprint{})
-			if err := m.Next[len(m.Next)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.Key = string(data[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AllKeys", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.AllKeys = bool(v != 0)
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Digest", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Digest = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -7104,7 +7799,7 @@ func (m *ConfReply) Unmarshal(data []byte) error {
 	}
 	return nil
 }
-func (m *Node) Unmarshal(data []byte) error {
+func (m *ConfReply) Unmarshal(data []byte) error {
 	l := len(data)
 	iNdEx := 0
 	for iNdEx < l {
@@ -7127,7 +7822,141 @@ func (m *Node) Unmarshal(data []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Node: wiretype end group for non-group")
+			return fmt.Errorf("proto: ConfReply: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ConfReply: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Cur", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Cur == nil {
+				m.Cur = &Blueprint{}
+			}
+			if err := m.Cur.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Abort", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Abort = bool(v != 0)
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Next", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Next = append(m.Next, &Blueprint{})
+			if err := m.Next[len(m.Next)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipDcSmartMerge(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Node) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowDcSmartMerge
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Node: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
 			return fmt.Errorf("proto: Node: illegal tag %d (wire type %d)", fieldNum, wire)
@@ -7135,9 +7964,253 @@ func (m *Node) Unmarshal(data []byte) error {
 		switch fieldNum {
 		case 1:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Id", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Id", wireType)
+			}
+			m.Id = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Id |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Version |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Weight", wireType)
+			}
+			m.Weight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Weight |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Zone", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Zone = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Conflict", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Conflict = bool(v != 0)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipDcSmartMerge(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Blueprint) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowDcSmartMerge
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Blueprint: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Blueprint: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nodes", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Nodes = append(m.Nodes, &Node{})
+			if err := m.Nodes[len(m.Nodes)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FaultTolerance", wireType)
+			}
+			m.FaultTolerance = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.FaultTolerance |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Epoch", wireType)
+			}
+			m.Epoch = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Epoch |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ReadQuorumSize", wireType)
+			}
+			m.ReadQuorumSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.ReadQuorumSize |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WriteQuorumSize", wireType)
 			}
-			m.Id = 0
+			m.WriteQuorumSize = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7147,16 +8220,16 @@ func (m *Node) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.Id |= (uint32(b) & 0x7F) << shift
+				m.WriteQuorumSize |= (uint32(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-		case 2:
+		case 7:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field ZoneFaults", wireType)
 			}
-			m.Version = 0
+			m.ZoneFaults = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7166,7 +8239,7 @@ func (m *Node) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.Version |= (uint32(b) & 0x7F) << shift
+				m.ZoneFaults |= (uint32(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
@@ -7192,7 +8265,7 @@ func (m *Node) Unmarshal(data []byte) error {
 	}
 	return nil
 }
-func (m *Blueprint) Unmarshal(data []byte) error {
+func (m *ConfID) Unmarshal(data []byte) error {
 	l := len(data)
 	iNdEx := 0
 	for iNdEx < l {
@@ -7215,17 +8288,17 @@ func (m *Blueprint) Unmarshal(data []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Blueprint: wiretype end group for non-group")
+			return fmt.Errorf("proto: ConfID: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: Blueprint: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ConfID: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Nodes", wireType)
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Order", wireType)
 			}
-			var msglen int
+			m.Order = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7235,43 +8308,29 @@ func (m *Blueprint) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				msglen |= (int(b) & 0x7F) << shift
+				m.Order |= (uint64(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
-				return ErrInvalidLengthDcSmartMerge
+		case 2:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Digest", wireType)
 			}
-			postIndex := iNdEx + msglen
-			if postIndex > l {
+			m.Digest = 0
+			if (iNdEx + 8) > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Nodes = append(m.Nodes, &Node{})
-			if err := m.Nodes[len(m.Nodes)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
-				return err
-			}
-			iNdEx = postIndex
+			iNdEx += 8
+			m.Digest = uint64(data[iNdEx-8])
+			m.Digest |= uint64(data[iNdEx-7]) << 8
+			m.Digest |= uint64(data[iNdEx-6]) << 16
+			m.Digest |= uint64(data[iNdEx-5]) << 24
+			m.Digest |= uint64(data[iNdEx-4]) << 32
+			m.Digest |= uint64(data[iNdEx-3]) << 40
+			m.Digest |= uint64(data[iNdEx-2]) << 48
+			m.Digest |= uint64(data[iNdEx-1]) << 56
 		case 3:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field FaultTolerance", wireType)
-			}
-			m.FaultTolerance = 0
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowDcSmartMerge
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := data[iNdEx]
-				iNdEx++
-				m.FaultTolerance |= (uint32(b) & 0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-		case 4:
 			if wireType != 0 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Epoch", wireType)
 			}
@@ -7311,6 +8370,7 @@ func (m *Blueprint) Unmarshal(data []byte) error {
 	}
 	return nil
 }
+
 func (m *NewCur) Unmarshal(data []byte) error {
 	l := len(data)
 	iNdEx := 0
@@ -7374,10 +8434,10 @@ func (m *NewCur) Unmarshal(data []byte) error {
 			}
 			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurC", wireType)
 			}
-			m.CurC = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7387,11 +8447,22 @@ func (m *NewCur) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurC |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurC.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -7661,6 +8732,37 @@ func (m *ReadReply) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -7777,6 +8879,35 @@ func (m *WriteS) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -7828,10 +8959,10 @@ func (m *WriteN) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurC", wireType)
 			}
-			m.CurC = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -7841,11 +8972,22 @@ func (m *WriteN) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurC |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurC.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Next", wireType)
@@ -7879,6 +9021,35 @@ func (m *WriteN) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -8028,6 +9199,37 @@ func (m *WriteNReply) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -8311,10 +9513,10 @@ func (m *NewState) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurC", wireType)
 			}
-			m.CurC = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -8324,11 +9526,22 @@ func (m *NewState) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurC |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurC.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
@@ -8395,6 +9608,66 @@ func (m *NewState) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -8662,10 +9935,10 @@ func (m *Prepare) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurC", wireType)
 			}
-			m.CurC = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -8675,11 +9948,22 @@ func (m *Prepare) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurC |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurC.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 0 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Rnd", wireType)
@@ -8918,10 +10202,10 @@ func (m *Propose) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurC", wireType)
 			}
-			m.CurC = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -8931,11 +10215,22 @@ func (m *Propose) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurC |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurC.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Val", wireType)
@@ -9733,6 +11028,37 @@ func (m *DReadReply) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -9849,6 +11175,37 @@ func (m *DNewState) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -10099,10 +11456,10 @@ func (m *SWriteN) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurL", wireType)
 			}
-			m.CurL = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -10112,11 +11469,22 @@ func (m *SWriteN) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurL |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurL.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Cur", wireType)
@@ -10151,10 +11519,10 @@ func (m *SWriteN) Unmarshal(data []byte) error {
 			}
 			iNdEx = postIndex
 		case 3:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field This", wireType)
 			}
-			m.This = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -10164,11 +11532,22 @@ func (m *SWriteN) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.This |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.This.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 4:
 			if wireType != 0 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Rnd", wireType)
@@ -10221,6 +11600,55 @@ func (m *SWriteN) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AllKeys", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.AllKeys = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -10368,6 +11796,37 @@ func (m *SWriteNReply) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -10419,10 +11878,10 @@ func (m *Commit) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurL", wireType)
 			}
-			m.CurL = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -10432,16 +11891,27 @@ func (m *Commit) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurL |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurL.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field This", wireType)
 			}
-			m.This = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -10451,11 +11921,22 @@ func (m *Commit) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.This |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.This.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 3:
 			if wireType != 0 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Rnd", wireType)
@@ -10728,10 +12209,10 @@ func (m *SState) Unmarshal(data []byte) error {
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
+			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CurL", wireType)
 			}
-			m.CurL = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowDcSmartMerge
@@ -10741,11 +12222,22 @@ func (m *SState) Unmarshal(data []byte) error {
 				}
 				b := data[iNdEx]
 				iNdEx++
-				m.CurL |= (uint32(b) & 0x7F) << shift
+				msglen |= (int(b) & 0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.CurL.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
@@ -10779,6 +12271,66 @@ func (m *SState) Unmarshal(data []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field KStates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDcSmartMerge
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDcSmartMerge
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.KStates = append(m.KStates, &KeyState{})
+			if err := m.KStates[len(m.KStates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDcSmartMerge(data[iNdEx:])
@@ -0,0 +1,127 @@
+// Code generated by protoc-gen-gogo.
+// source: lease.proto
+// DO NOT EDIT!
+
+package proto
+
+import proto1 "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto1.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type LeaseRequest struct {
+	Conf   *Conf  `protobuf:"bytes,1,opt,name=Conf" json:"Conf,omitempty"`
+	State  *State `protobuf:"bytes,2,opt,name=State" json:"State,omitempty"`
+	Client uint32 `protobuf:"varint,3,opt,name=Client,proto3" json:"Client,omitempty"`
+	Dur    int64  `protobuf:"varint,4,opt,name=Dur,proto3" json:"Dur,omitempty"`
+}
+
+func (m *LeaseRequest) Reset()         { *m = LeaseRequest{} }
+func (m *LeaseRequest) String() string { return proto1.CompactTextString(m) }
+func (*LeaseRequest) ProtoMessage()    {}
+
+func (m *LeaseRequest) GetConf() *Conf {
+	if m != nil {
+		return m.Conf
+	}
+	return nil
+}
+
+func (m *LeaseRequest) GetState() *State {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+type LeaseReply struct {
+	Cur *ConfReply `protobuf:"bytes,1,opt,name=Cur" json:"Cur,omitempty"`
+	Ok  bool       `protobuf:"varint,2,opt,name=Ok,proto3" json:"Ok,omitempty"`
+	Dur int64      `protobuf:"varint,3,opt,name=Dur,proto3" json:"Dur,omitempty"`
+}
+
+func (m *LeaseReply) Reset()         { *m = LeaseReply{} }
+func (m *LeaseReply) String() string { return proto1.CompactTextString(m) }
+func (*LeaseReply) ProtoMessage()    {}
+
+func (m *LeaseReply) GetCur() *ConfReply {
+	if m != nil {
+		return m.Cur
+	}
+	return nil
+}
+
+func init() {
+	proto1.RegisterType((*LeaseRequest)(nil), "proto.LeaseRequest")
+	proto1.RegisterType((*LeaseReply)(nil), "proto.LeaseReply")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Lease service
+
+type LeaseClient interface {
+	Lease(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (*LeaseReply, error)
+}
+
+type leaseClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewLeaseClient(cc *grpc.ClientConn) LeaseClient {
+	return &leaseClient{cc}
+}
+
+func (c *leaseClient) Lease(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (*LeaseReply, error) {
+	out := new(LeaseReply)
+	err := grpc.Invoke(ctx, "/proto.Lease/Lease", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Lease service
+
+type LeaseServer interface {
+	Lease(context.Context, *LeaseRequest) (*LeaseReply, error)
+}
+
+func RegisterLeaseServer(s *grpc.Server, srv LeaseServer) {
+	s.RegisterService(&_Lease_serviceDesc, srv)
+}
+
+func _Lease_Lease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(LeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(LeaseServer).Lease(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _Lease_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Lease",
+	HandlerType: (*LeaseServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lease",
+			Handler:    _Lease_Lease_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -0,0 +1,51 @@
+package proto
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// LeaseDrift bounds the rate at which the clocks of clients and servers may
+// drift apart, e.g. 0.01 for 1%. A server holds a lease a little longer, and
+// a client trusts it a little shorter, than the duration granted.
+var LeaseDrift = 0.01
+
+// HoldLease returns how long a server holds a lease granted for d.
+func HoldLease(d time.Duration) time.Duration {
+	return d + time.Duration(float64(d)*LeaseDrift)
+}
+
+// TrustLease returns how long a client may use a lease granted for d,
+// counted from before it asked for the lease.
+func TrustLease(d time.Duration) time.Duration {
+	return d - time.Duration(float64(d)*LeaseDrift)
+}
+
+func (m *LeaseReply) ok() bool   { return m.Ok }
+func (m *LeaseReply) stop() bool { return !m.Ok }
+
+// Lease asks the servers in c for a lease on the state in r. The reply is Ok,
+// if a quorum granted it, and Dur is then the shortest duration granted. If a
+// server refused, because it holds a newer state or the configuration moved
+// on, its reply is returned.
+func (c *Configuration) Lease(ctx context.Context, r *LeaseRequest) (*LeaseReply, error) {
+	replies, mids, err := c.callAll(ctx, func(ctx context.Context, cc *grpc.ClientConn) (quorumReply, error) {
+		return NewLeaseClient(cc).Lease(ctx, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rep := &LeaseReply{Ok: c.isQuorum(mids), Dur: r.Dur}
+	for _, q := range replies {
+		lr := q.(*LeaseReply)
+		if !lr.Ok {
+			return lr, nil
+		}
+		if lr.Dur < rep.Dur {
+			rep.Dur = lr.Dur
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,180 @@
+package proto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// quorumSpec holds what a weighted or zoned configuration adds to the
+// generated Configuration.
+type quorumSpec struct {
+	rquorum int
+	weights map[int]int
+	zones   map[int]string
+	zspan   int
+}
+
+// specs maps the weighted and zoned configurations of each Manager to their
+// quorumSpec, until the Manager is closed. Configurations from
+// NewConfiguration have none.
+var specs = struct {
+	sync.RWMutex
+	m map[*Manager]map[*Configuration]*quorumSpec
+}{m: make(map[*Manager]map[*Configuration]*quorumSpec)}
+
+var noSpec = &quorumSpec{}
+
+func setSpec(c *Configuration, s *quorumSpec) {
+	specs.Lock()
+	if specs.m[c.mgr] == nil {
+		specs.m[c.mgr] = make(map[*Configuration]*quorumSpec)
+	}
+	specs.m[c.mgr][c] = s
+	specs.Unlock()
+}
+
+// spec returns the quorumSpec of c, or an empty one.
+func (c *Configuration) spec() *quorumSpec {
+	specs.RLock()
+	s, ok := specs.m[c.mgr][c]
+	specs.RUnlock()
+	if !ok {
+		return noSpec
+	}
+	return s
+}
+
+// closeSpecs drops the quorumSpecs of m's configurations, it is called by
+// Close.
+func (m *Manager) closeSpecs() {
+	specs.Lock()
+	delete(specs.m, m)
+	specs.Unlock()
+}
+
+// NewWeightedConfiguration returns a new configuration given a set of machine
+// ids, their weights, a quorum size, which is the weight a quorum must have,
+// and the weight of a read quorum. If weights is nil, every machine has
+// weight 1. If readQuorum is 0, a read quorum intersects every quorum.
+func (m *Manager) NewWeightedConfiguration(ids []int, weights []int, quorumSize, readQuorum int, timeout time.Duration) (*Configuration, error) {
+	return m.NewZonedConfiguration(ids, weights, nil, 0, quorumSize, readQuorum, timeout)
+}
+
+// NewZonedConfiguration is NewWeightedConfiguration, where the machines are
+// also placed in zones, and the replies to a write must come from at least
+// span different zones. If zones is nil or span is at most 1, zones are
+// ignored.
+func (m *Manager) NewZonedConfiguration(ids []int, weights []int, zones []string, span, quorumSize, readQuorum int, timeout time.Duration) (*Configuration, error) {
+	if weights == nil && (zones == nil || span <= 1) && readQuorum == 0 {
+		return m.NewConfiguration(ids, quorumSize, timeout)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if len(ids) == 0 {
+		return nil, IllegalConfigError("need at least one machine")
+	}
+	if weights != nil && len(weights) != len(ids) {
+		return nil, IllegalConfigError("need one weight per machine")
+	}
+	if zones != nil && len(zones) != len(ids) {
+		return nil, IllegalConfigError("need one zone per machine")
+	}
+	s := &quorumSpec{rquorum: readQuorum}
+	if zones != nil && span > 1 {
+		s.zspan = span
+		s.zones = make(map[int]string, len(ids))
+		for i, z := range zones {
+			s.zones[ids[i]] = z
+		}
+	}
+	total := len(ids)
+	if weights != nil {
+		s.weights = make(map[int]int, len(ids))
+		total = 0
+		for i, w := range weights {
+			if w < 1 {
+				return nil, IllegalConfigError("weights must be positive")
+			}
+			s.weights[ids[i]] = w
+			total += w
+		}
+	}
+	if quorumSize > total || quorumSize < 1 {
+		return nil, IllegalConfigError("invalid quourm size")
+	}
+	if readQuorum > total || readQuorum < 0 {
+		return nil, IllegalConfigError("invalid read quourm size")
+	}
+	if timeout <= 0 {
+		return nil, IllegalConfigError("timeout must be positive")
+	}
+
+	var cmachines []*Machine
+	for _, mid := range ids {
+		if mid < 0 || mid >= len(m.machines) {
+			return nil, MachineNotFoundError(mid)
+		}
+		machine := m.machines[mid]
+		if machine == nil {
+			return nil, MachineNotFoundError(mid)
+		}
+		cmachines = append(cmachines, machine)
+	}
+	sort.Sort(ByGID(cmachines))
+
+	// The global id also covers the spec, so that configurations with
+	// different weights or zones are not Equal.
+	h := fnv.New32a()
+	var err error
+	write := func(v interface{}) {
+		if err == nil {
+			err = binary.Write(h, binary.LittleEndian, v)
+		}
+	}
+	write(uint32(quorumSize))
+	write(timeout)
+	write(uint32(readQuorum))
+	write(uint32(s.zspan))
+	for _, machine := range cmachines {
+		write(machine.gid)
+		if s.weights != nil {
+			write(uint32(s.weights[machine.id]))
+		}
+		if s.zones != nil {
+			write([]byte(s.zones[machine.id]))
+			write(uint8(0))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	gcid := h.Sum32()
+
+	cid, found := m.configGidToID[gcid]
+	if found {
+		if m.configs[cid] == nil {
+			panic(fmt.Sprintf("config with gcid %d and cid %d was nil", gcid, cid))
+		}
+		return m.configs[cid], nil
+	}
+	cid = len(m.configs)
+
+	c := &Configuration{
+		id:       cid,
+		gid:      gcid,
+		machines: ids,
+		mgr:      m,
+		quorum:   quorumSize,
+		timeout:  timeout,
+	}
+	m.configs = append(m.configs, c)
+	setSpec(c, s)
+
+	return c, nil
+}
@@ -0,0 +1,43 @@
+package proto
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZonedConfigurationGlobalID(t *testing.T) {
+	m := &Manager{
+		machines:      []*Machine{{id: 0, gid: 10}, {id: 1, gid: 11}, {id: 2, gid: 12}},
+		configGidToID: make(map[uint32]int),
+	}
+	defer m.closeSpecs()
+	ids := []int{0, 1, 2}
+
+	var gids []uint32
+	for _, qs := range []int{2, 3} {
+		for _, zones := range [][]string{{"a", "b", "c"}, {"a", "a", "b"}} {
+			c, err := m.NewZonedConfiguration(ids, []int{1, 2, 1}, zones, 2, qs, 0, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, gid := range gids {
+				if c.GlobalID() == gid {
+					t.Errorf("Configuration with quorum size %d and zones %v has the global id of an earlier one.", qs, zones)
+				}
+			}
+			gids = append(gids, c.GlobalID())
+		}
+	}
+
+	c, err := m.NewZonedConfiguration(ids, []int{1, 2, 1}, []string{"a", "b", "c"}, 2, 2, 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GlobalID() != gids[0] || c.spec().zspan != 2 {
+		t.Error("Same configuration was not found again.")
+	}
+	m.closeSpecs()
+	if c.spec() != noSpec {
+		t.Error("Quorum spec was kept after closing the manager.")
+	}
+}
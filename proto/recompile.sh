@@ -4,3 +4,33 @@
 #protoc --go_out=plugins=grpc+gorums:. dc-smartMerge.proto
 
 protoc --gogofast_out=plugins=grpc+gorums:. dc-smartMerge.proto
+protoc --gogo_out=plugins=grpc:. admin.proto
+protoc --gogo_out=plugins=grpc:. chunks.proto
+protoc --gogo_out=plugins=grpc:. cas.proto
+protoc --gogo_out=plugins=grpc:. watch.proto
+protoc --gogo_out=plugins=grpc:. lease.proto
+
+# patch applies the sed expression $2 to the file $1, and fails if it
+# changes nothing, e.g. because the generated code changed.
+patch() {
+	cp "$1" "$1.orig"
+	sed -i -e "$2" "$1"
+	if cmp -s "$1" "$1.orig"; then
+		rm "$1.orig"
+		echo "recompile.sh: no match for $2 in $1" >&2
+		exit 1
+	fi
+	rm "$1.orig"
+}
+
+# Pass the local ids of the machines that replied to the quorum functions,
+# so that they can count weights and zones (see util_udef.go).
+patch dc-smartMerge.pb.go 's/^\(type [A-Za-z]*QuorumFn func(c \*Configuration, replies \[\]\*[A-Za-z]*\)) /\1, mids []int) /'
+patch dc-smartMerge.pb.go 's/^\(type [A-Za-z]*QuorumFn func\)/\/\/ The replies were sent by the machines with the local ids in mids, in order.\n\1/'
+patch dc-smartMerge.pb.go 's/^\(\t\tm\.[A-Za-z]*qf = func(c \*Configuration, replies \[\]\*[A-Za-z]*\)) /\1, mids []int) /'
+patch dc-smartMerge.pb.go 's/^\(\t\t\tif \)len(replies)\( < c\.Quorum() {\)$/\1c.Weight(mids)\2/'
+patch dc-smartMerge.pb.go 's/\(m\.[A-Za-z]*qf(c, replyValues\))/\1, reply.MachineIDs)/'
+
+# Drop the weights and zones of the configurations on Close (see
+# quorums_udef.go).
+patch dc-smartMerge.pb.go 's/^\tm\.closed = true$/&\n\tm.closeSpecs()/'
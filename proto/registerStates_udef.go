@@ -27,3 +27,60 @@ func (s *State) Compare(st *State) int {
 
 	return 0
 }
+
+// KeyStates holds the most recent state known for each key.
+type KeyStates map[string]*State
+
+// Add stores st for key, if it is more recent than the state already held.
+// It returns true if st was stored.
+func (ks KeyStates) Add(key string, st *State) bool {
+	if st == nil || ks[key].Compare(st) != 1 {
+		return false
+	}
+	ks[key] = st
+	return true
+}
+
+// AddAll adds all states in kss.
+func (ks KeyStates) AddAll(kss []*KeyState) {
+	for _, kst := range kss {
+		ks.Add(kst.Key, kst.GetState())
+	}
+}
+
+// List returns the states of all keys.
+func (ks KeyStates) List() []*KeyState {
+	if len(ks) == 0 {
+		return nil
+	}
+	kss := make([]*KeyState, 0, len(ks))
+	for k, st := range ks {
+		kss = append(kss, &KeyState{Key: k, State: st})
+	}
+	return kss
+}
+
+// Others returns the states of all keys except key.
+func (ks KeyStates) Others(key string) []*KeyState {
+	kss := ks.List()
+	for i, kst := range kss {
+		if kst.Key == key {
+			return append(kss[:i], kss[i+1:]...)
+		}
+	}
+	return kss
+}
+
+// MergeKeyStates returns the most recent state for each key in a and b.
+func MergeKeyStates(a, b []*KeyState) []*KeyState {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+	ks := make(KeyStates, len(a))
+	ks.AddAll(a)
+	ks.AddAll(b)
+	return ks.List()
+}
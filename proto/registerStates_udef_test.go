@@ -0,0 +1,72 @@
+package proto
+
+import (
+	"testing"
+)
+
+func TestKeyStatesAdd(t *testing.T) {
+	ks := make(KeyStates)
+	s1 := &State{Value: []byte("1"), Timestamp: 1, Writer: 1}
+	s2 := &State{Value: []byte("2"), Timestamp: 2, Writer: 1}
+
+	if !ks.Add("a", s1) || ks["a"] != s1 {
+		t.Error("Add did not store the state for a new key.")
+	}
+	if !ks.Add("a", s2) || ks["a"] != s2 {
+		t.Error("Add did not store a newer state.")
+	}
+	if ks.Add("a", s1) || ks["a"] != s2 {
+		t.Error("Add did store an older state.")
+	}
+	if ks.Add("b", nil) {
+		t.Error("Add did store a nil state.")
+	}
+}
+
+func TestMergeKeyStates(t *testing.T) {
+	s1 := &State{Timestamp: 1, Writer: 1}
+	s2 := &State{Timestamp: 1, Writer: 2}
+	a := []*KeyState{{Key: "a", State: s1}, {Key: "", State: s2}}
+	b := []*KeyState{{Key: "a", State: s2}, {Key: "b", State: s1}}
+
+	ks := make(KeyStates)
+	ks.AddAll(MergeKeyStates(a, b))
+	if len(ks) != 3 {
+		t.Errorf("Merged states have %d keys, expected 3.", len(ks))
+	}
+	if ks["a"] != s2 || ks[""] != s2 || ks["b"] != s1 {
+		t.Error("Merged states do not hold the most recent state for each key.")
+	}
+
+	for _, kst := range ks.Others("a") {
+		if kst.Key == "a" {
+			t.Error("Others returned the excluded key.")
+		}
+	}
+	if len(ks.Others("a")) != 2 || len(ks.Others("c")) != 3 {
+		t.Error("Others returned the wrong number of keys.")
+	}
+}
+
+func TestNewStateKStatesMarshal(t *testing.T) {
+	ns := &NewState{
+		CurC:    ConfID{Order: 3, Digest: 5},
+		State:   &State{Value: []byte("x"), Timestamp: 2, Writer: 7},
+		Key:     "x",
+		KStates: []*KeyState{{Key: "", State: &State{Timestamp: 1}}, {Key: "y", State: &State{Value: []byte("y"), Timestamp: 4}}},
+	}
+	data, err := ns.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(NewState)
+	if err = got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Key != "x" || got.CurC != ns.CurC || got.State.Compare(ns.State) != 0 || len(got.KStates) != 2 {
+		t.Fatalf("Unmarshal returned %v, expected %v.", got, ns)
+	}
+	if got.KStates[1].Key != "y" || string(got.KStates[1].State.Value) != "y" || got.KStates[0].State.Timestamp != 1 {
+		t.Errorf("Unmarshal returned KStates %v, expected %v.", got.KStates, ns.KStates)
+	}
+}
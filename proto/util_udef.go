@@ -1,7 +1,60 @@
 package proto
 
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Weight returns the sum of the weights of the machines with local ids in
+// mids, e.g. of those that replied. In a configuration without weights, it is
+// len(mids).
+func (c *Configuration) Weight(mids []int) int {
+	weights := c.spec().weights
+	if weights == nil {
+		return len(mids)
+	}
+	w := 0
+	for _, mid := range mids {
+		w += weights[mid]
+	}
+	return w
+}
+
+// TotalWeight returns the weight of all machines in c.
+func (c *Configuration) TotalWeight() int {
+	return c.Weight(c.machines)
+}
+
+// ReadQuorum is the weight of a read quorum. Unless set when creating c, it
+// is the weight needed to intersect every write quorum.
 func (c *Configuration) ReadQuorum() int {
-	return c.Size() - c.Quorum() + 1
+	if rq := c.spec().rquorum; rq != 0 {
+		return rq
+	}
+	return c.TotalWeight() - c.Quorum() + 1
+}
+
+// Spans returns true, if the machines with local ids in mids are in as many
+// zones as a write quorum of c must span. In a configuration without zones,
+// it is always true.
+func (c *Configuration) Spans(mids []int) bool {
+	s := c.spec()
+	if s.zspan <= 1 {
+		return true
+	}
+	seen := make(map[string]bool, s.zspan)
+	for _, mid := range mids {
+		if z, ok := s.zones[mid]; ok {
+			seen[z] = true
+		}
+	}
+	return len(seen) >= s.zspan
+}
+
+// isQuorum returns true, if the machines mids are a MaxQuorum of c, that
+// spans enough zones.
+func (c *Configuration) isQuorum(mids []int) bool {
+	return c.Weight(mids) >= c.MaxQuorum() && c.Spans(mids)
 }
 
 func (c *Configuration) WriteQuorum() int {
@@ -41,3 +94,69 @@ func (m *Manager) ToGids(ids []int) (gids []uint32) {
 	}
 	return gids
 }
+
+// quorumReply is implemented by the replies of the services called with
+// callAll.
+type quorumReply interface {
+	ok() bool   // The server did what was asked.
+	stop() bool // No need to wait for more replies.
+}
+
+// callAll calls f at all servers in c. It returns the replies and the ids of
+// the machines that sent them, once a quorum of them is ok, once one of them
+// says to stop, or once all replied. It fails, if not even a quorum of servers
+// replied. Quorums are counted by weight, and are MaxQuorum, since these
+// services both read and write. They must also span the zones of c. It is used for the services that are not
+// generated with gorums.
+func (c *Configuration) callAll(ctx context.Context, f func(context.Context, *grpc.ClientConn) (quorumReply, error)) ([]quorumReply, []int, error) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type result struct {
+		mid int
+		r   quorumReply
+		err error
+	}
+	machines := c.members()
+	results := make(chan result, len(machines))
+	for _, m := range machines {
+		go func(m *Machine) {
+			r, err := f(ctx, m.conn)
+			results <- result{m.id, r, err}
+		}(m)
+	}
+
+	var (
+		replies []quorumReply
+		mids    []int
+		oks     []int
+	)
+	errCount := 0
+	for range machines {
+		select {
+		case res := <-results:
+			if res.err != nil {
+				errCount++
+				continue
+			}
+			replies = append(replies, res.r)
+			mids = append(mids, res.mid)
+			if res.r.ok() {
+				oks = append(oks, res.mid)
+			}
+			if c.isQuorum(oks) || res.r.stop() {
+				return replies, mids, nil
+			}
+		case <-ctx.Done():
+			if parent.Err() != nil {
+				return nil, nil, parent.Err()
+			}
+			return nil, nil, TimeoutRPCError{c.timeout, errCount, len(replies)}
+		}
+	}
+	if !c.isQuorum(mids) {
+		return nil, nil, IncompleteRPCError{errCount, len(replies)}
+	}
+	return replies, mids, nil
+}
@@ -0,0 +1,42 @@
+package proto
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Watch subscribes to current configurations newer than curc, at all servers
+// in c. The returned channel gets the configurations sent by any of them. It is
+// closed once all streams ended, or ctx is done.
+func (c *Configuration) Watch(ctx context.Context, curc ConfID) <-chan *NewCur {
+	conns := c.conns()
+	out := make(chan *NewCur, len(conns))
+	done := make(chan struct{}, len(conns))
+	for _, cc := range conns {
+		go func(cc *grpc.ClientConn) {
+			defer func() { done <- struct{}{} }()
+			stream, err := NewWatchClient(cc).Watch(ctx, &WatchRequest{CurC: curc.Ptr()})
+			if err != nil {
+				return
+			}
+			for {
+				nc, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				select {
+				case out <- nc:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(cc)
+	}
+	go func() {
+		for range conns {
+			<-done
+		}
+		close(out)
+	}()
+	return out
+}
@@ -4,7 +4,7 @@ import (
 	pr "github.com/relab/smartMerge/proto"
 )
 
-var DWriteNQF = func(c *pr.Configuration, replies []*pr.DReadReply) (*pr.DReadReply, bool) {
+var DWriteNQF = func(c *pr.Configuration, replies []*pr.DReadReply, mids []int) (*pr.DReadReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -14,7 +14,7 @@ var DWriteNQF = func(c *pr.Configuration, replies []*pr.DReadReply) (*pr.DReadRe
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -23,6 +23,7 @@ var DWriteNQF = func(c *pr.Configuration, replies []*pr.DReadReply) (*pr.DReadRe
 		if lastrep.GetState().Compare(rep.GetState()) == 1 {
 			lastrep.State = rep.GetState()
 		}
+		lastrep.KStates = pr.MergeKeyStates(lastrep.KStates, rep.GetKStates())
 	}
 
 	next := make([]*pr.Blueprint, 0, 1)
@@ -37,7 +38,7 @@ var DWriteNQF = func(c *pr.Configuration, replies []*pr.DReadReply) (*pr.DReadRe
 	return lastrep, true
 }
 
-var DSetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply) (*pr.NewStateReply, bool) {
+var DSetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply, mids []int) (*pr.NewStateReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -47,7 +48,7 @@ var DSetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply) (*pr.Ne
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -63,7 +64,7 @@ var DSetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply) (*pr.Ne
 	return lastrep, true
 }
 
-var DWriteNSetQF = func(c *pr.Configuration, replies []*pr.DWriteNsReply) (*pr.DWriteNsReply, bool) {
+var DWriteNSetQF = func(c *pr.Configuration, replies []*pr.DWriteNsReply, mids []int) (*pr.DWriteNsReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -73,7 +74,7 @@ var DWriteNSetQF = func(c *pr.Configuration, replies []*pr.DWriteNsReply) (*pr.D
 
 	// Return false, if not enough replies yet.
 
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -89,7 +90,7 @@ var DWriteNSetQF = func(c *pr.Configuration, replies []*pr.DWriteNsReply) (*pr.D
 	return lastrep, true
 }
 
-var GetOneNQF = func(c *pr.Configuration, replies []*pr.GetOneReply) (*pr.GetOneReply, bool) {
+var GetOneNQF = func(c *pr.Configuration, replies []*pr.GetOneReply, mids []int) (*pr.GetOneReply, bool) {
 	return replies[0], true
 }
 
@@ -0,0 +1,112 @@
+package qfuncs
+
+import (
+	pr "github.com/relab/smartMerge/proto"
+)
+
+// Quorum functions used by a recovering server. The server itself is not part
+// of the configuration, and the quorum size of the configuration is the
+// weight of the replies needed to intersect every write quorum.
+
+// newerCur returns the most recent of the two blueprints.
+func newerCur(old, cur *pr.Blueprint) *pr.Blueprint {
+	if cur != nil && old.LearnedCompare(cur) == 1 {
+		return cur
+	}
+	return old
+}
+
+var RecAReadSQF = func(c *pr.Configuration, replies []*pr.ReadReply, mids []int) (*pr.ReadReply, bool) {
+	if c.Weight(mids) < c.Quorum() {
+		return nil, false
+	}
+
+	lastrep := &pr.ReadReply{Cur: new(pr.ConfReply)}
+	for _, rep := range replies {
+		if lastrep.GetState().Compare(rep.GetState()) == 1 {
+			lastrep.State = rep.GetState()
+		}
+		lastrep.KStates = pr.MergeKeyStates(lastrep.KStates, rep.GetKStates())
+		lastrep.Cur.Cur = newerCur(lastrep.Cur.Cur, rep.GetCur().GetCur())
+		if rep.GetCur() != nil {
+			lastrep.Cur.Next = GetBlueprintSlice(lastrep.Cur.Next, rep.GetCur())
+		}
+	}
+
+	return lastrep, true
+}
+
+var RecLAPropQF = func(c *pr.Configuration, replies []*pr.LAReply, mids []int) (*pr.LAReply, bool) {
+	if c.Weight(mids) < c.Quorum() {
+		return nil, false
+	}
+
+	lastrep := &pr.LAReply{Cur: new(pr.ConfReply)}
+	for _, rep := range replies {
+		lastrep.LAState = lastrep.GetLAState().Merge(rep.GetLAState())
+		lastrep.Cur.Cur = newerCur(lastrep.Cur.Cur, rep.GetCur().GetCur())
+	}
+
+	return lastrep, true
+}
+
+var RecGetPromiseQF = func(c *pr.Configuration, replies []*pr.Promise, mids []int) (*pr.Promise, bool) {
+	if c.Weight(mids) < c.Quorum() {
+		return nil, false
+	}
+
+	lastrep := new(pr.Promise)
+	for _, rep := range replies {
+		lastrep.Cur = newerCur(lastrep.Cur, rep.GetCur())
+		if rep.GetDec() != nil {
+			lastrep.Dec = rep.GetDec()
+		}
+		if rep.Rnd > lastrep.Rnd {
+			lastrep.Rnd = rep.Rnd
+		}
+		if rep.Val == nil {
+			continue
+		}
+		if lastrep.Val == nil || rep.Val.Rnd > lastrep.Val.Rnd {
+			lastrep.Val = rep.Val
+		}
+	}
+
+	return lastrep, true
+}
+
+var RecDWriteNQF = func(c *pr.Configuration, replies []*pr.DReadReply, mids []int) (*pr.DReadReply, bool) {
+	if c.Weight(mids) < c.Quorum() {
+		return nil, false
+	}
+
+	lastrep := new(pr.DReadReply)
+	for _, rep := range replies {
+		if lastrep.GetState().Compare(rep.GetState()) == 1 {
+			lastrep.State = rep.GetState()
+		}
+		lastrep.KStates = pr.MergeKeyStates(lastrep.KStates, rep.GetKStates())
+		lastrep.Cur = newerCur(lastrep.Cur, rep.GetCur())
+		lastrep.Next = DGetBlueprintSlice(lastrep.Next, rep)
+	}
+
+	return lastrep, true
+}
+
+var RecSpSnOneQF = func(c *pr.Configuration, replies []*pr.SWriteNReply, mids []int) (*pr.SWriteNReply, bool) {
+	if c.Weight(mids) < c.Quorum() {
+		return nil, false
+	}
+
+	lastrep := new(pr.SWriteNReply)
+	for _, rep := range replies {
+		if lastrep.GetState().Compare(rep.GetState()) == 1 {
+			lastrep.State = rep.GetState()
+		}
+		lastrep.KStates = pr.MergeKeyStates(lastrep.KStates, rep.GetKStates())
+		lastrep.Cur = newerCur(lastrep.Cur, rep.GetCur())
+		lastrep.Next = GetBlueprintSlice(lastrep.Next, rep)
+	}
+
+	return lastrep, true
+}
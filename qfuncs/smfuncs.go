@@ -40,7 +40,7 @@ func handleConfReply(old *pr.ConfReply, cr *pr.ConfReply) *pr.ConfReply {
 	return old
 }
 
-var AReadSQF = func(c *pr.Configuration, replies []*pr.ReadReply) (*pr.ReadReply, bool) {
+var AReadSQF = func(c *pr.Configuration, replies []*pr.ReadReply, mids []int) (*pr.ReadReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -52,7 +52,7 @@ var AReadSQF = func(c *pr.Configuration, replies []*pr.ReadReply) (*pr.ReadReply
 	}
 
 	// Return false, if not enough replies yet.
-	if len(replies) < c.ReadQuorum() {
+	if c.Weight(mids) < c.ReadQuorum() {
 		if glog.V(7) {
 			glog.Infoln("Not enough ReadSReplies yet.")
 		}
@@ -64,13 +64,14 @@ var AReadSQF = func(c *pr.Configuration, replies []*pr.ReadReply) (*pr.ReadReply
 		if lastrep.GetState().Compare(rep.GetState()) == 1 {
 			lastrep.State = rep.GetState()
 		}
+		lastrep.KStates = pr.MergeKeyStates(lastrep.KStates, rep.GetKStates())
 		lastrep.Cur = handleConfResponder(lastrep.Cur, rep) // I think the assignment can be omitted.
 	}
 
 	return lastrep, true
 }
 
-var AWriteSQF = func(c *pr.Configuration, replies []*pr.ConfReply) (*pr.ConfReply, bool) {
+var AWriteSQF = func(c *pr.Configuration, replies []*pr.ConfReply, mids []int) (*pr.ConfReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -83,7 +84,7 @@ var AWriteSQF = func(c *pr.Configuration, replies []*pr.ConfReply) (*pr.ConfRepl
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		if glog.V(7) {
 			glog.Infoln("Not enough WriteSReplies yet.")
 		}
@@ -98,7 +99,7 @@ var AWriteSQF = func(c *pr.Configuration, replies []*pr.ConfReply) (*pr.ConfRepl
 	return lastrep, true
 }
 
-var AWriteNQF = func(c *pr.Configuration, replies []*pr.WriteNReply) (*pr.WriteNReply, bool) {
+var AWriteNQF = func(c *pr.Configuration, replies []*pr.WriteNReply, mids []int) (*pr.WriteNReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -111,7 +112,7 @@ var AWriteNQF = func(c *pr.Configuration, replies []*pr.WriteNReply) (*pr.WriteN
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -120,6 +121,7 @@ var AWriteNQF = func(c *pr.Configuration, replies []*pr.WriteNReply) (*pr.WriteN
 		if lastrep.GetState().Compare(rep.GetState()) == 1 {
 			lastrep.State = rep.GetState()
 		}
+		lastrep.KStates = pr.MergeKeyStates(lastrep.KStates, rep.GetKStates())
 		lastrep.LAState = lastrep.GetLAState().Merge(rep.GetLAState())
 		lastrep.Cur = handleConfResponder(lastrep.Cur, rep)
 	}
@@ -127,9 +129,9 @@ var AWriteNQF = func(c *pr.Configuration, replies []*pr.WriteNReply) (*pr.WriteN
 	return lastrep, true
 }
 
-var SetCurQF = func(c *pr.Configuration, replies []*pr.NewCurReply) (*pr.NewCurReply, bool) {
+var SetCurQF = func(c *pr.Configuration, replies []*pr.NewCurReply, mids []int) (*pr.NewCurReply, bool) {
 	// Return false, if not enough replies yet.
-	if len(replies) < c.WriteQuorum() {
+	if c.Weight(mids) < c.WriteQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -141,7 +143,7 @@ var SetCurQF = func(c *pr.Configuration, replies []*pr.NewCurReply) (*pr.NewCurR
 	return replies[0], true
 }
 
-var LAPropQF = func(c *pr.Configuration, replies []*pr.LAReply) (*pr.LAReply, bool) {
+var LAPropQF = func(c *pr.Configuration, replies []*pr.LAReply, mids []int) (*pr.LAReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -154,7 +156,7 @@ var LAPropQF = func(c *pr.Configuration, replies []*pr.LAReply) (*pr.LAReply, bo
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -167,7 +169,7 @@ var LAPropQF = func(c *pr.Configuration, replies []*pr.LAReply) (*pr.LAReply, bo
 	return lastrep, true
 }
 
-var SetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply) (*pr.NewStateReply, bool) {
+var SetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply, mids []int) (*pr.NewStateReply, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -176,7 +178,7 @@ var SetStateQF = func(c *pr.Configuration, replies []*pr.NewStateReply) (*pr.New
 	}
 
 	// Return false, if not enough replies yet.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
@@ -194,7 +196,7 @@ type NextReport interface {
 	GetNext() []*pr.Blueprint
 }
 
-var GetPromiseQF = func(c *pr.Configuration, replies []*pr.Promise) (*pr.Promise, bool) {
+var GetPromiseQF = func(c *pr.Configuration, replies []*pr.Promise, mids []int) (*pr.Promise, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -204,7 +206,7 @@ var GetPromiseQF = func(c *pr.Configuration, replies []*pr.Promise) (*pr.Promise
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.ReadQuorum() {
+	if c.Weight(mids) < c.ReadQuorum() {
 		return nil, false
 	}
 
@@ -232,7 +234,7 @@ var GetPromiseQF = func(c *pr.Configuration, replies []*pr.Promise) (*pr.Promise
 	return lastrep, true
 }
 
-var AcceptQF = func(c *pr.Configuration, replies []*pr.Learn) (*pr.Learn, bool) {
+var AcceptQF = func(c *pr.Configuration, replies []*pr.Learn, mids []int) (*pr.Learn, bool) {
 
 	// Stop RPC if new current configuration reported.
 	lastrep := replies[len(replies)-1]
@@ -242,7 +244,7 @@ var AcceptQF = func(c *pr.Configuration, replies []*pr.Learn) (*pr.Learn, bool)
 
 	// Return false, if not enough replies yet.
 	// This rpc is both reading and writing.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		return nil, false
 	}
 
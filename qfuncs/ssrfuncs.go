@@ -5,7 +5,7 @@ import (
 	pb "github.com/relab/smartMerge/proto"
 )
 
-var SpSnOneQF = func(c *pb.Configuration, replies []*pb.SWriteNReply) (*pb.SWriteNReply, bool) {
+var SpSnOneQF = func(c *pb.Configuration, replies []*pb.SWriteNReply, mids []int) (*pb.SWriteNReply, bool) {
 
 	lastrep := replies[len(replies)-1]
 	if lastrep.GetCur() != nil {
@@ -16,7 +16,7 @@ var SpSnOneQF = func(c *pb.Configuration, replies []*pb.SWriteNReply) (*pb.SWrit
 	}
 
 	// Return false, if not enough replies yet.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		if glog.V(7) {
 			glog.Infoln("Not enough SWriteNReplies yet.")
 		}
@@ -25,17 +25,19 @@ var SpSnOneQF = func(c *pb.Configuration, replies []*pb.SWriteNReply) (*pb.SWrit
 
 	var next []*pb.Blueprint
 	var rst *pb.State
+	var kss []*pb.KeyState
 	for _, rep := range replies {
 		next = GetBlueprintSlice(next, rep)
 		if rst.Compare(rep.GetState()) == 1 {
 			rst = rep.GetState()
 		}
+		kss = pb.MergeKeyStates(kss, rep.GetKStates())
 	}
 
-	return &pb.SWriteNReply{Next: next, State: rst}, true
+	return &pb.SWriteNReply{Next: next, State: rst, KStates: kss}, true
 }
 
-var SCommitQF = func(c *pb.Configuration, replies []*pb.CommitReply) (*pb.CommitReply, bool) {
+var SCommitQF = func(c *pb.Configuration, replies []*pb.CommitReply, mids []int) (*pb.CommitReply, bool) {
 
 	lastrep := replies[len(replies)-1]
 	if lastrep.GetCur() != nil {
@@ -46,7 +48,7 @@ var SCommitQF = func(c *pb.Configuration, replies []*pb.CommitReply) (*pb.Commit
 	}
 
 	// Return false, if not enough replies yet.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		if glog.V(7) {
 			glog.Infoln("Not enough CommitReplies yet.")
 		}
@@ -66,7 +68,7 @@ var SCommitQF = func(c *pb.Configuration, replies []*pb.CommitReply) (*pb.Commit
 }
 
 //Dead code. Remove eventually.
-// var SReadSQF = func(c *pb.Configuration, replies []*pb.SReadReply) (*pb.SReadReply, bool) {
+// var SReadSQF = func(c *pb.Configuration, replies []*pb.SReadReply, mids []int) (*pb.SReadReply, bool) {
 //
 // 	lastrep := replies[len(replies)-1]
 // 	if lastrep.GetCur() != nil {
@@ -77,7 +79,7 @@ var SCommitQF = func(c *pb.Configuration, replies []*pb.CommitReply) (*pb.Commit
 // 	}
 //
 // 	// Return false, if not enough replies yet.
-// 	if len(replies) < c.ReadQuorum() {
+// 	if c.Weight(mids) < c.ReadQuorum() {
 // 		if glog.V(7) {
 // 			glog.Infoln("Not enough SReadReplies yet.")
 // 		}
@@ -95,11 +97,11 @@ var SCommitQF = func(c *pb.Configuration, replies []*pb.CommitReply) (*pb.Commit
 //
 // }
 
-var SSetStateQF = func(c *pb.Configuration, replies []*pb.SStateReply) (*pb.SStateReply, bool) {
+var SSetStateQF = func(c *pb.Configuration, replies []*pb.SStateReply, mids []int) (*pb.SStateReply, bool) {
 	//Oups here we don't abort when a new cur is reported, since this is not always processed.
 
 	// Return false, if not enough replies yet.
-	if len(replies) < c.MaxQuorum() {
+	if c.Weight(mids) < c.MaxQuorum() || !c.Spans(mids) {
 		if glog.V(7) {
 			glog.Infoln("Not enough SReadReplies yet.")
 		}
@@ -0,0 +1,170 @@
+package regserver
+
+import (
+	"sort"
+	"time"
+
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+)
+
+// The Inspect methods implement the Admin service. They return a snapshot of
+// the server state, and also answer while the server is recovering.
+
+func (rs *RegServer) Inspect(ctx context.Context, ir *pb.InspectRequest) (*pb.Snapshot, error) {
+	rs.RLock()
+	defer rs.RUnlock()
+	return rs.snapshot("sm"), nil
+}
+
+func (cs *ConsServer) Inspect(ctx context.Context, ir *pb.InspectRequest) (*pb.Snapshot, error) {
+	cs.RLock()
+	defer cs.RUnlock()
+	sn := cs.snapshot("cons")
+	seen := make(map[pb.ConfID]bool)
+	for c := range cs.Rnd {
+		seen[c] = true
+	}
+	for c := range cs.Val {
+		seen[c] = true
+	}
+	for c := range cs.NextMap {
+		seen[c] = true
+	}
+	confs := make([]pb.ConfID, 0, len(seen))
+	for c := range seen {
+		confs = append(confs, c)
+	}
+	for _, c := range sortConfIDs(confs) {
+		sn.Paxos = append(sn.Paxos, &pb.PaxosRound{Conf: c.Ptr(), Rnd: cs.Rnd[c], Val: cs.Val[c], Next: cs.NextMap[c]})
+	}
+	return sn, nil
+}
+
+func (rs *RegServer) snapshot(alg string) *pb.Snapshot {
+	return &pb.Snapshot{
+		Algorithm:  alg,
+		Uptime:     int64(time.Since(rs.started)),
+		Recovering: rs.recovering,
+		Cur:        rs.Cur,
+		CurC:       rs.CurC.Ptr(),
+		Next:       rs.Next,
+		LAState:    rs.LAState,
+		Timestamp:  rs.RState.Timestamp,
+		Writer:     rs.RState.Writer,
+		Keys:       uint32(len(rs.KStates)),
+		Removed:    rs.dc.removed,
+		SafeToStop: rs.dc.safeToStop(),
+	}
+}
+
+func (ds *DynaServer) Inspect(ctx context.Context, ir *pb.InspectRequest) (*pb.Snapshot, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	sn := &pb.Snapshot{
+		Algorithm:  "dyna",
+		Uptime:     int64(time.Since(ds.started)),
+		Recovering: ds.recovering,
+		Cur:        ds.Cur,
+		CurC:       ds.CurC.Ptr(),
+		Timestamp:  ds.RState.Timestamp,
+		Writer:     ds.RState.Writer,
+		Keys:       uint32(len(ds.KStates)),
+		Removed:    ds.dc.removed,
+		SafeToStop: ds.dc.safeToStop(),
+	}
+	confs := make([]pb.ConfID, 0, len(ds.Next))
+	for c := range ds.Next {
+		confs = append(confs, c)
+	}
+	for _, c := range sortConfIDs(confs) {
+		sn.DNext = append(sn.DNext, &pb.ConfNext{Conf: c.Ptr(), Next: ds.Next[c]})
+	}
+	return sn, nil
+}
+
+func (srs *SSRServer) Inspect(ctx context.Context, ir *pb.InspectRequest) (*pb.Snapshot, error) {
+	srs.mu.Lock()
+	defer srs.mu.Unlock()
+	sn := &pb.Snapshot{
+		Algorithm:  "ssr",
+		Uptime:     int64(time.Since(srs.started)),
+		Recovering: srs.recovering,
+		Cur:        srs.Cur,
+		CurC:       srs.CurC.Ptr(),
+		Timestamp:  srs.RState.Timestamp,
+		Writer:     srs.RState.Writer,
+		Keys:       uint32(len(srs.KStates)),
+		Removed:    srs.dc.removed,
+		SafeToStop: srs.dc.safeToStop(),
+	}
+
+	// Collect all (conf, rnd) pairs found in any of the three maps.
+	rnds := make(map[pb.ConfID]map[uint32]bool)
+	add := func(c pb.ConfID, r uint32) {
+		if rnds[c] == nil {
+			rnds[c] = make(map[uint32]bool)
+		}
+		rnds[c][r] = true
+	}
+	for c, m := range srs.Proposed {
+		for r := range m {
+			add(c, r)
+		}
+	}
+	for c, m := range srs.Committed {
+		for r := range m {
+			add(c, r)
+		}
+	}
+	for c, m := range srs.Collected {
+		for r := range m {
+			add(c, r)
+		}
+	}
+
+	confs := make([]pb.ConfID, 0, len(rnds))
+	for c := range rnds {
+		confs = append(confs, c)
+	}
+	for _, c := range sortConfIDs(confs) {
+		rs := make([]uint32, 0, len(rnds[c]))
+		for r := range rnds[c] {
+			rs = append(rs, r)
+		}
+		for _, r := range sortUint32s(rs) {
+			sn.Rounds = append(sn.Rounds, &pb.SSRRound{
+				Conf:      c.Ptr(),
+				Rnd:       r,
+				Proposed:  srs.Proposed[c][r],
+				Committed: srs.Committed[c][r],
+				Collected: srs.Collected[c][r],
+			})
+		}
+	}
+	return sn, nil
+}
+
+type uint32s []uint32
+
+func (u uint32s) Len() int           { return len(u) }
+func (u uint32s) Less(i, j int) bool { return u[i] < u[j] }
+func (u uint32s) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+
+func sortUint32s(u []uint32) []uint32 {
+	sort.Sort(uint32s(u))
+	return u
+}
+
+type confIDs []pb.ConfID
+
+func (u confIDs) Len() int { return len(u) }
+func (u confIDs) Less(i, j int) bool {
+	return u[i].Less(u[j])
+}
+func (u confIDs) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+
+func sortConfIDs(u []pb.ConfID) []pb.ConfID {
+	sort.Sort(confIDs(u))
+	return u
+}
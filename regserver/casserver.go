@@ -0,0 +1,203 @@
+package regserver
+
+import (
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
+	"golang.org/x/net/context"
+)
+
+// Compare-and-swap on the cons servers. Every swap on a register is a Paxos
+// instance, that decides the state following the state with timestamp T, see
+// consclient/cas.go for the proposer. The servers keep the acceptor state of
+// an instance in a slot, until the register moved on by CasHistory states.
+// Until then, a proposer that was held up can still learn the decided state.
+//
+// The slots are not per configuration. On reconfiguration, the client freezes
+// CAS in the old configuration at a quorum, collecting their slots, and
+// installs the slots in the new configuration before it is used. A server only
+// takes part in CAS in its current configuration, or in a later one, once the
+// slots are installed there.
+
+// CasHistory is the number of states a register moves on, before the slot of
+// an instance is dropped.
+var CasHistory int32 = 64
+
+// casConf reports whether CAS may run in configuration c. Otherwise it returns
+// the current configuration, if c is outdated, or the next configuration.
+func (cs *ConsServer) casConf(c pb.ConfID) (cur *pb.Blueprint, next []*pb.Blueprint, ok bool) {
+	if older(c, cs.CurC) {
+		return cs.Cur, nil, false
+	}
+	if n := cs.NextMap[c]; n != nil {
+		return nil, []*pb.Blueprint{n}, false
+	}
+	if cs.CasFrozen[c] || (c.Newer(cs.CurC) && !cs.CasReady[c]) {
+		// The slots are being moved, the client has to try again.
+		return nil, nil, false
+	}
+	return nil, nil, true
+}
+
+// casStale reports whether the slot for instance t of key is dropped, or
+// would be. Since states only move on, a server never accepts in an instance
+// again, once it dropped the slot.
+func (rs *RegServer) casStale(key string, t int32) bool {
+	st := stateOf(rs.RState, rs.KStates, key)
+	return st != nil && st.Timestamp-CasHistory > t
+}
+
+// casDrop adds the deletion of the stale slots of key to u. The slots are
+// dropped from memory once u is committed.
+func (rs *RegServer) casDrop(u *update, key string) (n int) {
+	for t := range rs.Cas[key] {
+		if rs.casStale(key, t) {
+			t := t
+			u.Delete(casKey(key, t))
+			u.do(func() { delete(rs.Cas[key], t) })
+			n++
+		}
+	}
+	u.do(func() {
+		if len(rs.Cas[key]) == 0 {
+			delete(rs.Cas, key)
+		}
+	})
+	return n
+}
+
+// casSlot returns the slot for instance t of key. Slots are never changed,
+// only replaced, since replies may still hold them.
+func (cs *ConsServer) casSlot(key string, t int32) *pb.CasSlot {
+	if s := cs.Cas.Get(key, t); s != nil {
+		return s
+	}
+	return &pb.CasSlot{Key: key, T: t}
+}
+
+func (cs *ConsServer) putCasSlot(s *pb.CasSlot) error {
+	u := newUpdate()
+	putCasSlot(u.Batch, casKey(s.Key, s.T), s)
+	u.do(func() { cs.Cas.Put(s) })
+	cs.casDrop(u, s.Key)
+	return u.commit(cs.store)
+}
+
+func (cs *ConsServer) CasPrepare(ctx context.Context, p *pb.CasPrepare) (*pb.CasPromise, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.CasPromise{Cur: cs.Cur}, nil
+	}
+	glog.V(5).Infoln("Handling CasPrepare")
+
+	if cur, next, ok := cs.casConf(p.CurC.Value()); !ok {
+		return &pb.CasPromise{Cur: cur, Next: next}, nil
+	}
+	if cs.casStale(p.Key, p.T) {
+		return &pb.CasPromise{Stale: true}, nil
+	}
+
+	s := cs.casSlot(p.Key, p.T)
+	if p.Rnd <= s.Rnd {
+		return &pb.CasPromise{Rnd: s.Rnd}, nil
+	}
+	ns := *s
+	ns.Rnd = p.Rnd
+	if err := cs.putCasSlot(&ns); err != nil {
+		return nil, err
+	}
+	return &pb.CasPromise{Ok: true, Rnd: ns.Rnd, Slot: &ns}, nil
+}
+
+func (cs *ConsServer) CasAccept(ctx context.Context, p *pb.CasPropose) (*pb.CasLearn, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.CasLearn{Cur: cs.Cur}, nil
+	}
+	glog.V(5).Infoln("Handling CasAccept")
+
+	if cur, next, ok := cs.casConf(p.CurC.Value()); !ok {
+		return &pb.CasLearn{Cur: cur, Next: next}, nil
+	}
+	if cs.casStale(p.Key, p.T) {
+		return &pb.CasLearn{Stale: true}, nil
+	}
+
+	s := cs.casSlot(p.Key, p.T)
+	if p.Rnd < s.Rnd {
+		// Accept in old round.
+		return &pb.CasLearn{Rnd: s.Rnd}, nil
+	}
+	ns := &pb.CasSlot{Key: p.Key, T: p.T, Rnd: p.Rnd, VRnd: p.Rnd, Val: p.Val, Owner: p.Owner}
+	if err := cs.putCasSlot(ns); err != nil {
+		return nil, err
+	}
+	return &pb.CasLearn{Ok: true, Rnd: p.Rnd}, nil
+}
+
+// CasFreeze stops CAS in configuration f.CurC, and returns all slots.
+func (cs *ConsServer) CasFreeze(ctx context.Context, f *pb.CasFreeze) (*pb.CasSlots, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	glog.V(5).Infoln("Handling CasFreeze")
+
+	if c := f.CurC.Value(); !older(c, cs.CurC) && !cs.CasFrozen[c] {
+		b := new(storage.Batch)
+		putUint32(b, confKey(prefixCasFrozen, c), 1)
+		if err := persist(cs.store, b); err != nil {
+			return nil, err
+		}
+		cs.CasFrozen[c] = true
+	}
+	return &pb.CasSlots{CurC: f.CurC, Slots: cs.Cas.List()}, nil
+}
+
+// CasInstall merges the slots in in.Slots, and allows CAS in configuration
+// in.CurC.
+func (cs *ConsServer) CasInstall(ctx context.Context, in *pb.CasSlots) (*pb.CasInstalled, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	glog.V(5).Infoln("Handling CasInstall")
+
+	u := newUpdate()
+	merged := make(pb.KeySlots)
+	for _, s := range in.Slots {
+		if cs.casStale(s.Key, s.T) {
+			continue
+		}
+		m := merged.Get(s.Key, s.T)
+		if m == nil {
+			m = cs.Cas.Get(s.Key, s.T)
+		}
+		m = m.Merge(s)
+		merged.Put(m)
+		putCasSlot(u.Batch, casKey(s.Key, s.T), m)
+	}
+	u.do(func() {
+		for _, m := range merged.List() {
+			cs.Cas.Put(m)
+		}
+	})
+	if c := in.CurC.Value(); c.Newer(cs.CurC) && !cs.CasReady[c] {
+		putUint32(u.Batch, confKey(prefixCasReady, c), 1)
+		u.do(func() { cs.CasReady[c] = true })
+	}
+	if err := u.commit(cs.store); err != nil {
+		return nil, err
+	}
+	return &pb.CasInstalled{}, nil
+}
@@ -0,0 +1,169 @@
+package regserver
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Values larger than pb.ChunkThreshold are left out of the replies, and
+// fetched by the clients with the Chunks service. A client writing such a
+// value stages it first, and then sends the state without its value. The
+// server fills it in from the staged values, when the state arrives.
+
+// StageTimeout is how long a staged value is kept, if no state arrives for it.
+var StageTimeout = 1 * time.Minute
+
+// ErrNotStaged is returned for a state without its value, if the value was
+// not staged before.
+var ErrNotStaged = grpc.Errorf(codes.FailedPrecondition, "value was not staged")
+
+type stageKey struct {
+	key       string
+	timestamp int32
+	writer    uint32
+}
+
+type staged struct {
+	st *pb.State
+	at time.Time
+}
+
+type staging struct {
+	mu   sync.Mutex
+	vals map[stageKey]staged
+}
+
+func (sg *staging) stage(stream pb.Chunks_StageServer) error {
+	key, st, err := pb.RecvChunks(stream.Recv)
+	if err != nil {
+		return err
+	}
+
+	sg.mu.Lock()
+	if sg.vals == nil {
+		sg.vals = make(map[stageKey]staged)
+	}
+	for k, v := range sg.vals {
+		if time.Since(v.at) > StageTimeout {
+			delete(sg.vals, k)
+		}
+	}
+	sg.vals[stageKey{key, st.Timestamp, st.Writer}] = staged{st, time.Now()}
+	sg.mu.Unlock()
+
+	return stream.SendAndClose(&pb.StageReply{})
+}
+
+// take returns the staged state for st, and forgets it.
+func (sg *staging) take(key string, st *pb.State) *pb.State {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	k := stageKey{key, st.Timestamp, st.Writer}
+	v, ok := sg.vals[k]
+	if !ok {
+		return nil
+	}
+	delete(sg.vals, k)
+	return v.st
+}
+
+// resolve returns st and kss with the values left out filled in from the
+// staged ones. Values are only needed for states more recent than the stored
+// ones, others are returned as they are.
+func (sg *staging) resolve(rstate *pb.State, ks pb.KeyStates, key string, st *pb.State, kss []*pb.KeyState) (*pb.State, []*pb.KeyState, error) {
+	one := func(key string, st *pb.State) (*pb.State, error) {
+		if !st.Omitted() || stateOf(rstate, ks, key).Compare(st) != 1 {
+			return st, nil
+		}
+		if full := sg.take(key, st); full != nil {
+			return full, nil
+		}
+		return nil, ErrNotStaged
+	}
+
+	st, err := one(key, st)
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []*pb.KeyState
+	for i, kst := range kss {
+		full, err := one(kst.Key, kst.GetState())
+		if err != nil {
+			return nil, nil, err
+		}
+		if full == kst.GetState() {
+			continue
+		}
+		if out == nil {
+			out = append([]*pb.KeyState(nil), kss...)
+		}
+		out[i] = &pb.KeyState{Key: kst.Key, State: full}
+	}
+	if out == nil {
+		out = kss
+	}
+	return st, out, nil
+}
+
+// fetchValues fills in the values left out of st and kss, from the servers
+// in cnf. st is the state of the empty key.
+func fetchValues(cnf *pb.Configuration, st *pb.State, kss []*pb.KeyState) (*pb.State, []*pb.KeyState, error) {
+	st, err := cnf.Fetch(context.Background(), "", st)
+	if err != nil {
+		return nil, nil, err
+	}
+	kss, err = cnf.FetchAll(context.Background(), kss)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, kss, nil
+}
+
+// sendState sends the value of st, if st is the state asked for.
+func sendState(req *pb.FetchRequest, st *pb.State, stream pb.Chunks_FetchServer) error {
+	if st == nil || st.Timestamp != req.Timestamp || st.Writer != req.Writer {
+		return grpc.Errorf(codes.NotFound, "state is not held anymore")
+	}
+	return pb.SendChunks(stream.Send, req.Key, st)
+}
+
+// The Fetch and Stage methods implement the Chunks service. The stored values
+// are never changed, only replaced, so they are sent without holding the lock.
+
+func (rs *RegServer) Fetch(req *pb.FetchRequest, stream pb.Chunks_FetchServer) error {
+	rs.RLock()
+	st := stateOf(rs.RState, rs.KStates, req.Key)
+	rs.RUnlock()
+	return sendState(req, st, stream)
+}
+
+func (rs *RegServer) Stage(stream pb.Chunks_StageServer) error {
+	return rs.staged.stage(stream)
+}
+
+func (ds *DynaServer) Fetch(req *pb.FetchRequest, stream pb.Chunks_FetchServer) error {
+	ds.mu.RLock()
+	st := stateOf(ds.RState, ds.KStates, req.Key)
+	ds.mu.RUnlock()
+	return sendState(req, st, stream)
+}
+
+func (ds *DynaServer) Stage(stream pb.Chunks_StageServer) error {
+	return ds.staged.stage(stream)
+}
+
+func (srs *SSRServer) Fetch(req *pb.FetchRequest, stream pb.Chunks_FetchServer) error {
+	srs.mu.Lock()
+	st := stateOf(srs.RState, srs.KStates, req.Key)
+	srs.mu.Unlock()
+	return sendState(req, st, stream)
+}
+
+func (srs *SSRServer) Stage(stream pb.Chunks_StageServer) error {
+	return srs.staged.stage(stream)
+}
@@ -0,0 +1,56 @@
+package regserver_test
+
+import (
+	"testing"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestCollidingConfs(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	// Two incomparable next configurations with the same order.
+	blp := cl.C.GetCur(cl.CP)
+	x := blp.Copy()
+	x.FaultTolerance += 2
+	y := blp.Copy()
+	y.Rem(cl.ID(2))
+	if x.Order() != y.Order() || x.ID() == y.ID() {
+		t.Fatalf("Expected different ids with the same order, got %v and %v.", x.ID(), y.ID())
+	}
+
+	cnf := cl.CP.FullC(blp)
+	for _, next := range []*pb.Blueprint{x, y} {
+		if _, err := cnf.AWriteN(ctx, &pb.WriteN{CurC: blp.ID(), Next: next}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, rs := range cl.Servers {
+		rs.RLock()
+		n := len(rs.Next)
+		rs.RUnlock()
+		if n != 2 {
+			t.Errorf("Server %d holds %d next configurations, expected 2.", i, n)
+		}
+	}
+
+	// Consensus instances in x and y are independent.
+	rs := cl.Servers[0]
+	if _, err := rs.GetPromise(ctx, &pb.Prepare{CurC: x.ID(), Rnd: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if lrn, err := rs.Accept(ctx, &pb.Propose{CurC: x.ID(), Val: &pb.CV{Rnd: 2, Val: x}}); err != nil || !lrn.Learned {
+		t.Fatalf("Accept returned %v, %v.", lrn, err)
+	}
+	prom, err := rs.GetPromise(ctx, &pb.Prepare{CurC: y.ID(), Rnd: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prom.Val != nil || prom.Dec != nil || prom.Rnd != 0 {
+		t.Errorf("Prepare in configuration y returned %v, the state of x.", prom)
+	}
+}
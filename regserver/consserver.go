@@ -2,9 +2,11 @@ package regserver
 
 import (
 	"errors"
+	"time"
 
 	"github.com/golang/glog"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
 	"golang.org/x/net/context"
 )
 
@@ -18,23 +20,27 @@ func NewConsServer(noabort bool) *ConsServer {
 	}
 }
 
-func NewConsServerWithCur(cur *pb.Blueprint, curc uint32, noabort bool) *ConsServer {
+func NewConsServerWithCur(cur *pb.Blueprint, curc pb.ConfID, noabort bool) *ConsServer {
 	return &ConsServer{
 		NewRegServerWithCur(cur, curc, noabort),
 	}
 }
 
-func (cs *ConsServer) handleConf(conf *pb.Conf, next *pb.Blueprint) (cr *pb.ConfReply) {
-	if conf == nil || (conf.This < cs.CurC && !cs.noabort) {
-		//The client is using an outdated configuration, abort.
-		return &pb.ConfReply{Cur: cs.Cur, Abort: false}
+func NewConsServerWithStore(st storage.Store, noabort bool) (*ConsServer, error) {
+	rs, err := NewRegServerWithStore(st, noabort)
+	if err != nil {
+		return nil, err
 	}
+	return &ConsServer{rs}, nil
+}
 
-	if next != nil {
-		cs.NextMap[conf.This] = next
+func (cs *ConsServer) handleConf(conf *pb.Conf) (cr *pb.ConfReply) {
+	if cs.outdated(conf) {
+		//The client is using an outdated configuration, abort.
+		return &pb.ConfReply{Cur: cs.Cur, Abort: false}
 	}
 
-	if conf.Cur < cs.CurC {
+	if older(conf.Cur, cs.CurC) {
 		if n := cs.NextMap[conf.This]; n != nil {
 			// Inform the client of the next configurations
 			return &pb.ConfReply{Cur: cs.Cur, Abort: false, Next: []*pb.Blueprint{n}}
@@ -52,59 +58,137 @@ func (cs *ConsServer) handleConf(conf *pb.Conf, next *pb.Blueprint) (cr *pb.Conf
 func (cs *ConsServer) AReadS(ctx context.Context, rr *pb.Conf) (*pb.ReadReply, error) {
 	cs.RLock()
 	defer cs.RUnlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.ReadReply{Cur: &pb.ConfReply{Cur: cs.Cur}}, nil
+	}
 	glog.V(5).Infoln("Handling ReadS")
 
-	cr := cs.handleConf(rr, nil)
+	cr := cs.handleConf(rr)
 	if cr != nil && cr.Abort {
 		return &pb.ReadReply{Cur: cr}, nil
 	}
 
-	return &pb.ReadReply{State: cs.RState, Cur: cr}, nil
+	var key string
+	if rr != nil {
+		key = rr.Key
+	}
+	st := stateOf(cs.RState, cs.KStates, key)
+	if rr != nil && rr.Digest {
+		st = st.Digested()
+	} else {
+		st = st.Ref()
+	}
+	rep := &pb.ReadReply{State: st, Cur: cr}
+	if rr != nil && rr.AllKeys {
+		rep.KStates = pb.Refs(otherStates(cs.RState, cs.KStates, key))
+	}
+	return rep, nil
 }
 
-func (cs *ConsServer) AWriteS(ctx context.Context, wr *pb.WriteS) (*pb.ConfReply, error) {
+func (cs *ConsServer) AWriteS(ctx context.Context, wr *pb.WriteS) (rep *pb.ConfReply, err error) {
+	var until time.Time
+	defer afterUnlock(ctx, &until, &err)
 	cs.Lock()
 	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.ConfReply{Cur: cs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling WriteS")
-	if cs.RState.Compare(wr.GetState()) == 1 {
-		cs.RState = wr.GetState()
+	st, _, err := cs.staged.resolve(cs.RState, cs.KStates, wr.Key, wr.GetState(), nil)
+	if err != nil {
+		return nil, err
 	}
+	u := newUpdate()
+	setState(u, &cs.RState, cs.KStates, wr.Key, st)
+	if err := u.commit(cs.store); err != nil {
+		return nil, err
+	}
+	until = cs.leaseConflicts(wr.Key, nil)
 
-	if crepl := cs.handleConf(wr.GetConf(), nil); crepl != nil {
+	if crepl := cs.handleConf(wr.GetConf()); crepl != nil {
 		return crepl, nil
 	}
 	return &pb.ConfReply{}, nil
 
 }
 
-func (cs *ConsServer) AWriteN(ctx context.Context, wr *pb.WriteN) (*pb.WriteNReply, error) {
+func (cs *ConsServer) AWriteN(ctx context.Context, wr *pb.WriteN) (rep *pb.WriteNReply, err error) {
+	var until time.Time
+	defer afterUnlock(ctx, &until, &err)
 	cs.Lock()
 	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.WriteNReply{Cur: &pb.ConfReply{Cur: cs.Cur}}, nil
+	}
 	glog.V(5).Infoln("Handling WriteN")
 
-	cr := cs.handleConf(&pb.Conf{wr.CurC, wr.CurC}, wr.Next)
+	conf := &pb.Conf{This: wr.CurC, Cur: wr.CurC}
+	if wr.Next != nil && !cs.outdated(conf) {
+		b := new(storage.Batch)
+		putBlueprint(b, confKey(prefixNextMap, wr.CurC), wr.Next)
+		if err := persist(cs.store, b); err != nil {
+			return nil, err
+		}
+		cs.NextMap[wr.CurC] = wr.Next
+	}
+
+	cr := cs.handleConf(conf)
 	if cr != nil && cr.Abort {
 		return &pb.WriteNReply{Cur: cr}, nil
 	}
+	if cs.NextMap[wr.CurC] != nil {
+		// No more leases are granted, wait for the old ones before
+		// the state is moved.
+		until = cs.leased.all()
+	}
 
-	return &pb.WriteNReply{Cur: cr, State: cs.RState}, nil
+	return &pb.WriteNReply{
+		Cur:     cr,
+		State:   stateOf(cs.RState, cs.KStates, wr.Key).Ref(),
+		KStates: pb.Refs(otherStates(cs.RState, cs.KStates, wr.Key)),
+	}, nil
 }
 
-func (cs *ConsServer) SetState(ctx context.Context, ns *pb.NewState) (*pb.NewStateReply, error) {
+func (cs *ConsServer) SetState(ctx context.Context, ns *pb.NewState) (rep *pb.NewStateReply, err error) {
+	var until time.Time
+	defer afterUnlock(ctx, &until, &err)
 	cs.Lock()
 	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.NewStateReply{Cur: cs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling SetState")
 	if ns == nil {
 		return nil, errors.New("Empty NewState message")
 	}
 
-	if cs.CurC > ns.CurC {
+	if older(ns.CurC, cs.CurC) {
 		return &pb.NewStateReply{Cur: cs.Cur}, nil
 	}
+	st, kss, err := cs.staged.resolve(cs.RState, cs.KStates, ns.Key, ns.State, ns.KStates)
+	if err != nil {
+		return nil, err
+	}
 
-	if cs.RState.Compare(ns.State) == 1 {
-		cs.RState = ns.State
+	u := newUpdate()
+	setState(u, &cs.RState, cs.KStates, ns.Key, st)
+	setStates(u, &cs.RState, cs.KStates, kss)
+	if err := u.commit(cs.store); err != nil {
+		return nil, err
 	}
+	until = cs.leaseConflicts(ns.Key, kss)
 
 	var next []*pb.Blueprint
 	if cs.NextMap[ns.CurC] != nil {
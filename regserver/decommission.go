@@ -0,0 +1,219 @@
+package regserver
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+)
+
+// A server that is removed from the configuration is not needed anymore, once
+// the new configuration holds its state. When decommissioning is enabled, the
+// server notices its removal when a configuration without it is installed
+// with SetCur. From then on, it answers all protocol RPCs with the new current
+// configuration only, and hands over: it waits until a write quorum of the
+// current configuration holds register states at least as recent as its own.
+// Then it is safe to shut the server down.
+
+// HandoverRetry is the time to wait between checks, if the state is not yet
+// handed over.
+var HandoverRetry = 1 * time.Second
+
+type decommission struct {
+	peers   *Peers        // Nil, if decommissioning is not enabled.
+	id      uint32        // The id of this server in the blueprints.
+	removed bool          // Removed from Cur, only redirect clients.
+	safe    chan struct{} // Closed, once the state is handed over.
+}
+
+// id returns the id of this server, as computed by util.GetProcs.
+func (p *Peers) id() uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(p.Self))
+	return h.Sum32()
+}
+
+func (d *decommission) enable(p *Peers) <-chan struct{} {
+	if d.peers == nil {
+		d.peers = p
+		d.id = p.id()
+		d.safe = make(chan struct{})
+	}
+	return d.safe
+}
+
+// removedIn marks the server as removed, if it was removed in cur. It returns
+// true only the first time, to start the handover once.
+func (d *decommission) removedIn(cur *pb.Blueprint) bool {
+	if d.peers == nil || d.removed || !cur.IsRemoved(d.id) {
+		return false
+	}
+	d.removed = true
+	glog.Infof("Removed from configuration %d, only redirecting clients.\n", cur.Order())
+	return true
+}
+
+func (d *decommission) safeToStop() bool {
+	if d.safe == nil {
+		return false
+	}
+	select {
+	case <-d.safe:
+		return true
+	default:
+		return false
+	}
+}
+
+// readFunc reads all register states from the server in cnf, a configuration
+// with a single server. If the server knows a newer configuration than cur,
+// it returns that instead.
+type readFunc func(cnf *pb.Configuration, cur *pb.Blueprint) (*pb.Blueprint, []*pb.KeyState, error)
+
+// handover waits until a write quorum of the current configuration holds the
+// states in own, starting with cur, and then closes d.safe.
+func (d *decommission) handover(cur *pb.Blueprint, own []*pb.KeyState, read readFunc) {
+	mgr, err := d.peers.manager()
+	if err != nil {
+		glog.Errorln("Handover failed:", err)
+		return
+	}
+	defer mgr.Close()
+
+	for {
+		n, nc := holders(mgr, cur, own, read)
+		if nc != cur {
+			glog.V(3).Infoln("Handover found new current configuration", nc.Order())
+			cur = nc
+			continue
+		}
+		if n >= cur.Quorum() {
+			break
+		}
+		glog.V(3).Infof("Servers of weight %d in configuration %d hold the state, need %d.\n", n, cur.Order(), cur.Quorum())
+		time.Sleep(HandoverRetry)
+	}
+	glog.Infof("Configuration %d holds the state, safe to shut down.\n", cur.Order())
+	close(d.safe)
+}
+
+// holders returns the weight of the servers in cur, that hold the states in own.
+// If one of them knows a newer configuration, it returns 0 and that one.
+func holders(mgr *pb.Manager, cur *pb.Blueprint, own []*pb.KeyState, read readFunc) (int, *pb.Blueprint) {
+	known := make(map[uint32]bool)
+	for _, gid := range mgr.MachineGlobalIDs() {
+		known[gid] = true
+	}
+
+	n := 0
+	for _, id := range cur.Ids() {
+		if !known[id] {
+			continue
+		}
+		cnf, err := mgr.NewConfiguration(mgr.ToIds([]uint32{id}), 1, RecoveryTimeout)
+		if err != nil {
+			glog.Errorln("Handover:", err)
+			continue
+		}
+		nc, kss, err := read(cnf, cur)
+		if err != nil {
+			glog.V(3).Infof("Handover read from %d failed: %v\n", id, err)
+			continue
+		}
+		if nc != nil && cur.LearnedCompare(nc) == 1 {
+			return 0, nc
+		}
+		if covers(kss, own) {
+			n += cur.Weight(id)
+		}
+	}
+	return n, cur
+}
+
+// covers returns true, if kss holds a state at least as recent as own, for
+// every key in own.
+func covers(kss, own []*pb.KeyState) bool {
+	have := make(pb.KeyStates)
+	have.AddAll(kss)
+	for _, kst := range own {
+		if have[kst.Key].Compare(kst.GetState()) == 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Decommission makes the server notice its removal from the configuration.
+// p tells the server its own address and where to find the other servers.
+// The returned channel is closed, once it is safe to shut the server down.
+func (rs *RegServer) Decommission(p *Peers) <-chan struct{} {
+	rs.Lock()
+	defer rs.Unlock()
+	safe := rs.dc.enable(p)
+	rs.checkRemoved()
+	return safe
+}
+
+// checkRemoved starts the handover, if rs was removed in Cur. rs must be locked.
+func (rs *RegServer) checkRemoved() {
+	if !rs.dc.removedIn(rs.Cur) {
+		return
+	}
+	own := allStates(rs.RState, rs.KStates)
+	go rs.dc.handover(rs.Cur, own, func(cnf *pb.Configuration, cur *pb.Blueprint) (*pb.Blueprint, []*pb.KeyState, error) {
+		c := cur.ID()
+		rep, err := cnf.AReadS(context.Background(), &pb.Conf{This: c, Cur: c, AllKeys: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		return rep.Reply.GetCur().GetCur(), append(rep.Reply.KStates, &pb.KeyState{State: rep.Reply.GetState()}), nil
+	})
+}
+
+func (ds *DynaServer) Decommission(p *Peers) <-chan struct{} {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	safe := ds.dc.enable(p)
+	ds.checkRemoved()
+	return safe
+}
+
+func (ds *DynaServer) checkRemoved() {
+	if !ds.dc.removedIn(ds.Cur) {
+		return
+	}
+	own := allStates(ds.RState, ds.KStates)
+	go ds.dc.handover(ds.Cur, own, func(cnf *pb.Configuration, cur *pb.Blueprint) (*pb.Blueprint, []*pb.KeyState, error) {
+		c := cur.ID()
+		rep, err := cnf.DWriteN(context.Background(), &pb.DRead{Conf: &pb.Conf{This: c, Cur: c, AllKeys: true}})
+		if err != nil {
+			return nil, nil, err
+		}
+		return rep.Reply.GetCur(), append(rep.Reply.KStates, &pb.KeyState{State: rep.Reply.GetState()}), nil
+	})
+}
+
+func (srs *SSRServer) Decommission(p *Peers) <-chan struct{} {
+	srs.mu.Lock()
+	defer srs.mu.Unlock()
+	safe := srs.dc.enable(p)
+	srs.checkRemoved()
+	return safe
+}
+
+func (srs *SSRServer) checkRemoved() {
+	if !srs.dc.removedIn(srs.Cur) {
+		return
+	}
+	own := allStates(srs.RState, srs.KStates)
+	go srs.dc.handover(srs.Cur, own, func(cnf *pb.Configuration, cur *pb.Blueprint) (*pb.Blueprint, []*pb.KeyState, error) {
+		c := cur.ID()
+		rep, err := cnf.SpSnOne(context.Background(), &pb.SWriteN{CurL: c, Cur: cur, This: c, Rnd: 0, AllKeys: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		return rep.Reply.GetCur(), append(rep.Reply.KStates, &pb.KeyState{State: rep.Reply.GetState()}), nil
+	})
+}
@@ -0,0 +1,86 @@
+package regserver_test
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/regserver"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1alpha"
+)
+
+// checkHealth asks the server at addr whether it is in status st.
+func checkHealth(t *testing.T, addr, st string) {
+	cc, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	r, err := healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{Service: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Server %s is not %s, health check returned %v.", addr, st, r.Status)
+	}
+}
+
+func TestDecommission(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 4)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	safe := make([]<-chan struct{}, len(cl.Servers))
+	for i, rs := range cl.Servers {
+		safe[i] = rs.Decommission(&regserver.Peers{Addrs: cl.Addrs, Self: cl.Addrs[i]})
+	}
+	cl.C.WriteKey(ctx, cl.CP, "x", []byte("1"))
+	checkHealth(t, cl.Addrs[3], regserver.StatusMember)
+
+	old := cl.C.Blueps[0].Copy()
+	prop := old.Copy()
+	prop.Rem(cl.ID(3))
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.C.Reconf(ctx, cl.CP, old); err != nil {
+		t.Errorf("Reconf to the old configuration returned %v, expected nil.", err)
+	}
+	// Still holds server 3, so it is merged with the current configuration.
+	if !old.SetWeight(cl.ID(0), 2) {
+		t.Fatal("Could not set weight.")
+	}
+	if _, err := cl.C.Reconf(ctx, cl.CP, old); err != smclient.ErrSuperseded {
+		t.Errorf("Reconf to an incomparable configuration returned %v, expected %v.", err, smclient.ErrSuperseded)
+	}
+
+	select {
+	case <-safe[3]:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Removed server did not become safe to stop.")
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-safe[i]:
+			t.Errorf("Server %d is safe to stop, but was not removed.", i)
+		default:
+		}
+	}
+
+	sn, err := cl.Servers[3].Inspect(nil, &pb.InspectRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sn.Removed || !sn.SafeToStop {
+		t.Errorf("Removed server reports Removed=%v SafeToStop=%v.", sn.Removed, sn.SafeToStop)
+	}
+	checkHealth(t, cl.Addrs[3], regserver.StatusRemoved)
+	checkHealth(t, cl.Addrs[0], "")
+	if v, _, _ := cl.C.ReadKey(ctx, cl.CP, "x"); string(v) != "1" {
+		t.Errorf("Read after removal returned %q, expected %q.", v, "1")
+	}
+}
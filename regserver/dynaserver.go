@@ -3,18 +3,28 @@ package regserver
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
 	"golang.org/x/net/context"
 )
 
 type DynaServer struct {
-	Cur    *pb.Blueprint
-	CurC   uint32 // This should be the length of cur, not its Gid.
-	RState *pb.State
-	Next   map[uint32][]*pb.Blueprint
-	mu     sync.RWMutex
+	Cur      *pb.Blueprint
+	CurC     pb.ConfID // This should be the ID of cur, not its Gid.
+	RState   *pb.State
+	KStates  pb.KeyStates // States of registers with a non-empty key.
+	Next     map[pb.ConfID][]*pb.Blueprint
+	mu       sync.RWMutex
+	store    storage.Store
+	started  time.Time
+	dc       decommission
+	staged   staging
+	watching watchers
+
+	recovering bool
 }
 
 func (ds *DynaServer) PrintState(op string) {
@@ -28,39 +38,68 @@ func (ds *DynaServer) PrintState(op string) {
 
 func NewDynaServer() *DynaServer {
 	return &DynaServer{
-		RState: &pb.State{make([]byte, 0), int32(0), uint32(0)},
-		Next:   make(map[uint32][]*pb.Blueprint, 0),
-		mu:     sync.RWMutex{},
+		RState:  &pb.State{make([]byte, 0), int32(0), uint32(0), uint32(0), nil},
+		KStates: make(pb.KeyStates),
+		Next:    make(map[pb.ConfID][]*pb.Blueprint, 0),
+		mu:      sync.RWMutex{},
+		store:   storage.NewMemStore(),
+		started: time.Now(),
 	}
 }
 
-func NewDynaServerWithCur(cur *pb.Blueprint, curc uint32) *DynaServer {
+func NewDynaServerWithCur(cur *pb.Blueprint, curc pb.ConfID) *DynaServer {
 	return &DynaServer{
-		Cur:    cur,
-		CurC:   curc,
-		RState: &pb.State{make([]byte, 0), int32(0), uint32(0)},
-		Next:   make(map[uint32][]*pb.Blueprint, 0),
-		mu:     sync.RWMutex{},
+		Cur:     cur,
+		CurC:    curc,
+		RState:  &pb.State{make([]byte, 0), int32(0), uint32(0), uint32(0), nil},
+		KStates: make(pb.KeyStates),
+		Next:    make(map[pb.ConfID][]*pb.Blueprint, 0),
+		mu:      sync.RWMutex{},
+		store:   storage.NewMemStore(),
+		started: time.Now(),
 	}
 }
 
+// NewDynaServerWithStore returns a server that persists its state in st,
+// and recovers the state already held by st.
+func NewDynaServerWithStore(st storage.Store) (*DynaServer, error) {
+	ds := NewDynaServer()
+	if st == nil {
+		return ds, nil
+	}
+	ds.store = st
+	if err := ds.restore(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
 func (rs *DynaServer) DSetCur(ctx context.Context, nc *pb.NewCur) (*pb.NewCurReply, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
 	glog.V(5).Infoln("Handling DSetCur")
 
-	if uint32(nc.Cur.Len()) <= rs.CurC {
+	if !nc.Cur.ID().Newer(rs.CurC) {
 		return &pb.NewCurReply{false}, nil
 	}
 
-	rs.Cur = nc.Cur
-	rs.CurC = uint32(nc.Cur.Len())
-
-	for gid, _ := range rs.Next {
-		if gid < rs.CurC {
-			delete(rs.Next, gid)
-		}
+	curc := nc.Cur.ID()
+	u := newUpdate()
+	putBlueprint(u.Batch, keyCur, nc.Cur)
+	putConfID(u.Batch, keyCurC, curc)
+	u.do(func() {
+		rs.Cur = nc.Cur
+		rs.CurC = curc
+	})
+	rs.gc(u, curc)
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
 	}
+	rs.checkRemoved()
+	rs.watching.notify()
 
 	return &pb.NewCurReply{true}, nil
 }
@@ -71,7 +110,7 @@ func (rs *DynaServer) DWriteN(ctx context.Context, rr *pb.DRead) (*pb.DReadReply
 	// 	defer rs.mu.RUnlock()
 	// 	glog.V(5).Infoln("Handling Empty WriteN")
 	//
-	// 	if rr.Conf.Cur < rs.CurC {
+	// 	if older(rr.Conf.Cur, rs.CurC) {
 	// 		return &pb.DReadReply{Cur: rs.Cur}, nil
 	// 	}
 	//
@@ -80,9 +119,15 @@ func (rs *DynaServer) DWriteN(ctx context.Context, rr *pb.DRead) (*pb.DReadReply
 	// }
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.DReadReply{Cur: rs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling WriteN")
 
-	if rr.Conf.Cur < rs.CurC {
+	if older(rr.Conf.Cur, rs.CurC) {
 		return &pb.DReadReply{Cur: rs.Cur}, nil
 	}
 	n := rs.Next[rr.Conf.This]
@@ -96,27 +141,49 @@ func (rs *DynaServer) DWriteN(ctx context.Context, rr *pb.DRead) (*pb.DReadReply
 			}
 		}
 		if !found {
-			n = append(n, rr.Prop)
+			n = append(n[:len(n):len(n)], rr.Prop)
+			b := new(storage.Batch)
+			putBlueprints(b, confKey(prefixDNext, rr.Conf.This), n)
+			if err := persist(rs.store, b); err != nil {
+				return nil, err
+			}
 			rs.Next[rr.Conf.This] = n
 		}
 
 	}
 
-	return &pb.DReadReply{State: rs.RState, Next: n}, nil
+	rep := &pb.DReadReply{State: stateOf(rs.RState, rs.KStates, rr.Conf.Key).Ref(), Next: n}
+	if rr.Conf.AllKeys {
+		rep.KStates = pb.Refs(otherStates(rs.RState, rs.KStates, rr.Conf.Key))
+	}
+	return rep, nil
 }
 
 func (rs *DynaServer) DSetState(ctx context.Context, ns *pb.DNewState) (*pb.NewStateReply, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.NewStateReply{Cur: rs.Cur}, nil
+	}
 	glog.V(4).Infoln("Handling SetState")
 
-	if ns.Conf.Cur < rs.CurC {
+	if older(ns.Conf.Cur, rs.CurC) {
 		// Outdated
 		return &pb.NewStateReply{Cur: rs.Cur}, nil
 	}
+	st, kss, err := rs.staged.resolve(rs.RState, rs.KStates, ns.Conf.Key, ns.State, ns.KStates)
+	if err != nil {
+		return nil, err
+	}
 
-	if rs.RState.Compare(ns.State) == 1 {
-		rs.RState = ns.State
+	u := newUpdate()
+	setState(u, &rs.RState, rs.KStates, ns.Conf.Key, st)
+	setStates(u, &rs.RState, rs.KStates, kss)
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
 	}
 
 	return &pb.NewStateReply{Next: rs.Next[ns.Conf.This]}, nil
@@ -125,24 +192,42 @@ func (rs *DynaServer) DSetState(ctx context.Context, ns *pb.DNewState) (*pb.NewS
 func (rs *DynaServer) DWriteNSet(ctx context.Context, wr *pb.DWriteNs) (*pb.DWriteNsReply, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.DWriteNsReply{Cur: rs.Cur}, nil
+	}
 	glog.V(4).Infoln("Handling WriteNSet")
 
-	if wr.Conf.Cur < rs.CurC {
+	if older(wr.Conf.Cur, rs.CurC) {
 		glog.V(4).Infoln("CLient has outdated cur.")
 		return &pb.DWriteNsReply{Cur: rs.Cur}, nil
 	}
 
 	n := rs.Next[wr.Conf.This]
 	if len(n) == 0 {
-		rs.Next[wr.Conf.This] = []*pb.Blueprint{wr.Next}
+		next := []*pb.Blueprint{wr.Next}
+		b := new(storage.Batch)
+		putBlueprints(b, confKey(prefixDNext, wr.Conf.This), next)
+		if err := persist(rs.store, b); err != nil {
+			return nil, err
+		}
+		rs.Next[wr.Conf.This] = next
 	} else {
 		for _, bp := range n {
 			if bp.Equals(wr.Next) {
 				return &pb.DWriteNsReply{}, nil
 			}
 		}
-		rs.Next[wr.Conf.This] = append(n, wr.Next)
+		next := append(n[:len(n):len(n)], wr.Next)
 		glog.Warning("There are different values written to one snapshot.")
+		b := new(storage.Batch)
+		putBlueprints(b, confKey(prefixDNext, wr.Conf.This), next)
+		if err := persist(rs.store, b); err != nil {
+			return nil, err
+		}
+		rs.Next[wr.Conf.This] = next
 		// 	nx := n
 		//outerLoop:
 		// 	for _, newBp := range wr.Next {
@@ -164,20 +249,32 @@ func (rs *DynaServer) DWriteNSet(ctx context.Context, wr *pb.DWriteNs) (*pb.DWri
 func (rs *DynaServer) GetOneN(ctx context.Context, gt *pb.GetOne) (gtr *pb.GetOneReply, err error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.GetOneReply{Cur: rs.Cur}, nil
+	}
 
-	if gt.Conf.Cur < rs.CurC || gt.Conf.This < rs.CurC {
+	if older(gt.Conf.Cur, rs.CurC) || older(gt.Conf.This, rs.CurC) {
 		return &pb.GetOneReply{Cur: rs.Cur}, nil
 	}
 
 	if len(rs.Next[gt.Conf.This]) == 0 {
-		rs.Next[gt.Conf.This] = []*pb.Blueprint{gt.Next}
-		glog.V(5).Infof("Handling GetOne: In C%d is Next %d\n", gt.Conf.This, gt.Next.Len())
+		glog.V(5).Infof("Handling GetOne: In C%d is Next %d\n", gt.Conf.This, gt.Next.Order())
+		next := []*pb.Blueprint{gt.Next}
+		b := new(storage.Batch)
+		putBlueprints(b, confKey(prefixDNext, gt.Conf.This), next)
+		if err = persist(rs.store, b); err != nil {
+			return nil, err
+		}
+		rs.Next[gt.Conf.This] = next
 	}
 
 	return &pb.GetOneReply{Next: rs.Next[gt.Conf.This][0]}, nil
 }
 
-func (ds *DynaServer) CheckNext(curc uint32, op string) {
+func (ds *DynaServer) CheckNext(curc pb.ConfID, op string) {
 	if ds.Next[curc] == nil {
 		return
 	}
@@ -0,0 +1,127 @@
+package regserver
+
+import (
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+)
+
+// When a new current configuration is installed, the state kept for older
+// configurations is no longer used: all requests for an older configuration
+// are answered with the new current configuration. The gc methods add the
+// deletion of the state kept for configurations older than curc to u. The
+// state is removed from memory once u is committed. They must be called with
+// the lock held.
+
+var reclaimed uint64
+
+// Reclaimed returns the number of entries reclaimed by garbage collection
+// since the process started.
+func Reclaimed() uint64 {
+	return atomic.LoadUint64(&reclaimed)
+}
+
+func logReclaimed(n int, curc pb.ConfID) {
+	if n == 0 {
+		return
+	}
+	total := atomic.AddUint64(&reclaimed, uint64(n))
+	glog.V(2).Infof("Reclaimed %d entries for configurations older than %d, %d in total.\n", n, curc.Order, total)
+}
+
+func (rs *RegServer) gc(u *update, curc pb.ConfID) {
+	n := 0
+	for c := range rs.NextMap {
+		if older(c, curc) {
+			c := c
+			u.Delete(confKey(prefixNextMap, c))
+			u.do(func() { delete(rs.NextMap, c) })
+			n++
+		}
+	}
+	for c := range rs.Rnd {
+		if older(c, curc) {
+			c := c
+			u.Delete(confKey(prefixRnd, c))
+			u.do(func() { delete(rs.Rnd, c) })
+			n++
+		}
+	}
+	for c := range rs.Val {
+		if older(c, curc) {
+			c := c
+			u.Delete(confKey(prefixVal, c))
+			u.do(func() { delete(rs.Val, c) })
+			n++
+		}
+	}
+	for c := range rs.CasFrozen {
+		if older(c, curc) {
+			c := c
+			u.Delete(confKey(prefixCasFrozen, c))
+			u.do(func() { delete(rs.CasFrozen, c) })
+			n++
+		}
+	}
+	for c := range rs.CasReady {
+		if older(c, curc) {
+			c := c
+			u.Delete(confKey(prefixCasReady, c))
+			u.do(func() { delete(rs.CasReady, c) })
+			n++
+		}
+	}
+	for key := range rs.Cas {
+		n += rs.casDrop(u, key)
+	}
+	u.do(func() { logReclaimed(n, curc) })
+}
+
+func (ds *DynaServer) gc(u *update, curc pb.ConfID) {
+	n := 0
+	for c := range ds.Next {
+		if older(c, curc) {
+			c := c
+			u.Delete(confKey(prefixDNext, c))
+			u.do(func() { delete(ds.Next, c) })
+			n++
+		}
+	}
+	u.do(func() { logReclaimed(n, curc) })
+}
+
+func (srs *SSRServer) gc(u *update, curc pb.ConfID) {
+	n := 0
+	for c, rnds := range srs.Proposed {
+		if older(c, curc) {
+			c := c
+			for rnd := range rnds {
+				u.Delete(rndKey(prefixProposed, c, rnd))
+				n++
+			}
+			u.do(func() { delete(srs.Proposed, c) })
+		}
+	}
+	for c, rnds := range srs.Committed {
+		if older(c, curc) {
+			c := c
+			for rnd := range rnds {
+				u.Delete(rndKey(prefixCommitted, c, rnd))
+				n++
+			}
+			u.do(func() { delete(srs.Committed, c) })
+		}
+	}
+	for c, rnds := range srs.Collected {
+		if older(c, curc) {
+			c := c
+			for rnd := range rnds {
+				u.Delete(rndKey(prefixCollected, c, rnd))
+				n++
+			}
+			u.do(func() { delete(srs.Collected, c) })
+		}
+	}
+	u.do(func() { logReclaimed(n, curc) })
+}
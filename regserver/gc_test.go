@@ -0,0 +1,105 @@
+package regserver
+
+import (
+	"testing"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
+)
+
+func TestGC(t *testing.T) {
+	st := storage.NewMemStore()
+	rs, err := NewRegServerWithStore(st, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Cur, rs.CurC = b2, b2.ID()
+	old, cur := b2.ID(), b12.ID()
+
+	if _, err = rs.GetPromise(ctx, &pb.Prepare{CurC: old, Rnd: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rs.Accept(ctx, &pb.Propose{CurC: old, Val: &pb.CV{Rnd: 1, Val: b12}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rs.AWriteN(ctx, &pb.WriteN{CurC: old, Next: b12}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rs.GetPromise(ctx, &pb.Prepare{CurC: cur, Rnd: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = rs.SetCur(ctx, &pb.NewCur{Cur: b12, CurC: cur}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.NextMap) != 0 || len(rs.Val) != 0 {
+		t.Errorf("old entries were not removed: NextMap %v, Val %v", rs.NextMap, rs.Val)
+	}
+	if _, ok := rs.Rnd[old]; ok {
+		t.Error("old round was not removed")
+	}
+	if rs.Rnd[cur] != 2 {
+		t.Errorf("round of the current configuration is %d, want 2", rs.Rnd[cur])
+	}
+
+	kv, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{confKey(prefixNextMap, old), confKey(prefixRnd, old), confKey(prefixVal, old)} {
+		if _, ok := kv[key]; ok {
+			t.Errorf("deletion of %s was not persisted", key)
+		}
+	}
+	if _, ok := kv[confKey(prefixRnd, cur)]; !ok {
+		t.Error("round of the current configuration was not persisted")
+	}
+}
+
+func TestSSRGC(t *testing.T) {
+	st := storage.NewMemStore()
+	srs, err := NewSSRServerWithStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs.Cur, srs.CurC = b2, b2.ID()
+	old, cur := b2.ID(), b12.ID()
+
+	for _, c := range []pb.ConfID{old, cur} {
+		if _, err = srs.SpSnOne(ctx, &pb.SWriteN{CurL: old, Cur: b2, This: c, Prop: b123}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = srs.SCommit(ctx, &pb.Commit{CurL: old, This: c, Collect: b123}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = srs.SCommit(ctx, &pb.Commit{CurL: old, This: c, Commit: true, Collect: b123}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = srs.SSetCur(ctx, &pb.NewCur{Cur: b12, CurC: cur}); err != nil {
+		t.Fatal(err)
+	}
+	for name, ok := range map[string]bool{
+		"Proposed":  srs.Proposed[old] == nil && srs.Proposed[cur][0] != nil,
+		"Committed": srs.Committed[old] == nil && srs.Committed[cur][0] != nil,
+		"Collected": srs.Collected[old] == nil && srs.Collected[cur][0] != nil,
+	} {
+		if !ok {
+			t.Errorf("%s was not collected correctly", name)
+		}
+	}
+
+	kv, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{prefixProposed, prefixCommitted, prefixCollected} {
+		if _, ok := kv[rndKey(prefix, old, 0)]; ok {
+			t.Errorf("deletion of %s was not persisted", rndKey(prefix, old, 0))
+		}
+		if _, ok := kv[rndKey(prefix, cur, 0)]; !ok {
+			t.Errorf("%s was not kept", rndKey(prefix, cur, 0))
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package regserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
+	grpc "google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1alpha"
+)
+
+// ErrStopped is returned when stopping a server that was already stopped.
+var ErrStopped = errors.New("server already stopped")
+
+// A Handle is a running server, with its own listener and grpc server.
+// Several servers can run in one process, each with its own handle.
+type Handle struct {
+	lis   net.Listener
+	gs    *grpc.Server
+	store storage.Store
+	state sync.Locker // Held by the handlers, while they change the server state.
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newHandle(port int, st storage.Store, state sync.Locker, register func(*grpc.Server)) (*Handle, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []grpc.ServerOption
+	h := &Handle{lis: lis, gs: grpc.NewServer(opts...), store: st, state: state}
+	register(h.gs)
+	go h.gs.Serve(lis)
+	return h, nil
+}
+
+// Addr returns the address the server listens on. Use it to find the port
+// picked by the system, if the server was started with port 0.
+func (h *Handle) Addr() string {
+	return h.lis.Addr().String()
+}
+
+// Stop closes the listener and all connections at once, and closes the store.
+func (h *Handle) Stop() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		return ErrStopped
+	}
+	h.stopped = true
+
+	h.gs.Stop()
+	return h.closeStore()
+}
+
+// GracefulStop stops accepting new connections, waits for the request that
+// is changing the server state to finish, and then stops like Stop. Requests
+// still waiting for the state get no reply, and fail to persist on the closed
+// store, so no change is left half done. Other requests are not drained, the
+// vendored grpc has no graceful stop or interceptors to count them with.
+func (h *Handle) GracefulStop() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		return ErrStopped
+	}
+	h.stopped = true
+
+	h.lis.Close()
+	// The handlers hold the state lock while they persist and apply a change.
+	h.state.Lock()
+	defer h.state.Unlock()
+	h.gs.Stop()
+	return h.closeStore()
+}
+
+func (h *Handle) closeStore() error {
+	if h.store == nil {
+		return nil
+	}
+	return h.store.Close()
+}
+
+func (rs *RegServer) register(s *grpc.Server) {
+	pb.RegisterAdvRegisterServer(s, rs)
+	pb.RegisterAdminServer(s, rs)
+	healthpb.RegisterHealthServer(s, rs)
+	pb.RegisterChunksServer(s, rs)
+	pb.RegisterLeaseServer(s, rs)
+	pb.RegisterWatchServer(s, rs)
+}
+
+func (cs *ConsServer) register(s *grpc.Server) {
+	pb.RegisterAdvRegisterServer(s, cs)
+	pb.RegisterAdminServer(s, cs)
+	healthpb.RegisterHealthServer(s, cs)
+	pb.RegisterChunksServer(s, cs)
+	pb.RegisterLeaseServer(s, cs)
+	pb.RegisterWatchServer(s, cs)
+	pb.RegisterCasServer(s, cs)
+}
+
+func (ds *DynaServer) register(s *grpc.Server) {
+	pb.RegisterDynaDiskServer(s, ds)
+	pb.RegisterAdminServer(s, ds)
+	healthpb.RegisterHealthServer(s, ds)
+	pb.RegisterChunksServer(s, ds)
+	pb.RegisterWatchServer(s, ds)
+}
+
+func (srs *SSRServer) register(s *grpc.Server) {
+	pb.RegisterSpSnRegisterServer(s, srs)
+	pb.RegisterAdminServer(s, srs)
+	healthpb.RegisterHealthServer(s, srs)
+	pb.RegisterChunksServer(s, srs)
+	pb.RegisterWatchServer(s, srs)
+}
+
+// The Serve functions start a server on port, and return it together with
+// its handle. They take the store to keep the server state in. If st is nil,
+// state is only kept in memory. If st holds state from an earlier run, the
+// server continues from there, and init is ignored.
+
+func ServeAdv(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store, noabort bool) (*RegServer, *Handle, error) {
+	rs, err := NewRegServerWithStore(st, noabort)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = initCur(rs.store, &rs.Cur, &rs.CurC, init, initC); err != nil {
+		return nil, nil, err
+	}
+	h, err := newHandle(port, st, rs, rs.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rs, h, nil
+}
+
+func ServeDyna(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store) (*DynaServer, *Handle, error) {
+	ds, err := NewDynaServerWithStore(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = initCur(ds.store, &ds.Cur, &ds.CurC, init, initC); err != nil {
+		return nil, nil, err
+	}
+	h, err := newHandle(port, st, &ds.mu, ds.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ds, h, nil
+}
+
+func ServeSSR(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store) (*SSRServer, *Handle, error) {
+	srs, err := NewSSRServerWithStore(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = initCur(srs.store, &srs.Cur, &srs.CurC, init, initC); err != nil {
+		return nil, nil, err
+	}
+	h, err := newHandle(port, st, &srs.mu, srs.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	return srs, h, nil
+}
+
+func ServeCons(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store, noabort bool) (*ConsServer, *Handle, error) {
+	cs, err := NewConsServerWithStore(st, noabort)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = initCur(cs.store, &cs.Cur, &cs.CurC, init, initC); err != nil {
+		return nil, nil, err
+	}
+	h, err := newHandle(port, st, cs, cs.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cs, h, nil
+}
+
+// The ServeRecover functions start a server with the state held by st. If st
+// is empty, the server starts in recovering mode and fetches its state from
+// the peers, before answering requests. They block until recovery is done.
+
+func ServeAdvRecover(port int, p *Peers, st storage.Store, noabort bool) (*RegServer, *Handle, error) {
+	rs, err := NewRegServerWithStore(st, noabort)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs.recovering = rs.Cur == nil
+	h, err := newHandle(port, st, rs, rs.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rs.recovering {
+		return rs, h, rs.Recover(p)
+	}
+	return rs, h, nil
+}
+
+func ServeDynaRecover(port int, p *Peers, st storage.Store) (*DynaServer, *Handle, error) {
+	ds, err := NewDynaServerWithStore(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	ds.recovering = ds.Cur == nil
+	h, err := newHandle(port, st, &ds.mu, ds.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ds.recovering {
+		return ds, h, ds.Recover(p)
+	}
+	return ds, h, nil
+}
+
+func ServeSSRRecover(port int, p *Peers, st storage.Store) (*SSRServer, *Handle, error) {
+	srs, err := NewSSRServerWithStore(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	srs.recovering = srs.Cur == nil
+	h, err := newHandle(port, st, &srs.mu, srs.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	if srs.recovering {
+		return srs, h, srs.Recover(p)
+	}
+	return srs, h, nil
+}
+
+func ServeConsRecover(port int, p *Peers, st storage.Store, noabort bool) (*ConsServer, *Handle, error) {
+	cs, err := NewConsServerWithStore(st, noabort)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs.recovering = cs.Cur == nil
+	h, err := newHandle(port, st, cs, cs.register)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cs.recovering {
+		return cs, h, cs.Recover(p)
+	}
+	return cs, h, nil
+}
@@ -0,0 +1,57 @@
+package regserver_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/relab/smartMerge/regserver"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestClusterInOneProcess(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	c, cp, hs := cl.C, cl.CP, cl.Handles
+	ctx := context.Background()
+
+	c.WriteKey(ctx, cp, "x", []byte("1"))
+	if v, _, _ := c.ReadKey(ctx, cp, "x"); string(v) != "1" {
+		t.Fatalf("Read returned %q, expected %q.", v, "1")
+	}
+
+	// A majority is still available with one server stopped.
+	if err := hs[0].GracefulStop(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := c.ReadKey(ctx, cp, "x"); err != nil || string(v) != "1" {
+		t.Errorf("Read with one server stopped returned %q, %v, expected %q.", v, err, "1")
+	}
+
+	for _, h := range hs[1:] {
+		if err := h.Stop(); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := hs[0].Stop(); err != regserver.ErrStopped {
+		t.Errorf("Stopping a stopped server returned %v, expected %v.", err, regserver.ErrStopped)
+	}
+	if _, err := c.WriteKey(ctx, cp, "x", []byte("2")); !errors.Is(err, smclient.ErrQuorumUnavailable) {
+		t.Errorf("Write without servers returned %v, expected %v.", err, smclient.ErrQuorumUnavailable)
+	}
+}
+
+func TestStartTest(t *testing.T) {
+	if _, err := regserver.StartAdvTest(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := regserver.StartTest(0); err == nil {
+		t.Error("Starting a second global server returned no error.")
+	}
+	if err := regserver.Stop(); err != nil {
+		t.Errorf("Stopping the test server returned %v.", err)
+	}
+	if err := regserver.Stop(); err == nil {
+		t.Error("Stopping a stopped test server returned no error.")
+	}
+}
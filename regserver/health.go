@@ -0,0 +1,86 @@
+package regserver
+
+import (
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1alpha"
+)
+
+// Every server runs the grpc health service, on the same port. The status is
+// computed from the server state on each call. For the empty service name,
+// Check returns SERVING for a member of the current configuration, UNKNOWN if
+// the server has no current configuration yet, and NOT_SERVING otherwise.
+// To tell the other cases apart, ask for one of the statuses below by name.
+// Check returns SERVING for the status the server is in, and NOT_SERVING for
+// the others. Removal is only noticed after Decommission was called.
+const (
+	StatusUninitialized = "uninitialized" // No Cur yet.
+	StatusMember        = "member"        // Serving member of Cur.
+	StatusRemoved       = "removed"       // Removed from Cur, see Decommission.
+	StatusRecovering    = "recovering"    // Fetching its state, see Recover.
+)
+
+func status(recovering bool, cur *pb.Blueprint, dc *decommission) string {
+	switch {
+	case recovering:
+		return StatusRecovering
+	case cur == nil:
+		return StatusUninitialized
+	case dc.removed:
+		return StatusRemoved
+	default:
+		return StatusMember
+	}
+}
+
+func check(st, service string) (*healthpb.HealthCheckResponse, error) {
+	r := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}
+	switch service {
+	case "":
+		switch st {
+		case StatusMember:
+			r.Status = healthpb.HealthCheckResponse_SERVING
+		case StatusUninitialized:
+			r.Status = healthpb.HealthCheckResponse_UNKNOWN
+		}
+	case StatusUninitialized, StatusMember, StatusRemoved, StatusRecovering:
+		if service == st {
+			r.Status = healthpb.HealthCheckResponse_SERVING
+		}
+	default:
+		return nil, grpc.Errorf(codes.NotFound, "unknown service")
+	}
+	return r, nil
+}
+
+// The Check methods implement the grpc health service.
+
+func (rs *RegServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	rs.RLock()
+	st := status(rs.recovering, rs.Cur, &rs.dc)
+	rs.RUnlock()
+	return check(st, in.Service)
+}
+
+func (cs *ConsServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	cs.RLock()
+	st := status(cs.recovering, cs.Cur, &cs.dc)
+	cs.RUnlock()
+	return check(st, in.Service)
+}
+
+func (ds *DynaServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	ds.mu.RLock()
+	st := status(ds.recovering, ds.Cur, &ds.dc)
+	ds.mu.RUnlock()
+	return check(st, in.Service)
+}
+
+func (srs *SSRServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	srs.mu.Lock()
+	st := status(srs.recovering, srs.Cur, &srs.dc)
+	srs.mu.Unlock()
+	return check(st, in.Service)
+}
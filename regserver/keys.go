@@ -0,0 +1,60 @@
+package regserver
+
+import (
+	pb "github.com/relab/smartMerge/proto"
+)
+
+// The servers hold one register for each key. The register with the empty key
+// is kept in RState, all other registers in KStates. The helpers below give
+// keyed access to both, and add changes to the update u.
+
+func stateOf(rstate *pb.State, ks pb.KeyStates, key string) *pb.State {
+	if key == "" {
+		return rstate
+	}
+	return ks[key]
+}
+
+// setState stores st for key, if it is more recent than the stored state,
+// and than the states already added to u.
+func setState(u *update, rstate **pb.State, ks pb.KeyStates, key string, st *pb.State) {
+	old, ok := u.states[key]
+	if !ok {
+		old = stateOf(*rstate, ks, key)
+	}
+	if st == nil || old.Compare(st) != 1 {
+		return
+	}
+	if u.states == nil {
+		u.states = make(map[string]*pb.State)
+	}
+	u.states[key] = st
+	if key == "" {
+		putState(u.Batch, keyRState, st)
+		u.do(func() { *rstate = st })
+		return
+	}
+	putState(u.Batch, prefixKState+key, st)
+	u.do(func() { ks[key] = st })
+}
+
+func setStates(u *update, rstate **pb.State, ks pb.KeyStates, kss []*pb.KeyState) {
+	for _, kst := range kss {
+		setState(u, rstate, ks, kst.Key, kst.GetState())
+	}
+}
+
+// otherStates returns the states of all keys except key. These are transferred
+// together with the state of key, when moving to a new configuration.
+func otherStates(rstate *pb.State, ks pb.KeyStates, key string) []*pb.KeyState {
+	kss := ks.Others(key)
+	if key != "" {
+		kss = append(kss, &pb.KeyState{Key: "", State: rstate})
+	}
+	return kss
+}
+
+// allStates returns the states of all keys, including the empty key.
+func allStates(rstate *pb.State, ks pb.KeyStates) []*pb.KeyState {
+	return append(ks.List(), &pb.KeyState{Key: "", State: rstate})
+}
@@ -0,0 +1,184 @@
+package regserver
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+)
+
+// Read leases on the sm and cons servers. A client holding a lease on a state
+// from a quorum of the current configuration returns that state for atomic
+// reads, without asking the servers, see smclient/lease.go. A server only
+// grants a lease for a state that is not older than its own, and only in its
+// current configuration, if it knows no next configuration.
+//
+// Writes wait for the leases they conflict with, before they reply. AWriteS and
+// SetState wait for the leases on older states of the written keys, AWriteN
+// waits for all leases, once a next configuration is known, since the states
+// are moved there. A write quorum meets every lease quorum, so no write
+// completes while a client still reads an older state from its lease.
+//
+// Leases are kept in memory only. A server that restarted with its state, or
+// recovered it, makes writes wait until a lease it may have granted before
+// expired.
+
+// MaxLease is the longest lease a server grants.
+var MaxLease = 10 * time.Second
+
+type lease struct {
+	st    *pb.State // Only Timestamp and Writer are set, nil if never written.
+	until time.Time
+}
+
+// leases are protected by the lock of the server.
+type leases struct {
+	keys  map[string]map[uint32]lease // By key and client.
+	floor time.Time                   // Writes wait until then, after a restart.
+}
+
+func (l *leases) grant(key string, client uint32, st *pb.State, d time.Duration) time.Duration {
+	if d > MaxLease {
+		d = MaxLease
+	}
+	if l.keys == nil {
+		l.keys = make(map[string]map[uint32]lease)
+	}
+	if l.keys[key] == nil {
+		l.keys[key] = make(map[uint32]lease)
+	}
+	if st != nil {
+		st = &pb.State{Timestamp: st.Timestamp, Writer: st.Writer}
+	}
+	ls := lease{st, time.Now().Add(pb.HoldLease(d))}
+	if old, ok := l.keys[key][client]; ok && old.until.After(time.Now()) {
+		// Keep covering the old lease, the client may still use it.
+		if old.st.Compare(ls.st) == 1 {
+			ls.st = old.st
+		}
+		if old.until.After(ls.until) {
+			ls.until = old.until
+		}
+	}
+	l.keys[key][client] = ls
+	return d
+}
+
+// restarted makes writes wait for the leases granted before a restart.
+func (l *leases) restarted() {
+	l.floor = time.Now().Add(pb.HoldLease(MaxLease))
+}
+
+// conflicts returns when the last lease on an older state than st of key
+// expires. Expired leases of key are dropped.
+func (l *leases) conflicts(key string, st *pb.State) time.Time {
+	until := l.floor
+	now := time.Now()
+	for client, ls := range l.keys[key] {
+		switch {
+		case ls.until.Before(now):
+			delete(l.keys[key], client)
+		case ls.st.Compare(st) == 1 && ls.until.After(until):
+			until = ls.until
+		}
+	}
+	if len(l.keys[key]) == 0 {
+		delete(l.keys, key)
+	}
+	return until
+}
+
+// all returns when the last lease expires.
+func (l *leases) all() time.Time {
+	until := l.floor
+	for _, cls := range l.keys {
+		for _, ls := range cls {
+			if ls.until.After(until) {
+				until = ls.until
+			}
+		}
+	}
+	return until
+}
+
+// waitLeases waits until the leases expired. Call it without holding the
+// lock.
+func waitLeases(ctx context.Context, until time.Time) error {
+	d := until.Sub(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	glog.V(4).Infof("Waiting %v for read leases.\n", d)
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (rs *RegServer) Lease(ctx context.Context, lr *pb.LeaseRequest) (*pb.LeaseReply, error) {
+	rs.Lock()
+	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.LeaseReply{Cur: &pb.ConfReply{Cur: rs.Cur}}, nil
+	}
+	glog.V(5).Infoln("Handling Lease")
+
+	if cr := rs.handleConf(lr.GetConf()); cr != nil {
+		return &pb.LeaseReply{Cur: cr}, nil
+	}
+	return rs.grantLease(lr), nil
+}
+
+func (cs *ConsServer) Lease(ctx context.Context, lr *pb.LeaseRequest) (*pb.LeaseReply, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.recovering {
+		return nil, ErrRecovering
+	}
+	if cs.dc.removed {
+		return &pb.LeaseReply{Cur: &pb.ConfReply{Cur: cs.Cur}}, nil
+	}
+	glog.V(5).Infoln("Handling Lease")
+
+	if cr := cs.handleConf(lr.GetConf()); cr != nil {
+		return &pb.LeaseReply{Cur: cr}, nil
+	}
+	return cs.grantLease(lr), nil
+}
+
+// grantLease grants lr, unless rs holds a newer state, or is not in the
+// configuration of lr yet. rs must be locked.
+func (rs *RegServer) grantLease(lr *pb.LeaseRequest) *pb.LeaseReply {
+	key := lr.Conf.Key
+	if lr.Conf.Cur != rs.CurC || lr.State.Compare(stateOf(rs.RState, rs.KStates, key)) == 1 {
+		return &pb.LeaseReply{}
+	}
+	d := rs.leased.grant(key, lr.Client, lr.State, time.Duration(lr.Dur))
+	return &pb.LeaseReply{Ok: true, Dur: int64(d)}
+}
+
+// afterUnlock waits for the leases that expire at until, if err is nil. Defer
+// it before locking the server, so that it runs after the unlock.
+func afterUnlock(ctx context.Context, until *time.Time, err *error) {
+	if *err == nil {
+		*err = waitLeases(ctx, *until)
+	}
+}
+
+// leaseConflicts returns when the last lease on an older state of key, or of
+// the keys in kss, expires. rs must be locked.
+func (rs *RegServer) leaseConflicts(key string, kss []*pb.KeyState) time.Time {
+	until := rs.leased.conflicts(key, stateOf(rs.RState, rs.KStates, key))
+	for _, ks := range kss {
+		if u := rs.leased.conflicts(ks.Key, stateOf(rs.RState, rs.KStates, ks.Key)); u.After(until) {
+			until = u
+		}
+	}
+	return until
+}
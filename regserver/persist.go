@@ -0,0 +1,431 @@
+package regserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
+)
+
+// Keys under which the server state is stored. Per configuration entries use
+// a prefix followed by the configuration's epoch, order and digest, and for
+// SSR also the round, e.g. "rnd/0-12-8c2f0a41d3e5b697" or
+// "proposed/0-12-8c2f0a41d3e5b697/0". Registers with a non-empty key are
+// stored under "kstate/" followed by the key, and their CAS slots under
+// "cas/", followed by the instance and the key.
+const (
+	keyCur          = "cur"
+	keyCurC         = "curc"
+	keyRState       = "rstate"
+	keyLAState      = "lastate"
+	keyNext         = "next"
+	prefixNextMap   = "nextmap/"
+	prefixRnd       = "rnd/"
+	prefixVal       = "val/"
+	prefixDNext     = "dnext/"
+	prefixProposed  = "proposed/"
+	prefixCommitted = "committed/"
+	prefixCollected = "collected/"
+	prefixKState    = "kstate/"
+	prefixCas       = "cas/"
+	prefixCasFrozen = "casfrozen/"
+	prefixCasReady  = "casready/"
+)
+
+var errCorruptState = errors.New("corrupt stored server state")
+
+func confKey(prefix string, c pb.ConfID) string {
+	return fmt.Sprintf("%s%d-%d-%016x", prefix, c.Epoch, c.Order, c.Digest)
+}
+
+func rndKey(prefix string, c pb.ConfID, rnd uint32) string {
+	return fmt.Sprintf("%s/%d", confKey(prefix, c), rnd)
+}
+
+func casKey(key string, t int32) string {
+	return fmt.Sprintf("%s%d/%s", prefixCas, t, key)
+}
+
+func parseConfKey(key, prefix string) (pb.ConfID, error) {
+	return parseConfID(strings.TrimPrefix(key, prefix))
+}
+
+func parseRndKey(key, prefix string) (c pb.ConfID, rnd uint32, err error) {
+	parts := strings.Split(strings.TrimPrefix(key, prefix), "/")
+	if len(parts) != 2 {
+		return c, 0, errCorruptState
+	}
+	if c, err = parseConfID(parts[0]); err != nil {
+		return c, 0, err
+	}
+	y, err := strconv.ParseUint(parts[1], 10, 32)
+	return c, uint32(y), err
+}
+
+func parseConfID(s string) (c pb.ConfID, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return c, errCorruptState
+	}
+	e, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return c, err
+	}
+	c.Epoch = uint32(e)
+	if c.Order, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return c, err
+	}
+	c.Digest, err = strconv.ParseUint(parts[2], 16, 64)
+	return c, err
+}
+
+// Marshaling of protobuf messages cannot fail, except for programming errors.
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+func mustMarshal(m marshaler) []byte {
+	data, err := m.Marshal()
+	if err != nil {
+		glog.Fatalln("marshaling server state failed:", err)
+	}
+	return data
+}
+
+func putBlueprint(b *storage.Batch, key string, bp *pb.Blueprint) {
+	if bp == nil {
+		b.Delete(key)
+		return
+	}
+	b.Put(key, mustMarshal(bp))
+}
+
+func putState(b *storage.Batch, key string, st *pb.State) {
+	if st == nil {
+		b.Delete(key)
+		return
+	}
+	b.Put(key, mustMarshal(st))
+}
+
+func putCV(b *storage.Batch, key string, cv *pb.CV) {
+	if cv == nil {
+		b.Delete(key)
+		return
+	}
+	b.Put(key, mustMarshal(cv))
+}
+
+// The CAS messages have no Marshal method, they use reflection.
+func putCasSlot(b *storage.Batch, key string, s *pb.CasSlot) {
+	data, err := proto.Marshal(s)
+	if err != nil {
+		glog.Fatalln("marshaling server state failed:", err)
+	}
+	b.Put(key, data)
+}
+
+func putConfID(b *storage.Batch, key string, c pb.ConfID) {
+	b.Put(key, mustMarshal(&c))
+}
+
+func putUint32(b *storage.Batch, key string, x uint32) {
+	putUint64(b, key, uint64(x))
+}
+
+func putUint64(b *storage.Batch, key string, x uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	b.Put(key, buf[:n])
+}
+
+// A list of blueprints is stored as a sequence of length prefixed blueprints.
+func putBlueprints(b *storage.Batch, key string, bps []*pb.Blueprint) {
+	if len(bps) == 0 {
+		b.Delete(key)
+		return
+	}
+	var buf []byte
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, bp := range bps {
+		data := mustMarshal(bp)
+		n := binary.PutUvarint(tmp, uint64(len(data)))
+		buf = append(buf, tmp[:n]...)
+		buf = append(buf, data...)
+	}
+	b.Put(key, buf)
+}
+
+func getBlueprint(data []byte) (*pb.Blueprint, error) {
+	bp := new(pb.Blueprint)
+	if err := bp.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return bp, nil
+}
+
+func getState(data []byte) (*pb.State, error) {
+	st := new(pb.State)
+	if err := st.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func getCV(data []byte) (*pb.CV, error) {
+	cv := new(pb.CV)
+	if err := cv.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+func getCasSlot(data []byte) (*pb.CasSlot, error) {
+	s := new(pb.CasSlot)
+	if err := proto.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func getConfID(data []byte) (c pb.ConfID, err error) {
+	err = c.Unmarshal(data)
+	return c, err
+}
+
+func getUint32(data []byte) (uint32, error) {
+	x, err := getUint64(data)
+	return uint32(x), err
+}
+
+// getUint64 also reads values stored with putUint32.
+func getUint64(data []byte) (uint64, error) {
+	x, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, errCorruptState
+	}
+	return x, nil
+}
+
+func getBlueprints(data []byte) ([]*pb.Blueprint, error) {
+	var bps []*pb.Blueprint
+	for len(data) > 0 {
+		l, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < l {
+			return nil, errCorruptState
+		}
+		bp, err := getBlueprint(data[n : n+int(l)])
+		if err != nil {
+			return nil, err
+		}
+		bps = append(bps, bp)
+		data = data[n+int(l):]
+	}
+	return bps, nil
+}
+
+// restoreCur handles the entries common to all server types.
+func restoreCur(key string, val []byte, cur **pb.Blueprint, curc *pb.ConfID, rstate **pb.State, ks pb.KeyStates) (found bool, err error) {
+	switch {
+	case key == keyCur:
+		*cur, err = getBlueprint(val)
+	case key == keyCurC:
+		*curc, err = getConfID(val)
+	case key == keyRState:
+		*rstate, err = getState(val)
+	case strings.HasPrefix(key, prefixKState):
+		ks[strings.TrimPrefix(key, prefixKState)], err = getState(val)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// restore sets the server state to the state held by the store.
+func (rs *RegServer) restore() error {
+	kv, err := rs.store.Load()
+	if err != nil {
+		return err
+	}
+	for key, val := range kv {
+		found, err := restoreCur(key, val, &rs.Cur, &rs.CurC, &rs.RState, rs.KStates)
+		if found {
+			if err != nil {
+				return fmt.Errorf("restoring %s: %v", key, err)
+			}
+			continue
+		}
+		var c pb.ConfID
+		switch {
+		case key == keyLAState:
+			rs.LAState, err = getBlueprint(val)
+		case key == keyNext:
+			rs.Next, err = getBlueprints(val)
+		case strings.HasPrefix(key, prefixNextMap):
+			if c, err = parseConfKey(key, prefixNextMap); err == nil {
+				rs.NextMap[c], err = getBlueprint(val)
+			}
+		case strings.HasPrefix(key, prefixRnd):
+			if c, err = parseConfKey(key, prefixRnd); err == nil {
+				rs.Rnd[c], err = getUint32(val)
+			}
+		case strings.HasPrefix(key, prefixVal):
+			if c, err = parseConfKey(key, prefixVal); err == nil {
+				rs.Val[c], err = getCV(val)
+			}
+		case strings.HasPrefix(key, prefixCas):
+			var slot *pb.CasSlot
+			if slot, err = getCasSlot(val); err == nil {
+				rs.Cas.Put(slot)
+			}
+		case strings.HasPrefix(key, prefixCasFrozen):
+			if c, err = parseConfKey(key, prefixCasFrozen); err == nil {
+				rs.CasFrozen[c] = true
+			}
+		case strings.HasPrefix(key, prefixCasReady):
+			if c, err = parseConfKey(key, prefixCasReady); err == nil {
+				rs.CasReady[c] = true
+			}
+		default:
+			glog.Warningln("ignoring unknown key in stored state:", key)
+		}
+		if err != nil {
+			return fmt.Errorf("restoring %s: %v", key, err)
+		}
+	}
+	if len(kv) > 0 {
+		glog.Infof("Restored state with %d entries, CurC is %d.\n", len(kv), rs.CurC.Order)
+	}
+	return nil
+}
+
+func (ds *DynaServer) restore() error {
+	kv, err := ds.store.Load()
+	if err != nil {
+		return err
+	}
+	for key, val := range kv {
+		found, err := restoreCur(key, val, &ds.Cur, &ds.CurC, &ds.RState, ds.KStates)
+		if !found {
+			var c pb.ConfID
+			if !strings.HasPrefix(key, prefixDNext) {
+				glog.Warningln("ignoring unknown key in stored state:", key)
+				continue
+			}
+			if c, err = parseConfKey(key, prefixDNext); err == nil {
+				ds.Next[c], err = getBlueprints(val)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("restoring %s: %v", key, err)
+		}
+	}
+	if len(kv) > 0 {
+		glog.Infof("Restored state with %d entries, CurC is %d.\n", len(kv), ds.CurC.Order)
+	}
+	return nil
+}
+
+func (srs *SSRServer) restore() error {
+	kv, err := srs.store.Load()
+	if err != nil {
+		return err
+	}
+	for key, val := range kv {
+		found, err := restoreCur(key, val, &srs.Cur, &srs.CurC, &srs.RState, srs.KStates)
+		if !found {
+			var c pb.ConfID
+			var rnd uint32
+			switch {
+			case strings.HasPrefix(key, prefixProposed):
+				if c, rnd, err = parseRndKey(key, prefixProposed); err == nil {
+					srs.proposed(c, rnd)
+					srs.Proposed[c][rnd], err = getBlueprints(val)
+				}
+			case strings.HasPrefix(key, prefixCommitted):
+				if c, rnd, err = parseRndKey(key, prefixCommitted); err == nil {
+					srs.committed(c, rnd)
+					srs.Committed[c][rnd], err = getBlueprint(val)
+				}
+			case strings.HasPrefix(key, prefixCollected):
+				if c, rnd, err = parseRndKey(key, prefixCollected); err == nil {
+					srs.collected(c, rnd)
+					srs.Collected[c][rnd], err = getBlueprint(val)
+				}
+			default:
+				glog.Warningln("ignoring unknown key in stored state:", key)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("restoring %s: %v", key, err)
+		}
+	}
+	if len(kv) > 0 {
+		glog.Infof("Restored state with %d entries, CurC is %d.\n", len(kv), srs.CurC.Order)
+	}
+	return nil
+}
+
+// An update collects the changes a request makes to the server state. They
+// are added to the batch, and applied in memory by commit only after the
+// batch was persisted, so a server never replies with state it could lose.
+type update struct {
+	*storage.Batch
+	apply  []func()
+	states map[string]*pb.State // Register states added by setState, by key.
+}
+
+func newUpdate() *update {
+	return &update{Batch: new(storage.Batch)}
+}
+
+// do defers the in-memory change f until the update is persisted.
+func (u *update) do(f func()) {
+	u.apply = append(u.apply, f)
+}
+
+// commit persists the batch, if it holds any changes, and then applies the
+// changes in memory.
+func (u *update) commit(st storage.Store) error {
+	if u.Len() > 0 {
+		if err := persist(st, u.Batch); err != nil {
+			return err
+		}
+	}
+	for _, f := range u.apply {
+		f()
+	}
+	return nil
+}
+
+// persist writes b to the store, and logs if this fails.
+// Handlers must not reply, if persist returns an error.
+func persist(st storage.Store, b *storage.Batch) error {
+	if err := st.Write(b); err != nil {
+		glog.Errorln("could not persist server state:", err)
+		return err
+	}
+	return nil
+}
+
+// initCur sets the initial current configuration, if none was restored.
+func initCur(st storage.Store, cur **pb.Blueprint, curc *pb.ConfID, init *pb.Blueprint, initC pb.ConfID) error {
+	if *cur != nil || init == nil {
+		return nil
+	}
+	b := new(storage.Batch)
+	putBlueprint(b, keyCur, init)
+	putConfID(b, keyCurC, initC)
+	if err := persist(st, b); err != nil {
+		return err
+	}
+	*cur = init
+	*curc = initC
+	return nil
+}
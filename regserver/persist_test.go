@@ -0,0 +1,147 @@
+package regserver
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
+)
+
+// failStore is a store whose writes fail while fail is set.
+type failStore struct {
+	*storage.MemStore
+	fail bool
+}
+
+func (fs *failStore) Write(b *storage.Batch) error {
+	if fs.fail {
+		return errors.New("write failed")
+	}
+	return fs.MemStore.Write(b)
+}
+
+func TestRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "regserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fs, err := storage.OpenFileStore(dir, storage.SyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := NewConsServerWithStore(fs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := b12.ID()
+	s := &pb.State{Value: Put(5, make([]byte, 8)), Timestamp: 2}
+	sx := &pb.State{Value: Put(7, make([]byte, 8)), Timestamp: 3}
+	cv := &pb.CV{Rnd: 4, Val: b123}
+	if _, err = cs.SetCur(ctx, &pb.NewCur{Cur: b12, CurC: c}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.AWriteS(ctx, &pb.WriteS{State: s, Conf: &pb.Conf{This: c, Cur: c}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.AWriteS(ctx, &pb.WriteS{State: sx, Key: "x", Conf: &pb.Conf{This: c, Cur: c}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.LAProp(ctx, &pb.LAProposal{Prop: b123, Conf: &pb.Conf{This: c, Cur: c}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.GetPromise(ctx, &pb.Prepare{CurC: c, Rnd: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.Accept(ctx, &pb.Propose{CurC: c, Val: cv}); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err = storage.OpenFileStore(dir, storage.SyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	cs, err = NewConsServerWithStore(fs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cs.Cur.Equals(b12) || cs.CurC != c {
+		t.Errorf("restored cur %v with id %v, want %v", cs.Cur, cs.CurC, b12)
+	}
+	if cs.RState.Compare(s) != 0 || cs.KStates["x"].Compare(sx) != 0 {
+		t.Errorf("restored register states %v and %v, want %v and %v", cs.RState, cs.KStates["x"], s, sx)
+	}
+	if !cs.LAState.Equals(b123) {
+		t.Errorf("restored LAState %v, want %v", cs.LAState, b123)
+	}
+	if cs.Rnd[c] != cv.Rnd || cs.Val[c] == nil || !cs.Val[c].Val.Equals(cv.Val) {
+		t.Errorf("restored Rnd %d and Val %v, want %d and %v", cs.Rnd[c], cs.Val[c], cv.Rnd, cv)
+	}
+}
+
+func TestFailedPersist(t *testing.T) {
+	st := &failStore{MemStore: storage.NewMemStore()}
+	cs, err := NewConsServerWithStore(st, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := b2.ID()
+	if _, err = cs.SetCur(ctx, &pb.NewCur{Cur: b2, CurC: c}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.GetPromise(ctx, &pb.Prepare{CurC: c, Rnd: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A request that fails to persist its changes must not apply them.
+	st.fail = true
+	conf := &pb.Conf{This: c, Cur: c}
+	s := &pb.State{Value: Put(5, make([]byte, 8)), Timestamp: 2}
+	if _, err = cs.AWriteS(ctx, &pb.WriteS{State: s, Conf: conf}); err == nil {
+		t.Error("AWriteS did not fail")
+	}
+	if _, err = cs.SetState(ctx, &pb.NewState{CurC: c, State: s, KStates: []*pb.KeyState{{Key: "x", State: s}}}); err == nil {
+		t.Error("SetState did not fail")
+	}
+	if cs.RState.Compare(s) == 0 || cs.KStates["x"] != nil {
+		t.Error("register state was changed before it was persisted")
+	}
+	if _, err = cs.LAProp(ctx, &pb.LAProposal{Prop: b12, Conf: conf}); err == nil {
+		t.Error("LAProp did not fail")
+	}
+	if cs.LAState != nil {
+		t.Error("LAState was changed before it was persisted")
+	}
+	if _, err = cs.Accept(ctx, &pb.Propose{CurC: c, Val: &pb.CV{Rnd: 2, Val: b12}}); err == nil {
+		t.Error("Accept did not fail")
+	}
+	if cs.Rnd[c] != 1 || cs.Val[c] != nil {
+		t.Error("Rnd or Val was changed before it was persisted")
+	}
+	if _, err = cs.SetCur(ctx, &pb.NewCur{Cur: b12, CurC: b12.ID()}); err == nil {
+		t.Error("SetCur did not fail")
+	}
+	if cs.Cur != b2 || cs.CurC != c {
+		t.Error("Cur was changed before it was persisted")
+	}
+
+	// The same requests succeed, once the store works again.
+	st.fail = false
+	if _, err = cs.AWriteS(ctx, &pb.WriteS{State: s, Conf: conf}); err != nil || cs.RState.Compare(s) != 0 {
+		t.Errorf("AWriteS failed: %v", err)
+	}
+	if _, err = cs.SetCur(ctx, &pb.NewCur{Cur: b12, CurC: b12.ID()}); err != nil || cs.Cur != b12 {
+		t.Errorf("SetCur failed: %v", err)
+	}
+	if _, ok := cs.Rnd[c]; ok {
+		t.Error("Rnd of the old configuration was not collected")
+	}
+}
@@ -0,0 +1,408 @@
+package regserver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+	qf "github.com/relab/smartMerge/qfuncs"
+	"golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// A server that lost its state, e.g. after a disk replacement, must not reply
+// with its empty initial state. Instead it starts in recovering mode, where
+// all protocol RPCs are refused, and reads the current configuration and the
+// latest state from enough servers to intersect every write quorum. Only then
+// does it start serving requests again.
+
+// ErrRecovering is returned by all protocol RPCs while the server recovers.
+var ErrRecovering = grpc.Errorf(codes.Unavailable, "server is recovering its state")
+
+// RecoveryTimeout is the timeout for the quorum calls during recovery.
+var RecoveryTimeout = 1 * time.Second
+
+// RecoveryRetry is the time to wait before retrying a failed recovery attempt.
+var RecoveryRetry = 1 * time.Second
+
+var errConfChanged = errors.New("configuration changed during recovery")
+
+// Peers tells a recovering server where to find its state.
+type Peers struct {
+	Addrs []string      // Addresses of all servers, as in the config file.
+	Self  string        // The address of this server.
+	Cur   *pb.Blueprint // A configuration the server was part of, e.g. the initial one.
+}
+
+// NewPeers returns the peers of the server listening on port. addrs are the
+// servers from the config file, and the first initsize of them form the
+// initial configuration.
+func NewPeers(addrs []string, ids []uint32, port, initsize int) (*Peers, error) {
+	p := &Peers{Addrs: addrs}
+	suffix := ":" + strconv.Itoa(port)
+	for _, addr := range addrs {
+		if strings.HasSuffix(addr, suffix) {
+			if p.Self != "" {
+				return nil, fmt.Errorf("several servers in the config file use port %d", port)
+			}
+			p.Self = addr
+		}
+	}
+	if p.Self == "" {
+		return nil, fmt.Errorf("no server in the config file uses port %d", port)
+	}
+	if initsize > len(ids) {
+		return nil, errors.New("not enough servers to fulfill initsize")
+	}
+
+	p.Cur = pb.InitBlueprint(ids[:initsize])
+	return p, nil
+}
+
+func (p *Peers) manager() (*pb.Manager, error) {
+	addrs := make([]string, 0, len(p.Addrs))
+	for _, addr := range p.Addrs {
+		if addr != p.Self {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no other servers to recover from")
+	}
+
+	return pb.NewManager(addrs, pb.WithGrpcDialOptions(grpc.WithInsecure()),
+		pb.WithAReadSQuorumFunc(qf.RecAReadSQF),
+		pb.WithLAPropQuorumFunc(qf.RecLAPropQF),
+		pb.WithGetPromiseQuorumFunc(qf.RecGetPromiseQF),
+		pb.WithDWriteNQuorumFunc(qf.RecDWriteNQF),
+		pb.WithSpSnOneQuorumFunc(qf.RecSpSnOneQF),
+	)
+}
+
+// readConf returns a configuration with the other servers in blp. Its quorum
+// size is the weight needed to intersect every write quorum in blp.
+func readConf(mgr *pb.Manager, blp *pb.Blueprint) (*pb.Configuration, error) {
+	return quorumConf(mgr, blp, blp.ReadQuorum())
+}
+
+// writeConf is readConf with the weight of a write quorum in blp, so that it
+// also intersects every read quorum.
+func writeConf(mgr *pb.Manager, blp *pb.Blueprint) (*pb.Configuration, error) {
+	return quorumConf(mgr, blp, blp.Quorum())
+}
+
+func quorumConf(mgr *pb.Manager, blp *pb.Blueprint, q int) (*pb.Configuration, error) {
+	known := make(map[uint32]bool)
+	for _, gid := range mgr.MachineGlobalIDs() {
+		known[gid] = true
+	}
+
+	gids := make([]uint32, 0, len(blp.Ids()))
+	ws := make([]int, 0, len(blp.Ids()))
+	w := 0
+	for _, id := range blp.Ids() {
+		if known[id] {
+			gids = append(gids, id)
+			ws = append(ws, blp.Weight(id))
+			w += blp.Weight(id)
+		}
+	}
+
+	if q > w {
+		return nil, fmt.Errorf("recovery needs other servers of weight %d in configuration %d, but they only have %d", q, blp.Order(), w)
+	}
+	return mgr.NewWeightedConfiguration(mgr.ToIds(gids), ws, q, 0, RecoveryTimeout)
+}
+
+// recoverWith connects to the peers, and calls rec until it succeeds. conf
+// returns the configuration rec reads from.
+func recoverWith(p *Peers, conf func(*pb.Manager, *pb.Blueprint) (*pb.Configuration, error), rec func(*pb.Manager, *pb.Blueprint) error) error {
+	mgr, err := p.manager()
+	if err != nil {
+		return err
+	}
+	defer mgr.Close()
+
+	// Fail early, if the configuration is too small to recover from.
+	if _, err = conf(mgr, p.Cur); err != nil {
+		return err
+	}
+
+	glog.Infoln("Starting recovery from configuration", p.Cur.Order())
+	for {
+		err = rec(mgr, p.Cur)
+		if err == nil {
+			return nil
+		}
+		glog.Warningf("Recovery attempt failed: %v. Retrying in %v.\n", err, RecoveryRetry)
+		time.Sleep(RecoveryRetry)
+	}
+}
+
+// readCur reads the state from the most recent configuration, starting with cur.
+func readCur(mgr *pb.Manager, cur *pb.Blueprint) (*pb.Blueprint, *pb.ReadReply, error) {
+	for {
+		cnf, err := readConf(mgr, cur)
+		if err != nil {
+			return nil, nil, err
+		}
+		c := cur.ID()
+		rep, err := cnf.AReadS(context.Background(), &pb.Conf{This: c, Cur: c, AllKeys: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		if nc := rep.Reply.GetCur().GetCur(); nc != nil && cur.LearnedCompare(nc) == 1 {
+			glog.V(3).Infoln("Recovery found new current configuration", nc.Order())
+			cur = nc
+			continue
+		}
+		r := rep.Reply
+		if r.State, r.KStates, err = fetchValues(cnf, r.State, r.KStates); err != nil {
+			return nil, nil, err
+		}
+		return cur, r, nil
+	}
+}
+
+func newerNext(next []*pb.Blueprint, curc pb.ConfID) []*pb.Blueprint {
+	newNext := make([]*pb.Blueprint, 0, len(next))
+	for _, blp := range next {
+		if blp.ID().Newer(curc) {
+			newNext = append(newNext, blp)
+		}
+	}
+	return newNext
+}
+
+// Recover fetches the current configuration, the register states and the
+// lattice agreement state from the peers. It blocks until this succeeded.
+func (rs *RegServer) Recover(p *Peers) error {
+	return recoverWith(p, readConf, func(mgr *pb.Manager, cur *pb.Blueprint) error {
+		cur, rrep, err := readCur(mgr, cur)
+		if err != nil {
+			return err
+		}
+		cnf, err := readConf(mgr, cur)
+		if err != nil {
+			return err
+		}
+		c := cur.ID()
+		lrep, err := cnf.LAProp(context.Background(), &pb.LAProposal{Conf: &pb.Conf{This: c, Cur: c}})
+		if err != nil {
+			return err
+		}
+		if nc := lrep.Reply.GetCur().GetCur(); nc != nil && cur.LearnedCompare(nc) == 1 {
+			return errConfChanged
+		}
+
+		rs.Lock()
+		defer rs.Unlock()
+		next := newerNext(rrep.GetCur().GetNext(), c)
+
+		u := newUpdate()
+		putBlueprint(u.Batch, keyCur, cur)
+		putConfID(u.Batch, keyCurC, c)
+		putBlueprints(u.Batch, keyNext, next)
+		u.do(func() {
+			rs.Cur = cur
+			rs.CurC = c
+			rs.Next = next
+		})
+		setState(u, &rs.RState, rs.KStates, "", rrep.GetState())
+		setStates(u, &rs.RState, rs.KStates, rrep.GetKStates())
+		rs.setLAState(u, rs.LAState.Merge(lrep.Reply.GetLAState()))
+		rs.gc(u, c)
+		if err = u.commit(rs.store); err != nil {
+			return err
+		}
+		rs.recovering = false
+		rs.leased.restarted()
+		rs.watching.notify()
+		glog.Infof("Recovered state in configuration %d.\n", rs.CurC)
+		return nil
+	})
+}
+
+// Recover fetches the current configuration, the register states and the
+// consensus state of the current configuration from the peers.
+// It blocks until this succeeded.
+func (cs *ConsServer) Recover(p *Peers) error {
+	return recoverWith(p, writeConf, func(mgr *pb.Manager, cur *pb.Blueprint) error {
+		cur, rrep, err := readCur(mgr, cur)
+		if err != nil {
+			return err
+		}
+		// Read the promises from a write quorum, which intersects every
+		// quorum that may have relied on the lost promise of this server.
+		cnf, err := writeConf(mgr, cur)
+		if err != nil {
+			return err
+		}
+		c := cur.ID()
+		prep, err := cnf.GetPromise(context.Background(), &pb.Prepare{CurC: c, Rnd: 0})
+		if err != nil {
+			return err
+		}
+		if nc := prep.Reply.GetCur(); nc != nil && cur.LearnedCompare(nc) == 1 {
+			return errConfChanged
+		}
+
+		cs.Lock()
+		defer cs.Unlock()
+		u := newUpdate()
+		putBlueprint(u.Batch, keyCur, cur)
+		putConfID(u.Batch, keyCurC, c)
+		u.do(func() {
+			cs.Cur = cur
+			cs.CurC = c
+		})
+		setState(u, &cs.RState, cs.KStates, "", rrep.GetState())
+		setStates(u, &cs.RState, cs.KStates, rrep.GetKStates())
+		if dec := prep.Reply.GetDec(); dec != nil {
+			putBlueprint(u.Batch, confKey(prefixNextMap, c), dec)
+			u.do(func() { cs.NextMap[c] = dec })
+		} else {
+			// Never accept in a round lower than what a quorum has promised.
+			rnd, val := prep.Reply.Rnd, prep.Reply.GetVal()
+			putUint32(u.Batch, confKey(prefixRnd, c), rnd)
+			u.do(func() { cs.Rnd[c] = rnd })
+			if val != nil {
+				putCV(u.Batch, confKey(prefixVal, c), val)
+				u.do(func() { cs.Val[c] = val })
+			}
+		}
+		// The CAS slots are lost. Do not take part in CAS, until a
+		// reconfiguration installs them in the next configuration.
+		putUint32(u.Batch, confKey(prefixCasFrozen, c), 1)
+		u.do(func() { cs.CasFrozen[c] = true })
+		cs.gc(u, c)
+		if err = u.commit(cs.store); err != nil {
+			return err
+		}
+		cs.recovering = false
+		cs.leased.restarted()
+		cs.watching.notify()
+		glog.Infof("Recovered state in configuration %d.\n", cs.CurC)
+		return nil
+	})
+}
+
+// Recover fetches the current configuration, the register states and the
+// proposals for the current configuration from the peers.
+// It blocks until this succeeded.
+func (ds *DynaServer) Recover(p *Peers) error {
+	return recoverWith(p, readConf, func(mgr *pb.Manager, cur *pb.Blueprint) error {
+		var rep *pb.DWriteNReply
+		for {
+			cnf, err := readConf(mgr, cur)
+			if err != nil {
+				return err
+			}
+			c := cur.ID()
+			rep, err = cnf.DWriteN(context.Background(), &pb.DRead{Conf: &pb.Conf{This: c, Cur: c, AllKeys: true}})
+			if err != nil {
+				return err
+			}
+			nc := rep.Reply.GetCur()
+			if nc == nil || cur.LearnedCompare(nc) != 1 {
+				r := rep.Reply
+				if r.State, r.KStates, err = fetchValues(cnf, r.State, r.KStates); err != nil {
+					return err
+				}
+				break
+			}
+			glog.V(3).Infoln("Recovery found new current configuration", nc.Order())
+			cur = nc
+		}
+
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		c := cur.ID()
+
+		u := newUpdate()
+		putBlueprint(u.Batch, keyCur, cur)
+		putConfID(u.Batch, keyCurC, c)
+		u.do(func() {
+			ds.Cur = cur
+			ds.CurC = c
+		})
+		setState(u, &ds.RState, ds.KStates, "", rep.Reply.GetState())
+		setStates(u, &ds.RState, ds.KStates, rep.Reply.GetKStates())
+		if next := rep.Reply.GetNext(); len(next) > 0 {
+			putBlueprints(u.Batch, confKey(prefixDNext, c), next)
+			u.do(func() { ds.Next[c] = next })
+		}
+		ds.gc(u, c)
+		if err := u.commit(ds.store); err != nil {
+			return err
+		}
+		ds.recovering = false
+		ds.watching.notify()
+		glog.Infof("Recovered state in configuration %d.\n", ds.CurC)
+		return nil
+	})
+}
+
+// Recover fetches the current configuration, the register states and the
+// proposals for the current configuration from the peers.
+// It blocks until this succeeded.
+func (srs *SSRServer) Recover(p *Peers) error {
+	return recoverWith(p, readConf, func(mgr *pb.Manager, cur *pb.Blueprint) error {
+		var rep *pb.SpSnOneReply
+		for {
+			cnf, err := readConf(mgr, cur)
+			if err != nil {
+				return err
+			}
+			c := cur.ID()
+			rep, err = cnf.SpSnOne(context.Background(), &pb.SWriteN{CurL: c, Cur: cur, This: c, Rnd: 0, AllKeys: true})
+			if err != nil {
+				return err
+			}
+			nc := rep.Reply.GetCur()
+			if nc == nil || cur.LearnedCompare(nc) != 1 {
+				r := rep.Reply
+				if r.State, r.KStates, err = fetchValues(cnf, r.State, r.KStates); err != nil {
+					return err
+				}
+				break
+			}
+			glog.V(3).Infoln("Recovery found new current configuration", nc.Order())
+			cur = nc
+		}
+
+		srs.mu.Lock()
+		defer srs.mu.Unlock()
+		c := cur.ID()
+
+		u := newUpdate()
+		putBlueprint(u.Batch, keyCur, cur)
+		putConfID(u.Batch, keyCurC, c)
+		u.do(func() {
+			srs.Cur = cur
+			srs.CurC = c
+		})
+		setState(u, &srs.RState, srs.KStates, "", rep.Reply.GetState())
+		setStates(u, &srs.RState, srs.KStates, rep.Reply.GetKStates())
+		if next := rep.Reply.GetNext(); len(next) > 0 {
+			putBlueprints(u.Batch, rndKey(prefixProposed, c, 0), next)
+			u.do(func() {
+				srs.proposed(c, 0)
+				srs.Proposed[c][0] = next
+			})
+		}
+		srs.gc(u, c)
+		if err := u.commit(srs.store); err != nil {
+			return err
+		}
+		srs.recovering = false
+		srs.watching.notify()
+		glog.Infof("Recovered state in configuration %d.\n", srs.CurC)
+		return nil
+	})
+}
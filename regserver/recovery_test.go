@@ -0,0 +1,200 @@
+package regserver_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/regserver"
+	"github.com/relab/smartMerge/storage"
+	"github.com/relab/smartMerge/store"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// recovered is the state of a server after recovery.
+type recovered struct {
+	cur     *pb.Blueprint
+	rstate  *pb.State
+	kstates pb.KeyStates
+	h       *regserver.Handle
+	err     error
+}
+
+func serve(alg string, port int, st storage.Store) (h *regserver.Handle, err error) {
+	switch alg {
+	case "cons":
+		_, h, err = regserver.ServeCons(port, nil, pb.ConfID{}, st, false)
+	case "dyna":
+		_, h, err = regserver.ServeDyna(port, nil, pb.ConfID{}, st)
+	case "ssr":
+		_, h, err = regserver.ServeSSR(port, nil, pb.ConfID{}, st)
+	default:
+		_, h, err = regserver.ServeAdv(port, nil, pb.ConfID{}, st, false)
+	}
+	return h, err
+}
+
+func serveRecover(alg string, port int, p *regserver.Peers, st storage.Store) (r recovered) {
+	switch alg {
+	case "cons":
+		var cs *regserver.ConsServer
+		if cs, r.h, r.err = regserver.ServeConsRecover(port, p, st, false); cs != nil {
+			r.cur, r.rstate, r.kstates = cs.Cur, cs.RState, cs.KStates
+		}
+	case "dyna":
+		var ds *regserver.DynaServer
+		if ds, r.h, r.err = regserver.ServeDynaRecover(port, p, st); ds != nil {
+			r.cur, r.rstate, r.kstates = ds.Cur, ds.RState, ds.KStates
+		}
+	case "ssr":
+		var srs *regserver.SSRServer
+		if srs, r.h, r.err = regserver.ServeSSRRecover(port, p, st); srs != nil {
+			r.cur, r.rstate, r.kstates = srs.Cur, srs.RState, srs.KStates
+		}
+	default:
+		var rs *regserver.RegServer
+		if rs, r.h, r.err = regserver.ServeAdvRecover(port, p, st, false); rs != nil {
+			r.cur, r.rstate, r.kstates = rs.Cur, rs.RState, rs.KStates
+		}
+	}
+	return r
+}
+
+// protocolCall calls a protocol RPC of alg on the server at addr. It waits
+// for the server to listen first.
+func protocolCall(alg, addr string) error {
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cc, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	ctx := context.Background()
+	switch alg {
+	case "dyna":
+		_, err = pb.NewDynaDiskClient(cc).DWriteN(ctx, &pb.DRead{Conf: &pb.Conf{}})
+	case "ssr":
+		_, err = pb.NewSpSnRegisterClient(cc).SpSnOne(ctx, &pb.SWriteN{})
+	default:
+		_, err = pb.NewAdvRegisterClient(cc).AReadS(ctx, &pb.Conf{})
+	}
+	return err
+}
+
+func openStore(t *testing.T, dir string) storage.Store {
+	st, err := storage.OpenFileStore(dir, storage.SyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestRecover(t *testing.T) {
+	defer func(to, retry time.Duration) {
+		regserver.RecoveryTimeout, regserver.RecoveryRetry = to, retry
+	}(regserver.RecoveryTimeout, regserver.RecoveryRetry)
+	regserver.RecoveryTimeout, regserver.RecoveryRetry = 200*time.Millisecond, 50*time.Millisecond
+
+	for _, alg := range []string{"sm", "cons", "dyna", "ssr"} {
+		testRecover(t, alg)
+	}
+}
+
+// testRecover wipes the store of a server, and restarts it while too few
+// servers are up to recover from.
+func testRecover(t *testing.T, alg string) {
+	dirs := make([]string, 3)
+	stores := make([]storage.Store, 3)
+	for i := range dirs {
+		dir, err := ioutil.TempDir("", "recover")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs[i], stores[i] = dir, openStore(t, dir)
+	}
+	cl := testcluster.StartWithStores(t, alg, stores)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	c, err := store.NewClient(cl.Init, alg, "", 2, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Write(ctx, cl.CP, []byte("a")); err != nil {
+		t.Fatalf("%s: %v", alg, err)
+	}
+	for _, v := range []string{"1", "2"} {
+		if _, err = c.WriteKey(ctx, cl.CP, "x", []byte(v)); err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+	}
+
+	for _, h := range cl.Handles[:2] {
+		if err = h.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.RemoveAll(dirs[0]); err != nil {
+		t.Fatal(err)
+	}
+	ports := make([]int, 2)
+	for i := range ports {
+		if ports[i], err = strconv.Atoi(cl.Addrs[i][len("localhost:"):]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only one other server is up, a read quorum needs two.
+	p := &regserver.Peers{Addrs: cl.Addrs, Self: cl.Addrs[0], Cur: cl.Init}
+	done := make(chan recovered, 1)
+	go func(st storage.Store) { done <- serveRecover(alg, ports[0], p, st) }(openStore(t, dirs[0]))
+	if err = protocolCall(alg, cl.Addrs[0]); grpc.Code(err) != codes.Unavailable {
+		t.Errorf("%s: Call to a recovering server returned %v, expected %v.", alg, err, regserver.ErrRecovering)
+	}
+	select {
+	case r := <-done:
+		t.Fatalf("%s: Server recovered from one other server, returned %v.", alg, r.err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	h, err := serve(alg, ports[1], openStore(t, dirs[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Stop()
+	var r recovered
+	select {
+	case r = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s: Server did not recover.", alg)
+	}
+	if r.err != nil {
+		t.Fatalf("%s: Recovery returned %v.", alg, r.err)
+	}
+	defer r.h.Stop()
+
+	if !r.cur.Equals(cl.Init) {
+		t.Errorf("%s: Recovered configuration %v, expected %v.", alg, r.cur, cl.Init)
+	}
+	if r.rstate == nil || string(r.rstate.Value) != "a" || r.kstates["x"] == nil || string(r.kstates["x"].Value) != "2" {
+		t.Errorf("%s: Recovered states %v and %v, expected %q and %q.", alg, r.rstate, r.kstates["x"], "a", "2")
+	}
+	if err = protocolCall(alg, cl.Addrs[0]); grpc.Code(err) == codes.Unavailable {
+		t.Errorf("%s: Call to a recovered server returned %v.", alg, err)
+	}
+}
@@ -4,25 +4,39 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	l "github.com/relab/smartMerge/leader"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
 	"golang.org/x/net/context"
 )
 
 type RegServer struct {
 	sync.RWMutex
-	Cur     *pb.Blueprint
-	CurC    uint32
-	LAState *pb.Blueprint //Used only for SM-Lattice agreement
-	RState  *pb.State
-	Next    []*pb.Blueprint
-	NextMap map[uint32]*pb.Blueprint //Used only for Consensus based
-	Rnd     map[uint32]uint32        //Used only for Consensus based
-	Val     map[uint32]*pb.CV        //Used only for Consensus based
-	noabort bool
-	Leader  *l.Leader
+	Cur       *pb.Blueprint
+	CurC      pb.ConfID
+	LAState   *pb.Blueprint //Used only for SM-Lattice agreement
+	RState    *pb.State
+	KStates   pb.KeyStates // States of registers with a non-empty key.
+	Next      []*pb.Blueprint
+	NextMap   map[pb.ConfID]*pb.Blueprint //Used only for Consensus based
+	Rnd       map[pb.ConfID]uint32        //Used only for Consensus based
+	Val       map[pb.ConfID]*pb.CV        //Used only for Consensus based
+	Cas       pb.KeySlots                 //Used only for CAS, see casserver.go
+	CasFrozen map[pb.ConfID]bool          //Used only for CAS
+	CasReady  map[pb.ConfID]bool          //Used only for CAS
+	noabort   bool
+	Leader    *l.Leader
+	store     storage.Store
+	started   time.Time
+	dc        decommission
+	staged    staging
+	leased    leases
+	watching  watchers
+
+	recovering bool // Refuse all requests while recovering the state from other servers.
 }
 
 func (rs *RegServer) PrintState(op string) {
@@ -40,16 +54,22 @@ var InitState = pb.State{Value: nil, Timestamp: int32(0), Writer: uint32(0)}
 func NewRegServer(noabort bool) *RegServer {
 	rs := &RegServer{}
 	rs.RWMutex = sync.RWMutex{}
-	rs.RState = &pb.State{make([]byte, 0), int32(0), uint32(0)}
+	rs.RState = &pb.State{make([]byte, 0), int32(0), uint32(0), uint32(0), nil}
+	rs.KStates = make(pb.KeyStates)
 	rs.Next = make([]*pb.Blueprint, 0, 5)
-	rs.NextMap = make(map[uint32]*pb.Blueprint, 5)
-	rs.Rnd = make(map[uint32]uint32, 5)
-	rs.Val = make(map[uint32]*pb.CV, 5)
+	rs.NextMap = make(map[pb.ConfID]*pb.Blueprint, 5)
+	rs.Rnd = make(map[pb.ConfID]uint32, 5)
+	rs.Val = make(map[pb.ConfID]*pb.CV, 5)
+	rs.Cas = make(pb.KeySlots)
+	rs.CasFrozen = make(map[pb.ConfID]bool)
+	rs.CasReady = make(map[pb.ConfID]bool)
 	rs.noabort = noabort
+	rs.store = storage.NewMemStore()
+	rs.started = time.Now()
 	return rs
 }
 
-func NewRegServerWithCur(cur *pb.Blueprint, curc uint32, noabort bool) *RegServer {
+func NewRegServerWithCur(cur *pb.Blueprint, curc pb.ConfID, noabort bool) *RegServer {
 	rs := NewRegServer(noabort)
 	rs.Cur = cur
 	rs.CurC = curc
@@ -57,34 +77,67 @@ func NewRegServerWithCur(cur *pb.Blueprint, curc uint32, noabort bool) *RegServe
 	return rs
 }
 
-func (rs *RegServer) handleConf(conf *pb.Conf, n *pb.Blueprint) (cr *pb.ConfReply) {
-	if conf == nil || (conf.This < rs.CurC && !rs.noabort) {
-		//The client is using an outdated configuration, abort.
-		return &pb.ConfReply{Cur: rs.Cur, Abort: false}
+// NewRegServerWithStore returns a server that persists its state in st,
+// and recovers the state already held by st.
+func NewRegServerWithStore(st storage.Store, noabort bool) (*RegServer, error) {
+	rs := NewRegServer(noabort)
+	if st == nil {
+		return rs, nil
+	}
+	rs.store = st
+	if err := rs.restore(); err != nil {
+		return nil, err
 	}
+	if rs.Cur != nil {
+		rs.leased.restarted()
+	}
+	return rs, nil
+}
 
-	if n != nil {
-		found := false
-		for _, nxt := range rs.Next {
-			if n.LearnedEquals(nxt) {
-				found = true
-				break
-			}
-		}
-		if !found {
-			rs.Next = append(rs.Next, n)
+// older reports whether the configuration c is older than cur, or one that
+// conflicts with it: a different configuration with the same order can not
+// follow cur anymore.
+func older(c, cur pb.ConfID) bool {
+	return cur.Newer(c) || (!c.Newer(cur) && c != cur)
+}
+
+// outdated reports whether the client is using an outdated configuration.
+func (rs *RegServer) outdated(conf *pb.Conf) bool {
+	return conf == nil || (older(conf.This, rs.CurC) && !rs.noabort)
+}
+
+// addNext adds n to the next configurations, unless it is known already.
+func (rs *RegServer) addNext(u *update, n *pb.Blueprint) {
+	for _, nxt := range rs.Next {
+		if n.LearnedEquals(nxt) {
+			return
 		}
 	}
+	next := append(rs.Next[:len(rs.Next):len(rs.Next)], n)
+	putBlueprints(u.Batch, keyNext, next)
+	u.do(func() { rs.Next = next })
+}
+
+func (rs *RegServer) setLAState(u *update, la *pb.Blueprint) {
+	putBlueprint(u.Batch, keyLAState, la)
+	u.do(func() { rs.LAState = la })
+}
+
+func (rs *RegServer) handleConf(conf *pb.Conf) (cr *pb.ConfReply) {
+	if rs.outdated(conf) {
+		//The client is using an outdated configuration, abort.
+		return &pb.ConfReply{Cur: rs.Cur, Abort: false}
+	}
 
 	next := make([]*pb.Blueprint, 0, len(rs.Next))
-	this := int(conf.This)
+	this := conf.This
 	for _, nxt := range rs.Next {
-		if nxt.Len() > this {
+		if nxt.ID().Newer(this) {
 			next = append(next, nxt)
 		}
 	}
 
-	if conf.Cur < rs.CurC {
+	if older(conf.Cur, rs.CurC) {
 		// Inform the client of the new current configuration
 		return &pb.ConfReply{Cur: rs.Cur, Abort: false, Next: next}
 	}
@@ -98,64 +151,140 @@ func (rs *RegServer) handleConf(conf *pb.Conf, n *pb.Blueprint) (cr *pb.ConfRepl
 func (rs *RegServer) AReadS(ctx context.Context, rr *pb.Conf) (*pb.ReadReply, error) {
 	rs.RLock()
 	defer rs.RUnlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.ReadReply{Cur: &pb.ConfReply{Cur: rs.Cur}}, nil
+	}
 	glog.V(5).Infoln("Handling ReadS")
 
-	cr := rs.handleConf(rr, nil)
+	cr := rs.handleConf(rr)
 	if cr != nil && cr.Abort {
 		return &pb.ReadReply{Cur: cr}, nil
 	}
 
-	return &pb.ReadReply{State: rs.RState, Cur: cr}, nil
+	var key string
+	if rr != nil {
+		key = rr.Key
+	}
+	st := stateOf(rs.RState, rs.KStates, key)
+	if rr != nil && rr.Digest {
+		st = st.Digested()
+	} else {
+		st = st.Ref()
+	}
+	rep := &pb.ReadReply{State: st, Cur: cr}
+	if rr != nil && rr.AllKeys {
+		rep.KStates = pb.Refs(otherStates(rs.RState, rs.KStates, key))
+	}
+	return rep, nil
 }
 
-func (rs *RegServer) AWriteS(ctx context.Context, wr *pb.WriteS) (*pb.ConfReply, error) {
+func (rs *RegServer) AWriteS(ctx context.Context, wr *pb.WriteS) (rep *pb.ConfReply, err error) {
+	var until time.Time
+	defer afterUnlock(ctx, &until, &err)
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.ConfReply{Cur: rs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling WriteS")
-	if rs.RState.Compare(wr.GetState()) == 1 {
-		rs.RState = wr.GetState()
+	st, _, err := rs.staged.resolve(rs.RState, rs.KStates, wr.Key, wr.GetState(), nil)
+	if err != nil {
+		return nil, err
+	}
+	u := newUpdate()
+	setState(u, &rs.RState, rs.KStates, wr.Key, st)
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
 	}
+	until = rs.leaseConflicts(wr.Key, nil)
 
-	if crepl := rs.handleConf(wr.GetConf(), nil); crepl != nil {
+	if crepl := rs.handleConf(wr.GetConf()); crepl != nil {
 		return crepl, nil
 	}
 	return &pb.ConfReply{}, nil
 }
 
-func (rs *RegServer) AWriteN(ctx context.Context, wr *pb.WriteN) (*pb.WriteNReply, error) {
+func (rs *RegServer) AWriteN(ctx context.Context, wr *pb.WriteN) (rep *pb.WriteNReply, err error) {
+	var until time.Time
+	defer afterUnlock(ctx, &until, &err)
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.WriteNReply{Cur: &pb.ConfReply{Cur: rs.Cur}}, nil
+	}
 	glog.V(5).Infoln("Handling WriteN")
 
-	cr := rs.handleConf(&pb.Conf{wr.CurC, wr.CurC}, wr.Next)
+	conf := &pb.Conf{This: wr.CurC, Cur: wr.CurC}
+	u := newUpdate()
+	if wr.Next != nil && !rs.outdated(conf) {
+		rs.addNext(u, wr.Next)
+	}
+	// This is nor necessary for sm, but only for running Consensus using norecontact.
+	putBlueprint(u.Batch, confKey(prefixNextMap, wr.CurC), wr.Next)
+	u.do(func() { rs.NextMap[wr.CurC] = wr.Next })
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
+	}
+
+	cr := rs.handleConf(conf)
 	if cr != nil && cr.Abort {
 		return &pb.WriteNReply{Cur: cr}, nil
 	}
+	if cr != nil && len(cr.Next) > 0 {
+		// No more leases are granted, wait for the old ones before
+		// the state is moved.
+		until = rs.leased.all()
+	}
 
-	rs.NextMap[wr.CurC] = wr.Next // This is nor necessary for sm, but only for running Consensus using norecontact.
-
-	return &pb.WriteNReply{Cur: cr, State: rs.RState, LAState: rs.LAState}, nil
+	return &pb.WriteNReply{
+		Cur:     cr,
+		State:   stateOf(rs.RState, rs.KStates, wr.Key).Ref(),
+		LAState: rs.LAState,
+		KStates: pb.Refs(otherStates(rs.RState, rs.KStates, wr.Key)),
+	}, nil
 }
 
 func (rs *RegServer) LAProp(ctx context.Context, lap *pb.LAProposal) (lar *pb.LAReply, err error) {
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.LAReply{Cur: &pb.ConfReply{Cur: rs.Cur}}, nil
+	}
 	glog.V(5).Infoln("Handling LAProp")
 
-	cr := rs.handleConf(lap.GetConf(), nil)
+	cr := rs.handleConf(lap.GetConf())
 	if cr != nil && cr.Abort {
 		return &pb.LAReply{Cur: cr}, nil
 	}
 
+	u := newUpdate()
 	if rs.LAState.Compare(lap.Prop) == 1 {
 		glog.V(6).Infoln("LAState Accepted")
 		//Accept
-		rs.LAState = lap.Prop
+		rs.setLAState(u, lap.Prop)
+		if err = u.commit(rs.store); err != nil {
+			return nil, err
+		}
 		return &pb.LAReply{Cur: cr}, nil
 	}
 
 	//Not Accepted, try again.
-	rs.LAState = rs.LAState.Merge(lap.Prop)
+	rs.setLAState(u, rs.LAState.Merge(lap.Prop))
+	if err = u.commit(rs.store); err != nil {
+		return nil, err
+	}
 	if cr != nil {
 		// In this case, we don't need to send the next values, since the client first has to solve LA in this configuration.
 		cr.Next = nil
@@ -163,27 +292,45 @@ func (rs *RegServer) LAProp(ctx context.Context, lap *pb.LAProposal) (lar *pb.LA
 	return &pb.LAReply{Cur: cr, LAState: rs.LAState}, nil
 }
 
-func (rs *RegServer) SetState(ctx context.Context, ns *pb.NewState) (*pb.NewStateReply, error) {
+func (rs *RegServer) SetState(ctx context.Context, ns *pb.NewState) (rep *pb.NewStateReply, err error) {
+	var until time.Time
+	defer afterUnlock(ctx, &until, &err)
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.NewStateReply{Cur: rs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling SetState")
 	if ns == nil {
 		return nil, errors.New("Empty NewState message")
 	}
+	st, kss, err := rs.staged.resolve(rs.RState, rs.KStates, ns.Key, ns.State, ns.KStates)
+	if err != nil {
+		return nil, err
+	}
 
-	rs.LAState = rs.LAState.Merge(ns.LAState)
-	if rs.RState.Compare(ns.State) == 1 {
-		rs.RState = ns.State
+	u := newUpdate()
+	if ns.LAState != nil {
+		rs.setLAState(u, rs.LAState.Merge(ns.LAState))
+	}
+	setState(u, &rs.RState, rs.KStates, ns.Key, st)
+	setStates(u, &rs.RState, rs.KStates, kss)
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
 	}
+	until = rs.leaseConflicts(ns.Key, kss)
 
-	if rs.CurC > ns.CurC {
+	if older(ns.CurC, rs.CurC) {
 		return &pb.NewStateReply{Cur: rs.Cur}, nil
 	}
 
 	next := make([]*pb.Blueprint, 0, len(rs.Next))
-	this := int(ns.CurC)
+	this := ns.CurC
 	for _, nxt := range rs.Next {
-		if nxt.Len() > this {
+		if nxt.ID().Newer(this) {
 			next = append(next, nxt)
 		}
 	}
@@ -194,9 +341,15 @@ func (rs *RegServer) SetState(ctx context.Context, ns *pb.NewState) (*pb.NewStat
 func (rs *RegServer) GetPromise(ctx context.Context, pre *pb.Prepare) (*pb.Promise, error) {
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.Promise{Cur: rs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling Prepare")
 
-	if pre.CurC < rs.CurC {
+	if older(pre.CurC, rs.CurC) {
 		return &pb.Promise{Cur: rs.Cur}, nil
 	}
 
@@ -207,6 +360,11 @@ func (rs *RegServer) GetPromise(ctx context.Context, pre *pb.Prepare) (*pb.Promi
 
 	if rnd, ok := rs.Rnd[pre.CurC]; !ok || pre.Rnd > rnd {
 		// A Prepare in a new and higher round.
+		b := new(storage.Batch)
+		putUint32(b, confKey(prefixRnd, pre.CurC), pre.Rnd)
+		if err := persist(rs.store, b); err != nil {
+			return nil, err
+		}
 		rs.Rnd[pre.CurC] = pre.Rnd
 		return &pb.Promise{Val: rs.Val[pre.CurC]}, nil
 	}
@@ -217,9 +375,15 @@ func (rs *RegServer) GetPromise(ctx context.Context, pre *pb.Prepare) (*pb.Promi
 func (rs *RegServer) Accept(ctx context.Context, pro *pb.Propose) (lrn *pb.Learn, err error) {
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
+	if rs.dc.removed {
+		return &pb.Learn{Cur: rs.Cur}, nil
+	}
 	glog.V(5).Infoln("Handling Accept")
 
-	if pro.CurC < rs.CurC {
+	if older(pro.CurC, rs.CurC) {
 		return &pb.Learn{Cur: rs.Cur}, nil
 	}
 
@@ -233,6 +397,12 @@ func (rs *RegServer) Accept(ctx context.Context, pro *pb.Propose) (lrn *pb.Learn
 		return &pb.Learn{Learned: false}, nil
 	}
 
+	b := new(storage.Batch)
+	putUint32(b, confKey(prefixRnd, pro.CurC), pro.Val.Rnd)
+	putCV(b, confKey(prefixVal, pro.CurC), pro.Val)
+	if err = persist(rs.store, b); err != nil {
+		return nil, err
+	}
 	rs.Rnd[pro.CurC] = pro.Val.Rnd
 	rs.Val[pro.CurC] = pro.Val
 	return &pb.Learn{Learned: true}, nil
@@ -243,6 +413,9 @@ func (rs *RegServer) SetCur(ctx context.Context, nc *pb.NewCur) (*pb.NewCurReply
 	glog.V(5).Infoln("Handling Set Cur")
 	rs.Lock()
 	defer rs.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
 	//defer rs.PrintState("SetCur")
 
 	if nc.CurC == rs.CurC {
@@ -254,16 +427,23 @@ func (rs *RegServer) SetCur(ctx context.Context, nc *pb.NewCur) (*pb.NewCurReply
 	}
 
 	glog.V(3).Infoln("New Current Conf: ", nc.GetCur())
-	rs.Cur = nc.Cur
-	rs.CurC = nc.CurC
-
-	newNext := make([]*pb.Blueprint, 0, len(rs.Next))
-	for _, blp := range rs.Next {
-		if uint32(blp.Len()) > rs.CurC {
-			newNext = append(newNext, blp)
-		}
+	newNext := newerNext(rs.Next, nc.CurC)
+
+	u := newUpdate()
+	putBlueprint(u.Batch, keyCur, nc.Cur)
+	putConfID(u.Batch, keyCurC, nc.CurC)
+	putBlueprints(u.Batch, keyNext, newNext)
+	u.do(func() {
+		rs.Cur = nc.Cur
+		rs.CurC = nc.CurC
+		rs.Next = newNext
+	})
+	rs.gc(u, nc.CurC)
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
 	}
-	rs.Next = newNext
+	rs.checkRemoved()
+	rs.watching.notify()
 
 	return &pb.NewCurReply{true}, nil
 }
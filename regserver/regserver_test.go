@@ -17,24 +17,27 @@ var one = uint32(1)
 var two = uint32(2)
 var tre = uint32(3)
 
-var n11 = &pb.Node{one, one}
-var n12 = &pb.Node{one, two}
-var n22 = &pb.Node{two, two}
-var n32 = &pb.Node{tre, two}
-var n33 = &pb.Node{tre, tre}
-
-var b1 = &pb.Blueprint{[]*pb.Node{n11}, one, one}
-var b2 = &pb.Blueprint{[]*pb.Node{n22}, two, one}
-var b12 = &pb.Blueprint{[]*pb.Node{n11, n22}, two, one}
-var b22 = &pb.Blueprint{[]*pb.Node{n11, n22}, two, two}
-var b23 = &pb.Blueprint{[]*pb.Node{n11, n22}, tre, two}
-
-var b12x = &pb.Blueprint{[]*pb.Node{n12, n22}, two, one}
-var b123 = &pb.Blueprint{[]*pb.Node{n12, n22, n32}, two, one}
-var bx = &pb.Blueprint{[]*pb.Node{n11, n33}, tre, two}
-var by = &pb.Blueprint{[]*pb.Node{n12, n32}, two, one}
+var n11 = &pb.Node{Id: one, Version: one}
+var n12 = &pb.Node{Id: one, Version: two}
+var n22 = &pb.Node{Id: two, Version: two}
+var n32 = &pb.Node{Id: tre, Version: two}
+var n33 = &pb.Node{Id: tre, Version: tre}
+
+var b1 = &pb.Blueprint{Nodes: []*pb.Node{n11}, FaultTolerance: one, Epoch: one}
+var b2 = &pb.Blueprint{Nodes: []*pb.Node{n22}, FaultTolerance: two, Epoch: one}
+var b12 = &pb.Blueprint{Nodes: []*pb.Node{n11, n22}, FaultTolerance: two, Epoch: one}
+var b22 = &pb.Blueprint{Nodes: []*pb.Node{n11, n22}, FaultTolerance: two, Epoch: two}
+var b23 = &pb.Blueprint{Nodes: []*pb.Node{n11, n22}, FaultTolerance: tre, Epoch: two}
+
+var b12x = &pb.Blueprint{Nodes: []*pb.Node{n12, n22}, FaultTolerance: two, Epoch: one}
+var b123 = &pb.Blueprint{Nodes: []*pb.Node{n12, n22, n32}, FaultTolerance: two, Epoch: one}
+var bx = &pb.Blueprint{Nodes: []*pb.Node{n11, n33}, FaultTolerance: tre, Epoch: two}
+var by = &pb.Blueprint{Nodes: []*pb.Node{n12, n32}, FaultTolerance: two, Epoch: one}
 var b0 *pb.Blueprint
 
+// c1 is the id of a configuration older than all the blueprints above.
+var c1 = pb.ConfID{Order: 1}
+
 func Put(x int, bytes []byte) []byte {
 	binary.PutUvarint(bytes, uint64(x))
 	return bytes
@@ -46,16 +49,15 @@ func Get(bytes []byte) int {
 }
 
 func TestSetState(t *testing.T) {
-	rs := NewRegServer(false)
+	rs := NewRegServerWithCur(b2, b2.ID(), false)
 	rs.Next = []*pb.Blueprint{b12, b12x}
 	//Perfectly normal SetState
 	stest, err := rs.SetState(ctx, &pb.NewState{
-		Cur:     b2,
-		CurC:    uint32(b2.Len()),
+		CurC:    b2.ID(),
 		State:   &pb.State{Value: nil, Timestamp: 2, Writer: 0},
 		LAState: b1,
 	})
-	if err != nil || rs.Cur != b2 || rs.CurC != uint32(b2.Len()) || rs.RState.Compare(&pb.State{nil, 2, 0}) != 0 || !rs.LAState.Equals(b1) {
+	if err != nil || rs.Cur != b2 || rs.CurC != b2.ID() || rs.RState.Compare(&pb.State{nil, 2, 0, 0, nil}) != 0 || !rs.LAState.Equals(b1) {
 		t.Error("first write did not work")
 	}
 	if len(stest.Next) != 2 {
@@ -64,12 +66,11 @@ func TestSetState(t *testing.T) {
 
 	// Set state in Cur.
 	stest, _ = rs.SetState(ctx, &pb.NewState{
-		Cur:     b2,
-		CurC:    uint32(b2.Len()),
+		CurC:    b2.ID(),
 		State:   &pb.State{Value: nil, Timestamp: 2, Writer: 1},
 		LAState: b2,
 	})
-	if rs.Cur != b2 || rs.CurC != uint32(b2.Len()) || rs.RState.Compare(&pb.State{nil, 2, 1}) != 0 || !rs.LAState.Equals(b12) {
+	if rs.Cur != b2 || rs.CurC != b2.ID() || rs.RState.Compare(&pb.State{nil, 2, 1, 0, nil}) != 0 || !rs.LAState.Equals(b12) {
 		t.Error("did not set state correctly")
 	}
 	if len(stest.Next) != 2 {
@@ -79,13 +80,15 @@ func TestSetState(t *testing.T) {
 		t.Error("did return wrong cur")
 	}
 
-	// Clean next on set state
+	// Clean next when moving to a new cur
+	if _, err := rs.SetCur(ctx, &pb.NewCur{Cur: b12, CurC: b12.ID()}); err != nil {
+		t.Fatal(err)
+	}
 	stest, _ = rs.SetState(ctx, &pb.NewState{
-		Cur:     b12,
-		CurC:    uint32(b12.Len()),
+		CurC:    b12.ID(),
 		LAState: b12x,
 	})
-	if rs.Cur != b12 || rs.CurC != uint32(b12.Len()) || rs.RState.Compare(&pb.State{nil, 2, 1}) != 0 || !rs.LAState.Equals(b12x) {
+	if rs.Cur != b12 || rs.CurC != b12.ID() || rs.RState.Compare(&pb.State{nil, 2, 1, 0, nil}) != 0 || !rs.LAState.Equals(b12x) {
 		t.Error("did not set state correctly")
 	}
 	if len(rs.Next) != 1 {
@@ -100,12 +103,11 @@ func TestSetState(t *testing.T) {
 
 	// Set state in old cur
 	stest, _ = rs.SetState(ctx, &pb.NewState{
-		Cur:     b2,
-		CurC:    uint32(b2.Len()),
-		State:   &pb.State{nil, 3, 0},
+		CurC:    b2.ID(),
+		State:   &pb.State{nil, 3, 0, 0, nil},
 		LAState: b123,
 	})
-	if rs.Cur != b12 || rs.CurC != uint32(b12.Len()) || rs.RState.Compare(&pb.State{nil, 3, 0}) != 0 || !rs.LAState.Equals(b123) {
+	if rs.Cur != b12 || rs.CurC != b12.ID() || rs.RState.Compare(&pb.State{nil, 3, 0, 0, nil}) != 0 || !rs.LAState.Equals(b123) {
 		t.Error("did not set state correctly")
 	}
 	if len(rs.Next) != 1 {
@@ -133,39 +135,39 @@ func TestLAProp(t *testing.T) {
 	if stest.LAState != nil {
 		t.Error("did return LAState")
 	}
-	if len(stest.Next) != 1 {
+	if len(nextOf(stest.Cur)) != 1 {
 		t.Error("wrong next")
 	}
 
 	rs.Cur = b2
-	rs.CurC = uint32(b2.Len())
+	rs.CurC = b2.ID()
 
-	//Can abort
-	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: b12x, Conf: &pb.Conf{one, one}})
-	if rs.LAState != b12 {
-		t.Error("did write on abort")
+	//Old configuration, returns cur but still writes.
+	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: b12x, Conf: &pb.Conf{This: c1, Cur: c1}})
+	if rs.LAState != b12x {
+		t.Error("did not write in old configuration")
 	}
-	if !stest.Cur.Abort || stest.Cur.Cur != b2 {
-		t.Error("laprop did return correct abort")
+	if stest.Cur == nil || stest.Cur.Cur != b2 {
+		t.Error("laprop did not return cur")
 	}
 
-	//Does not abort, but return cur, does not write old value.
-	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: b2, Conf: &pb.Conf{Cur: one, This: uint32(b2.Len())}})
+	//Return cur, does not write old value.
+	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: b2, Conf: &pb.Conf{Cur: c1, This: b2.ID()}})
 	if stest.Cur.Abort || stest.Cur.Cur != b2 {
 		t.Error("laprop did not return correct cur.")
 	}
-	if !stest.LAState.Equals(b12) {
+	if !stest.LAState.Equals(b12x) {
 		//fmt.Println(stest.LAState)
 		t.Error("did not return LAState")
 	}
-	if !rs.LAState.Equals(b12) {
+	if !rs.LAState.Equals(b12x) {
 		t.Error("wrong state")
 	}
 
 	// If noabort is true, does not abort, but sends cur, state and next.
 	rs.Next = []*pb.Blueprint{b12, b12x}
 	rs.noabort = true
-	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: by, Conf: &pb.Conf{one, one}})
+	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: by, Conf: &pb.Conf{This: c1, Cur: c1}})
 	if stest.Cur.Abort || stest.Cur.Cur != b2 {
 		t.Error("laprop did not return correct cur.")
 	}
@@ -177,8 +179,8 @@ func TestLAProp(t *testing.T) {
 	}
 
 	// Only send next that is large.
-	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: bx, Conf: &pb.Conf{uint32(b12.Len()), uint32(b12.Len())}})
-	if stest.Cur != nil {
+	stest, _ = rs.LAProp(ctx, &pb.LAProposal{Prop: bx, Conf: &pb.Conf{This: b12.ID(), Cur: b12.ID()}})
+	if stest.Cur != nil && stest.Cur.Cur != nil {
 		t.Error("laprop did not return correct cur.")
 	}
 	if !rs.LAState.Equals(bx.Merge(b123)) {
@@ -206,22 +208,22 @@ func TestAWriteN(t *testing.T) {
 	}
 
 	rs.Cur = b2
-	rs.CurC = uint32(b2.Len())
+	rs.CurC = b2.ID()
 	rs.LAState = b12x
 	rs.RState = s
 
 	//Can abort
-	stest, _ = rs.AWriteN(ctx, &pb.WriteN{Next: b12x, CurC: one})
+	stest, _ = rs.AWriteN(ctx, &pb.WriteN{Next: b12x, CurC: c1})
 	if len(rs.Next) != 1 {
 		t.Error("did write next on abort")
 	}
-	if !stest.Cur.Abort || stest.Cur.Cur != b2 {
+	if stest.Cur == nil || stest.Cur.Cur != b2 {
 		t.Error("writeN did return correct abort")
 	}
 
 	//Does not abort, does not write duplicate next.
-	stest, _ = rs.AWriteN(ctx, &pb.WriteN{Next: b12, CurC: uint32(b2.Len())})
-	if stest.Cur != nil {
+	stest, _ = rs.AWriteN(ctx, &pb.WriteN{Next: b12, CurC: b2.ID()})
+	if stest.Cur != nil && stest.Cur.Cur != nil {
 		t.Error("writeN did not return correct cur.")
 	}
 	if stest.State != s {
@@ -233,20 +235,20 @@ func TestAWriteN(t *testing.T) {
 	if stest.LAState != b12x {
 		t.Error("did not return LAState")
 	}
-	if len(stest.Next) != 1 {
+	if len(nextOf(stest.Cur)) != 1 {
 		t.Error("writeN did not return correct next")
 	}
 
 	// If noabort is true, does not abort, but sends cur, state and next.
 	rs.noabort = true
-	stest, _ = rs.AWriteN(ctx, &pb.WriteN{Next: b12x, CurC: one})
+	stest, _ = rs.AWriteN(ctx, &pb.WriteN{Next: b12x, CurC: c1})
 	if stest.Cur.Abort || stest.Cur.Cur != b2 {
 		t.Error("writeN did not return correct cur.")
 	}
 	if stest.State != s {
 		t.Error("writeN returned wrong state")
 	}
-	if len(stest.Next) != 2 {
+	if len(nextOf(stest.Cur)) != 2 {
 		t.Error("writeN did not return correct Next")
 	}
 	if len(rs.Next) != 2 {
@@ -257,11 +259,11 @@ func TestAWriteN(t *testing.T) {
 	}
 
 	// Only send next that is large.
-	stest, _ = rs.AWriteN(ctx, &pb.WriteN{CurC: uint32(b12.Len())})
-	if stest.Cur != nil {
+	stest, _ = rs.AWriteN(ctx, &pb.WriteN{CurC: b12.ID()})
+	if stest.Cur == nil || stest.Cur.Cur != nil {
 		t.Error("writeN did not return correct cur.")
 	}
-	if len(stest.Next) != 1 {
+	if len(nextOf(stest.Cur)) != 1 {
 		t.Error("writeN did not return correct Next")
 	}
 }
@@ -283,21 +285,21 @@ func TestWriteAWriteS(t *testing.T) {
 
 	s0 := &pb.State{Value: nil, Timestamp: 1, Writer: 0}
 	rs.Cur = b2
-	rs.CurC = uint32(b2.Len())
+	rs.CurC = b2.ID()
 
 	//Can abort
-	stest, _ = rs.AWriteS(ctx, &pb.WriteS{State: s0, Conf: &pb.Conf{one, one}})
+	stest, _ = rs.AWriteS(ctx, &pb.WriteS{State: s0, Conf: &pb.Conf{This: c1, Cur: c1}})
 	if rs.RState == s0 {
 		t.Error("did write value with smaller timestamp")
 	}
-	if !stest.Cur.Abort || stest.Cur.Cur != b2 {
+	if stest.Cur != b2 {
 		t.Error("writeS did return correct abort")
 	}
 
 	//Does not abort, but sends cur, and new state.
 	s2 := &pb.State{Value: nil, Timestamp: 2, Writer: 1}
-	stest, _ = rs.AWriteS(ctx, &pb.WriteS{State: s2, Conf: &pb.Conf{Cur: one, This: uint32(b2.Len())}})
-	if stest.Cur.Abort || stest.Cur.Cur != b2 {
+	stest, _ = rs.AWriteS(ctx, &pb.WriteS{State: s2, Conf: &pb.Conf{Cur: c1, This: b2.ID()}})
+	if stest.Abort || stest.Cur != b2 {
 		t.Error("writeS did not return correct cur.")
 	}
 	if rs.RState != s2 {
@@ -308,23 +310,23 @@ func TestWriteAWriteS(t *testing.T) {
 	s3 := &pb.State{Value: nil, Timestamp: 3, Writer: 0}
 	rs.noabort = true
 	rs.Next = []*pb.Blueprint{b12, b12x}
-	stest, _ = rs.AWriteS(ctx, &pb.WriteS{State: s3, Conf: &pb.Conf{Cur: one, This: one}})
-	if stest.Cur.Abort || stest.Cur.Cur != b2 {
+	stest, _ = rs.AWriteS(ctx, &pb.WriteS{State: s3, Conf: &pb.Conf{Cur: c1, This: c1}})
+	if stest.Abort || stest.Cur != b2 {
 		t.Error("writeS did not return correct cur.")
 	}
 	if rs.RState != s3 {
 		t.Error("writeS returned wrong state")
 	}
-	if len(stest.Next) != 2 {
+	if len(nextOf(stest)) != 2 {
 		t.Error("writeS did not return correct Next")
 	}
 
 	// Only send next that is large.
-	stest, _ = rs.AWriteS(ctx, &pb.WriteS{Conf: &pb.Conf{uint32(b12.Len()), uint32(b12.Len())}})
+	stest, _ = rs.AWriteS(ctx, &pb.WriteS{Conf: &pb.Conf{This: b12.ID(), Cur: b12.ID()}})
 	if stest.Cur != nil {
 		t.Error("writeS did not return correct cur.")
 	}
-	if len(stest.Next) != 1 {
+	if len(nextOf(stest)) != 1 {
 		t.Error("writeS did not return correct Next")
 	}
 }
@@ -333,7 +335,7 @@ func TestWriteAReadS(t *testing.T) {
 	rs := NewRegServer(false)
 	var bytes = make([]byte, 64)
 	bytes = Put(5, bytes)
-	s := &pb.State{bytes, 2, 0}
+	s := &pb.State{bytes, 2, 0, 0, nil}
 
 	// Test it returns no error
 	stest, err := rs.AReadS(ctx, &pb.Conf{})
@@ -345,16 +347,16 @@ func TestWriteAReadS(t *testing.T) {
 
 	rs.RState = s
 	rs.Cur = b2
-	rs.CurC = uint32(b2.Len())
+	rs.CurC = b2.ID()
 
 	//Can abort
-	stest, _ = rs.AReadS(ctx, &pb.Conf{one, one})
-	if !stest.Cur.Abort || stest.Cur.Cur != b2 {
+	stest, _ = rs.AReadS(ctx, &pb.Conf{This: c1, Cur: c1})
+	if stest.Cur == nil || stest.Cur.Cur != b2 {
 		t.Error("read S did return correct abort")
 	}
 
 	//Does not abort, but sends cur, and new state.
-	stest, _ = rs.AReadS(ctx, &pb.Conf{Cur: one, This: uint32(b2.Len())})
+	stest, _ = rs.AReadS(ctx, &pb.Conf{Cur: c1, This: b2.ID()})
 	if stest.Cur.Abort || stest.Cur.Cur != b2 {
 		t.Error("read S did not return correct cur.")
 	}
@@ -365,27 +367,35 @@ func TestWriteAReadS(t *testing.T) {
 	// If noabort is true, does not abort, but sends cur, state and next.
 	rs.noabort = true
 	rs.Next = []*pb.Blueprint{b12, b12x}
-	stest, _ = rs.AReadS(ctx, &pb.Conf{one, one})
+	stest, _ = rs.AReadS(ctx, &pb.Conf{This: c1, Cur: c1})
 	if stest.Cur.Abort || stest.Cur.Cur != b2 {
 		t.Error("read S did not return correct cur.")
 	}
 	if stest.State.Compare(s) != 0 {
 		t.Error("readS returned wrong state")
 	}
-	if len(stest.Next) != 2 {
+	if len(nextOf(stest.Cur)) != 2 {
 		t.Error("readS did not return correct Next")
 	}
 
 	// Only send next that is large.
-	stest, _ = rs.AReadS(ctx, &pb.Conf{uint32(b12.Len()), uint32(b12.Len())})
-	if stest.Cur != nil {
+	stest, _ = rs.AReadS(ctx, &pb.Conf{This: b12.ID(), Cur: b12.ID()})
+	if stest.Cur == nil || stest.Cur.Cur != nil {
 		t.Error("read S did not return correct cur.")
 	}
 	if stest.State.Compare(s) != 0 {
 		t.Error("readS returned wrong state")
 	}
-	if len(stest.Next) != 1 {
+	if len(nextOf(stest.Cur)) != 1 {
 		t.Error("readS did not return correct Next")
 	}
 
 }
+
+// nextOf returns the next configurations in cr, if any.
+func nextOf(cr *pb.ConfReply) []*pb.Blueprint {
+	if cr == nil {
+		return nil
+	}
+	return cr.Next
+}
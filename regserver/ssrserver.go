@@ -3,56 +3,100 @@ package regserver
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
 	"golang.org/x/net/context"
 )
 
 type SSRServer struct {
 	Cur       *pb.Blueprint
-	CurC      uint32 // This should be the length of cur, not its Gid.
+	CurC      pb.ConfID // This should be the ID of cur, not its Gid.
 	RState    *pb.State
-	Proposed  map[uint32]map[uint32][]*pb.Blueprint //Conf, Rnd -> Proposals
-	Committed map[uint32]map[uint32]*pb.Blueprint   //Conf, Rnd -> Committed value
-	Collected map[uint32]map[uint32]*pb.Blueprint
+	KStates   pb.KeyStates                             // States of registers with a non-empty key.
+	Proposed  map[pb.ConfID]map[uint32][]*pb.Blueprint //Conf, Rnd -> Proposals
+	Committed map[pb.ConfID]map[uint32]*pb.Blueprint   //Conf, Rnd -> Committed value
+	Collected map[pb.ConfID]map[uint32]*pb.Blueprint
 	mu        sync.Mutex
+	store     storage.Store
+	started   time.Time
+	dc        decommission
+	staged    staging
+	watching  watchers
+
+	recovering bool
 }
 
 func NewSSRServer() *SSRServer {
 	return &SSRServer{
-		RState:    &pb.State{make([]byte, 0), int32(0), uint32(0)},
-		Proposed:  make(map[uint32]map[uint32][]*pb.Blueprint, 5),
-		Committed: make(map[uint32]map[uint32]*pb.Blueprint, 5),
-		Collected: make(map[uint32]map[uint32]*pb.Blueprint, 5),
+		RState:    &pb.State{make([]byte, 0), int32(0), uint32(0), uint32(0), nil},
+		KStates:   make(pb.KeyStates),
+		Proposed:  make(map[pb.ConfID]map[uint32][]*pb.Blueprint, 5),
+		Committed: make(map[pb.ConfID]map[uint32]*pb.Blueprint, 5),
+		Collected: make(map[pb.ConfID]map[uint32]*pb.Blueprint, 5),
 		mu:        sync.Mutex{},
+		store:     storage.NewMemStore(),
+		started:   time.Now(),
 	}
 }
 
-func NewSSRServerWithCur(cur *pb.Blueprint, curc uint32) *SSRServer {
+func NewSSRServerWithCur(cur *pb.Blueprint, curc pb.ConfID) *SSRServer {
 	srs := NewSSRServer()
 	srs.Cur = cur
 	srs.CurC = curc
 	return srs
 }
 
+// NewSSRServerWithStore returns a server that persists its state in st,
+// and recovers the state already held by st.
+func NewSSRServerWithStore(st storage.Store) (*SSRServer, error) {
+	srs := NewSSRServer()
+	if st == nil {
+		return srs, nil
+	}
+	srs.store = st
+	if err := srs.restore(); err != nil {
+		return nil, err
+	}
+	return srs, nil
+}
+
 func (srs *SSRServer) SpSnOne(ctx context.Context, wn *pb.SWriteN) (*pb.SWriteNReply, error) {
 	srs.mu.Lock()
 	defer srs.mu.Unlock()
+	if srs.recovering {
+		return nil, ErrRecovering
+	}
+	if srs.dc.removed {
+		return &pb.SWriteNReply{Cur: srs.Cur}, nil
+	}
 	glog.V(5).Infoln("handling SpSnOne")
 
-	if wn.CurL < srs.CurC {
+	if older(wn.CurL, srs.CurC) {
 		return &pb.SWriteNReply{Cur: srs.Cur}, nil
 	}
 
 	var s *pb.State
+	var kss []*pb.KeyState
 	if wn.Rnd == 0 {
-		s = srs.RState
+		s = stateOf(srs.RState, srs.KStates, wn.Key).Ref()
+		if wn.AllKeys {
+			kss = pb.Refs(otherStates(srs.RState, srs.KStates, wn.Key))
+		}
 	}
 
-	if l := uint32(wn.Cur.Len()); l > srs.CurC {
-		srs.CurC = l
-		srs.Cur = wn.Cur
+	u := newUpdate()
+	if c := wn.Cur.ID(); c.Newer(srs.CurC) {
+		putBlueprint(u.Batch, keyCur, wn.Cur)
+		putConfID(u.Batch, keyCurC, c)
+		srs.gc(u, c)
+		u.do(func() {
+			srs.CurC = c
+			srs.Cur = wn.Cur
+			srs.watching.notify()
+		})
 	}
 
 	proposed := srs.proposed(wn.This, wn.Rnd)
@@ -66,14 +110,23 @@ func (srs *SSRServer) SpSnOne(ctx context.Context, wn *pb.SWriteN) (*pb.SWriteNR
 			}
 		}
 		if !found {
-			srs.Proposed[wn.This][wn.Rnd] = append(proposed, wn.Prop)
+			p := append(proposed[:len(proposed):len(proposed)], wn.Prop)
+			putBlueprints(u.Batch, rndKey(prefixProposed, wn.This, wn.Rnd), p)
+			u.do(func() {
+				srs.proposed(wn.This, wn.Rnd)
+				srs.Proposed[wn.This][wn.Rnd] = p
+			})
 		}
 	}
+	if err := u.commit(srs.store); err != nil {
+		return nil, err
+	}
+	srs.checkRemoved()
 
-	return &pb.SWriteNReply{Next: proposed, State: s}, nil
+	return &pb.SWriteNReply{Next: proposed, State: s, KStates: kss}, nil
 }
 
-func (srs *SSRServer) proposed(this, rnd uint32) []*pb.Blueprint {
+func (srs *SSRServer) proposed(this pb.ConfID, rnd uint32) []*pb.Blueprint {
 	if srs.Proposed[this] == nil {
 		srs.Proposed[this] = make(map[uint32][]*pb.Blueprint, 1)
 	}
@@ -83,9 +136,15 @@ func (srs *SSRServer) proposed(this, rnd uint32) []*pb.Blueprint {
 func (srs *SSRServer) SCommit(ctx context.Context, cm *pb.Commit) (*pb.CommitReply, error) {
 	srs.mu.Lock()
 	defer srs.mu.Unlock()
+	if srs.recovering {
+		return nil, ErrRecovering
+	}
+	if srs.dc.removed {
+		return &pb.CommitReply{Cur: srs.Cur}, nil
+	}
 	glog.V(5).Infoln("handling SCommit")
 
-	if cm.CurL < srs.CurC {
+	if older(cm.CurL, srs.CurC) {
 		return &pb.CommitReply{Cur: srs.Cur}, nil
 	}
 
@@ -94,27 +153,37 @@ func (srs *SSRServer) SCommit(ctx context.Context, cm *pb.Commit) (*pb.CommitRep
 			glog.Fatalln("Tried to commit an empty value.")
 		}
 		if srs.committed(cm.This, cm.Rnd) == nil {
+			b := new(storage.Batch)
+			putBlueprint(b, rndKey(prefixCommitted, cm.This, cm.Rnd), cm.Collect)
+			if err := persist(srs.store, b); err != nil {
+				return nil, err
+			}
 			srs.Committed[cm.This][cm.Rnd] = cm.Collect
-		} else if srs.committed(cm.This, cm.Rnd).Len() != cm.Collect.Len() {
+		} else if !srs.committed(cm.This, cm.Rnd).LearnedEquals(cm.Collect) {
 			// The is a simple sanity check. It could be omitted.
-			glog.Fatalf("Committing two different values in the same round with length %d and %d.", srs.committed(cm.This, cm.Rnd).Len(), cm.Collect.Len())
+			glog.Fatalf("Committing two different values in the same round with length %d and %d.", srs.committed(cm.This, cm.Rnd).Order(), cm.Collect.Order())
 		}
 		return &pb.CommitReply{Collected: srs.collected(cm.This, cm.Rnd)}, nil
 	}
 	x := srs.collected(cm.This, cm.Rnd)
 	x = x.Merge(cm.Collect)
+	b := new(storage.Batch)
+	putBlueprint(b, rndKey(prefixCollected, cm.This, cm.Rnd), x)
+	if err := persist(srs.store, b); err != nil {
+		return nil, err
+	}
 	srs.Collected[cm.This][cm.Rnd] = x
 	return &pb.CommitReply{Collected: x, Committed: srs.committed(cm.This, cm.Rnd)}, nil
 }
 
-func (srs *SSRServer) committed(this, rnd uint32) *pb.Blueprint {
+func (srs *SSRServer) committed(this pb.ConfID, rnd uint32) *pb.Blueprint {
 	if srs.Committed[this] == nil {
 		srs.Committed[this] = make(map[uint32]*pb.Blueprint, 1)
 	}
 	return srs.Committed[this][rnd]
 }
 
-func (srs *SSRServer) collected(this, rnd uint32) *pb.Blueprint {
+func (srs *SSRServer) collected(this pb.ConfID, rnd uint32) *pb.Blueprint {
 	if srs.Collected[this] == nil {
 		srs.Collected[this] = make(map[uint32]*pb.Blueprint, 1)
 	}
@@ -126,7 +195,7 @@ func (srs *SSRServer) collected(this, rnd uint32) *pb.Blueprint {
 // 	defer srs.mu.RUnlock()
 // 	glog.V(5).Infoln("handling SRead")
 //
-// 	if rd.CurL < srs.CurC {
+// 	if older(rd.CurL, srs.CurC) {
 // 		return &pb.SReadReply{Cur: srs.Cur}, nil
 // 	}
 //
@@ -136,15 +205,28 @@ func (srs *SSRServer) collected(this, rnd uint32) *pb.Blueprint {
 func (srs *SSRServer) SSetState(ctx context.Context, ss *pb.SState) (*pb.SStateReply, error) {
 	srs.mu.Lock()
 	defer srs.mu.Unlock()
+	if srs.recovering {
+		return nil, ErrRecovering
+	}
+	if srs.dc.removed {
+		return &pb.SStateReply{Cur: srs.Cur}, nil
+	}
 	glog.V(5).Infoln("handling SSetState")
 
 	var c *pb.Blueprint
-	if ss.CurL < srs.CurC {
+	if older(ss.CurL, srs.CurC) {
 		c = srs.Cur
 	}
+	st, kss, err := srs.staged.resolve(srs.RState, srs.KStates, ss.Key, ss.State, ss.KStates)
+	if err != nil {
+		return nil, err
+	}
 
-	if srs.RState.Compare(ss.State) == 1 {
-		srs.RState = ss.State
+	u := newUpdate()
+	setState(u, &srs.RState, srs.KStates, ss.Key, st)
+	setStates(u, &srs.RState, srs.KStates, kss)
+	if err := u.commit(srs.store); err != nil {
+		return nil, err
 	}
 
 	if len(srs.proposed(ss.CurL, 0)) != 0 {
@@ -158,6 +240,9 @@ func (rs *SSRServer) SSetCur(ctx context.Context, nc *pb.NewCur) (*pb.NewCurRepl
 	glog.V(5).Infoln("Handling Set Cur")
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	if rs.recovering {
+		return nil, ErrRecovering
+	}
 	//defer rs.PrintState("SetCur")
 
 	if nc.CurC == rs.CurC {
@@ -174,8 +259,19 @@ func (rs *SSRServer) SSetCur(ctx context.Context, nc *pb.NewCur) (*pb.NewCurRepl
 	}
 
 	glog.V(3).Infoln("New Current Conf: ", nc.GetCur())
-	rs.Cur = nc.Cur
-	rs.CurC = nc.CurC
+	u := newUpdate()
+	putBlueprint(u.Batch, keyCur, nc.Cur)
+	putConfID(u.Batch, keyCurC, nc.CurC)
+	u.do(func() {
+		rs.Cur = nc.Cur
+		rs.CurC = nc.CurC
+	})
+	rs.gc(u, nc.CurC)
+	if err := u.commit(rs.store); err != nil {
+		return nil, err
+	}
+	rs.checkRemoved()
+	rs.watching.notify()
 
 	return &pb.NewCurReply{true}, nil
 }
@@ -2,18 +2,18 @@ package regserver
 
 import (
 	"errors"
-	"fmt"
 	"log"
-	"net"
 	"sync"
 
 	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/storage"
 	grpc "google.golang.org/grpc"
 )
 
-// For now, I don't imagine needing to start several servers.
-// We therefore do this globally, instead of simply returning the grpcServer.
-var grpcServer *grpc.Server
+// The Start functions and Stop keep one server globally, for the server
+// binaries. To run several servers in one process, use the Serve functions
+// and the returned handles instead.
+var handle *Handle
 var mu sync.Mutex
 var haveServer = false
 
@@ -21,168 +21,146 @@ func Stop() error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	if haveServer == false {
+	if haveServer == false || handle == nil {
 		log.Println("Tried to stop grpc-server, but no server was found.")
 		return errors.New("No grpc server found.")
 	}
 
-	grpcServer.Stop()
+	err := handle.Stop()
+	handle = nil
 	haveServer = false
-	return nil
+	return err
 }
 
-func StartTest(port int) (*grpc.Server, error) {
-	rs := NewRegServer(false)
-
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
-
-	var opts []grpc.ServerOption
-	grpcServ := grpc.NewServer(opts...)
-	pb.RegisterAdvRegisterServer(grpcServ, rs)
-	go grpcServ.Serve(lis)
-	haveServer = true
-
-	return grpcServ, nil
-
-}
-
-////////////////// Advanced Server //////////////////////
-
-func StartAdv(port int, noabort bool) (*RegServer, error) {
-	return StartAdvInConf(port, nil, uint32(0), noabort)
-}
-
-func StartAdvInConf(port int, init *pb.Blueprint, initC uint32, noabort bool) (*RegServer, error) {
+// start runs serve, and keeps the returned handle globally. The lock is not
+// held while serving, since the Recover functions block until recovery is done.
+func start(serve func() (*Handle, error)) error {
 	mu.Lock()
-	defer mu.Unlock()
 	if haveServer == true {
+		mu.Unlock()
 		log.Println("Abort start of grpc server, since old server exists.")
-		return nil, errors.New("There already exists an old server.")
+		return errors.New("There already exists an old server.")
 	}
+	haveServer = true
+	mu.Unlock()
 
-	rs := NewRegServerWithCur(init, initC, noabort)
+	h, err := serve()
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+	mu.Lock()
+	defer mu.Unlock()
+	if h == nil {
+		haveServer = false
 	}
+	handle = h
+	return err
+}
 
-	var opts []grpc.ServerOption
-	grpcServer = grpc.NewServer(opts...)
-	pb.RegisterAdvRegisterServer(grpcServer, rs)
-	go grpcServer.Serve(lis)
-	haveServer = true
-
-	return rs, nil
+// StartTest is StartAdvTest.
+func StartTest(port int) (*grpc.Server, error) {
+	return StartAdvTest(port)
 }
 
-func StartAdvTest(port int) (*grpc.Server, error) {
-	rs := NewRegServer(false)
+////////////////// Advanced Server //////////////////////
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
+// The Start functions call the matching Serve function, see handle.go.
 
-	var opts []grpc.ServerOption
-	grpcServ := grpc.NewServer(opts...)
-	pb.RegisterAdvRegisterServer(grpcServ, rs)
-	go grpcServ.Serve(lis)
-	haveServer = true
+func StartAdv(port int, st storage.Store, noabort bool) (*RegServer, error) {
+	return StartAdvInConf(port, nil, pb.ConfID{}, st, noabort)
+}
 
-	return grpcServ, nil
+func StartAdvInConf(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store, noabort bool) (rs *RegServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		rs, h, err = ServeAdv(port, init, initC, st, noabort)
+		return h, err
+	})
+	return rs, err
+}
 
+// StartAdvTest starts a RegServer that keeps its state in memory, and
+// returns its grpc server. Stop it with Stop.
+func StartAdvTest(port int) (gs *grpc.Server, err error) {
+	err = start(func() (h *Handle, err error) {
+		_, h, err = ServeAdv(port, nil, pb.ConfID{}, nil, false)
+		if h != nil {
+			gs = h.gs
+		}
+		return h, err
+	})
+	return gs, err
 }
 
 ////////////////// Dyna Server //////////////////////
 
-func StartDyna(port int) (*DynaServer, error) {
-	return StartDynaInConf(port, nil, uint32(0))
+func StartDyna(port int, st storage.Store) (*DynaServer, error) {
+	return StartDynaInConf(port, nil, pb.ConfID{}, st)
 }
 
-func StartDynaInConf(port int, init *pb.Blueprint, initC uint32) (*DynaServer, error) {
-	mu.Lock()
-	defer mu.Unlock()
-	if haveServer == true {
-		log.Println("Abort start of grpc server, since old server exists.")
-		return nil, errors.New("There already exists an old server.")
-	}
-
-	ds := NewDynaServerWithCur(init, initC)
-
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
-
-	var opts []grpc.ServerOption
-	grpcServer = grpc.NewServer(opts...)
-	pb.RegisterDynaDiskServer(grpcServer, ds)
-	go grpcServer.Serve(lis)
-	haveServer = true
-
-	return ds, nil
+func StartDynaInConf(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store) (ds *DynaServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		ds, h, err = ServeDyna(port, init, initC, st)
+		return h, err
+	})
+	return ds, err
 }
 
 ////////////////// SSRegister Server //////////////////////
 
-func StartSSR(port int) (*SSRServer, error) {
-	return StartSSRInConf(port, nil, uint32(0))
+func StartSSR(port int, st storage.Store) (*SSRServer, error) {
+	return StartSSRInConf(port, nil, pb.ConfID{}, st)
 }
 
-func StartSSRInConf(port int, init *pb.Blueprint, initC uint32) (*SSRServer, error) {
-	mu.Lock()
-	defer mu.Unlock()
-	if haveServer == true {
-		log.Println("Abort start of grpc server, since old server exists.")
-		return nil, errors.New("There already exists an old server.")
-	}
-
-	ds := NewSSRServerWithCur(init, initC)
-
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
-
-	var opts []grpc.ServerOption
-	grpcServer = grpc.NewServer(opts...)
-	pb.RegisterSpSnRegisterServer(grpcServer, ds)
-	go grpcServer.Serve(lis)
-	haveServer = true
-
-	return ds, nil
+func StartSSRInConf(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store) (srs *SSRServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		srs, h, err = ServeSSR(port, init, initC, st)
+		return h, err
+	})
+	return srs, err
 }
 
 ///////////////// Consensus Server ////////////////////
 
-func StartCons(port int, noabort bool) (*ConsServer, error) {
-	return StartConsInConf(port, nil, uint32(0), noabort)
+func StartCons(port int, st storage.Store, noabort bool) (*ConsServer, error) {
+	return StartConsInConf(port, nil, pb.ConfID{}, st, noabort)
 }
 
-func StartConsInConf(port int, init *pb.Blueprint, initC uint32, noabort bool) (*ConsServer, error) {
-	mu.Lock()
-	defer mu.Unlock()
-	if haveServer == true {
-		log.Println("Abort start of grpc server, since old server exists.")
-		return nil, errors.New("There already exists an old server.")
-	}
+func StartConsInConf(port int, init *pb.Blueprint, initC pb.ConfID, st storage.Store, noabort bool) (cs *ConsServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		cs, h, err = ServeCons(port, init, initC, st, noabort)
+		return h, err
+	})
+	return cs, err
+}
 
-	cs := NewConsServerWithCur(init, initC, noabort)
+///////////////// Recovering Servers ////////////////////
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
+func StartAdvRecover(port int, p *Peers, st storage.Store, noabort bool) (rs *RegServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		rs, h, err = ServeAdvRecover(port, p, st, noabort)
+		return h, err
+	})
+	return rs, err
+}
 
-	var opts []grpc.ServerOption
-	grpcServer = grpc.NewServer(opts...)
-	pb.RegisterAdvRegisterServer(grpcServer, cs)
-	go grpcServer.Serve(lis)
-	haveServer = true
+func StartDynaRecover(port int, p *Peers, st storage.Store) (ds *DynaServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		ds, h, err = ServeDynaRecover(port, p, st)
+		return h, err
+	})
+	return ds, err
+}
+
+func StartSSRRecover(port int, p *Peers, st storage.Store) (srs *SSRServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		srs, h, err = ServeSSRRecover(port, p, st)
+		return h, err
+	})
+	return srs, err
+}
 
-	return cs, nil
+func StartConsRecover(port int, p *Peers, st storage.Store, noabort bool) (cs *ConsServer, err error) {
+	err = start(func() (h *Handle, err error) {
+		cs, h, err = ServeConsRecover(port, p, st, noabort)
+		return h, err
+	})
+	return cs, err
 }
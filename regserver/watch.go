@@ -0,0 +1,91 @@
+package regserver
+
+import (
+	"sync"
+
+	pb "github.com/relab/smartMerge/proto"
+)
+
+// Clients subscribe to new current configurations with the Watch service. A
+// server notifies its subscribers, whenever it installs a newer current
+// configuration, with SetCur, DSetCur or SSetCur, or when recovering. A
+// subscriber that does not keep up only gets the newest configuration.
+
+type watchers struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]bool
+}
+
+// notify wakes up all subscribers. It does not block.
+func (w *watchers) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch sends the current configuration returned by cur to the subscriber,
+// every time it is newer than the last one sent, until the client goes away.
+func (w *watchers) watch(req *pb.WatchRequest, stream pb.Watch_WatchServer, cur func() (*pb.Blueprint, pb.ConfID)) error {
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+	w.mu.Lock()
+	if w.subs == nil {
+		w.subs = make(map[chan struct{}]bool)
+	}
+	w.subs[ch] = true
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.subs, ch)
+		w.mu.Unlock()
+	}()
+
+	last := req.CurC.Value()
+	for {
+		select {
+		case <-ch:
+			blp, c := cur()
+			if blp == nil || !c.Newer(last) {
+				continue
+			}
+			if err := stream.Send(&pb.NewCur{Cur: blp, CurC: c}); err != nil {
+				return err
+			}
+			last = c
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// The Watch methods implement the Watch service. A recovering server has no
+// current configuration yet, and sends the one it recovers.
+
+func (rs *RegServer) Watch(req *pb.WatchRequest, stream pb.Watch_WatchServer) error {
+	return rs.watching.watch(req, stream, func() (*pb.Blueprint, pb.ConfID) {
+		rs.RLock()
+		defer rs.RUnlock()
+		return rs.Cur, rs.CurC
+	})
+}
+
+func (ds *DynaServer) Watch(req *pb.WatchRequest, stream pb.Watch_WatchServer) error {
+	return ds.watching.watch(req, stream, func() (*pb.Blueprint, pb.ConfID) {
+		ds.mu.RLock()
+		defer ds.mu.RUnlock()
+		return ds.Cur, ds.CurC
+	})
+}
+
+func (srs *SSRServer) Watch(req *pb.WatchRequest, stream pb.Watch_WatchServer) error {
+	return srs.watching.watch(req, stream, func() (*pb.Blueprint, pb.ConfID) {
+		srs.mu.Lock()
+		defer srs.mu.Unlock()
+		return srs.Cur, srs.CurC
+	})
+}
@@ -7,24 +7,42 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/debug"
-	"syscall"
 	"runtime/pprof"
+	"syscall"
 
 	"github.com/golang/glog"
 
 	"github.com/relab/smartMerge/regserver"
+	"github.com/relab/smartMerge/storage"
+	"github.com/relab/smartMerge/util"
 )
 
 var (
-	port     = flag.Int("port", 10000, "this servers address ip:port.")
+	port       = flag.Int("port", 10000, "this servers address ip:port.")
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
-	gcoff    = flag.Bool("gcoff", false, "turn garbage collection off.")
-	alg      = flag.String("alg", "", "algorithm to use (sm | dyna | ssr | cons )")
-	allCores = flag.Bool("all-cores", false, "use all available logical CPUs")
+	gcoff      = flag.Bool("gcoff", false, "turn garbage collection off.")
+	alg        = flag.String("alg", "", "algorithm to use (sm | dyna | ssr | cons )")
+	allCores   = flag.Bool("all-cores", false, "use all available logical CPUs")
 
 	noabort = flag.Bool("no-abort", false, "do not send aborting new-cur information.")
+
+	datadir = flag.String("datadir", "", "directory to keep the server state in. If empty, state is kept in memory only.")
+	fsync   = flag.String("fsync", "always", "when to sync the state to disk (always | periodic | never )")
+
+	doRecover = flag.Bool("recover", false, "if the datadir is empty, recover the state from the other servers before serving requests.")
+	confFile  = flag.String("conf", "config", "the config file, a list of host:port addresses. Only used with -recover and -decommission.")
+	initsize  = flag.Int("initsize", 1, "the number of servers in the initial configuration. Only used with -recover.")
+
+	decommission = flag.String("decommission", "off", "what to do once removed from the configuration, and the state is handed over (off | report | exit ).")
+
+	maxLease = flag.Duration("maxlease", regserver.MaxLease, "the longest read lease granted to sm and cons clients (0 grants none).")
 )
 
+// A decommissioner can tell when it was removed, and it is safe to stop it.
+type decommissioner interface {
+	Decommission(p *regserver.Peers) <-chan struct{}
+}
+
 func main() {
 	flag.Parse()
 	defer glog.Flush()
@@ -32,6 +50,7 @@ func main() {
 	if *gcoff {
 		debug.SetGCPercent(-1)
 	}
+	regserver.MaxLease = *maxLease
 
 	if *cpuprofile != "" {
 		glog.Infoln("Starting cpuprofiling in file", *cpuprofile)
@@ -50,27 +69,81 @@ func main() {
 	}
 
 	var err error
+	policy, err := storage.ParseSyncPolicy(*fsync)
+	if err != nil {
+		glog.Fatalln(err)
+	}
+	st, err := storage.Open(*datadir, policy)
+	if err != nil {
+		glog.Fatalln("Opening storage returned error", err)
+	}
+
+	switch *decommission {
+	case "off", "report", "exit":
+	default:
+		glog.Fatalf("Unknown value %q for -decommission.\n", *decommission)
+	}
+
 	glog.Infoln("Starting Server with port: ", *port)
+	var peers *regserver.Peers
+	if *doRecover || *decommission != "off" {
+		addrs, ids := util.GetProcs(*confFile, false)
+		if peers, err = regserver.NewPeers(addrs, ids, *port, *initsize); err != nil {
+			glog.Fatalln(err)
+		}
+	}
+	var srv decommissioner
 	switch *alg {
 	case "", "sm":
-		_, err = regserver.StartAdv(*port, *noabort)
+		if *doRecover {
+			srv, err = regserver.StartAdvRecover(*port, peers, st, *noabort)
+		} else {
+			srv, err = regserver.StartAdv(*port, st, *noabort)
+		}
 	case "dyna":
-		_, err = regserver.StartDyna(*port)
+		if *doRecover {
+			srv, err = regserver.StartDynaRecover(*port, peers, st)
+		} else {
+			srv, err = regserver.StartDyna(*port, st)
+		}
 	case "ssr":
-		_, err = regserver.StartSSR(*port)
+		if *doRecover {
+			srv, err = regserver.StartSSRRecover(*port, peers, st)
+		} else {
+			srv, err = regserver.StartSSR(*port, st)
+		}
 	case "cons":
-		_, err = regserver.StartCons(*port, *noabort)
+		if *doRecover {
+			srv, err = regserver.StartConsRecover(*port, peers, st, *noabort)
+		} else {
+			srv, err = regserver.StartCons(*port, st, *noabort)
+		}
 	}
 
 	if err != nil {
 		glog.Fatalln("Starting server returned error", err)
 	}
 
+	// safe stays nil, and blocks forever, unless we should exit.
+	var safe <-chan struct{}
+	if *decommission != "off" {
+		safe = srv.Decommission(peers)
+		if *decommission == "report" {
+			safe = nil
+		}
+	}
+
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, os.Kill, syscall.SIGTERM)
 
 	for {
 		select {
+		case <-safe:
+			glog.Infoln("Removed and handed over the state, shutting down.")
+			if err = regserver.Stop(); err != nil {
+				glog.Errorf("Stopping server returned error: %v\n", err)
+			}
+			return
 		case signal := <-signalChan:
 			if exit := handleSignal(signal); exit {
 				err = regserver.Stop()
@@ -0,0 +1,104 @@
+package smclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	conf "github.com/relab/smartMerge/confProvider"
+	"golang.org/x/net/context"
+)
+
+// KeyWriter is implemented by all clients.
+type KeyWriter interface {
+	WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error)
+}
+
+// Batcher coalesces concurrent writes to the same register. Only one write
+// per register is sent at a time. Writes arriving in the meantime, or within
+// Window after it, are gathered, and only the last of them is written in the
+// next round. All writes of a round return when it is done, with its result.
+//
+// This is linearizable: The writes of a round are concurrent with each other,
+// they are ordered in the order they arrived, at the moment the last is
+// written. Their values are overwritten at once, so no read can see them.
+type Batcher struct {
+	KeyWriter
+	Window time.Duration
+
+	mu   sync.Mutex
+	next map[string]*batch // The batch that is gathering writes, per key.
+	busy map[string]bool   // Whether a round is running, per key.
+}
+
+type batch struct {
+	cp   conf.Provider
+	val  []byte
+	done chan struct{}
+	cnt  int
+	err  error
+}
+
+// NewBatcher returns a Batcher writing with w.
+func NewBatcher(w KeyWriter, window time.Duration) *Batcher {
+	return &Batcher{
+		KeyWriter: w,
+		Window:    window,
+		next:      make(map[string]*batch),
+		busy:      make(map[string]bool),
+	}
+}
+
+func (b *Batcher) Write(ctx context.Context, cp conf.Provider, val []byte) (cnt int, err error) {
+	return b.WriteKey(ctx, cp, "", val)
+}
+
+// WriteKey adds val to the next round for key, and waits for it. If ctx is
+// done first, WriteKey returns, but the value may still be written.
+func (b *Batcher) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
+	b.mu.Lock()
+	bt := b.next[key]
+	if bt == nil {
+		bt = &batch{cp: cp, done: make(chan struct{})}
+		b.next[key] = bt
+		if !b.busy[key] {
+			b.busy[key] = true
+			go b.run(key)
+		}
+	}
+	bt.val = val
+	b.mu.Unlock()
+
+	select {
+	case <-bt.done:
+		return bt.cnt, bt.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// run writes the batches for key, until no more writes arrive.
+func (b *Batcher) run(key string) {
+	for {
+		if b.Window > 0 {
+			time.Sleep(b.Window)
+		}
+		b.mu.Lock()
+		bt := b.next[key]
+		if bt == nil {
+			delete(b.busy, key)
+			b.mu.Unlock()
+			return
+		}
+		delete(b.next, key)
+		b.mu.Unlock()
+
+		// The round serves all writers of the batch, so it does not use
+		// the context of any of them.
+		bt.cnt, bt.err = b.KeyWriter.WriteKey(context.Background(), bt.cp, key, bt.val)
+		if bt.err != nil {
+			glog.Errorf("Batched write to %q returned error: %v\n", key, bt.err)
+		}
+		close(bt.done)
+	}
+}
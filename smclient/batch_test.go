@@ -0,0 +1,57 @@
+package smclient_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/relab/smartMerge/confProvider"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+// countWriter counts the writes sent to the servers.
+type countWriter struct {
+	smclient.KeyWriter
+	mu     sync.Mutex
+	rounds int
+}
+
+func (cw *countWriter) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (int, error) {
+	cw.mu.Lock()
+	cw.rounds++
+	cw.mu.Unlock()
+	return cw.KeyWriter.WriteKey(ctx, cp, key, val)
+}
+
+func TestBatcher(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	cw := &countWriter{KeyWriter: cl.C}
+	b := smclient.NewBatcher(cw, 50*time.Millisecond)
+	written := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		val := fmt.Sprint(i)
+		written[val] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.WriteKey(ctx, cl.CP, "x", []byte(val)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if cw.rounds >= 10 {
+		t.Errorf("20 concurrent writes used %d rounds, expected them to be batched.", cw.rounds)
+	}
+	if v, _, err := cl.C.ReadKey(ctx, cl.CP, "x"); err != nil || !written[string(v)] {
+		t.Errorf("Read after batched writes returned %q, %v.", v, err)
+	}
+}
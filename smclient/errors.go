@@ -0,0 +1,64 @@
+package smclient
+
+import (
+	"errors"
+
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+)
+
+// Errors returned by the clients. Check for them with errors.Is, the
+// returned errors may wrap them.
+var (
+	// ErrQuorumUnavailable is matched by quorum calls that failed, because
+	// too many servers returned errors.
+	ErrQuorumUnavailable = errors.New("quorum unavailable")
+	// ErrTimeout is matched by quorum calls that timed out, or whose context
+	// deadline expired.
+	ErrTimeout = errors.New("quorum call timed out")
+	// ErrMinSize is returned for a reconfiguration to less than MinSize
+	// servers.
+	ErrMinSize = errors.New("configuration below minimum size")
+	// ErrZones is returned for a reconfiguration to a blueprint, that breaks
+	// its zone rule, see pb.Blueprint.CheckZones.
+	ErrZones = errors.New("configuration does not tolerate the loss of its zones")
+	// ErrSuperseded is returned by Reconf, if the proposal was incomparable
+	// to the current configuration, and a merged blueprint was installed
+	// instead. A proposal the current configuration already holds is not an
+	// error.
+	ErrSuperseded = errors.New("proposal is superseded by the current configuration")
+)
+
+// QuorumError is returned if a quorum call failed after all retries. Err is
+// the error of the last attempt, usually a pb.IncompleteRPCError, a
+// pb.TimeoutRPCError or the error of the context.
+type QuorumError struct {
+	Op  string // The failed call, e.g. "ReadS".
+	Err error
+}
+
+// NewQuorumError returns a QuorumError for the call op.
+func NewQuorumError(op string, err error) error {
+	return &QuorumError{Op: op, Err: err}
+}
+
+func (e *QuorumError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *QuorumError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e matches ErrQuorumUnavailable or ErrTimeout.
+func (e *QuorumError) Is(target error) bool {
+	switch target {
+	case ErrQuorumUnavailable:
+		_, ok := e.Err.(pb.IncompleteRPCError)
+		return ok
+	case ErrTimeout:
+		_, ok := e.Err.(pb.TimeoutRPCError)
+		return ok || errors.Is(e.Err, context.DeadlineExceeded)
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
 )
 
 func (smc *SmClient) SetNewCur(cur int) {
@@ -24,7 +25,7 @@ func (smc *SmClient) HandleOneCur(cur int, newCur *pb.Blueprint) int {
 		return cur
 	}
 	if glog.V(7) {
-		glog.Infof("Found new Cur with length %d, current has length %d\n", newCur.Len(), smc.Blueps[cur].Len())
+		glog.Infof("Found new Cur with length %d, current has length %d\n", newCur.Order(), smc.Blueps[cur].Order())
 	}
 	return smc.findorinsert(cur, newCur)
 }
@@ -38,7 +39,7 @@ func (smc *SmClient) HandleNewCur(cur int, newCur *pb.ConfReply) int {
 		return cur
 	}
 	if glog.V(3) {
-		glog.Infof("Found new Cur with length %d, current has length %d\n", newCur.Cur.Len(), smc.Blueps[cur].Len())
+		glog.Infof("Found new Cur with length %d, current has length %d\n", newCur.Cur.Order(), smc.Blueps[cur].Order())
 	}
 
 	return smc.findorinsert(cur, newCur.Cur)
@@ -78,7 +79,7 @@ func (smc *SmClient) findorinsert(i int, blp *pb.Blueprint) int {
 }
 
 func (smc *SmClient) insert(i int, blp *pb.Blueprint) {
-	glog.V(3).Infof("Inserting new blueprint with length %d at place %d\n", blp.Len(), i)
+	glog.V(3).Infof("Inserting new blueprint with length %d at place %d\n", blp.Order(), i)
 
 	smc.Blueps = append(smc.Blueps, blp)
 
@@ -91,27 +92,58 @@ func (smc *SmClient) insert(i int, blp *pb.Blueprint) {
 	}
 }
 
-func (smc *SmClient) SetCur(cp conf.Provider, cur *pb.Blueprint) {
+// SetCur sends cur to the servers in cur.
+func (smc *SmClient) SetCur(ctx context.Context, cp conf.Provider, cur *pb.Blueprint) {
+	setCur(ctx, cp, cur, smc.Id, smc.Policy)
+}
+
+// setCur is SetCur without the client, for goroutines that outlive an
+// operation's view of the client.
+func setCur(ctx context.Context, cp conf.Provider, cur *pb.Blueprint, id uint32, p *RetryPolicy) {
 	cnf := cp.WriteC(cur, nil)
 
 	for j := 0; ; j++ {
-		_, err := cnf.SetCur(&pb.NewCur{
-			CurC: uint32(cur.Len()),
+		_, err := cnf.SetCur(ctx, &pb.NewCur{
+			CurC: cur.ID(),
 			Cur:  cur})
 
-		if err != nil && j == 0 {
-			glog.Errorf("C%d: error from Thrifty New Cur: %v\n", smc.Id, err)
+		if err != nil && p.Widen(j) {
+			glog.Errorf("C%d: error from Thrifty New Cur: %v\n", id, err)
 			// Try again with full configuration.
 			cnf = cp.FullC(cur)
 		}
 
-		if err != nil && j == Retry {
-			glog.Errorf("C%d: error %v from NewCur after %d retries: ", smc.Id, err, Retry)
-			break
+		if p.Retry(ctx, "SetCur", j, err) {
+			continue
 		}
-
-		if err == nil {
-			break
+		if err != nil {
+			glog.Errorf("C%d: error %v from NewCur after %d attempts: ", id, err, j+1)
 		}
+		break
+	}
+}
+
+// NotifyRemoved calls notify with a configuration for every server in old,
+// that was removed in cur. Clients only contact the servers in Cur, so the
+// removed servers do not learn about their removal otherwise. This is best
+// effort, notify runs in the background. It outlives the operation that
+// called NotifyRemoved, so it does not get the operation's context.
+func NotifyRemoved(cp conf.Provider, old, cur *pb.Blueprint, notify func(context.Context, *pb.Configuration) error) {
+	for _, id := range cur.Removed(old) {
+		cnf := cp.FullC(&pb.Blueprint{Nodes: []*pb.Node{{Id: id}}})
+		go func(id uint32) {
+			if err := notify(context.Background(), cnf); err != nil {
+				glog.V(3).Infof("Notifying removed server %d failed: %v\n", id, err)
+			}
+		}(id)
 	}
 }
+
+// SetCurRemoved sends the current blueprint to the servers removed since old.
+func (smc *SmClient) SetCurRemoved(cp conf.Provider, old *pb.Blueprint) {
+	cur := smc.Blueps[0]
+	NotifyRemoved(cp, old, cur, func(ctx context.Context, cnf *pb.Configuration) error {
+		_, err := cnf.SetCur(ctx, &pb.NewCur{CurC: cur.ID(), Cur: cur})
+		return err
+	})
+}
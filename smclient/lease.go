@@ -0,0 +1,93 @@
+package smclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	conf "github.com/relab/smartMerge/confProvider"
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+)
+
+// LeaseReads, if positive, makes atomic reads of the sm and cons clients ask
+// the servers for a read lease of that length, once the state is written back.
+// While the lease lasts, atomic reads of the same key return that state,
+// without contacting the servers. Writes to the key wait until the lease
+// expired, also those of the client holding it. See regserver/lease.go.
+var LeaseReads time.Duration
+
+type leased struct {
+	st    *pb.State
+	c     pb.ConfID // The configuration the lease was granted in.
+	until time.Time
+}
+
+// leaseCache holds the leases of a client, shared by its views. A nil
+// leaseCache holds no leases.
+type leaseCache struct {
+	mu   sync.Mutex
+	keys map[string]leased
+}
+
+func newLeaseCache() *leaseCache {
+	return &leaseCache{keys: make(map[string]leased)}
+}
+
+// get returns the leased state of key, if the lease was granted in the
+// configuration c, and did not expire.
+func (lc *leaseCache) get(key string, c pb.ConfID) (*pb.State, bool) {
+	if lc == nil {
+		return nil, false
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	l, ok := lc.keys[key]
+	if !ok {
+		return nil, false
+	}
+	if l.c != c || !time.Now().Before(l.until) {
+		delete(lc.keys, key)
+		return nil, false
+	}
+	return l.st, true
+}
+
+func (lc *leaseCache) put(key string, l leased) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if old, ok := lc.keys[key]; ok && old.c == l.c && old.st.Compare(l.st) == -1 {
+		// A concurrent read got a lease on a newer state.
+		return
+	}
+	lc.keys[key] = l
+}
+
+// lease asks for a read lease on st, the state of key that was just written
+// back to the current configuration.
+func (smc *SmClient) lease(ctx context.Context, cp conf.Provider, key string, st *pb.State) (cnt int) {
+	if LeaseReads <= 0 || smc.leases == nil || len(smc.Blueps) > 1 {
+		return 0
+	}
+	blp := smc.Blueps[0]
+	c := blp.ID()
+	start := time.Now()
+	rep, err := cp.FullC(blp).Lease(ctx, &pb.LeaseRequest{
+		Conf:   &pb.Conf{This: c, Cur: c, Key: key},
+		State:  &pb.State{Timestamp: st.Timestamp, Writer: st.Writer},
+		Client: smc.Id,
+		Dur:    int64(LeaseReads),
+	})
+	if err != nil {
+		glog.V(3).Infof("C%d: no read lease on %q: %v\n", smc.Id, key, err)
+		return 1
+	}
+	smc.SetNewCur(smc.HandleNewCur(0, rep.GetCur()))
+	if rep.Ok && rep.Dur > 0 {
+		smc.leases.put(key, leased{st, c, start.Add(pb.TrustLease(time.Duration(rep.Dur)))})
+	}
+	return 1
+}
@@ -0,0 +1,64 @@
+package smclient_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestReadLeases(t *testing.T) {
+	smclient.LeaseReads = 300 * time.Millisecond
+	defer func() { smclient.LeaseReads = 0 }()
+	cl := testcluster.Start(t, "sm", 4)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	r, err := smclient.New(cl.C.GetCur(cl.CP), 2, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(exp string, local bool) {
+		v, cnt, err := r.ReadKey(ctx, cl.CP, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(v) != exp {
+			t.Errorf("Read returned %q, expected %q.", v, exp)
+		}
+		if (cnt == 0) != local {
+			t.Errorf("Read used %d accesses, expected a local read: %v.", cnt, local)
+		}
+	}
+
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	read("1", false)
+	read("1", true)
+
+	// The write waits for the lease, the next read sees it.
+	start := time.Now()
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Write took %v, did not wait for the lease.", d)
+	}
+	read("2", false)
+	read("2", true)
+
+	// So does a reconfiguration.
+	prop := cl.C.GetCur(cl.CP)
+	prop.Rem(cl.ID(3))
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	read("3", false)
+	read("3", true)
+}
@@ -0,0 +1,126 @@
+package smclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	pb "github.com/relab/smartMerge/proto"
+)
+
+// BluepDir is where clients keep the blueprints they know, if set. Every
+// client saves its current and next blueprints to the file blueps-<id> there,
+// whenever they change. A client started again with the same id starts from
+// the newest configuration it knew, instead of the initial one, see
+// StartBlueps.
+var BluepDir = ""
+
+var errCorruptBlueps = errors.New("corrupt blueprint file")
+
+func bluepFile(id uint32) string {
+	return filepath.Join(BluepDir, fmt.Sprintf("blueps-%d", id))
+}
+
+// StartBlueps returns the blueprints a client with id starts from. These are
+// the saved blueprints, if their current one is newer than initBlp, otherwise
+// just initBlp. stale reports whether initBlp is outdated. The client then
+// skips the initial SetCur.
+func StartBlueps(initBlp *pb.Blueprint, id uint32) (blps []*pb.Blueprint, stale bool) {
+	if BluepDir == "" {
+		return []*pb.Blueprint{initBlp}, false
+	}
+	saved, err := LoadBlueps(bluepFile(id))
+	if err != nil {
+		glog.Errorln("Loading saved blueprints returned error:", err)
+	}
+	if len(saved) == 0 || !saved[0].ID().Newer(initBlp.ID()) {
+		return []*pb.Blueprint{initBlp}, false
+	}
+	glog.Infof("C%d: Starting from saved configuration with length %d.\n", id, saved[0].Order())
+	return saved, true
+}
+
+// SaveBlueps saves the blueprints of the client with id, if BluepDir is set.
+// Errors are only logged, the client keeps working without the file.
+func SaveBlueps(id uint32, blps []*pb.Blueprint) {
+	if BluepDir == "" {
+		return
+	}
+	if err := WriteBlueps(bluepFile(id), blps); err != nil {
+		glog.Errorln("Saving blueprints returned error:", err)
+	}
+}
+
+// WriteBlueps replaces file with blps, each prefixed with its length.
+func WriteBlueps(file string, blps []*pb.Blueprint) error {
+	var data []byte
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, blp := range blps {
+		b, err := blp.Marshal()
+		if err != nil {
+			return err
+		}
+		n := binary.PutUvarint(buf, uint64(len(b)))
+		data = append(data, buf[:n]...)
+		data = append(data, b...)
+	}
+
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// LoadBlueps reads the blueprints written to file by WriteBlueps. It returns
+// none if file does not exist.
+func LoadBlueps(file string) ([]*pb.Blueprint, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var blps []*pb.Blueprint
+	for len(data) > 0 {
+		l, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < l {
+			return nil, errCorruptBlueps
+		}
+		blp := new(pb.Blueprint)
+		if err := blp.Unmarshal(data[n : n+int(l)]); err != nil {
+			return nil, err
+		}
+		blps = append(blps, blp)
+		data = data[n+int(l):]
+	}
+	return blps, nil
+}
+
+func sameBlueps(a, b []*pb.Blueprint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package smclient_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestPersistBlueps(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 4)
+	defer cl.Stop()
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "blueps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	smclient.BluepDir = dir
+	defer func() { smclient.BluepDir = "" }()
+
+	initBlp := cl.C.GetCur(cl.CP)
+	c, err := smclient.New(initBlp, 3, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prop := c.GetCur(cl.CP)
+	prop.Rem(cl.ID(3))
+	if _, err := c.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WriteKey(ctx, cl.CP, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted client starts from the configuration it knew.
+	c, err = smclient.New(initBlp, 3, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur := c.GetCur(cl.CP); cur.Order() != prop.Order() {
+		t.Errorf("Restarted client is in configuration with length %d, expected %d.", cur.Order(), prop.Order())
+	}
+	if v, _, err := c.ReadKey(ctx, cl.CP, "x"); err != nil || string(v) != "1" {
+		t.Errorf("Read after restart returned %q, %v, expected %q.", v, err, "1")
+	}
+
+	// Other clients still start from the initial configuration.
+	if c, err = smclient.New(initBlp, 4, cl.CP, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cur := c.GetCur(cl.CP); cur.Order() != initBlp.Order() {
+		t.Errorf("New client is in configuration with length %d, expected %d.", cur.Order(), initBlp.Order())
+	}
+}
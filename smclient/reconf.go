@@ -1,44 +1,76 @@
 package smclient
 
 import (
-	"errors"
-
 	"github.com/golang/glog"
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
 )
 
-func (smc *SmClient) Reconf(cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
+// Reconf installs prop. If the current configuration already holds prop, it
+// returns nil without contacting the servers. If prop and the current
+// configuration are incomparable, prop is merged with it, and ErrSuperseded
+// is returned once the merged blueprint is installed in place of prop.
+func (smc *SmClient) Reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
+	op := smc.View()
+	defer smc.Merge(op)
+	return op.reconf(ctx, cp, prop)
+}
+
+func (smc *SmClient) reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
 	//Proposed blueprint is already in place, or outdated.
 	if prop.Compare(smc.Blueps[0]) == 1 {
 		glog.V(3).Infof("C%d: Proposal is already in place.", smc.Id)
 		return 0, nil
 	}
+	if err := prop.CheckZones(); err != nil {
+		glog.Errorf("C%d: Rejecting proposal: %v", smc.Id, err)
+		return 0, ErrZones
+	}
 
-	_, cnt, err = smc.Doreconf(cp, prop, 0, nil)
+	incomparable := smc.Blueps[0].Compare(prop) != 1
+	_, cnt, err = smc.doreconf(ctx, cp, prop, 0, "", nil)
+	if err == nil && incomparable && !prop.Equals(smc.Blueps[0]) {
+		err = ErrSuperseded
+	}
 	return
 }
 
 // Regular is: 0 for reconfiguration 1 for regular read, 2 for atomic read/write
-func (smc *SmClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular int, val []byte) (rst *pb.State, cnt int, err error) {
+// Key is the register to read or write. The states of all other registers are
+// moved along when moving to a new configuration.
+func (smc *SmClient) Doreconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, regular int, key string, val []byte) (rst *pb.State, cnt int, err error) {
+	op := smc.View()
+	defer smc.Merge(op)
+	return op.doreconf(ctx, cp, prop, regular, key, val)
+}
+
+func (smc *SmClient) doreconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, regular int, key string, val []byte) (rst *pb.State, cnt int, err error) {
 	if glog.V(6) {
 		glog.Infof("C%d: Starting reconf\n", smc.Id)
 	}
 
 	if prop.Compare(smc.Blueps[0]) != 1 {
 		// A new blueprint was proposed. Need to solve Lattice Agreement:
-		prop, cnt, err = smc.lagree(cp, prop)
+		prop, cnt, err = smc.lagree(ctx, cp, prop)
 		if err != nil {
 			return nil, 0, err
 		}
 		if len(prop.Ids()) < MinSize {
 			glog.Errorf("Aborting Reconfiguration to avoid unacceptable configuration.")
-			return nil, cnt, errors.New("Abort before moving to unacceptable configuration.")
+			return nil, cnt, ErrMinSize
+		}
+		if err := prop.CheckZones(); err != nil {
+			glog.Errorf("Aborting Reconfiguration, learned blueprint breaks zone rule: %v", err)
+			return nil, cnt, ErrZones
 		}
 	}
 
+	old := smc.Blueps[0]
 	cur := 0
 	las := new(pb.Blueprint)
+	// States of the other registers, moved along to new configurations.
+	kst := make(pb.KeyStates)
 	var wid []int // Did already write to these processes.
 	var rid []int // Did already read from these processes.
 
@@ -54,7 +86,7 @@ forconfiguration:
 				// If read or write operation: Need to read before writing.
 				var st *pb.State
 				var c int
-				st, cur, c, err = smc.Doread(cp, cur, i, rid)
+				st, cur, c, err = smc.Doread(ctx, cp, cur, i, rid, key)
 				if err != nil {
 					return nil, 0, err
 				}
@@ -82,38 +114,42 @@ forconfiguration:
 			writeN := new(pb.AWriteNReply)
 
 			for j := 0; cnf != nil; j++ {
-				writeN, err = cnf.AWriteN(&pb.WriteN{
-					CurC: uint32(smc.Blueps[i].Len()),
+				writeN, err = cnf.AWriteN(ctx, &pb.WriteN{
+					CurC: smc.Blueps[i].ID(),
 					Next: prop,
+					Key:  key,
 				})
 				cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && smc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedWriteN: %v\n", smc.Id, err)
 					// Try again with full configuration.
 					cnf = cp.FullC(smc.Blueps[i])
 				}
 
-				if err != nil && j == Retry {
-					glog.Errorf("C%d: error %v from WriteN after %d retries: ", smc.Id, err, Retry)
-					return nil, 0, err
+				if smc.Policy.Retry(ctx, "WriteN", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from WriteN after %d attempts: ", smc.Id, err, j+1)
+					return nil, 0, NewQuorumError("WriteN", err)
 				}
+				break
 			}
 
 			if i > 0 && glog.V(3) {
-				glog.Infof("C%d: WriteN in Configuration with length %d\n ", smc.Id, smc.Blueps[i].Len())
+				glog.Infof("C%d: WriteN in Configuration with length %d\n ", smc.Id, smc.Blueps[i].Order())
 			} else if glog.V(6) {
 				glog.Infoln("WriteN returned.")
 			}
 
 			cur = smc.HandleNewCur(cur, writeN.Reply.GetCur())
 			las = las.Merge(writeN.Reply.GetLAState())
-			if rst.Compare(writeN.Reply.GetState()) == 1 {
-				rst = writeN.Reply.GetState()
+			if rst, err = cnf.FetchNewer(ctx, key, rst, writeN.Reply.GetState()); err != nil {
+				return nil, 0, err
+			}
+			if err = cnf.FetchNewerAll(ctx, kst, writeN.Reply.GetKStates()); err != nil {
+				return nil, 0, err
 			}
 
 			if c := writeN.Reply.GetCur(); c == nil || !c.Abort {
@@ -129,30 +165,39 @@ forconfiguration:
 			var setS *pb.SetStateReply
 
 			for j := 0; ; j++ {
-				setS, err = cnf.SetState(&pb.NewState{
-					CurC:    uint32(smc.Blueps[i].Len()),
-					State:   rst,
-					LAState: las})
+				var st *pb.State
+				var kss []*pb.KeyState
+				if st, err = cnf.Stage(ctx, key, rst); err == nil {
+					kss, err = cnf.StageAll(ctx, kst.Others(key))
+				}
+				if err == nil {
+					setS, err = cnf.SetState(ctx, &pb.NewState{
+						CurC:    smc.Blueps[i].ID(),
+						State:   st,
+						LAState: las,
+						Key:     key,
+						KStates: kss})
+				}
 				cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && smc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from OptimizedSetState: %v\n", smc.Id, err)
 					// Try again with full configuration.
 					cnf = cp.FullC(smc.Blueps[i])
 				}
 
-				if err != nil && j == Retry {
-					glog.Errorf("C%d: error %v from SetState after %d retries: ", smc.Id, err, Retry)
-					return nil, 0, err
+				if smc.Policy.Retry(ctx, "SetState", j, err) {
+					continue
 				}
-
-				if err == nil {
-					break
+				if err != nil {
+					glog.Errorf("C%d: error %v from SetState after %d attempts: ", smc.Id, err, j+1)
+					return nil, 0, NewQuorumError("SetState", err)
 				}
+				break
 			}
 
 			if i > 0 && glog.V(3) {
-				glog.Infof("C%d: Set State in Configuration with length %d\n ", smc.Id, smc.Blueps[i].Len())
+				glog.Infof("C%d: Set State in Configuration with length %d\n ", smc.Id, smc.Blueps[i].Order())
 			} else if glog.V(6) {
 				glog.Infoln("Set state returned.")
 			}
@@ -164,13 +209,14 @@ forconfiguration:
 
 	smc.SetNewCur(cur)
 	if cnt > 2 {
-		smc.SetCur(cp, smc.Blueps[0])
+		smc.SetCur(ctx, cp, smc.Blueps[0])
+		smc.SetCurRemoved(cp, old)
 		cnt++
 	}
 	return rst, cnt, nil
 }
 
-func (smc *SmClient) lagree(cp conf.Provider, prop *pb.Blueprint) (dec *pb.Blueprint, cnt int, err error) {
+func (smc *SmClient) lagree(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (dec *pb.Blueprint, cnt int, err error) {
 	cur := 0
 	var rid []int
 	prop = prop.Merge(smc.Blueps[0])
@@ -184,27 +230,27 @@ func (smc *SmClient) lagree(cp conf.Provider, prop *pb.Blueprint) (dec *pb.Bluep
 		laProp := new(pb.LAPropReply)
 
 		for j := 0; cnf != nil; j++ {
-			laProp, err = cnf.LAProp(&pb.LAProposal{
+			laProp, err = cnf.LAProp(ctx, &pb.LAProposal{
 				Conf: &pb.Conf{
-					This: uint32(smc.Blueps[i].Len()),
-					Cur:  uint32(smc.Blueps[cur].Len())},
+					This: smc.Blueps[i].ID(),
+					Cur:  smc.Blueps[cur].ID()},
 				Prop: prop})
 			cnt++
 
-			if err != nil && j == 0 {
+			if err != nil && smc.Policy.Widen(j) {
 				glog.Errorf("C%d: error from OptimizedLAProp: %v\n", smc.Id, err)
 				// Try again with full configuration.
 				cnf = cp.FullC(smc.Blueps[i])
 			}
 
-			if err != nil && j == Retry {
-				glog.Errorf("C%d: error %v from LAProp after %d retries: ", smc.Id, err, Retry)
-				return nil, 0, err
+			if smc.Policy.Retry(ctx, "LAProp", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("C%d: error %v from LAProp after %d attempts: ", smc.Id, err, j+1)
+				return nil, 0, NewQuorumError("LAProp", err)
 			}
+			break
 		}
 
 		if glog.V(4) {
@@ -234,7 +280,7 @@ func (smc *SmClient) lagree(cp conf.Provider, prop *pb.Blueprint) (dec *pb.Bluep
 	return prop, cnt, nil
 }
 
-func (smc *SmClient) Doread(cp conf.Provider, curin, i int, rid []int) (st *pb.State, cur, cnt int, err error) {
+func (smc *SmClient) Doread(ctx context.Context, cp conf.Provider, curin, i int, rid []int, key string) (st *pb.State, cur, cnt int, err error) {
 	cnf := cp.ReadC(smc.Blueps[i], rid)
 	if cnf == nil {
 		cnt++
@@ -242,26 +288,28 @@ func (smc *SmClient) Doread(cp conf.Provider, curin, i int, rid []int) (st *pb.S
 	read := new(pb.AReadSReply)
 
 	for j := 0; cnf != nil; j++ {
-		read, err = cnf.AReadS(&pb.Conf{
-			This: uint32(smc.Blueps[i].Len()),
-			Cur:  uint32(smc.Blueps[i].Len()),
+		read, err = cnf.AReadS(ctx, &pb.Conf{
+			This:   smc.Blueps[i].ID(),
+			Cur:    smc.Blueps[i].ID(),
+			Key:    key,
+			Digest: DigestReads,
 		})
 		cnt++
 
-		if err != nil && j == 0 {
+		if err != nil && smc.Policy.Widen(j) {
 			glog.Errorf("C%d: error from OptimizedReads: %v\n", smc.Id, err)
 			// Try again with full configuration.
 			cnf = cp.FullC(smc.Blueps[i])
 		}
 
-		if err != nil && j == Retry {
-			glog.Errorf("C%d: error %v from ReadS after %d retries: ", smc.Id, err, Retry)
-			return nil, 0, 0, err
+		if smc.Policy.Retry(ctx, "ReadS", j, err) {
+			continue
 		}
-
-		if err == nil {
-			break
+		if err != nil {
+			glog.Errorf("C%d: error %v from ReadS after %d attempts: ", smc.Id, err, j+1)
+			return nil, 0, 0, NewQuorumError("ReadS", err)
 		}
+		break
 	}
 
 	if glog.V(6) {
@@ -269,5 +317,8 @@ func (smc *SmClient) Doread(cp conf.Provider, curin, i int, rid []int) (st *pb.S
 	}
 	cur = smc.HandleNewCur(curin, read.Reply.GetCur())
 
-	return read.Reply.GetState(), cur, cnt, nil
+	if st, err = cnf.Fetch(ctx, key, read.Reply.GetState()); err != nil {
+		return nil, 0, 0, err
+	}
+	return st, cur, cnt, nil
 }
@@ -0,0 +1,140 @@
+package smclient_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestLargeFaultTolerance(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 4)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	prop := cl.C.GetCur(cl.CP)
+	prop.FaultTolerance = 40
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	prop = cl.C.GetCur(cl.CP)
+	prop.Rem(cl.ID(3))
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if cur := cl.C.GetCur(cl.CP); !cur.Equals(prop) {
+		t.Errorf("Client ended in configuration %v, expected %v.", cur, prop)
+	}
+	if v, _, err := cl.C.ReadKey(ctx, cl.CP, "x"); err != nil || string(v) != "1" {
+		t.Errorf("Read returned %q, %v, expected %q.", v, err, "1")
+	}
+}
+
+func TestWeightedQuorums(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	// The first server gets 3 of 5 votes. With FaultTolerance 2, it is a read
+	// and a write quorum on its own.
+	prop := cl.C.GetCur(cl.CP).Copy()
+	prop.FaultTolerance = 2
+	if !prop.SetWeight(cl.ID(0), 3) {
+		t.Fatal("SetWeight did not change the weight.")
+	}
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if cur := cl.C.GetCur(cl.CP); !cur.Equals(prop) || cur.Quorum() != 3 {
+		t.Fatalf("Client ended in configuration %v, expected %v.", cur, prop)
+	}
+
+	for _, h := range cl.Handles[1:] {
+		if err := h.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := cl.C.ReadKey(ctx, cl.CP, "x"); err != nil || string(v) != "1" {
+		t.Errorf("Read with only the heavy server returned %q, %v, expected %q.", v, err, "1")
+	}
+}
+
+func TestReadQuorumSize(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	// Read from any one server, and write to all.
+	prop := cl.C.GetCur(cl.CP).Copy()
+	if err := prop.SetQuorums(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if cur := cl.C.GetCur(cl.CP); !cur.Equals(prop) || cur.ReadQuorum() != 1 || cur.Quorum() != 3 {
+		t.Fatalf("Client ended in configuration %v, expected %v.", cur, prop)
+	}
+
+	for _, h := range cl.Handles[1:] {
+		if err := h.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, _, err := cl.C.RReadKey(ctx, cl.CP, "x"); err != nil || string(v) != "1" {
+		t.Errorf("Regular read from one server returned %q, %v, expected %q.", v, err, "1")
+	}
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("2")); err == nil {
+		t.Error("Write to one of three servers succeeded.")
+	}
+}
+
+func TestZones(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	// One server in each zone, tolerating the loss of one zone.
+	gids := make([]uint32, len(cl.Addrs))
+	prop := cl.C.GetCur(cl.CP).Copy()
+	for i := range cl.Addrs {
+		gids[i] = cl.ID(i)
+		prop.SetZone(gids[i], string('a'+rune(i)))
+	}
+	prop.SetZoneFaults(1)
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if cur := cl.C.GetCur(cl.CP); !cur.Equals(prop) {
+		t.Fatalf("Client ended in configuration %v, expected %v.", cur, prop)
+	}
+
+	// Two servers in one zone cannot tolerate its loss.
+	bad := prop.Copy()
+	bad.SetZone(gids[2], "a")
+	if _, err := cl.C.Reconf(ctx, cl.CP, bad); !errors.Is(err, smclient.ErrZones) {
+		t.Errorf("Reconf to two zones returned %v, expected ErrZones.", err)
+	}
+
+	if err := cl.Handles[2].Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.C.WriteKey(ctx, cl.CP, "x", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, err := cl.C.ReadKey(ctx, cl.CP, "x"); err != nil || string(v) != "1" {
+		t.Errorf("Read after losing a zone returned %q, %v, expected %q.", v, err, "1")
+	}
+}
@@ -0,0 +1,78 @@
+package smclient
+
+import (
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy decides how often a failed quorum call is tried again, how long
+// to wait in between, and when to give up on the thrifty configuration.
+type RetryPolicy struct {
+	// Attempts is the number of times a quorum call is tried, at least once.
+	Attempts int
+	// Backoff is the wait before the second attempt. It doubles for every
+	// further attempt, up to MaxBackoff if that is set. Zero retries at once.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter randomizes every wait by up to this fraction, e.g. 0.2 for ±20%.
+	Jitter float64
+	// FullAfter is the number of failed attempts after which the call
+	// switches from the thrifty to the full configuration. Zero never
+	// switches.
+	FullAfter int
+	// OnAttempt, if set, is called after every attempt, with the name of the
+	// call, the number of the attempt, starting at 0, and its error.
+	OnAttempt func(op string, attempt int, err error)
+}
+
+// DefaultRetry is used by clients created without a policy. It tries twice,
+// the second time with the full configuration.
+var DefaultRetry = &RetryPolicy{Attempts: 2, FullAfter: 1}
+
+// Widen reports whether the call should switch to the full configuration,
+// after attempt failed.
+func (p *RetryPolicy) Widen(attempt int) bool {
+	return p.FullAfter > 0 && attempt+1 == p.FullAfter
+}
+
+// Retry is called after every attempt of op. It reports whether op should be
+// tried again, and then waits for the backoff. It returns false if err is nil,
+// if this was the last attempt, or if ctx is done.
+func (p *RetryPolicy) Retry(ctx context.Context, op string, attempt int, err error) bool {
+	if p.OnAttempt != nil {
+		p.OnAttempt(op, attempt, err)
+	}
+	if err == nil || attempt+1 >= p.Attempts || ctx.Err() != nil {
+		return false
+	}
+	d := p.backoff(attempt)
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoff returns the wait after attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < attempt; i++ {
+		if d*2 < d || (p.MaxBackoff > 0 && d >= p.MaxBackoff) {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(d))
+	}
+	return d
+}
@@ -0,0 +1,68 @@
+package smclient_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestCancel(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	cl.C.WriteKey(context.Background(), cl.CP, "x", []byte("1"))
+
+	// The servers hang while their state is locked, so the read only returns
+	// when ctx expires, not after the configuration's timeout.
+	for _, rs := range cl.Servers {
+		rs.Lock()
+		defer rs.Unlock()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	v, _, err := cl.C.ReadKey(ctx, cl.CP, "x")
+	if v != nil {
+		t.Errorf("Read from hanging servers returned %q.", v)
+	}
+	var qe *smclient.QuorumError
+	if !errors.Is(err, smclient.ErrTimeout) || !errors.As(err, &qe) || qe.Op != "ReadS" {
+		t.Errorf("Read from hanging servers returned %v, expected a timeout of ReadS.", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Read returned after %v, expected it to be cancelled after 100ms.", d)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 3)
+	cl.C.WriteKey(context.Background(), cl.CP, "x", []byte("1"))
+	cl.Stop()
+
+	var attempts []error
+	cl.C.Policy = &smclient.RetryPolicy{
+		Attempts:  3,
+		Backoff:   20 * time.Millisecond,
+		FullAfter: 1,
+		OnAttempt: func(op string, attempt int, err error) {
+			if op != "ReadS" || attempt != len(attempts) {
+				t.Errorf("OnAttempt got attempt %d of %s, expected %d of ReadS.", attempt, op, len(attempts))
+			}
+			attempts = append(attempts, err)
+		},
+	}
+	start := time.Now()
+	if _, _, err := cl.C.ReadKey(context.Background(), cl.CP, "x"); !errors.Is(err, smclient.ErrQuorumUnavailable) {
+		t.Errorf("Read from stopped servers returned %v, expected %v.", err, smclient.ErrQuorumUnavailable)
+	}
+	if len(attempts) != 3 {
+		t.Errorf("Read was tried %d times, expected 3.", len(attempts))
+	}
+	// Waits 20ms and 40ms between the attempts.
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Errorf("Read returned after %v, expected a backoff of at least 60ms.", d)
+	}
+}
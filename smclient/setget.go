@@ -4,18 +4,24 @@ import (
 	"github.com/golang/glog"
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
 )
 
-func (smc *SmClient) get(cp conf.Provider) (rs *pb.State, cnt int) {
+// get reads the state of key. If fetch is false, a value larger than
+// pb.ChunkThreshold is left out, see proto/chunks_udef.go.
+func (smc *SmClient) get(ctx context.Context, cp conf.Provider, key string, fetch bool) (rs *pb.State, cnt int, err error) {
 	cur := 0
 	var rid []int
+	var src *pb.Configuration // The configuration rs was read from.
 	for i := 0; i < len(smc.Blueps); i++ {
 		cnt++
 		if i < cur {
 			continue
 		}
 		if i > 0 && i == cur {
-			go smc.SetCur(cp, smc.Blueps[cur])
+			// Runs in the background, ctx may be cancelled before it is done.
+			// It gets a copy of cur, since the view keeps changing.
+			go setCur(context.Background(), cp, smc.Blueps[cur].Copy(), smc.Id, smc.Policy)
 		}
 		smc.checkrid(i, rid, cp)
 
@@ -25,29 +31,30 @@ func (smc *SmClient) get(cp conf.Provider) (rs *pb.State, cnt int) {
 		//}
 
 		read := new(pb.AReadSReply)
-		var err error
 
 		for j := 0; cnf != nil; j++ {
-			read, err = cnf.AReadS(&pb.Conf{
-				This: uint32(smc.Blueps[i].Len()),
-				Cur:  uint32(smc.Blueps[cur].Len()),
+			read, err = cnf.AReadS(ctx, &pb.Conf{
+				This:   smc.Blueps[i].ID(),
+				Cur:    smc.Blueps[cur].ID(),
+				Key:    key,
+				Digest: DigestReads,
 			})
 			//cnt++
 
-			if err != nil && j == 0 {
+			if err != nil && smc.Policy.Widen(j) {
 				glog.Errorln("error from OptimizedReadS: ", err)
 				// Try again with full configuration.
 				cnf = cp.FullC(smc.Blueps[i])
 			}
 
-			if err != nil && j == Retry {
-				glog.Errorf("error %v from ReadS after %d retries.\n", err, Retry)
-				return nil, 0
+			if smc.Policy.Retry(ctx, "ReadS", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("error %v from ReadS after %d attempts.\n", err, j+1)
+				return nil, 0, NewQuorumError("ReadS", err)
 			}
+			break
 		}
 
 		if glog.V(6) {
@@ -58,6 +65,7 @@ func (smc *SmClient) get(cp conf.Provider) (rs *pb.State, cnt int) {
 
 		if rs.Compare(read.Reply.GetState()) == 1 {
 			rs = read.Reply.GetState()
+			src = cnf
 		}
 
 		if len(smc.Blueps) > i+1 && (read.Reply.GetCur() == nil || !read.Reply.Cur.Abort) {
@@ -67,10 +75,16 @@ func (smc *SmClient) get(cp conf.Provider) (rs *pb.State, cnt int) {
 	}
 
 	smc.SetNewCur(cur)
+	if fetch && rs.Omitted() {
+		if rs, err = src.Fetch(ctx, key, rs); err != nil {
+			glog.Errorln("error from Fetch: ", err)
+			return nil, 0, err
+		}
+	}
 	return
 }
 
-func (smc *SmClient) set(cp conf.Provider, rs *pb.State) (cnt int) {
+func (smc *SmClient) set(ctx context.Context, cp conf.Provider, key string, rs *pb.State) (cnt int, err error) {
 	cur := 0
 	var rid []int
 	for i := 0; i < len(smc.Blueps); i++ {
@@ -80,7 +94,9 @@ func (smc *SmClient) set(cp conf.Provider, rs *pb.State) (cnt int) {
 		}
 
 		if i > 0 && i == cur {
-			go smc.SetCur(cp, smc.Blueps[cur])
+			// Runs in the background, ctx may be cancelled before it is done.
+			// It gets a copy of cur, since the view keeps changing.
+			go setCur(context.Background(), cp, smc.Blueps[cur].Copy(), smc.Id, smc.Policy)
 		}
 		smc.checkrid(i, rid, cp)
 
@@ -90,32 +106,35 @@ func (smc *SmClient) set(cp conf.Provider, rs *pb.State) (cnt int) {
 		//}
 
 		write := new(pb.AWriteSReply)
-		var err error
 
 		for j := 0; cnf != nil; j++ {
-			write, err = cnf.AWriteS(&pb.WriteS{
-				State: rs,
-				Conf: &pb.Conf{
-					This: uint32(smc.Blueps[i].Len()),
-					Cur:  uint32(smc.Blueps[cur].Len()),
-				},
-			})
+			var st *pb.State
+			if st, err = cnf.Stage(ctx, key, rs); err == nil {
+				write, err = cnf.AWriteS(ctx, &pb.WriteS{
+					State: st,
+					Conf: &pb.Conf{
+						This: smc.Blueps[i].ID(),
+						Cur:  smc.Blueps[cur].ID(),
+					},
+					Key: key,
+				})
+			}
 			//cnt++
 
-			if err != nil && j == 0 {
+			if err != nil && smc.Policy.Widen(j) {
 				glog.Errorln("error from OptimizedWriteS: ", err)
 				// Try again with full configuration.
 				cnf = cp.FullC(smc.Blueps[i])
 			}
 
-			if err != nil && j == Retry {
-				glog.Errorf("error %v from WriteS after %d retries. \n", err, Retry)
-				return 0
+			if smc.Policy.Retry(ctx, "WriteS", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("error %v from WriteS after %d attempts. \n", err, j+1)
+				return 0, NewQuorumError("WriteS", err)
 			}
+			break
 		}
 
 		if glog.V(6) {
@@ -131,7 +150,7 @@ func (smc *SmClient) set(cp conf.Provider, rs *pb.State) (cnt int) {
 	}
 
 	smc.SetNewCur(cur)
-	return cnt
+	return cnt, nil
 }
 
 func (smc *SmClient) checkrid(new int, rid []int, cp conf.Provider) []int {
@@ -0,0 +1,167 @@
+package smclient_test
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestLargeValues(t *testing.T) {
+	defer func(th, size int) { pb.ChunkThreshold, pb.ChunkSize = th, size }(pb.ChunkThreshold, pb.ChunkSize)
+	pb.ChunkThreshold, pb.ChunkSize = 16, 8
+	cl := testcluster.Start(t, "sm", 4)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	large := bytes.Repeat([]byte("0123456789"), 10)
+	cl.C.WriteKey(ctx, cl.CP, "x", large)
+	cl.C.WriteKey(ctx, cl.CP, "y", large[:50])
+	if v, _, _ := cl.C.ReadKey(ctx, cl.CP, "x"); !bytes.Equal(v, large) {
+		t.Fatalf("Read returned %q, expected %q.", v, large)
+	}
+
+	// The new configuration gets the values through the client.
+	prop := cl.C.Blueps[0].Copy()
+	prop.Rem(cl.ID(0))
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	cl.Handles[0].Stop()
+
+	if v, _, _ := cl.C.ReadKey(ctx, cl.CP, "x"); !bytes.Equal(v, large) {
+		t.Errorf("Read after reconfiguration returned %q, expected %q.", v, large)
+	}
+	if v, _, _ := cl.C.ReadKey(ctx, cl.CP, "y"); !bytes.Equal(v, large[:50]) {
+		t.Errorf("Read after reconfiguration returned %q, expected %q.", v, large[:50])
+	}
+}
+
+func TestDigestReads(t *testing.T) {
+	defer func(d bool) { smclient.DigestReads = d }(smclient.DigestReads)
+	smclient.DigestReads = true
+	cl := testcluster.Start(t, "sm", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	val := bytes.Repeat([]byte("0123456789"), 100)
+	cl.C.WriteKey(ctx, cl.CP, "x", val)
+
+	blp := cl.C.Blueps[0]
+	read, err := cl.CP.FullC(blp).AReadS(ctx, &pb.Conf{This: blp.ID(), Cur: blp.ID(), Key: "x", Digest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := read.Reply.GetState(); len(st.Value) != 0 || len(st.Digest) == 0 || int(st.ValueLen) != len(val) {
+		t.Errorf("AReadS asking for a digest returned %v.", st)
+	}
+
+	if v, _, _ := cl.C.ReadKey(ctx, cl.CP, "x"); !bytes.Equal(v, val) {
+		t.Errorf("Read returned %q, expected %q.", v, val)
+	}
+	// The value is fetched from another server, if one is stopped.
+	cl.Handles[0].Stop()
+	for i := 0; i < 5; i++ {
+		if v, _, _ := cl.C.ReadKey(ctx, cl.CP, "x"); !bytes.Equal(v, val) {
+			t.Fatalf("Read with one server stopped returned %q, expected %q.", v, val)
+		}
+	}
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 5)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	prop := cl.C.GetCur(cl.CP)
+	prop.Rem(cl.ID(4))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+			t.Error(err)
+		}
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				val := []byte(fmt.Sprint(j))
+				if _, err := cl.C.WriteKey(ctx, cl.CP, key, val); err != nil {
+					t.Error(err)
+					return
+				}
+				if v, _, err := cl.C.ReadKey(ctx, cl.CP, key); err != nil || !bytes.Equal(v, val) {
+					t.Errorf("Read of %s returned %q, %v, expected %q.", key, v, err, val)
+					return
+				}
+			}
+		}(fmt.Sprint("k", i))
+	}
+	wg.Wait()
+
+	if cur := cl.C.GetCur(cl.CP); !cur.Equals(prop) {
+		t.Errorf("Client ended in a configuration of size %d, expected %d.", cur.Order(), prop.Order())
+	}
+}
+
+// TestConcurrentReconf runs reads, writes and a reconfiguration on one client,
+// after another client moved the configuration. The operations find the new
+// configuration, and send it to the servers in the background. Run it with
+// -race.
+func TestConcurrentReconf(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 5)
+	defer cl.Stop()
+	ctx := context.Background()
+
+	rc, err := smclient.New(cl.Init, 2, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prop := rc.GetCur(cl.CP)
+	prop.Rem(cl.ID(4))
+	if _, err = rc.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		prop := cl.C.GetCur(cl.CP)
+		prop.Rem(cl.ID(3))
+		if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+			t.Error(err)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				val := []byte(fmt.Sprint(j))
+				if _, err := cl.C.WriteKey(ctx, cl.CP, key, val); err != nil {
+					t.Error(err)
+					return
+				}
+				if v, _, err := cl.C.ReadKey(ctx, cl.CP, key); err != nil || !bytes.Equal(v, val) {
+					t.Errorf("Read of %s returned %q, %v, expected %q.", key, v, err, val)
+					return
+				}
+			}
+		}(fmt.Sprint("k", i))
+	}
+	wg.Wait()
+
+	if cur := cl.C.GetCur(cl.CP); len(cur.Ids()) != 3 {
+		t.Errorf("Client ended in configuration %v, expected the first three servers.", cur)
+	}
+}
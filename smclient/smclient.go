@@ -1,49 +1,98 @@
 package smclient
 
 import (
-	"errors"
+	"sync"
 
 	"github.com/golang/glog"
 
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
 )
 
-const Retry = 1
 const MinSize = 3
 
+// DigestReads makes AReadS ask for the digest of the value only. The value is
+// then fetched from a single server, instead of being sent by a whole quorum.
+var DigestReads = false
+
+// SmClient is safe for concurrent use. Every operation works on its own View
+// of Blueps, and merges what it learned back when it is done. Do not access
+// Blueps directly while operations are running.
 type SmClient struct {
 	Blueps []*pb.Blueprint
 	Id     uint32
+	Policy *RetryPolicy
+
+	mu       sync.Mutex // Protects Blueps.
+	onNewCur CurCallbacks
+	leases   *leaseCache // Shared with the views.
 }
 
-func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*SmClient, error) {
-	cnf := cp.FullC(initBlp)
+// New creates a client for the configuration initBlp, or for the newer
+// blueprints saved in BluepDir. A nil rp uses DefaultRetry.
+func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider, rp *RetryPolicy) (*SmClient, error) {
+	if rp == nil {
+		rp = DefaultRetry
+	}
 
 	glog.Infof("New Client with Id: %d\n", id)
 
-	_, err := cnf.SetCur(&pb.NewCur{initBlp, uint32(initBlp.Len())})
-	if err != nil {
-		glog.Errorln("initial SetCur returned error: ", err)
-		return nil, errors.New("Initial SetCur failed.")
+	blps, stale := StartBlueps(initBlp, id)
+	if !stale {
+		cnf := cp.FullC(initBlp)
+		_, err := cnf.SetCur(context.Background(), &pb.NewCur{initBlp, initBlp.ID()})
+		if err != nil {
+			glog.Errorln("initial SetCur returned error: ", err)
+			return nil, NewQuorumError("SetCur", err)
+		}
+		SaveBlueps(id, blps)
 	}
 	return &SmClient{
-		Blueps: []*pb.Blueprint{initBlp},
+		Blueps: blps,
 		Id:     id,
+		Policy: rp,
+		leases: newLeaseCache(),
 	}, nil
 }
 
 //Atomic read
-func (smc *SmClient) Read(cp conf.Provider) (val []byte, cnt int) {
+func (smc *SmClient) Read(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return smc.ReadKey(ctx, cp, "")
+}
+
+//Regular read
+func (smc *SmClient) RRead(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return smc.RReadKey(ctx, cp, "")
+}
+
+func (smc *SmClient) Write(ctx context.Context, cp conf.Provider, val []byte) (cnt int, err error) {
+	return smc.WriteKey(ctx, cp, "", val)
+}
+
+//Atomic read of the register with the given key.
+func (smc *SmClient) ReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
+	op := smc.View()
+	defer smc.Merge(op)
+	if st, ok := op.leases.get(key, op.Blueps[0].ID()); ok {
+		return st.Value, 0, nil
+	}
+	return op.readKey(ctx, cp, key)
+}
+
+func (smc *SmClient) readKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Read")
 	}
-	rs, cnt := smc.get(cp)
-	if rs == nil {
-		return nil, cnt
+	rs, cnt, err := smc.get(ctx, cp, key, true)
+	if err != nil || rs == nil {
+		return nil, cnt, err
 	}
 
-	mcnt := smc.set(cp, rs)
+	mcnt, err := smc.set(ctx, cp, key, rs)
+	if err != nil {
+		return nil, cnt + mcnt, err
+	}
 
 	if glog.V(3) {
 		if cnt > 1 {
@@ -53,40 +102,53 @@ func (smc *SmClient) Read(cp conf.Provider) (val []byte, cnt int) {
 			glog.Infof("set used %d accesses\n", mcnt)
 		}
 	}
+	mcnt += smc.lease(ctx, cp, key, rs)
 	if cnt > mcnt {
-		return rs.Value, cnt
+		return rs.Value, cnt, nil
 	}
-	return rs.Value, mcnt
+	return rs.Value, mcnt, nil
 }
 
-//Regular read
-func (smc *SmClient) RRead(cp conf.Provider) (val []byte, cnt int) {
+//Regular read of the register with the given key.
+func (smc *SmClient) RReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
+	op := smc.View()
+	defer smc.Merge(op)
+	return op.rreadKey(ctx, cp, key)
+}
+
+func (smc *SmClient) rreadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting regular Read")
 	}
-	rs, cnt := smc.get(cp)
-	if rs == nil {
-		return nil, cnt
+	rs, cnt, err := smc.get(ctx, cp, key, true)
+	if err != nil || rs == nil {
+		return nil, cnt, err
 	}
 	if glog.V(3) {
 		if cnt > 1 {
 			glog.Infof("get used %d accesses\n", cnt)
 		}
 	}
-	return rs.Value, cnt
+	return rs.Value, cnt, nil
 }
 
-func (smc *SmClient) Write(cp conf.Provider, val []byte) int {
+func (smc *SmClient) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
+	op := smc.View()
+	defer smc.Merge(op)
+	return op.writeKey(ctx, cp, key, val)
+}
+
+func (smc *SmClient) writeKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Write")
 	}
-	rs, cnt := smc.get(cp)
-	if rs == nil && cnt == 0 {
-		return 0
+	rs, cnt, err := smc.get(ctx, cp, key, false)
+	if err != nil {
+		return cnt, err
 	}
 	rs = smc.WriteValue(&val, rs)
 
-	mcnt := smc.set(cp, rs)
+	mcnt, err := smc.set(ctx, cp, key, rs)
 	if glog.V(3) {
 		if cnt > 1 {
 			glog.Infof("get used %d accesses\n", cnt)
@@ -95,7 +157,16 @@ func (smc *SmClient) Write(cp conf.Provider, val []byte) int {
 			glog.Infof("set used %d accesses\n", mcnt)
 		}
 	}
-	return cnt + mcnt
+	return cnt + mcnt, err
+}
+
+// WriteState writes st to the register with the given key as it is. Unlike
+// WriteKey, it does not pick a new timestamp, so servers holding a more recent
+// state ignore it.
+func (smc *SmClient) WriteState(ctx context.Context, cp conf.Provider, key string, st *pb.State) (cnt int, err error) {
+	op := smc.View()
+	defer smc.Merge(op)
+	return op.set(ctx, cp, key, st)
 }
 
 // Given a state returned from a regular read, and a value to be written,
@@ -114,5 +185,43 @@ func (smc *SmClient) WriteValue(val *[]byte, st *pb.State) *pb.State {
 }
 
 func (smc *SmClient) GetCur(cp conf.Provider) *pb.Blueprint {
+	smc.mu.Lock()
+	defer smc.mu.Unlock()
 	return smc.Blueps[0].Copy()
 }
+
+// View returns a copy of the client for a single operation. The operation can
+// change the copy's Blueps without locking. Pass it to Merge when done.
+func (smc *SmClient) View() *SmClient {
+	smc.mu.Lock()
+	defer smc.mu.Unlock()
+	return &SmClient{
+		Blueps: append([]*pb.Blueprint(nil), smc.Blueps...),
+		Id:     smc.Id,
+		Policy: smc.Policy,
+		leases: smc.leases,
+	}
+}
+
+// Merge adds the blueprints op learned to the client. Concurrent operations
+// may have moved the client further already, outdated blueprints are ignored.
+func (smc *SmClient) Merge(op *SmClient) {
+	smc.mu.Lock()
+	old := smc.Blueps[0]
+	var before []*pb.Blueprint
+	if BluepDir != "" {
+		before = append(before, smc.Blueps...)
+	}
+	cur := smc.findorinsert(0, op.Blueps[0])
+	smc.HandleNext(cur, op.Blueps[1:])
+	smc.SetNewCur(cur)
+	nc := smc.Blueps[0]
+	if BluepDir != "" && !sameBlueps(before, smc.Blueps) {
+		SaveBlueps(smc.Id, smc.Blueps)
+	}
+	smc.mu.Unlock()
+
+	if nc != old {
+		smc.onNewCur.Notify(nc)
+	}
+}
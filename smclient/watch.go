@@ -0,0 +1,124 @@
+package smclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	conf "github.com/relab/smartMerge/confProvider"
+	pb "github.com/relab/smartMerge/proto"
+	"golang.org/x/net/context"
+)
+
+// WatchInterval is how often Watch checks, whether the client moved to a new
+// configuration by itself. It is also the wait before subscribing again, if
+// all servers ended their streams.
+var WatchInterval = 1 * time.Second
+
+// OnNewCur registers fn to be called with every new current configuration the
+// client moves to, from its operations or from Watch. fn must not change the
+// blueprint. It may use the client.
+func (smc *SmClient) OnNewCur(fn func(cur *pb.Blueprint)) {
+	smc.onNewCur.Add(fn)
+}
+
+// Watch subscribes to new current configurations at the servers, and moves
+// the client to them in the background, until ctx is done.
+func (smc *SmClient) Watch(ctx context.Context, cp conf.Provider) {
+	go WatchCur(ctx, cp, func() *pb.Blueprint {
+		return smc.GetCur(cp)
+	}, func(cur *pb.Blueprint) {
+		smc.Merge(&SmClient{Blueps: []*pb.Blueprint{cur}})
+	})
+}
+
+// WatchCur subscribes to current configurations newer than cur(), at the
+// servers of cur(), and passes them to found. Once cur() returns a newer
+// configuration, it moves on to its servers. It returns when ctx is done.
+func WatchCur(ctx context.Context, cp conf.Provider, cur func() *pb.Blueprint, found func(*pb.Blueprint)) {
+	for ctx.Err() == nil {
+		blp := cur()
+		wctx, cancel := context.WithCancel(ctx)
+		ended := watchConf(wctx, cp, blp, cur, found)
+		cancel()
+		if !ended {
+			continue
+		}
+		glog.V(3).Infof("Watching configuration %d ended, subscribing again.\n", blp.Order())
+		select {
+		case <-time.After(WatchInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// watchConf watches the servers of blp, until cur() moves past blp or ctx is
+// done. It reports whether all servers ended their streams before.
+func watchConf(ctx context.Context, cp conf.Provider, blp *pb.Blueprint, cur func() *pb.Blueprint, found func(*pb.Blueprint)) (ended bool) {
+	c := blp.ID()
+	ncs := cp.FullC(blp).Watch(ctx, c)
+	tick := time.NewTicker(WatchInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case nc, ok := <-ncs:
+			if !ok {
+				return ctx.Err() == nil
+			}
+			if c.Less(nc.Cur.ID()) {
+				glog.V(3).Infof("Watch found new current configuration %d.\n", nc.Cur.Order())
+				found(nc.Cur)
+			}
+		case <-tick.C:
+		case <-ctx.Done():
+			return false
+		}
+		if c.Less(cur().ID()) {
+			return false
+		}
+	}
+}
+
+// CurCallbacks calls the registered functions for new current
+// configurations, in order. Only one goroutine calls them at a time. A
+// configuration passed to Notify meanwhile is handed to that goroutine, so the
+// functions may run operations that find new configurations themselves.
+type CurCallbacks struct {
+	mu      sync.Mutex
+	fns     []func(*pb.Blueprint)
+	last    pb.ConfID // ID of the last configuration passed on.
+	pending *pb.Blueprint
+	running bool
+}
+
+// Add registers fn.
+func (cb *CurCallbacks) Add(fn func(*pb.Blueprint)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.fns = append(cb.fns, fn)
+}
+
+// Notify calls the functions with cur, unless they were already called with
+// cur or a configuration after it, in the order of ConfID.Less.
+func (cb *CurCallbacks) Notify(cur *pb.Blueprint) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if len(cb.fns) == 0 || !cb.last.Less(cur.ID()) || (cb.pending != nil && !cb.pending.ID().Less(cur.ID())) {
+		return
+	}
+	cb.pending = cur
+	if cb.running {
+		return
+	}
+	cb.running = true
+	for cb.pending != nil {
+		cur, fns := cb.pending, cb.fns
+		cb.pending, cb.last = nil, cur.ID()
+		cb.mu.Unlock()
+		for _, fn := range fns {
+			fn(cur)
+		}
+		cb.mu.Lock()
+	}
+	cb.running = false
+}
@@ -0,0 +1,63 @@
+package smclient_test
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestWatch(t *testing.T) {
+	cl := testcluster.Start(t, "sm", 4)
+	defer cl.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := smclient.New(cl.C.GetCur(cl.CP), 2, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(chan *pb.Blueprint, 10)
+	w.OnNewCur(func(cur *pb.Blueprint) { found <- cur })
+	w.Watch(ctx, cl.CP)
+
+	prop := cl.C.GetCur(cl.CP)
+	prop.Rem(cl.ID(3))
+	if _, err := cl.C.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cur := <-found:
+		if cur.Order() != prop.Order() {
+			t.Errorf("Watch found configuration with length %d, expected %d.", cur.Order(), prop.Order())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not find the new configuration.")
+	}
+	if cur := w.GetCur(cl.CP); cur.Order() != prop.Order() {
+		t.Errorf("Watching client is in configuration with length %d, expected %d.", cur.Order(), prop.Order())
+	}
+}
+
+func TestCurCallbacks(t *testing.T) {
+	a := &pb.Blueprint{Nodes: []*pb.Node{{Id: 1}}}
+	b := &pb.Blueprint{Nodes: []*pb.Node{{Id: 2}}}
+	if b.ID().Less(a.ID()) {
+		a, b = b, a
+	}
+
+	var cb smclient.CurCallbacks
+	var got []*pb.Blueprint
+	cb.Add(func(cur *pb.Blueprint) { got = append(got, cur) })
+	// b has the same Order as a, but is a different configuration.
+	for _, cur := range []*pb.Blueprint{a, b, a, b} {
+		cb.Notify(cur)
+	}
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("Callbacks were called with %v, expected %v and %v.", got, a, b)
+	}
+}
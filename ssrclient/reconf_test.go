@@ -0,0 +1,44 @@
+package ssrclient_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/relab/smartMerge/ssrclient"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestZones(t *testing.T) {
+	cl := testcluster.Start(t, "ssr", 3)
+	defer cl.Stop()
+	ctx := context.Background()
+	c, err := ssrclient.New(cl.Init, 1, cl.CP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two servers in one zone cannot tolerate its loss.
+	bad := c.GetCur(cl.CP)
+	for i, z := range []string{"a", "a", "b"} {
+		bad.SetZone(cl.ID(i), z)
+	}
+	bad.SetZoneFaults(1)
+	if _, err := c.Reconf(ctx, cl.CP, bad); !errors.Is(err, smclient.ErrZones) {
+		t.Errorf("Reconf to two zones returned %v, expected ErrZones.", err)
+	}
+	if cur := c.GetCur(cl.CP); !cur.Equals(cl.Init) {
+		t.Errorf("Client moved to configuration %v after a rejected Reconf.", cur)
+	}
+
+	// One server in each zone can.
+	prop := bad.Copy()
+	prop.SetZone(cl.ID(1), "c")
+	if _, err := c.Reconf(ctx, cl.CP, prop); err != nil {
+		t.Fatal(err)
+	}
+	if cur := c.GetCur(cl.CP); !cur.Equals(prop) {
+		t.Errorf("Client ended in configuration %v, expected %v.", cur, prop)
+	}
+}
@@ -1,50 +1,74 @@
 package ssrclient
 
 import (
-	"errors"
-
 	"github.com/golang/glog"
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
 	smc "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
 type SSRClient struct {
 	*smc.SmClient
 }
 
-func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider) (*SSRClient, error) {
-
-	cnf := cp.FullC(initBlp)
+func New(initBlp *pb.Blueprint, id uint32, cp conf.Provider, rp *smc.RetryPolicy) (*SSRClient, error) {
+	if rp == nil {
+		rp = smc.DefaultRetry
+	}
 
 	glog.Infof("New Client with Id: %d\n", id)
 
-	_, err := cnf.SSetCur(&pb.NewCur{initBlp, uint32(initBlp.Len())})
-	if err != nil {
-		glog.Errorln("initial SetCur returned error: ", err)
-		return nil, errors.New("Initial SetCur failed.")
+	blps, stale := smc.StartBlueps(initBlp, id)
+	if !stale {
+		cnf := cp.FullC(initBlp)
+		_, err := cnf.SSetCur(context.Background(), &pb.NewCur{initBlp, initBlp.ID()})
+		if err != nil {
+			glog.Errorln("initial SetCur returned error: ", err)
+			return nil, smc.NewQuorumError("SSetCur", err)
+		}
+		smc.SaveBlueps(id, blps)
 	}
 
 	sc := &smc.SmClient{
-		Blueps: []*pb.Blueprint{initBlp},
+		Blueps: blps,
 		Id:     id,
+		Policy: rp,
 	}
 
 	return &SSRClient{sc}, nil
 }
 
 //Atomic read
-func (ssc *SSRClient) Read(cp conf.Provider) (val []byte, cnt int) {
+func (ssc *SSRClient) Read(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return ssc.ReadKey(ctx, cp, "")
+}
+
+//Regular read
+func (ssc *SSRClient) RRead(ctx context.Context, cp conf.Provider) (val []byte, cnt int, err error) {
+	return ssc.RReadKey(ctx, cp, "")
+}
+
+func (ssc *SSRClient) Write(ctx context.Context, cp conf.Provider, val []byte) (cnt int, err error) {
+	return ssc.WriteKey(ctx, cp, "", val)
+}
+
+//Atomic read of the register with the given key.
+func (ssc *SSRClient) ReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
+	op := &SSRClient{ssc.View()}
+	defer ssc.Merge(op.SmClient)
+	return op.readKey(ctx, cp, key)
+}
+
+func (ssc *SSRClient) readKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Read")
 	}
 	var st *pb.State
-	var err error
 
-	st, cnt, err = ssc.Doreconf(cp, nil, false, nil)
+	st, cnt, err = ssc.doreconf(ctx, cp, nil, false, key, nil)
 	if err != nil {
-		glog.Errorln("Error during Read", err)
-		return nil, 0
+		return nil, cnt, err
 	}
 
 	if glog.V(3) {
@@ -53,25 +77,27 @@ func (ssc *SSRClient) Read(cp conf.Provider) (val []byte, cnt int) {
 		}
 	}
 	if st == nil {
-		glog.Errorln("read returned nil state")
-		return nil, cnt
+		return nil, cnt, nil
 	}
-	return st.Value, cnt
+	return st.Value, cnt, nil
 }
 
-//Regular read
-func (ssc *SSRClient) RRead(cp conf.Provider) (val []byte, cnt int) {
+//Regular read of the register with the given key.
+func (ssc *SSRClient) RReadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
+	op := &SSRClient{ssc.View()}
+	defer ssc.Merge(op.SmClient)
+	return op.rreadKey(ctx, cp, key)
+}
+
+func (ssc *SSRClient) rreadKey(ctx context.Context, cp conf.Provider, key string) (val []byte, cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting regular Read")
 	}
 	var st *pb.State
-	var err error
-
-	st, cnt, err = ssc.Doreconf(cp, nil, true, nil)
 
+	st, cnt, err = ssc.doreconf(ctx, cp, nil, true, key, nil)
 	if err != nil {
-		glog.Errorln("Error during RRead")
-		return nil, 0
+		return nil, cnt, err
 	}
 	if glog.V(3) {
 		if cnt > 2 {
@@ -79,43 +105,55 @@ func (ssc *SSRClient) RRead(cp conf.Provider) (val []byte, cnt int) {
 		}
 	}
 	if st == nil {
-		glog.Errorln("read returned nil state")
-		return nil, cnt
+		return nil, cnt, nil
 	}
-	return st.Value, cnt
+	return st.Value, cnt, nil
 }
 
-func (ssc *SSRClient) Write(cp conf.Provider, val []byte) (cnt int) {
+func (ssc *SSRClient) WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
+	op := &SSRClient{ssc.View()}
+	defer ssc.Merge(op.SmClient)
+	return op.writeKey(ctx, cp, key, val)
+}
+
+func (ssc *SSRClient) writeKey(ctx context.Context, cp conf.Provider, key string, val []byte) (cnt int, err error) {
 	if glog.V(5) {
 		glog.Infoln("starting Write")
 	}
-	var err error
-
-	_, cnt, err = ssc.Doreconf(cp, nil, false, val)
 
+	_, cnt, err = ssc.doreconf(ctx, cp, nil, false, key, val)
 	if err != nil {
-		glog.Errorln("Error during Write")
-		return 0
+		return cnt, err
 	}
 	if glog.V(3) {
 		if cnt > 3 {
 			glog.Infof("Write used %d accesses\n", cnt)
 		}
 	}
-	return cnt
+	return cnt, nil
 }
 
-func (ssc *SSRClient) Reconf(cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
+func (ssc *SSRClient) Reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
+	op := &SSRClient{ssc.View()}
+	defer ssc.Merge(op.SmClient)
+	return op.reconf(ctx, cp, prop)
+}
+
+func (ssc *SSRClient) reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (cnt int, err error) {
 	//Proposed blueprint is already in place, or outdated.
 	if prop.Compare(ssc.Blueps[0]) == 1 {
 		glog.V(3).Infof("C%d: Proposal is already in place.", ssc.Id)
 		return 0, nil
 	}
+	if err := prop.CheckZones(); err != nil {
+		glog.Errorf("C%d: Rejecting proposal: %v", ssc.Id, err)
+		return 0, smc.ErrZones
+	}
 
-	_, cnt, err = ssc.Doreconf(cp, prop, true, nil)
+	incomparable := ssc.Blueps[0].Compare(prop) != 1
+	_, cnt, err = ssc.doreconf(ctx, cp, prop, true, "", nil)
+	if err == nil && incomparable && !prop.Equals(ssc.Blueps[0]) {
+		err = smc.ErrSuperseded
+	}
 	return
 }
-
-func (ssc *SSRClient) GetCur(cp conf.Provider) *pb.Blueprint {
-	return ssc.Blueps[0].Copy()
-}
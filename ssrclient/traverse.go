@@ -7,13 +7,24 @@ import (
 	conf "github.com/relab/smartMerge/confProvider"
 	pb "github.com/relab/smartMerge/proto"
 	smc "github.com/relab/smartMerge/smclient"
+	"golang.org/x/net/context"
 )
 
-func (ssc *SSRClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular bool, val []byte) (rst *pb.State, cnt int, err error) {
+// Doreconf reads or writes the register with the given key. The states of all
+// other registers are moved along when moving to a new configuration.
+func (ssc *SSRClient) Doreconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, regular bool, key string, val []byte) (rst *pb.State, cnt int, err error) {
+	op := &SSRClient{ssc.View()}
+	defer ssc.Merge(op.SmClient)
+	return op.doreconf(ctx, cp, prop, regular, key, val)
+}
+
+func (ssc *SSRClient) doreconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint, regular bool, key string, val []byte) (rst *pb.State, cnt int, err error) {
 	if glog.V(6) {
 		glog.Infof("C%d: Starting doreconfiguration\n", ssc.Id)
 	}
 
+	old := ssc.Blueps[0]
+	kst := make(pb.KeyStates) // States of the other registers.
 	for i := 0; i < len(ssc.Blueps); i++ {
 
 		cnt++
@@ -30,7 +41,9 @@ func (ssc *SSRClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular boo
 		var newcur bool
 		var st *pb.State
 
-		prop, _, newcur, st, err = ssc.spsn(cp, i, prop)
+		// Only fetch the other registers, if we might move to a new configuration.
+		allkeys := prop != nil || i+1 < len(ssc.Blueps)
+		prop, _, newcur, st, err = ssc.spsn(ctx, cp, i, prop, key, allkeys, rst, kst)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -47,6 +60,19 @@ func (ssc *SSRClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular boo
 			rst = st
 		}
 
+		if !allkeys && i+1 < len(ssc.Blueps) {
+			// Found a new configuration, also need the other registers.
+			newcur, err = ssc.readAll(ctx, cp, i, key, kst)
+			if err != nil {
+				return nil, 0, err
+			}
+			cnt++
+			if newcur {
+				i = -1
+				continue
+			}
+		}
+
 		if i+1 == len(ssc.Blueps) && (!regular || i > 0) {
 			//Establish new cur, or write value in write, atomic read.
 
@@ -57,37 +83,46 @@ func (ssc *SSRClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular boo
 			//var setS *pb.SSetStateReply
 
 			for j := 0; ; j++ {
-				_, err = cnf.SSetState(&pb.SState{
-					CurL:  uint32(ssc.Blueps[i].Len()),
-					State: rst,
-				})
-				//cnt++
-
+				var st *pb.State
+				var kss []*pb.KeyState
+				if st, err = cnf.Stage(ctx, key, rst); err == nil {
+					kss, err = cnf.StageAll(ctx, kst.Others(key))
+				}
 				if err == nil {
-					break
+					_, err = cnf.SSetState(ctx, &pb.SState{
+						CurL:    ssc.Blueps[i].ID(),
+						State:   st,
+						Key:     key,
+						KStates: kss,
+					})
 				}
+				//cnt++
 
-				if err != nil && j == 0 {
+				if err != nil && ssc.Policy.Widen(j) {
 					glog.Errorf("C%d: error from Thrifty SetState: %v\n", ssc.Id, err)
 					// Try again with full configuration.
 					cnf = cp.FullC(ssc.Blueps[i])
 				}
 
-				if err != nil && j == smc.Retry {
-					glog.Errorf("C%d: error %v from SetState after %d retries: ", ssc.Id, err, smc.Retry)
-					return nil, 0, err
+				if ssc.Policy.Retry(ctx, "SetState", j, err) {
+					continue
+				}
+				if err != nil {
+					glog.Errorf("C%d: error %v from SetState after %d attempts: ", ssc.Id, err, j+1)
+					return nil, 0, smc.NewQuorumError("SetState", err)
 				}
+				break
 			}
 
 			if i > 0 && glog.V(3) {
-				glog.Infof("C%d: Set state in configuration of size %d.\n", ssc.Id, ssc.Blueps[i].Len())
+				glog.Infof("C%d: Set state in configuration of size %d.\n", ssc.Id, ssc.Blueps[i].Order())
 			} else if glog.V(6) {
 				glog.Infof("Set state returned.")
 			}
 
 			// if cr := setS.Reply.Cur; !regular && cr != nil {
 			// 				ssc.Blueps = []*pb.Blueprint{cr}
-			// 				glog.V(3).Infof("C%d: SetState returned new current conf of length %d.\n", ssc.Id, cr.Len())
+			// 				glog.V(3).Infof("C%d: SetState returned new current conf of length %d.\n", ssc.Id, cr.Order())
 			// 				i = -1
 			// 				continue
 			// 			}
@@ -99,6 +134,9 @@ func (ssc *SSRClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular boo
 			// 			}
 
 			ssc.Blueps = []*pb.Blueprint{ssc.Blueps[i]}
+			if i > 0 {
+				ssc.SetCurRemoved(cp, old)
+			}
 			return
 		}
 	}
@@ -106,7 +144,9 @@ func (ssc *SSRClient) Doreconf(cp conf.Provider, prop *pb.Blueprint, regular boo
 	return rst, cnt, nil
 }
 
-func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *pb.Blueprint, cnt int, cur bool, rst *pb.State, err error) {
+// spsn returns the more recent of have and the state read in configuration i.
+// The other registers are added to kst.
+func (ssc *SSRClient) spsn(ctx context.Context, cp conf.Provider, i int, prop *pb.Blueprint, key string, allkeys bool, have *pb.State, kst pb.KeyStates) (next *pb.Blueprint, cnt int, cur bool, rst *pb.State, err error) {
 
 	for rnd := 0; ; rnd++ {
 		//Do SpSn Phase 1:
@@ -119,39 +159,46 @@ func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *p
 		}
 
 		for j := 0; ; j++ {
-			collect, err = cnf.SpSnOne(&pb.SWriteN{
-				CurL: uint32(ssc.Blueps[0].Len()),
-				Cur:  c,
-				This: uint32(ssc.Blueps[i].Len()),
-				Rnd:  uint32(rnd),
-				Prop: prop,
+			collect, err = cnf.SpSnOne(ctx, &pb.SWriteN{
+				CurL:    ssc.Blueps[0].ID(),
+				Cur:     c,
+				This:    ssc.Blueps[i].ID(),
+				Rnd:     uint32(rnd),
+				Prop:    prop,
+				Key:     key,
+				AllKeys: allkeys,
 			})
-			if err != nil && j == 0 {
+			if err != nil && ssc.Policy.Widen(j) {
 				glog.Errorf("C%d: error from OptimizedSpSnOne: %v\n", ssc.Id, err)
 				//Try again with full configuration.
 				cnf = cp.FullC(ssc.Blueps[i])
 			}
 			cnt++
 
-			if err != nil && j == smc.Retry {
-				glog.Errorf("C%d: error %v from Phase1 after %d retries.\n", ssc.Id, err, smc.Retry)
-				return nil, 0, false, nil, err
+			if ssc.Policy.Retry(ctx, "Phase1", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("C%d: error %v from Phase1 after %d attempts.\n", ssc.Id, err, j+1)
+				return nil, 0, false, nil, smc.NewQuorumError("Phase1", err)
 			}
+			break
 		}
 
 		// Abort on new Cur
 		if cr := collect.Reply.Cur; cr != nil {
 			ssc.Blueps = []*pb.Blueprint{cr}
-			glog.V(3).Infof("C%d: Phase1 returned new current conf of length %d.\n", ssc.Id, cr.Len())
+			glog.V(3).Infof("C%d: Phase1 returned new current conf of length %d.\n", ssc.Id, cr.Order())
 			return prop, cnt, true, nil, nil
 		}
 
 		if rnd == 0 {
-			rst = collect.Reply.GetState()
+			if rst, err = cnf.FetchNewer(ctx, key, have, collect.Reply.GetState()); err != nil {
+				return nil, cnt, false, nil, err
+			}
+			if err = cnf.FetchNewerAll(ctx, kst, collect.Reply.GetKStates()); err != nil {
+				return nil, cnt, false, nil, err
+			}
 		}
 
 		// Merge with other proposals, or commit.
@@ -164,7 +211,7 @@ func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *p
 			prop = prop.Merge(blp)
 		}
 
-		if prop.Len() == 0 && commit {
+		if prop.Order() == 0 && commit {
 			if glog.V(6) {
 				glog.Infof("C%d: Empty Phase1 returned commit.\n", ssc.Id)
 			}
@@ -178,7 +225,7 @@ func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *p
 		if commit {
 			ssc.HandleOneCur(i, prop)
 			if glog.V(3) {
-				glog.Infof("C%d: Committing Bluep with length %d.\n", ssc.Id, prop.Len())
+				glog.Infof("C%d: Committing Bluep with length %d.\n", ssc.Id, prop.Order())
 			}
 		}
 
@@ -188,35 +235,35 @@ func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *p
 		var commitR *pb.SCommitReply
 
 		for j := 0; ; j++ {
-			commitR, err = cnf.SCommit(&pb.Commit{
-				CurL:    uint32(ssc.Blueps[0].Len()),
-				This:    uint32(ssc.Blueps[i].Len()),
+			commitR, err = cnf.SCommit(ctx, &pb.Commit{
+				CurL:    ssc.Blueps[0].ID(),
+				This:    ssc.Blueps[i].ID(),
 				Rnd:     uint32(rnd),
 				Commit:  commit,
 				Collect: prop,
 			})
 			cnt++
 
-			if err != nil && j == 0 {
+			if err != nil && ssc.Policy.Widen(j) {
 				glog.Errorf("C%d: error from OptimizedCommit: %v\n", ssc.Id, err)
 				// Try again with full configuration.
 				cnf = cp.FullC(ssc.Blueps[i])
 			}
 
-			if err != nil && j == smc.Retry {
-				glog.Errorf("C%d: error %v from Commit after %d retries: ", ssc.Id, err, smc.Retry)
-				return nil, 0, false, nil, err
+			if ssc.Policy.Retry(ctx, "Commit", j, err) {
+				continue
 			}
-
-			if err == nil {
-				break
+			if err != nil {
+				glog.Errorf("C%d: error %v from Commit after %d attempts: ", ssc.Id, err, j+1)
+				return nil, 0, false, nil, smc.NewQuorumError("Commit", err)
 			}
+			break
 		}
 
 		// Abort on new Cur.
 		if cr := commitR.Reply.Cur; cr != nil {
 			ssc.Blueps = []*pb.Blueprint{cr}
-			glog.V(3).Infof("C%d: Commit returned new current conf of length %d.\n", ssc.Id, cr.Len())
+			glog.V(3).Infof("C%d: Commit returned new current conf of length %d.\n", ssc.Id, cr.Order())
 			return prop, cnt, true, nil, nil
 		}
 
@@ -228,7 +275,7 @@ func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *p
 		}
 
 		//If no uncommitted was collected, return.
-		if commitR.Reply.Collected.Len() == 0 {
+		if commitR.Reply.Collected.Order() == 0 {
 			if glog.V(4) {
 				glog.Infof("C%d: Commit returned in rnd %d, nothing collected.", ssc.Id, rnd)
 			}
@@ -236,10 +283,56 @@ func (ssc *SSRClient) spsn(cp conf.Provider, i int, prop *pb.Blueprint) (next *p
 		}
 
 		if glog.V(4) {
-			glog.Infof("C%d: Commit returned in rnd %d. Length collected is %d.\n", ssc.Id, rnd, commitR.Reply.Collected.Len())
+			glog.Infof("C%d: Commit returned in rnd %d. Length collected is %d.\n", ssc.Id, rnd, commitR.Reply.Collected.Order())
 		}
 
 		//Merge with collected and go to next rnd.
 		prop = prop.Merge(commitR.Reply.Collected)
 	}
 }
+
+// readAll reads the states of all registers in configuration i, without
+// proposing anything. The state of key is not needed, since it was read before.
+func (ssc *SSRClient) readAll(ctx context.Context, cp conf.Provider, i int, key string, kst pb.KeyStates) (cur bool, err error) {
+	cnf := cp.WriteC(ssc.Blueps[i], nil)
+
+	var collect *pb.SpSnOneReply
+	for j := 0; ; j++ {
+		collect, err = cnf.SpSnOne(ctx, &pb.SWriteN{
+			CurL:    ssc.Blueps[0].ID(),
+			This:    ssc.Blueps[i].ID(),
+			Key:     key,
+			AllKeys: true,
+		})
+		if err != nil && ssc.Policy.Widen(j) {
+			glog.Errorf("C%d: error from OptimizedSpSnOne: %v\n", ssc.Id, err)
+			//Try again with full configuration.
+			cnf = cp.FullC(ssc.Blueps[i])
+		}
+
+		if ssc.Policy.Retry(ctx, "Phase1", j, err) {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("C%d: error %v from Phase1 after %d attempts.\n", ssc.Id, err, j+1)
+			return false, smc.NewQuorumError("Phase1", err)
+		}
+		break
+	}
+
+	if cr := collect.Reply.Cur; cr != nil {
+		ssc.Blueps = []*pb.Blueprint{cr}
+		glog.V(3).Infof("C%d: Phase1 returned new current conf of length %d.\n", ssc.Id, cr.Order())
+		return true, nil
+	}
+	return false, cnf.FetchNewerAll(ctx, kst, collect.Reply.GetKStates())
+}
+
+// SetCurRemoved sends the current blueprint to the servers removed since old.
+func (ssc *SSRClient) SetCurRemoved(cp conf.Provider, old *pb.Blueprint) {
+	cur := ssc.Blueps[0]
+	smc.NotifyRemoved(cp, old, cur, func(ctx context.Context, cnf *pb.Configuration) error {
+		_, err := cnf.SSetCur(ctx, &pb.NewCur{CurC: cur.ID(), Cur: cur})
+		return err
+	})
+}
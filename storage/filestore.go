@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SyncInterval is the interval between syncs when using SyncPeriodic.
+var SyncInterval = 100 * time.Millisecond
+
+// SnapshotEvery is the number of logged batches after which the log is
+// compacted into a new snapshot.
+var SnapshotEvery = 1000
+
+const (
+	walName      = "wal"
+	snapshotName = "snapshot"
+	headerSize   = 8
+)
+
+var errCorrupt = errors.New("storage: corrupt record")
+
+// FileStore keeps a write-ahead log of batches in a directory. The log is
+// periodically compacted into a snapshot file. A copy of all values is kept in
+// memory, such that snapshots can be written without reading the log.
+type FileStore struct {
+	mu     sync.Mutex
+	dir    string
+	policy SyncPolicy
+	wal    *os.File
+	m      map[string][]byte
+	logged int // batches in the log since the last snapshot
+	dirty  bool
+	closed bool
+	err    error // set if the log may be broken, returned by all writes
+	stopC  chan struct{}
+	doneC  chan struct{}
+}
+
+func OpenFileStore(dir string, policy SyncPolicy) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		dir:    dir,
+		policy: policy,
+		m:      make(map[string][]byte),
+	}
+
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fs.wal = wal
+
+	if err = fs.replay(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+
+	if policy == SyncPeriodic {
+		fs.stopC = make(chan struct{})
+		fs.doneC = make(chan struct{})
+		go fs.syncLoop()
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) loadSnapshot() error {
+	data, err := ioutil.ReadFile(filepath.Join(fs.dir, snapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b, n, err := readRecord(data)
+	if err != nil || n != len(data) {
+		return errors.New("storage: corrupt snapshot in " + fs.dir)
+	}
+	b.apply(fs.m)
+	return nil
+}
+
+// replay applies all complete records in the log. A torn record at the end of
+// the log, left by a crash during Write, is truncated.
+func (fs *FileStore) replay() error {
+	data, err := ioutil.ReadAll(fs.wal)
+	if err != nil {
+		return err
+	}
+
+	off := 0
+	for off < len(data) {
+		b, n, err := readRecord(data[off:])
+		if err != nil {
+			glog.Warningf("storage: truncating log in %s at offset %d: %v\n", fs.dir, off, err)
+			break
+		}
+		b.apply(fs.m)
+		fs.logged++
+		off += n
+	}
+
+	if off < len(data) {
+		if err = fs.wal.Truncate(int64(off)); err != nil {
+			return err
+		}
+	}
+	_, err = fs.wal.Seek(int64(off), io.SeekStart)
+	return err
+}
+
+// Write appends b to the log. If that fails, the log is cut back to where it
+// was, since replay would stop at a torn record and lose the batches written
+// after it. If the log cannot be cut back or synced, the store fails, and
+// all later writes return the error.
+func (fs *FileStore) Write(b *Batch) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return ErrClosed
+	}
+	if fs.err != nil {
+		return fs.err
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	off, err := fs.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = fs.wal.Write(encodeRecord(b)); err != nil {
+		if rerr := fs.rollback(off); rerr != nil {
+			glog.Errorf("storage: could not cut back log in %s: %v\n", fs.dir, rerr)
+			fs.err = err
+		}
+		return err
+	}
+	if fs.policy == SyncAlways {
+		if err = fs.wal.Sync(); err != nil {
+			fs.err = err
+			return err
+		}
+	} else {
+		fs.dirty = true
+	}
+
+	b.apply(fs.m)
+	fs.logged++
+	if fs.logged >= SnapshotEvery {
+		return fs.snapshot()
+	}
+	return nil
+}
+
+// rollback cuts the log back to off, the end of the last complete record.
+func (fs *FileStore) rollback(off int64) error {
+	if err := fs.wal.Truncate(off); err != nil {
+		return err
+	}
+	_, err := fs.wal.Seek(off, io.SeekStart)
+	return err
+}
+
+// snapshot writes all values to a new snapshot file and empties the log.
+func (fs *FileStore) snapshot() error {
+	keys := make([]string, 0, len(fs.m))
+	for k := range fs.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := new(Batch)
+	for _, k := range keys {
+		b.Put(k, fs.m[k])
+	}
+
+	tmp := filepath.Join(fs.dir, snapshotName+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(encodeRecord(b)); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(fs.dir, snapshotName)); err != nil {
+		return err
+	}
+	if err = syncDir(fs.dir); err != nil {
+		return err
+	}
+
+	if err = fs.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = fs.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = fs.wal.Sync(); err != nil {
+		return err
+	}
+	glog.V(3).Infof("storage: wrote snapshot with %d keys after %d batches\n", len(keys), fs.logged)
+	fs.logged = 0
+	fs.dirty = false
+	return nil
+}
+
+func (fs *FileStore) Load() (map[string][]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return nil, ErrClosed
+	}
+	return copyMap(fs.m), nil
+}
+
+func (fs *FileStore) syncLoop() {
+	defer close(fs.doneC)
+	tick := time.NewTicker(SyncInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-fs.stopC:
+			return
+		case <-tick.C:
+			fs.mu.Lock()
+			if fs.dirty && !fs.closed {
+				if err := fs.wal.Sync(); err != nil {
+					glog.Errorln("storage: periodic sync failed:", err)
+				} else {
+					fs.dirty = false
+				}
+			}
+			fs.mu.Unlock()
+		}
+	}
+}
+
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	if fs.closed {
+		fs.mu.Unlock()
+		return ErrClosed
+	}
+	fs.closed = true
+	fs.mu.Unlock()
+
+	if fs.stopC != nil {
+		close(fs.stopC)
+		<-fs.doneC
+	}
+	if fs.policy != SyncNever {
+		if err := fs.wal.Sync(); err != nil {
+			fs.wal.Close()
+			return err
+		}
+	}
+	return fs.wal.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// A record is a header holding the payload length and its CRC-32 checksum,
+// followed by the payload, which is the encoded batch.
+func encodeRecord(b *Batch) []byte {
+	size := binary.MaxVarintLen64
+	for _, o := range b.ops {
+		size += 1 + 2*binary.MaxVarintLen64 + len(o.key) + len(o.value)
+	}
+	buf := make([]byte, headerSize+size)
+	p := buf[headerSize:]
+
+	n := binary.PutUvarint(p, uint64(len(b.ops)))
+	for _, o := range b.ops {
+		p[n] = byte(o.kind)
+		n++
+		n += binary.PutUvarint(p[n:], uint64(len(o.key)))
+		n += copy(p[n:], o.key)
+		if o.kind == opPut {
+			n += binary.PutUvarint(p[n:], uint64(len(o.value)))
+			n += copy(p[n:], o.value)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(n))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(p[:n]))
+	return buf[:headerSize+n]
+}
+
+// readRecord decodes the record at the start of data, and returns the batch
+// and the number of bytes used.
+func readRecord(data []byte) (*Batch, int, error) {
+	if len(data) < headerSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	size := int(binary.LittleEndian.Uint32(data[0:4]))
+	if size > len(data)-headerSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	p := data[headerSize : headerSize+size]
+	if crc32.ChecksumIEEE(p) != binary.LittleEndian.Uint32(data[4:8]) {
+		return nil, 0, errCorrupt
+	}
+
+	nops, n := binary.Uvarint(p)
+	if n <= 0 {
+		return nil, 0, errCorrupt
+	}
+	b := &Batch{ops: make([]op, 0, nops)}
+	for i := uint64(0); i < nops; i++ {
+		if n >= len(p) {
+			return nil, 0, errCorrupt
+		}
+		o := op{kind: opKind(p[n])}
+		n++
+		key, m := readBytes(p[n:])
+		if m <= 0 {
+			return nil, 0, errCorrupt
+		}
+		o.key = string(key)
+		n += m
+		if o.kind == opPut {
+			val, m := readBytes(p[n:])
+			if m <= 0 {
+				return nil, 0, errCorrupt
+			}
+			o.value = append([]byte(nil), val...)
+			n += m
+		}
+		b.ops = append(b.ops, o)
+	}
+	return b, headerSize + size, nil
+}
+
+func readBytes(p []byte) ([]byte, int) {
+	l, n := binary.Uvarint(p)
+	if n <= 0 || uint64(len(p)-n) < l {
+		return nil, 0
+	}
+	return p[n : n+int(l)], n + int(l)
+}
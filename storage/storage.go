@@ -0,0 +1,159 @@
+// Package storage provides durable key-value storage for the server state.
+//
+// A server writes all changes made while handling one request as a single
+// Batch. A Batch is applied atomically: after a crash either all or none of
+// its operations are visible when the store is reopened.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type Store interface {
+	// Write applies all operations in b. When Write returns without error,
+	// the batch is durable according to the sync policy of the store.
+	Write(b *Batch) error
+	// Load returns a copy of all key-value pairs held by the store.
+	Load() (map[string][]byte, error)
+	Close() error
+}
+
+var ErrClosed = errors.New("storage: store is closed")
+
+type opKind byte
+
+const (
+	opPut opKind = iota + 1
+	opDelete
+)
+
+type op struct {
+	kind  opKind
+	key   string
+	value []byte
+}
+
+// Batch collects a set of operations that are written atomically.
+type Batch struct {
+	ops []op
+}
+
+// Put sets key to a copy of value, so the caller may reuse value.
+func (b *Batch) Put(key string, value []byte) {
+	b.ops = append(b.ops, op{kind: opPut, key: key, value: append([]byte(nil), value...)})
+}
+
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, op{kind: opDelete, key: key})
+}
+
+func (b *Batch) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.ops)
+}
+
+func (b *Batch) apply(m map[string][]byte) {
+	for _, o := range b.ops {
+		switch o.kind {
+		case opPut:
+			m[o.key] = o.value
+		case opDelete:
+			delete(m, o.key)
+		}
+	}
+}
+
+// SyncPolicy determines when a FileStore calls fsync on its log.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log before Write returns.
+	SyncAlways SyncPolicy = iota
+	// SyncPeriodic syncs the log every SyncInterval.
+	SyncPeriodic
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncPeriodic:
+		return "periodic"
+	case SyncNever:
+		return "never"
+	}
+	return fmt.Sprintf("SyncPolicy(%d)", int(p))
+}
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "", "always":
+		return SyncAlways, nil
+	case "periodic":
+		return SyncPeriodic, nil
+	case "never":
+		return SyncNever, nil
+	}
+	return SyncAlways, fmt.Errorf("storage: unknown sync policy %q", s)
+}
+
+// MemStore keeps all values in memory. It is used when no data directory is
+// given, and in tests.
+type MemStore struct {
+	mu     sync.Mutex
+	m      map[string][]byte
+	closed bool
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{m: make(map[string][]byte)}
+}
+
+func (ms *MemStore) Write(b *Batch) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.closed {
+		return ErrClosed
+	}
+	b.apply(ms.m)
+	return nil
+}
+
+func (ms *MemStore) Load() (map[string][]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.closed {
+		return nil, ErrClosed
+	}
+	return copyMap(ms.m), nil
+}
+
+func (ms *MemStore) Close() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.closed = true
+	return nil
+}
+
+// copyMap returns a copy of m, with copies of its values.
+func copyMap(m map[string][]byte) map[string][]byte {
+	c := make(map[string][]byte, len(m))
+	for k, v := range m {
+		c[k] = append([]byte(nil), v...)
+	}
+	return c
+}
+
+// Open returns a FileStore in dir, or a MemStore if dir is empty.
+func Open(dir string, policy SyncPolicy) (Store, error) {
+	if dir == "" {
+		return NewMemStore(), nil
+	}
+	return OpenFileStore(dir, policy)
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFileStoreRecover(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fs, err := OpenFileStore(dir, SyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(Batch)
+	b.Put("a", []byte("1"))
+	b.Put("b", []byte("2"))
+	if err = fs.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	b = new(Batch)
+	b.Delete("a")
+	b.Put("c", nil)
+	if err = fs.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	fs.Close()
+
+	fs, err = OpenFileStore(dir, SyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	m, _ := fs.Load()
+	if len(m) != 2 || string(m["b"]) != "2" {
+		t.Errorf("recovered wrong values: %v", m)
+	}
+	if _, ok := m["c"]; !ok {
+		t.Error("did not recover empty value")
+	}
+}
+
+func TestFileStoreTornWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fs, err := OpenFileStore(dir, SyncNever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(Batch)
+	b.Put("a", []byte("1"))
+	fs.Write(b)
+	b = new(Batch)
+	b.Put("a", []byte("2"))
+	fs.Write(b)
+	fs.Close()
+
+	// Cut the last record in half.
+	wal := filepath.Join(dir, walName)
+	fi, _ := os.Stat(wal)
+	os.Truncate(wal, fi.Size()-3)
+
+	fs, err = OpenFileStore(dir, SyncNever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := fs.Load()
+	if string(m["a"]) != "1" {
+		t.Errorf("expected value of first batch after torn write, got %q", m["a"])
+	}
+
+	// New writes must follow the last complete record.
+	b = new(Batch)
+	b.Put("a", []byte("3"))
+	fs.Write(b)
+	fs.Close()
+	fs, _ = OpenFileStore(dir, SyncNever)
+	defer fs.Close()
+	m, _ = fs.Load()
+	if string(m["a"]) != "3" {
+		t.Errorf("write after truncation was lost, got %q", m["a"])
+	}
+}
+
+func TestFileStoreSnapshot(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func(n int) { SnapshotEvery = n }(SnapshotEvery)
+	SnapshotEvery = 3
+
+	fs, err := OpenFileStore(dir, SyncPeriodic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		b := new(Batch)
+		b.Put(string('a'+byte(i)), []byte{byte(i)})
+		if err = fs.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs.Close()
+
+	if _, err = os.Stat(filepath.Join(dir, snapshotName)); err != nil {
+		t.Error("no snapshot was written")
+	}
+
+	fs, err = OpenFileStore(dir, SyncPeriodic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	m, _ := fs.Load()
+	if len(m) != 7 || m["g"][0] != 6 {
+		t.Errorf("recovered wrong values after snapshot: %v", m)
+	}
+	if fs.logged != 1 {
+		t.Errorf("log holds %d batches after snapshot, expected 1", fs.logged)
+	}
+}
+
+func TestFileStoreFailedWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fs, err := OpenFileStore(dir, SyncNever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(Batch)
+	b.Put("a", []byte("1"))
+	if err = fs.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that failed halfway leaves part of a record, rollback removes it.
+	off, _ := fs.wal.Seek(0, io.SeekCurrent)
+	fs.wal.Write(encodeRecord(b)[:5])
+	if err = fs.rollback(off); err != nil {
+		t.Fatal(err)
+	}
+	b = new(Batch)
+	b.Put("b", []byte("2"))
+	if err = fs.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the log cannot be written or cut back, the store fails.
+	wal := fs.wal
+	if fs.wal, err = os.Open(filepath.Join(dir, walName)); err != nil {
+		t.Fatal(err)
+	}
+	fs.wal.Seek(0, io.SeekEnd)
+	if fs.Write(b) == nil || fs.Write(new(Batch)) == nil {
+		t.Error("write to a read-only log did not fail the store")
+	}
+	fs.wal.Close()
+	fs.wal = wal
+	fs.Close()
+
+	fs, err = OpenFileStore(dir, SyncNever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	m, _ := fs.Load()
+	if string(m["a"]) != "1" || string(m["b"]) != "2" {
+		t.Errorf("batch after a failed write was lost, got %v", m)
+	}
+}
+
+func TestBatchCopiesValues(t *testing.T) {
+	ms := NewMemStore()
+	v := []byte("1")
+	b := new(Batch)
+	b.Put("a", v)
+	ms.Write(b)
+	v[0] = '2'
+	m, _ := ms.Load()
+	m["a"][0] = '3'
+	if m, _ = ms.Load(); string(m["a"]) != "1" {
+		t.Errorf("store shares values with its callers, got %q", m["a"])
+	}
+}
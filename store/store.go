@@ -0,0 +1,240 @@
+// Package store connects to a set of servers running one of the
+// reconfigurable storage algorithms, and returns a client for it.
+//
+// Use Open to embed the storage in a program:
+//
+//	st, err := store.Open(store.Options{Addrs: addrs, Alg: "sm"})
+//	if err != nil {
+//		...
+//	}
+//	defer st.Close()
+//	err = st.Write(ctx, "key", []byte("value"))
+//
+// NewConfP and NewClient are the parts Open is built from, for programs that
+// need the number of quorum calls per operation, like the experiment client.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	conf "github.com/relab/smartMerge/confProvider"
+	cc "github.com/relab/smartMerge/consclient"
+	"github.com/relab/smartMerge/doreconf"
+	dyna "github.com/relab/smartMerge/dynaclient"
+	pb "github.com/relab/smartMerge/proto"
+	qf "github.com/relab/smartMerge/qfuncs"
+	smc "github.com/relab/smartMerge/smclient"
+	ssr "github.com/relab/smartMerge/ssrclient"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// DialTimeout is how long Open and NewConfP wait for the connections to the
+// servers.
+var DialTimeout = 3 * time.Second
+
+// Store is a reconfigurable atomic storage, with one register per key. The
+// empty key is a register like any other. A Store is safe for concurrent use.
+//
+// The operations return the errors of package smclient, see
+// smclient/errors.go.
+type Store interface {
+	// Read returns the value of key, atomically: no later Read returns an
+	// older value.
+	Read(ctx context.Context, key string) ([]byte, error)
+	// RRead returns the value of key with a regular read. It is cheaper than
+	// Read, but two concurrent RReads may see a write in different orders.
+	RRead(ctx context.Context, key string) ([]byte, error)
+	// Write sets key to val.
+	Write(ctx context.Context, key string, val []byte) error
+	// Reconf moves the storage to the configuration prop, e.g. a copy of
+	// Current with nodes added or removed.
+	Reconf(ctx context.Context, prop *pb.Blueprint) error
+	// Current returns a copy of the current configuration, as far as the
+	// store knows.
+	Current() *pb.Blueprint
+	// Close closes the connections to the servers.
+	Close() error
+}
+
+// Client is the interface of the algorithm clients returned by NewClient.
+// Besides their result, the operations return the number of quorum calls
+// they needed.
+type Client interface {
+	RRead(context.Context, conf.Provider) ([]byte, int, error)
+	Read(context.Context, conf.Provider) ([]byte, int, error)
+	Write(ctx context.Context, cp conf.Provider, val []byte) (int, error)
+	RReadKey(ctx context.Context, cp conf.Provider, key string) ([]byte, int, error)
+	ReadKey(ctx context.Context, cp conf.Provider, key string) ([]byte, int, error)
+	WriteKey(ctx context.Context, cp conf.Provider, key string, val []byte) (int, error)
+	Reconf(ctx context.Context, cp conf.Provider, prop *pb.Blueprint) (int, error)
+	GetCur(conf.Provider) *pb.Blueprint
+}
+
+// Options for Open.
+type Options struct {
+	// Addrs are the host:port addresses of all servers the store may use.
+	Addrs []string
+	// Alg is the algorithm the servers run: sm, dyna, ssr or cons. Empty is
+	// sm.
+	Alg string
+	// Opt is the optimization: no or doreconf. doreconf is only supported
+	// for sm and cons, dyna and ssr always use it.
+	Opt string
+	// ConfProvider decides which servers the quorum calls contact: normal,
+	// thrifty or norecontact. Empty is normal.
+	ConfProvider string
+	// Init is the initial configuration. If nil, it holds all servers in
+	// Addrs, and tolerates a minority of them failing.
+	Init *pb.Blueprint
+	// ID is the id of the client. Concurrent clients should use different
+	// ids.
+	ID int
+	// Retry is the retry policy of the client, smclient.DefaultRetry if nil.
+	Retry *smc.RetryPolicy
+}
+
+type store struct {
+	cl  Client
+	cp  conf.Provider
+	mgr *pb.Manager
+}
+
+// Open connects to the servers in opts.Addrs, and returns a Store using the
+// algorithm in opts.Alg.
+func Open(opts Options) (Store, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("store: no server addresses")
+	}
+	if err := checkAlg(opts.Alg, opts.Opt); err != nil {
+		return nil, err
+	}
+	cp, mgr, err := NewConfP(opts.Addrs, opts.ConfProvider, opts.ID)
+	if err != nil {
+		return nil, err
+	}
+	initB := opts.Init
+	if initB == nil {
+		initB = pb.InitBlueprint(mgr.MachineGlobalIDs())
+	}
+	rp := opts.Retry
+	if rp == nil {
+		rp = smc.DefaultRetry
+	}
+	cl, err := NewClient(initB, opts.Alg, opts.Opt, opts.ID, cp, rp)
+	if err != nil {
+		mgr.Close()
+		return nil, err
+	}
+	return &store{cl, cp, mgr}, nil
+}
+
+func (s *store) Read(ctx context.Context, key string) ([]byte, error) {
+	val, _, err := s.cl.ReadKey(ctx, s.cp, key)
+	return val, err
+}
+
+func (s *store) RRead(ctx context.Context, key string) ([]byte, error) {
+	val, _, err := s.cl.RReadKey(ctx, s.cp, key)
+	return val, err
+}
+
+func (s *store) Write(ctx context.Context, key string, val []byte) error {
+	_, err := s.cl.WriteKey(ctx, s.cp, key, val)
+	return err
+}
+
+func (s *store) Reconf(ctx context.Context, prop *pb.Blueprint) error {
+	_, err := s.cl.Reconf(ctx, s.cp, prop)
+	return err
+}
+
+func (s *store) Current() *pb.Blueprint {
+	return s.cl.GetCur(s.cp)
+}
+
+func (s *store) Close() error {
+	return s.mgr.Close()
+}
+
+// NewConfP connects to the servers in addrs, and returns the manager and a
+// configuration provider of kind cprov: normal, thrifty or norecontact.
+func NewConfP(addrs []string, cprov string, id int) (cp conf.Provider, mgr *pb.Manager, err error) {
+	switch cprov {
+	case "", "normal", "thrifty", "norecontact":
+	default:
+		return nil, nil, fmt.Errorf("store: confprovider %q is not supported", cprov)
+	}
+	mgr, err = pb.NewManager(addrs, pb.WithGrpcDialOptions(
+		grpc.WithBlock(),
+		grpc.WithTimeout(DialTimeout),
+		grpc.WithInsecure()),
+		pb.WithAReadSQuorumFunc(qf.AReadSQF),
+		pb.WithAWriteSQuorumFunc(qf.AWriteSQF),
+		pb.WithAWriteNQuorumFunc(qf.AWriteNQF),
+		pb.WithSetCurQuorumFunc(qf.SetCurQF),
+		pb.WithLAPropQuorumFunc(qf.LAPropQF),
+		pb.WithSetStateQuorumFunc(qf.SetStateQF),
+		pb.WithGetPromiseQuorumFunc(qf.GetPromiseQF),
+		pb.WithAcceptQuorumFunc(qf.AcceptQF),
+		pb.WithDWriteNQuorumFunc(qf.DWriteNQF),
+		pb.WithDSetStateQuorumFunc(qf.DSetStateQF),
+		pb.WithDWriteNSetQuorumFunc(qf.DWriteNSetQF),
+		pb.WithDSetCurQuorumFunc(qf.DSetCurQF),
+		pb.WithGetOneNQuorumFunc(qf.GetOneNQF),
+		pb.WithSpSnOneQuorumFunc(qf.SpSnOneQF),
+		pb.WithSCommitQuorumFunc(qf.SCommitQF),
+		pb.WithSSetStateQuorumFunc(qf.SSetStateQF),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cp = conf.NewProvider(mgr, id)
+	switch cprov {
+	case "thrifty":
+		cp = &conf.ThriftyConfP{Provider: cp}
+	case "normal", "":
+		cp = &conf.NormalConfP{Provider: cp}
+	}
+	return
+}
+
+// NewClient returns a client of algorithm alg (sm, dyna, ssr or cons) with
+// optimization opt (no or doreconf), starting from the configuration initB.
+func NewClient(initB *pb.Blueprint, alg string, opt string, id int, cp conf.Provider, rp *smc.RetryPolicy) (cl Client, err error) {
+	if err := checkAlg(alg, opt); err != nil {
+		return nil, err
+	}
+	switch alg {
+	case "dyna":
+		return dyna.New(initB, uint32(id), cp, rp)
+	case "ssr":
+		return ssr.New(initB, uint32(id), cp, rp)
+	case "cons":
+		if opt == "doreconf" {
+			return doreconf.NewCons(initB, uint32(id), cp, rp)
+		}
+		return cc.New(initB, uint32(id), cp, rp)
+	}
+	if opt == "doreconf" {
+		return doreconf.NewSM(initB, uint32(id), cp, rp)
+	}
+	return smc.New(initB, uint32(id), cp, rp)
+}
+
+func checkAlg(alg, opt string) error {
+	switch alg {
+	case "", "sm", "dyna", "ssr", "cons":
+	default:
+		return fmt.Errorf("store: algorithm %q is not supported", alg)
+	}
+	switch opt {
+	case "", "no", "doreconf":
+	default:
+		return fmt.Errorf("store: optimization %q is not supported", opt)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/relab/smartMerge/store"
+	"github.com/relab/smartMerge/testcluster"
+	"golang.org/x/net/context"
+)
+
+func TestStore(t *testing.T) {
+	for _, alg := range []string{"sm", "cons"} {
+		cl := testcluster.Start(t, alg, 4)
+		ctx := context.Background()
+		st, err := store.Open(store.Options{Addrs: cl.Addrs, Alg: alg, ID: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := st.Write(ctx, "x", []byte("1")); err != nil {
+			t.Fatalf("%s: Write returned error: %v", alg, err)
+		}
+		if v, err := st.Read(ctx, "x"); err != nil || string(v) != "1" {
+			t.Errorf("%s: Read returned %q, %v, expected %q.", alg, v, err, "1")
+		}
+
+		prop := st.Current()
+		prop.Rem(cl.ID(3))
+		if err := st.Reconf(ctx, prop); err != nil {
+			t.Fatalf("%s: Reconf returned error: %v", alg, err)
+		}
+		if cur := st.Current(); cur.Order() != prop.Order() {
+			t.Errorf("%s: Current has length %d after Reconf, expected %d.", alg, cur.Order(), prop.Order())
+		}
+		if v, err := st.RRead(ctx, "x"); err != nil || string(v) != "1" {
+			t.Errorf("%s: RRead after Reconf returned %q, %v, expected %q.", alg, v, err, "1")
+		}
+		if err := st.Close(); err != nil {
+			t.Error(err)
+		}
+		cl.Stop()
+	}
+
+	if _, err := store.Open(store.Options{Addrs: []string{"localhost:1"}, Alg: "paxos"}); err == nil {
+		t.Error("Open with an unknown algorithm returned no error.")
+	}
+}
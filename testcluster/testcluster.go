@@ -0,0 +1,112 @@
+// Package testcluster runs a cluster of servers in the test process, for the
+// tests of the servers and the clients. Servers run on ports picked by the
+// system, with their state in memory unless a store is given.
+package testcluster
+
+import (
+	"hash/fnv"
+	"net"
+	"testing"
+	"time"
+
+	conf "github.com/relab/smartMerge/confProvider"
+	pb "github.com/relab/smartMerge/proto"
+	"github.com/relab/smartMerge/regserver"
+	"github.com/relab/smartMerge/smclient"
+	"github.com/relab/smartMerge/storage"
+	"github.com/relab/smartMerge/store"
+)
+
+func init() {
+	// Calls to stopped servers wait for the redial, so with the default
+	// timeout they time out instead of failing.
+	store.DialTimeout = time.Second
+}
+
+// Cluster is a set of servers running in this process, and a client.
+type Cluster struct {
+	Alg     string
+	Servers []*regserver.RegServer // The servers, for sm and cons.
+	Handles []*regserver.Handle
+	Addrs   []string
+	Init    *pb.Blueprint // The initial configuration, with all servers.
+	CP      conf.Provider
+	C       *smclient.SmClient // A client with id 1, for sm and cons.
+	mgr     *pb.Manager
+}
+
+// Start starts n servers running alg (sm, cons, dyna or ssr), and connects
+// to all of them. With cons, use the client with consclient.ConsClient.
+func Start(t testing.TB, alg string, n int) *Cluster {
+	return StartWithStores(t, alg, make([]storage.Store, n))
+}
+
+// StartWithStores is Start with one server for each store in stores. A nil
+// store keeps the server state in memory.
+func StartWithStores(t testing.TB, alg string, stores []storage.Store) *Cluster {
+	cl := &Cluster{Alg: alg}
+	for _, st := range stores {
+		h, err := cl.serve(st)
+		if err != nil {
+			cl.Stop()
+			t.Fatal(err)
+		}
+		_, port, _ := net.SplitHostPort(h.Addr())
+		cl.Handles = append(cl.Handles, h)
+		cl.Addrs = append(cl.Addrs, net.JoinHostPort("localhost", port))
+	}
+
+	var err error
+	cl.CP, cl.mgr, err = store.NewConfP(cl.Addrs, "normal", 1)
+	if err != nil {
+		cl.Stop()
+		t.Fatal(err)
+	}
+	cl.Init = pb.InitBlueprint(cl.mgr.MachineGlobalIDs())
+	if alg == "sm" || alg == "cons" {
+		if cl.C, err = smclient.New(cl.Init, 1, cl.CP, nil); err != nil {
+			cl.Stop()
+			t.Fatal(err)
+		}
+	}
+	return cl
+}
+
+func (cl *Cluster) serve(st storage.Store) (*regserver.Handle, error) {
+	switch cl.Alg {
+	case "cons":
+		cs, h, err := regserver.ServeCons(0, nil, pb.ConfID{}, st, false)
+		if err == nil {
+			cl.Servers = append(cl.Servers, cs.RegServer)
+		}
+		return h, err
+	case "dyna":
+		_, h, err := regserver.ServeDyna(0, nil, pb.ConfID{}, st)
+		return h, err
+	case "ssr":
+		_, h, err := regserver.ServeSSR(0, nil, pb.ConfID{}, st)
+		return h, err
+	}
+	rs, h, err := regserver.ServeAdv(0, nil, pb.ConfID{}, st, false)
+	if err == nil {
+		cl.Servers = append(cl.Servers, rs)
+	}
+	return h, err
+}
+
+// ID returns the global id of server i, as used in the blueprints.
+func (cl *Cluster) ID(i int) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(cl.Addrs[i]))
+	return h.Sum32()
+}
+
+// Stop stops all servers, and closes the connections to them.
+func (cl *Cluster) Stop() {
+	for _, h := range cl.Handles {
+		h.Stop()
+	}
+	if cl.mgr != nil {
+		cl.mgr.Close()
+	}
+}